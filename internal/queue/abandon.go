@@ -0,0 +1,63 @@
+package queue
+
+import (
+	"log/slog"
+)
+
+// WithPatience makes customers give up and leave if they have not been
+// served within a patience time drawn from dist, in minutes. Customers in
+// service never leave.
+func WithPatience(dist ServiceDistribution) Option {
+	return func(s *Simulation) {
+		s.patience = dist
+	}
+}
+
+// schedulePatience queues the time at which customer c, arriving at time t,
+// runs out of patience.
+func (r *run) schedulePatience(c *Customer, t int) {
+	if r.s.patience == nil {
+		return
+	}
+	patience := max(1, r.s.ticks(r.s.patience.Sample(r.s.patienceRng)))
+	// abandonments at the same time are handled in order of arrival
+	r.events.push(event{time: t + patience, kind: abandonEvent, server: c.Index, customer: c})
+}
+
+// abandon makes customer c leave at time t if it is still waiting.
+func (r *run) abandon(c *Customer, t int) {
+	if !removeCustomer(&r.queue, c) {
+		found := false
+		for j := range r.servers {
+			if removeCustomer(&r.servers[j].queue, c) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return
+		}
+	}
+	r.abandoned++
+	r.abandonWait += t - c.ArrivalTime
+	if r.classes != nil {
+		r.classes[c.Class].abandoned++
+	}
+	r.timeInSystem += t - c.ArrivalTime
+	r.leave(t)
+	r.event(CustomerAbandoned, t, c)
+	if r.logs(LevelCustomer) {
+		r.logAttrs(LevelCustomer, "customer abandoned", slog.Int("customer", c.Index), r.at(t), r.durationAttr("wait", t-c.ArrivalTime))
+	}
+}
+
+// removeCustomer takes c out of the line q and reports whether it was there.
+func removeCustomer(q *[]*Customer, c *Customer) bool {
+	for i, x := range *q {
+		if x == c {
+			*q = append((*q)[:i], (*q)[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
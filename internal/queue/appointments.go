@@ -0,0 +1,210 @@
+package queue
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Appointment is an arrival booked for Time, in minutes. Category names the
+// catalog class of the visit, or is empty to draw the class like for any
+// other customer.
+type Appointment struct {
+	Time     int
+	Category string
+}
+
+// WithAppointments adds booked arrivals to the random ones, which a
+// customerRate of 0 switches off. Every booked customer fails to show up
+// with probability noShow, and the others arrive off their booked time by a
+// lateness drawn from lateness, in minutes, which is negative for early
+// arrivals; nil means everyone is on time. Early arrivals wait for the doors
+// to open at startTime and late ones are let in until endTime. Booked
+// customers are admitted even after the last ticket time.
+func WithAppointments(appointments []Appointment, noShow float64, lateness ServiceDistribution) Option {
+	return func(s *Simulation) {
+		s.appointments = appointments
+		s.noShow = noShow
+		s.lateness = lateness
+	}
+}
+
+// ReadAppointments reads a booking calendar from CSV with a header line and
+// the columns time, as HH:MM, and an optional catalog category, e.g.
+//
+//	time,category
+//	08:00,checkup
+//	08:20,vaccination
+func ReadAppointments(r io.Reader) ([]Appointment, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("schedule has no appointments")
+	}
+
+	var appointments []Appointment
+	for i, rec := range records[1:] {
+		t, err := parseTime(rec[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+2, err)
+		}
+		a := Appointment{Time: t}
+		if len(rec) > 1 {
+			a.Category = strings.TrimSpace(rec[1])
+		}
+		appointments = append(appointments, a)
+	}
+	return appointments, nil
+}
+
+// LoadAppointments reads a booking calendar from a CSV file, see
+// ReadAppointments.
+func LoadAppointments(path string) ([]Appointment, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	appointments, err := ReadAppointments(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return appointments, nil
+}
+
+// booking is a booked customer who shows up, at time arrival.
+type booking struct {
+	arrival     int
+	appointment int
+	class       int // -1 to draw from the catalog
+}
+
+// book draws who of the booked customers show up, and when. The draws come
+// from the arrival stream, so that they do not depend on the number of
+// servers.
+func (r *run) book() {
+	s := r.s
+	rng := s.customerDist.rng
+	for _, a := range s.appointments {
+		if rng.Float64() < s.noShow {
+			r.noShows++
+			continue
+		}
+		arrival := a.Time
+		if s.lateness != nil {
+			arrival += s.ticks(s.lateness.Sample(rng))
+		}
+		class := -1
+		for i, c := range s.classes {
+			if c.Name == a.Category {
+				class = i
+			}
+		}
+		r.booked = append(r.booked, booking{
+			arrival:     min(max(arrival, s.startTime), s.endTime-1),
+			appointment: a.Time,
+			class:       class,
+		})
+	}
+	sort.SliceStable(r.booked, func(i, j int) bool { return r.booked[i].arrival < r.booked[j].arrival })
+}
+
+// arriveBooked lets in the booked customers who arrive at time t.
+func (r *run) arriveBooked(t int) {
+	for len(r.booked) > 0 && r.booked[0].arrival == t {
+		b := r.booked[0]
+		r.booked = r.booked[1:]
+		r.advance(t)
+		c := r.newCustomer(t, b.class)
+		if c == nil {
+			continue
+		}
+		r.groups++
+		c.booked, c.appointment = true, b.appointment
+		r.join(t, c)
+		r.scaleUp(t)
+	}
+}
+
+func simulateAppointments(seed int64, args []string) {
+	startTime := 8 * 60 // 08:00
+	endTime := 16 * 60  // 16:00
+	serverRate := 6.0   // only seeds the servers, service times come from the catalog
+
+	fs := flag.NewFlagSet("booked", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	schedule := fs.String("schedule", "appointments.csv", "CSV `file` of booked times and visit categories")
+	catalog := fs.String("catalog", "clinic.csv", "CSV `file` of visit categories, see catalog.csv")
+	noShow := fs.Float64("no-show", 0.1, "probability that a booked patient does not come")
+	early := fs.Float64("early", 10, "most minutes a patient comes early")
+	late := fs.Float64("late", 10, "most minutes a patient comes late")
+	walkIns := fs.Float64("walk-ins", 0, "rate of patients without appointment, per hour")
+	maxServers := fs.Int("max-servers", 4, "largest number of doctors to try")
+	reps := fs.Int("reps", 200, "number of replications to average over")
+	fs.Parse(args)
+	checkServers("max-servers", *maxServers)
+
+	appointments, err := LoadAppointments(*schedule)
+	exitOnError(err)
+	classes, err := LoadCatalog(*catalog)
+	exitOnError(err)
+	for _, a := range appointments {
+		found := a.Category == ""
+		for _, c := range classes {
+			found = found || c.Name == a.Category
+		}
+		if !found {
+			exitOnError(fmt.Errorf("%s: category %q of the %s appointment is not in %s", *schedule, a.Category, formatTime(a.Time), *catalog))
+		}
+	}
+	if *noShow < 0 || *noShow > 1 || *early < 0 || *late < 0 {
+		exitOnError(fmt.Errorf("need 0 <= -no-show <= 1 and non-negative -early and -late"))
+	}
+	lateness := Uniform{-*early, *late}
+
+	// Every number of doctors sees the same patients.
+	rng := rand.New(rand.NewSource(seed))
+	var sims []*Simulation
+	for range *reps {
+		seed := rng.Int63()
+		for nServers := 1; nServers <= *maxServers; nServers++ {
+			sims = append(sims, NewSimulation(startTime, endTime, nServers, *walkIns, serverRate, seed,
+				WithCatalog(classes), WithAppointments(appointments, *noShow, lateness)))
+		}
+	}
+	results := simulateAll(sims)
+
+	fmt.Printf("Opening Hours      : %s-%s\n", formatTime(startTime), formatTime(endTime))
+	fmt.Printf("Appointments       : %d, from %s to %s\n", len(appointments), formatTime(appointments[0].Time), formatTime(appointments[len(appointments)-1].Time))
+	fmt.Printf("No-Show Probability: %.2f\n", *noShow)
+	fmt.Printf("Arrival Jitter     : %.0f minutes early to %.0f minutes late\n", *early, *late)
+	fmt.Printf("Walk-ins           : %.2f patients/hour\n", *walkIns)
+	fmt.Printf("Replications       : %d\n", *reps)
+	fmt.Println()
+	fmt.Println("doctors,patients,no_shows,average_wait_time,average_delay,utilization,overtime_minutes")
+	n := float64(*reps)
+	for nServers := 1; nServers <= *maxServers; nServers++ {
+		var patients, noShows, wait, delay, utilization, overtime float64
+		for k := nServers - 1; k < len(results); k += *maxServers {
+			r := results[k]
+			patients += float64(r.TotalCustomers) / n
+			noShows += float64(r.NoShows) / n
+			wait += r.AverageWaitTime / n
+			delay += r.AverageAppointmentDelay / n
+			overtime += float64(r.Overtime) / n
+			for _, sv := range r.Servers {
+				utilization += sv.Utilization / n / float64(nServers)
+			}
+		}
+		fmt.Printf("%d,%.2f,%.2f,%.4f,%.4f,%.4f,%.2f\n", nServers, patients, noShows, wait, delay, utilization, overtime)
+	}
+}
@@ -0,0 +1,100 @@
+package queue
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"reflect"
+	"runtime"
+)
+
+// auditDeterminism runs the same seeded scenarios with GOMAXPROCS set to 1
+// and to a larger value and reports an error unless every result is
+// bit-identical.
+func auditDeterminism(seed int64, args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	procs := fs.Int("procs", max(runtime.NumCPU(), 2), "GOMAXPROCS for the parallel run")
+	maxHours := fs.Int("max-hours", 1000, "longest grid simulation to include, in hours")
+	fs.Parse(args)
+
+	var times []int
+	for _, t := range gridTimes {
+		if t <= *maxHours {
+			times = append(times, t)
+		}
+	}
+	scenarios := func() []SimulationResult {
+		results, _, _ := runGrid(context.Background(), seed, times, []int{1, 2}, 1000, 5.8, 6.0, VarianceReduction{}, 0, nil)
+		var sims []*Simulation
+		for _, p := range []ServerSelectionPolicy{EarliestAvailable, LeastBusy, RandomServer, RoundRobin, FastestServer} {
+			sims = append(sims, NewSimulation(0, *maxHours*60, 2, 5.8, 6.0, seed, WithServerSelection(p), WithServerRates(8.0, 4.0)))
+		}
+		return append(results, simulateAll(sims)...)
+	}
+
+	prev := runtime.GOMAXPROCS(1)
+	defer runtime.GOMAXPROCS(prev)
+	serial := scenarios()
+	runtime.GOMAXPROCS(*procs)
+	parallel := scenarios()
+
+	failed := 0
+	for i := range serial {
+		if !bitIdentical(reflect.ValueOf(serial[i]), reflect.ValueOf(parallel[i])) {
+			failed++
+			fmt.Printf("FAIL scenario %d:\n\tGOMAXPROCS=1: %+v\n\tGOMAXPROCS=%d: %+v\n", i, serial[i], *procs, parallel[i])
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("audit: %d of %d scenarios differ between GOMAXPROCS=1 and GOMAXPROCS=%d", failed, len(serial), *procs)
+	}
+	fmt.Printf("PASS: %d scenarios bit-identical at GOMAXPROCS=1 and GOMAXPROCS=%d\n", len(serial), *procs)
+	return nil
+}
+
+// bitIdentical is like reflect.DeepEqual, except that floats must have the
+// same bit pattern, so NaN equals NaN and 0 differs from -0.
+func bitIdentical(a, b reflect.Value) bool {
+	if a.Kind() != b.Kind() {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return math.Float64bits(a.Float()) == math.Float64bits(b.Float())
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if !bitIdentical(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice, reflect.Array:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !bitIdentical(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Pointer, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return bitIdentical(a.Elem(), b.Elem())
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for _, k := range a.MapKeys() {
+			if !b.MapIndex(k).IsValid() || !bitIdentical(a.MapIndex(k), b.MapIndex(k)) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a.Equal(b)
+	}
+}
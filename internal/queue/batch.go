@@ -0,0 +1,82 @@
+package queue
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+)
+
+// WithGroupArrivals makes customers arrive in groups whose size is one plus
+// a Poisson variable, so groups average meanSize customers. The arrival rate
+// then counts groups rather than customers.
+func WithGroupArrivals(meanSize float64) Option {
+	return func(s *Simulation) {
+		s.groupMean = meanSize
+	}
+}
+
+// WithBatchService lets a server serve up to maxSize customers at once, like
+// a shuttle or an oven, taking a single service time for the whole batch. An
+// idle server waits until at least minSize customers are in line, except
+// after closing time.
+func WithBatchService(minSize, maxSize int) Option {
+	return func(s *Simulation) {
+		s.minBatch, s.maxBatch = minSize, maxSize
+	}
+}
+
+// groupSize returns the size of the next arriving group.
+func (s *Simulation) groupSize() int {
+	if s.groupDist == nil {
+		return 1
+	}
+	return 1 + s.groupDist.Get()
+}
+
+func simulateBatches(seed int64, args []string) {
+	startTime := 8 * 60 // 08:00
+	endTime := 16 * 60  // 16:00
+
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	nServers := fs.Int("servers", 1, "number of servers")
+	customerRate := fs.Float64("rate", 4.0, "arrival rate, in groups per hour")
+	groupMean := fs.Float64("group", 2.5, "mean group size, at least 1")
+	serverRate := fs.Float64("service-rate", 3.0, "service rate, in batches per hour")
+	minBatch := fs.Int("min-batch", 1, "smallest batch a server starts")
+	maxBatch := fs.Int("max-batch", 8, "largest batch a server takes")
+	reps := fs.Int("reps", 1000, "number of replications to average over")
+	fs.Parse(args)
+	checkServers("servers", *nServers)
+
+	if *groupMean < 1 || *minBatch < 1 || *maxBatch < *minBatch {
+		exitOnError(fmt.Errorf("need -group >= 1 and 1 <= -min-batch <= -max-batch"))
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	sims := make([]*Simulation, *reps)
+	for i := range sims {
+		sims[i] = NewSimulation(startTime, endTime, *nServers, *customerRate, *serverRate, rng.Int63(),
+			WithGroupArrivals(*groupMean), WithBatchService(*minBatch, *maxBatch))
+	}
+	results := simulateAll(sims)
+
+	n := float64(*reps)
+	var customers, groupSize, batchSize, wait, service, overtime float64
+	for _, r := range results {
+		customers += float64(r.TotalCustomers) / n
+		groupSize += r.AverageGroupSize / n
+		batchSize += r.AverageBatchSize / n
+		wait += r.AverageWaitTime / n
+		service += r.AverageServiceTime / n
+		overtime += float64(r.Overtime) / n
+	}
+	fmt.Printf("Replications       : %d\n", *reps)
+	fmt.Printf("Total Customers    : %.2f (%.2f groups/hour of %.2f on average)\n", customers, *customerRate, *groupMean)
+	fmt.Printf("Total Servers      : %d (batches of %d to %d)\n", *nServers, *minBatch, *maxBatch)
+	fmt.Printf("Average GroupSize  : %.6f customers\n", groupSize)
+	fmt.Printf("Average BatchSize  : %.6f customers\n", batchSize)
+	fmt.Printf("Average WaitTime   : %.6f minutes\n", wait)
+	fmt.Printf("Average ServiceTime: %.6f minutes\n", service)
+	fmt.Printf("Average Overtime   : %.6f minutes\n", overtime)
+}
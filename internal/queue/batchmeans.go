@@ -0,0 +1,87 @@
+package queue
+
+import "math"
+
+// WithBatchMeans splits the customers served, in the order they were
+// served, into between k and 2k-1 batches of equally many and reports the
+// mean wait of every batch in BatchMeans. One long run then yields a
+// confidence interval of the steady-state wait, see BatchMeansInterval.
+func WithBatchMeans(k int) Option {
+	return func(s *Simulation) {
+		s.batchMeans = max(k, 2)
+	}
+}
+
+// batchMeans keeps the sums of consecutive batches of equally many
+// observations without knowing in advance how many there will be: once it
+// holds 2k full batches, it merges them pairwise and doubles the batch size.
+type batchMeans struct {
+	k    int
+	size int       // observations per batch
+	sums []float64 // of the full batches
+	sum  float64   // of the batch being filled
+	n    int       // observations in the batch being filled
+}
+
+func newBatchMeans(k int) *batchMeans {
+	return &batchMeans{k: k, size: 1}
+}
+
+func (b *batchMeans) add(x float64) {
+	b.sum += x
+	b.n++
+	if b.n < b.size {
+		return
+	}
+	b.sums = append(b.sums, b.sum)
+	b.sum, b.n = 0, 0
+	if len(b.sums) == 2*b.k {
+		for i := range b.k {
+			b.sums[i] = b.sums[2*i] + b.sums[2*i+1]
+		}
+		b.sums = b.sums[:b.k]
+		b.size *= 2
+	}
+}
+
+// means returns the means of the full batches. The batch being filled is
+// left out.
+func (b *batchMeans) means() []float64 {
+	means := make([]float64, len(b.sums))
+	for i, s := range b.sums {
+		means[i] = s / float64(b.size)
+	}
+	return means
+}
+
+// BatchMeansInterval returns the grand mean of batch means, the half width
+// of its confidence interval at the given level, and the lag-1
+// autocorrelation of the batch means. The interval assumes the batches are
+// independent, so it is too narrow when the autocorrelation is clearly
+// positive, and fewer, larger batches should be used.
+func BatchMeansInterval(means []float64, level float64) (mean, half, lag1 float64) {
+	k := len(means)
+	if k < 2 {
+		return math.NaN(), math.NaN(), math.NaN()
+	}
+	mean, variance := meanVariance(means)
+	half = tQuantile(1-(1-level)/2, k-1) * math.Sqrt(variance/float64(k))
+	return mean, half, autocorrelation(means, 1)
+}
+
+// autocorrelation returns the sample autocorrelation of xs at the given
+// lag.
+func autocorrelation(xs []float64, lag int) float64 {
+	mean, _ := meanVariance(xs)
+	num, den := float64(0), float64(0)
+	for i, x := range xs {
+		den += (x - mean) * (x - mean)
+		if i >= lag {
+			num += (x - mean) * (xs[i-lag] - mean)
+		}
+	}
+	if den == 0 {
+		return 0
+	}
+	return num / den
+}
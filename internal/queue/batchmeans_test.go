@@ -0,0 +1,57 @@
+package queue
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestBatchMeans(t *testing.T) {
+	const k = 5
+	b := newBatchMeans(k)
+	for n := 1; n <= 1000; n++ {
+		b.add(float64(n))
+		means := b.means()
+		// the batches double in size to keep between k and 2k-1 of them
+		if n >= k && (len(means) < k || len(means) >= 2*k) {
+			t.Fatalf("%d batches after %d observations", len(means), n)
+		}
+		if len(means) != n/b.size {
+			t.Fatalf("%d batches of %d after %d observations", len(means), b.size, n)
+		}
+		// batch i holds observations i*size+1 to (i+1)*size
+		for i, m := range means {
+			if want := float64(i*b.size) + float64(b.size+1)/2; m != want {
+				t.Fatalf("after %d observations batch %d of %d has mean %g, want %g", n, i, b.size, m, want)
+			}
+		}
+	}
+}
+
+func TestBatchMeansInterval(t *testing.T) {
+	mean, half, lag1 := BatchMeansInterval([]float64{1, 2, 3, 4}, 0.95)
+	// t(0.975, 3) sqrt(5/3 / 4)
+	if mean != 2.5 || math.Abs(half-3.182446305284263*math.Sqrt(5.0/12)) > 1e-9 || math.Abs(lag1-0.25) > 1e-12 {
+		t.Errorf("got %g ± %g with lag-1 autocorrelation %g", mean, half, lag1)
+	}
+	if mean, half, _ := BatchMeansInterval([]float64{1}, 0.95); !math.IsNaN(mean) || !math.IsNaN(half) {
+		t.Errorf("got %g ± %g from one batch", mean, half)
+	}
+
+	// the interval covers the mean of independent batches 95% of the time
+	rng := rand.New(rand.NewSource(1))
+	covered := 0
+	const trials = 4000
+	for range trials {
+		means := make([]float64, 10)
+		for i := range means {
+			means[i] = 7 + 3*rng.NormFloat64()
+		}
+		if mean, half, _ := BatchMeansInterval(means, 0.95); math.Abs(mean-7) <= half {
+			covered++
+		}
+	}
+	if c := float64(covered) / trials; c < 0.94 || c > 0.96 {
+		t.Errorf("covered the mean %.1f%% of the time, want 95%%", 100*c)
+	}
+}
@@ -0,0 +1,73 @@
+package queue
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// benchmark is a configuration whose throughput the bench command
+// measures. Its options may draw on the catalog.
+type benchmark struct {
+	name     string
+	nServers int
+	opts     func(classes []CustomerClass) []Option
+}
+
+// benchmarks are the configurations of the bench command: the grid's M/M/c
+// queues and the common variations of the engine's hot path.
+var benchmarks = []benchmark{
+	{"mm1", 1, nil},
+	{"mm2", 2, nil},
+	{"mm2-separate", 2, func([]CustomerClass) []Option { return []Option{WithSeparateQueues(false)} }},
+	{"mm2-ps", 2, func([]CustomerClass) []Option { return []Option{WithProcessorSharing()} }},
+	{"catalog", 3, func(classes []CustomerClass) []Option { return []Option{WithCatalog(classes)} }},
+}
+
+// simulation returns the simulation of the benchmark for the given hours,
+// with the rates of the grid.
+func (b benchmark) simulation(hours int, customerRate, serverRate float64, seed int64, classes []CustomerClass) *Simulation {
+	var opts []Option
+	if b.opts != nil {
+		opts = b.opts(classes)
+	}
+	return NewSimulation(0, hours*60, b.nServers, customerRate, serverRate, seed, opts...)
+}
+
+// runBenchmarks simulates every configuration for the given hours, in one
+// run at a time, and reports the customers simulated per second and the
+// allocations per customer.
+func runBenchmarks(seed int64, args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	hours := fs.Int("hours", 10000, "hours to simulate per configuration")
+	customerRate := fs.Float64("rate", 5.8, "arrival rate, in customers per hour")
+	serverRate := fs.Float64("service-rate", 6.0, "service rate per server, in customers per hour")
+	catalog := fs.String("catalog", "catalog.csv", "CSV `file` of transaction categories for the catalog configuration")
+	fs.Parse(args)
+	if *hours < 1 {
+		exitOnError(fmt.Errorf("need -hours >= 1"))
+	}
+	classes, err := LoadCatalog(*catalog)
+	exitOnError(err)
+
+	fmt.Printf("Simulated          : %d hours per configuration, GOMAXPROCS %d\n", *hours, runtime.GOMAXPROCS(0))
+	fmt.Println()
+	fmt.Println("config,customers,seconds,customers_per_second,allocs_per_customer,bytes_per_customer")
+	for _, b := range benchmarks {
+		s := b.simulation(*hours, *customerRate, *serverRate, seed, classes)
+
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		began := time.Now()
+		r := s.Simulate(false)
+		elapsed := time.Since(began).Seconds()
+		runtime.ReadMemStats(&after)
+
+		n := float64(max(r.TotalCustomers, 1))
+		fmt.Printf("%s,%d,%.3f,%.0f,%.3f,%.1f\n", b.name, r.TotalCustomers, elapsed, float64(r.TotalCustomers)/elapsed,
+			float64(after.Mallocs-before.Mallocs)/n, float64(after.TotalAlloc-before.TotalAlloc)/n)
+	}
+}
@@ -0,0 +1,26 @@
+package queue
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// BenchmarkSimulate runs the configurations of the bench command for 1000
+// hours at a time and reports the customers simulated per second.
+func BenchmarkSimulate(b *testing.B) {
+	classes, err := LoadCatalog(filepath.Join("..", "..", "catalog.csv"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			customers := 0
+			for i := 0; i < b.N; i++ {
+				r := bm.simulation(1000, 5.8, 6.0, int64(i), classes).Simulate(false)
+				customers += r.TotalCustomers
+			}
+			b.ReportMetric(float64(customers)/b.Elapsed().Seconds(), "customers/s")
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package queue
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand"
+)
+
+// InterruptPolicy says what happens to a customer whose service is cut short
+// by a breakdown.
+type InterruptPolicy int
+
+const (
+	// ResumeService continues with the work that was left.
+	ResumeService InterruptPolicy = iota
+	// RestartService does the whole service again.
+	RestartService
+)
+
+// Breakdowns describes random server failures. Times are exponentially
+// distributed with the given means, in minutes.
+type Breakdowns struct {
+	TimeToFailure float64
+	RepairTime    float64
+	Interrupt     InterruptPolicy
+}
+
+// WithBreakdowns makes every server fail from time to time. A broken server
+// stops mid-service; the interrupted customer goes back to the front of the
+// line and is served again according to the interrupt policy.
+func WithBreakdowns(b Breakdowns) Option {
+	return func(s *Simulation) {
+		s.breakdowns = &b
+	}
+}
+
+func (r *run) scheduleFailures() {
+	if r.s.breakdowns == nil {
+		return
+	}
+	for j := range r.servers {
+		r.scheduleFailure(j, r.s.startTime)
+	}
+}
+
+// scheduleFailure draws the next failure of server j after time t. Once
+// the doors have closed and everyone has left, servers stop failing.
+func (r *run) scheduleFailure(j int, t int) {
+	if t >= r.s.endTime && r.inSystem == 0 {
+		return
+	}
+	ttf := max(1, r.s.ticks(r.s.failureDist[j].Get()))
+	r.events.push(event{time: t + ttf, kind: failureEvent, server: j})
+}
+
+// fail breaks server j down at time t.
+func (r *run) fail(j int, t int) {
+	sv := &r.servers[j]
+	sv.broken = true
+	sv.failures++
+	repair := max(1, r.s.ticks(r.s.repairDist[j].Get()))
+	sv.downtime += repair
+	r.events.push(event{time: t + repair, kind: repairEvent, server: j})
+	if r.logs(LevelDebug) {
+		r.logAttrs(LevelDebug, "server failed", slog.Int("server", j), r.at(t), r.durationAttr("repair", repair))
+	}
+
+	if len(sv.batch) > 0 {
+		// cancel the departure and put the customers back in line
+		left := sv.batch[0].FinishTime - t
+		r.busyTime[j] -= left
+		if sv.setupEnd > t {
+			// the setup was not over, and the service not begun
+			sv.setupTime -= sv.setupEnd - t
+			left -= sv.setupEnd - t
+		}
+		sv.version++
+		for _, c := range sv.batch {
+			c.Interruptions++
+			r.interruptions++
+			c.work = left + sv.rest
+			if r.s.breakdowns.Interrupt == RestartService {
+				c.work = c.service
+			}
+			if r.logs(LevelCustomer) {
+				r.logAttrs(LevelCustomer, "customer interrupted", slog.Int("customer", c.Index), r.at(t), slog.Int("server", j), r.durationAttr("left", c.work))
+			}
+		}
+		if r.s.separateQueues {
+			sv.queue = append(append([]*Customer(nil), sv.batch...), sv.queue...)
+		} else {
+			r.queue = append(append([]*Customer(nil), sv.batch...), r.queue...)
+		}
+		for _, c := range sv.batch {
+			r.event(CustomerInterrupted, t, c)
+		}
+		sv.batch = sv.batch[:0]
+	}
+	r.redirectLine(j, t)
+	if !r.s.separateQueues {
+		// other free servers may pick up the interrupted customers
+		r.dispatch(t)
+	}
+}
+
+// repair puts server j back to work at time t.
+func (r *run) repair(j int, t int) {
+	r.servers[j].broken = false
+	if r.logs(LevelDebug) {
+		r.logAttrs(LevelDebug, "server repaired", slog.Int("server", j), r.at(t))
+	}
+	if r.idle(j) {
+		r.next(j, t)
+	}
+	r.scheduleFailure(j, t)
+}
+
+func simulateBreakdowns(seed int64, args []string) {
+	startTime := 8 * 60 // 08:00
+	endTime := 16 * 60  // 16:00
+	customerRate := 5.8 // 5.8 customers per hour
+	serverRate := 6.0   // 6 customers per hour, or 10 minutes per customer
+
+	fs := flag.NewFlagSet("breakdowns", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	nServers := fs.Int("servers", 2, "number of servers")
+	mttf := fs.Float64("mttf", 120, "mean time to failure, in minutes")
+	mttr := fs.Float64("mttr", 15, "mean repair time, in minutes")
+	restart := fs.Bool("restart", false, "restart interrupted services instead of resuming them")
+	reps := fs.Int("reps", 1000, "number of replications to average over")
+	fs.Parse(args)
+	checkServers("servers", *nServers)
+
+	b := Breakdowns{TimeToFailure: *mttf, RepairTime: *mttr}
+	if *restart {
+		b.Interrupt = RestartService
+	}
+
+	// Both variants share seeds, so they see the same customers.
+	rng := rand.New(rand.NewSource(seed))
+	var sims []*Simulation
+	for range *reps {
+		seed := rng.Int63()
+		sims = append(sims,
+			NewSimulation(startTime, endTime, *nServers, customerRate, serverRate, seed),
+			NewSimulation(startTime, endTime, *nServers, customerRate, serverRate, seed, WithBreakdowns(b)))
+	}
+	results := simulateAll(sims)
+
+	n := float64(*reps)
+	var waitReliable, waitBroken, interruptions float64
+	downtime := make([]float64, *nServers)
+	failures := make([]float64, *nServers)
+	for i := 0; i < len(results); i += 2 {
+		waitReliable += results[i].AverageWaitTime / n
+		waitBroken += results[i+1].AverageWaitTime / n
+		interruptions += float64(results[i+1].Interruptions) / n
+		for j, st := range results[i+1].Servers {
+			downtime[j] += float64(st.Downtime) / n
+			failures[j] += float64(st.Failures) / n
+		}
+	}
+	fmt.Printf("Replications       : %d\n", *reps)
+	fmt.Printf("Time To Failure    : %.2f minutes on average\n", *mttf)
+	fmt.Printf("Repair Time        : %.2f minutes on average\n", *mttr)
+	for j := range downtime {
+		fmt.Printf("Server %-12d: %.2f failures, %.2f minutes down per day\n", j, failures[j], downtime[j])
+	}
+	fmt.Printf("Interruptions      : %.2f customers per day\n", interruptions)
+	fmt.Printf("Average WaitTime   : %.6f minutes without breakdowns\n", waitReliable)
+	fmt.Printf("Average WaitTime   : %.6f minutes with breakdowns (%+.6f)\n", waitBroken, waitBroken-waitReliable)
+}
@@ -0,0 +1,216 @@
+package queue
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// CustomerClass is a kind of customer, such as a transaction type in a
+// bank's catalog, with its own service time distribution. Frequency is the
+// relative share of arrivals that belong to the class. Customers of a higher
+// Priority go ahead of those of a lower one in line, and with
+// WithPreemption take over their servers.
+type CustomerClass struct {
+	Name      string
+	Frequency float64
+	Service   ServiceDistribution
+	Priority  int
+}
+
+// WithCatalog gives every arriving customer a class drawn according to the
+// class frequencies and serves it with the class's service distribution,
+// instead of the servers' exponential service times.
+func WithCatalog(classes []CustomerClass) Option {
+	return func(s *Simulation) {
+		s.classes = classes
+	}
+}
+
+// ReadCatalog reads customer classes from CSV with a header line and the
+// columns category, frequency, distribution and the distribution's
+// parameters, e.g.
+//
+//	category,frequency,distribution,p1,p2
+//	deposit,0.45,exp,4
+//	loan,0.10,lognormal,25,10
+//
+// See ParseDistribution for the distributions. A header naming the third
+// column priority gives every class a priority before its distribution:
+//
+//	category,frequency,priority,distribution,p1,p2
+//	resuscitation,0.05,3,exp,60
+func ReadCatalog(r io.Reader) ([]CustomerClass, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("catalog has no categories")
+	}
+
+	prioritized := len(records[0]) > 2 && strings.EqualFold(strings.TrimSpace(records[0][2]), "priority")
+	var classes []CustomerClass
+	for i, rec := range records[1:] {
+		line := i + 2
+		for len(rec) > 0 && strings.TrimSpace(rec[len(rec)-1]) == "" {
+			rec = rec[:len(rec)-1]
+		}
+		priority := 0
+		if prioritized {
+			if len(rec) < 4 {
+				return nil, fmt.Errorf("line %d: want category,frequency,priority,distribution,params...", line)
+			}
+			if priority, err = strconv.Atoi(rec[2]); err != nil {
+				return nil, fmt.Errorf("line %d: invalid priority %q", line, rec[2])
+			}
+			rec = append(rec[:2:2], rec[3:]...)
+		}
+		if len(rec) < 3 {
+			return nil, fmt.Errorf("line %d: want category,frequency,distribution,params...", line)
+		}
+		freq, err := strconv.ParseFloat(rec[1], 64)
+		if err != nil || freq < 0 {
+			return nil, fmt.Errorf("line %d: invalid frequency %q", line, rec[1])
+		}
+		dist, err := ParseDistribution(rec[2], rec[3:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		classes = append(classes, CustomerClass{Name: rec[0], Frequency: freq, Service: dist, Priority: priority})
+	}
+	return classes, nil
+}
+
+// LoadCatalog reads customer classes from a CSV file, see ReadCatalog.
+func LoadCatalog(path string) ([]CustomerClass, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	classes, err := ReadCatalog(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return classes, nil
+}
+
+// WithServiceDistribution serves every customer with a service time drawn
+// from dist, e.g. an Empirical distribution of observed times, instead of
+// the servers' exponential service times. A catalog takes precedence.
+func WithServiceDistribution(dist ServiceDistribution) Option {
+	return func(s *Simulation) {
+		s.service = dist
+	}
+}
+
+// drawClass returns the class of the next arriving customer.
+func (s *Simulation) drawClass() int {
+	if len(s.classes) == 0 {
+		return 0
+	}
+	total := float64(0)
+	for _, c := range s.classes {
+		total += c.Frequency
+	}
+	x := s.mixRng.Float64() * total
+	for i, c := range s.classes {
+		x -= c.Frequency
+		if x < 0 {
+			return i
+		}
+	}
+	return len(s.classes) - 1
+}
+
+// serviceTime draws the service time of customer c at server j starting at
+// time t, in whole ticks, from the server's random stream.
+func (r *run) serviceTime(j int, c *Customer, t int) int {
+	s := r.s
+	var minutes float64
+	switch {
+	case len(s.classes) > 0:
+		minutes = s.classes[c.Class].Service.Sample(s.serverDist[j].rng)
+	case s.service != nil:
+		minutes = s.service.Sample(s.serverDist[j].rng)
+	default:
+		minutes = s.serverDist[j].Get()
+	}
+	if len(s.covariates) > 0 {
+		minutes /= s.serviceFactor(t)
+	}
+	if len(s.speeds) > 0 {
+		minutes /= r.speed(j, t)
+	}
+	return s.ticks(minutes)
+}
+
+// meanServiceTime returns the mean service time at server j, in minutes.
+func (s *Simulation) meanServiceTime(j int) float64 {
+	if len(s.classes) == 0 && s.service != nil {
+		return s.service.Mean()
+	}
+	if len(s.classes) == 0 {
+		return float64(60) / s.serverRates[j]
+	}
+	total, mean := float64(0), float64(0)
+	for _, c := range s.classes {
+		total += c.Frequency
+		mean += c.Frequency * c.Service.Mean()
+	}
+	return mean / total
+}
+
+// ClassStats describes the customers of one class of the catalog. Waits,
+// service and sojourn times, from arrival to departure, are averages over
+// those served, in minutes.
+type ClassStats struct {
+	Name               string
+	Customers          int
+	Abandoned          int
+	AverageWaitTime    float64
+	AverageServiceTime float64
+	AverageSojournTime float64
+	// P90WaitTime is the 90th percentile wait, rounded up to the minute.
+	P90WaitTime int
+}
+
+// classTally accumulates the statistics of a class during a run, in ticks.
+// With streaming statistics p90 estimates the 90th percentile wait in place
+// of the histogram of waits.
+type classTally struct {
+	customers, served, abandoned int
+	wait, service, sojourn       int
+	waits                        histogram
+	p90                          *p2Quantile
+}
+
+func (r *run) classStats() []ClassStats {
+	if len(r.s.classes) == 0 {
+		return nil
+	}
+	k := r.s.tick
+	stats := make([]ClassStats, len(r.classes))
+	for i, c := range r.classes {
+		stats[i] = ClassStats{
+			Name:               r.s.classes[i].Name,
+			Customers:          c.customers,
+			Abandoned:          c.abandoned,
+			AverageWaitTime:    ratio(c.wait, c.served) / float64(k),
+			AverageServiceTime: ratio(c.service, c.served) / float64(k),
+			AverageSojournTime: ratio(c.sojourn, c.served) / float64(k),
+			P90WaitTime:        (c.waits.quantile(0.9) + k - 1) / k,
+		}
+		if c.p90 != nil {
+			stats[i].P90WaitTime = int(math.Round(c.p90.value() / float64(k)))
+		}
+	}
+	return stats
+}
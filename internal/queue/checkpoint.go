@@ -0,0 +1,462 @@
+package queue
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"log/slog"
+	"math/rand"
+	"os"
+	"reflect"
+	"sort"
+)
+
+// Checkpoint saves the whole state of a run to a file every so many
+// simulated hours: the events scheduled, the customers inside, the state of
+// every random stream and the statistics so far. A long run that crashes or
+// is stopped can then go on from the last save rather than start over, and
+// ends with the very result it would have had. The run resumed must be the
+// same simulation, with the same options, drawing from the default random
+// streams; a save of any other is refused.
+type Checkpoint struct {
+	// Path is the file the state is saved to, replaced at every save.
+	Path string
+	// Every is the number of simulated hours between saves.
+	Every int
+	// Resume starts the run from the state saved in Path, if there is one.
+	Resume bool
+}
+
+// WithCheckpoint saves the state of the run, and resumes it, as cp says.
+func WithCheckpoint(cp Checkpoint) Option {
+	return func(s *Simulation) {
+		s.checkpoints = &cp
+	}
+}
+
+// snapshot is the state of a run at the start of a tick, as saved. The
+// customers are saved once and referred to by their position in Customers,
+// so that the lines, the servers and the events still share them.
+type snapshot struct {
+	Time int
+
+	// the simulation the state belongs to
+	Seed                               int64
+	StartTime, EndTime, Tick, NServers int
+	Options                            []byte // its fingerprint
+
+	Streams    map[string][]byte
+	NextServer int
+
+	Customers []customerSnapshot
+	Events    []eventSnapshot
+	Queue     []int
+	Servers   []serverSnapshot
+	BusyTime  []int
+
+	CustomerCount, Groups, TotalWait, TotalService, Jockeys int
+	Waits                                                   histogramSnapshot
+	Streaming                                               *streamingSnapshot
+	BatchMeans                                              *batchMeansSnapshot
+
+	Interruptions, SentAway, Preemptions, PreemptionDelay, Denied, LastFinish int
+	Abandoned, AbandonWait                                                    int
+
+	Classes                                 []classSnapshot
+	Booked                                  []bookingSnapshot
+	NoShows, BookedServed, AppointmentDelay int
+
+	InSystem, LastEmpty, MaxBacklog, MaxBacklogTime, RecoveredAt int
+	Overload                                                     *OverloadStats
+
+	Area, OpenArea, LastChange, TimeInSystem int
+	TimeAt                                   []int
+	QueueTicks, QueueOverTicks, Completed    int
+	States                                   []State
+	NextState                                int
+	Scaling                                  *ScalingStats
+}
+
+type customerSnapshot struct {
+	Customer    Customer
+	Booked      bool
+	Appointment int
+	Service     int
+	Work        int
+	Preempted   bool
+	PreemptedAt int
+	Left        float64
+}
+
+type eventSnapshot struct {
+	Time, Kind, Server, Version int
+	Customer                    int // -1 for none
+}
+
+type serverSnapshot struct {
+	Batch, Queue             []int
+	OffDuty, Broken          bool
+	Version, Served, Batches int
+	Failures, Downtime       int
+	FreeAt, LastClass        int
+	SetupEnd, Setups         int
+	SetupTime, Slice, Rest   int
+	SharedAt                 int
+	Standby, Calling         bool
+	DutySince, DutyTime      int
+	IdleSince                int
+}
+
+type histogramSnapshot struct {
+	Counts      []int
+	N, Sum, Top int
+}
+
+type streamingSnapshot struct {
+	N             int
+	Mean, M2, Max float64
+	Quantiles     []p2Snapshot
+}
+
+type p2Snapshot struct {
+	P                          float64
+	N                          int
+	Heights, Pos, Desired, Inc [5]float64
+}
+
+type batchMeansSnapshot struct {
+	K, Size, N int
+	Sums       []float64
+	Sum        float64
+}
+
+type classSnapshot struct {
+	Customers, Served, Abandoned, Wait, Service, Sojourn int
+	Waits                                                histogramSnapshot
+	P90                                                  *p2Snapshot
+}
+
+type bookingSnapshot struct {
+	Arrival, Appointment, Class int
+}
+
+// save saves the state of the run at the start of tick t to the checkpoint
+// file, through a temporary file so that a crash while saving leaves the
+// last save whole.
+func (r *run) save(t int) error {
+	s := r.s
+	sn := snapshot{
+		Time: t, Seed: s.seed, StartTime: s.startTime, EndTime: s.endTime, Tick: s.tick, NServers: s.nServers, Options: r.options,
+		Streams: map[string][]byte{}, NextServer: s.nextServer,
+		BusyTime:      r.busyTime,
+		CustomerCount: r.customers, Groups: r.groups, TotalWait: r.totalWait, TotalService: r.totalService, Jockeys: r.jockeys,
+		Waits:         histogramSnapshot{r.waits.counts, r.waits.n, r.waits.sum, r.waits.top},
+		Interruptions: r.interruptions, SentAway: r.sentAway, Preemptions: r.preemptions, PreemptionDelay: r.preemptionDelay,
+		Denied: r.denied, LastFinish: r.lastFinish, Abandoned: r.abandoned, AbandonWait: r.abandonWait,
+		NoShows: r.noShows, BookedServed: r.bookedServed, AppointmentDelay: r.appointmentDelay,
+		InSystem: r.inSystem, LastEmpty: r.lastEmpty, MaxBacklog: r.maxBacklog, MaxBacklogTime: r.maxBacklogTime,
+		RecoveredAt: r.recoveredAt, Overload: r.overload,
+		Area: r.area, OpenArea: r.openArea, LastChange: r.lastChange, TimeInSystem: r.timeInSystem, TimeAt: r.timeAt,
+		QueueTicks: r.queueTicks, QueueOverTicks: r.queueOverTicks, Completed: r.completed,
+		States: r.states, NextState: r.nextState, Scaling: r.scaling,
+	}
+	for key, src := range s.streamSources {
+		if a, ok := src.(antitheticSource); ok {
+			src = a.Source
+		}
+		m, ok := src.(encoding.BinaryMarshaler)
+		if !ok {
+			return fmt.Errorf("checkpoint: stream %s cannot be saved, only the default streams can", key)
+		}
+		b, err := m.MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("checkpoint: stream %s: %v", key, err)
+		}
+		sn.Streams[key] = b
+	}
+
+	index := map[*Customer]int{}
+	ref := func(c *Customer) int {
+		if c == nil {
+			return -1
+		}
+		i, ok := index[c]
+		if !ok {
+			i = len(sn.Customers)
+			index[c] = i
+			sn.Customers = append(sn.Customers, customerSnapshot{
+				Customer: *c, Booked: c.booked, Appointment: c.appointment, Service: c.service, Work: c.work,
+				Preempted: c.preempted, PreemptedAt: c.preemptedAt, Left: c.left,
+			})
+		}
+		return i
+	}
+	refs := func(cs []*Customer) []int {
+		is := make([]int, len(cs))
+		for i, c := range cs {
+			is[i] = ref(c)
+		}
+		return is
+	}
+	sn.Queue = refs(r.queue)
+	for _, sv := range r.servers {
+		sn.Servers = append(sn.Servers, serverSnapshot{
+			Batch: refs(sv.batch), Queue: refs(sv.queue), OffDuty: sv.offDuty, Broken: sv.broken,
+			Version: sv.version, Served: sv.served, Batches: sv.batches, Failures: sv.failures, Downtime: sv.downtime,
+			FreeAt: sv.freeAt, LastClass: sv.lastClass, SetupEnd: sv.setupEnd, Setups: sv.setups, SetupTime: sv.setupTime,
+			Slice: sv.slice, Rest: sv.rest, SharedAt: sv.sharedAt,
+			Standby: sv.standby, Calling: sv.calling, DutySince: sv.dutySince, DutyTime: sv.dutyTime, IdleSince: sv.idleSince,
+		})
+	}
+	for _, e := range r.events {
+		sn.Events = append(sn.Events, eventSnapshot{e.time, int(e.kind), e.server, e.version, ref(e.customer)})
+	}
+	if b := r.batchMeans; b != nil {
+		sn.BatchMeans = &batchMeansSnapshot{K: b.k, Size: b.size, N: b.n, Sums: b.sums, Sum: b.sum}
+	}
+	if w := r.streaming; w != nil {
+		sn.Streaming = &streamingSnapshot{N: w.n, Mean: w.mean, M2: w.m2, Max: w.max}
+		for _, q := range w.quantiles {
+			sn.Streaming.Quantiles = append(sn.Streaming.Quantiles, *q.snapshot())
+		}
+	}
+	for _, c := range r.classes {
+		cs := classSnapshot{c.customers, c.served, c.abandoned, c.wait, c.service, c.sojourn,
+			histogramSnapshot{c.waits.counts, c.waits.n, c.waits.sum, c.waits.top}, nil}
+		if c.p90 != nil {
+			cs.P90 = c.p90.snapshot()
+		}
+		sn.Classes = append(sn.Classes, cs)
+	}
+	for _, b := range r.booked {
+		sn.Booked = append(sn.Booked, bookingSnapshot{b.arrival, b.appointment, b.class})
+	}
+
+	path := s.checkpoints.Path
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(sn); err != nil {
+		f.Close()
+		return fmt.Errorf("checkpoint: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// load restores the state saved in the checkpoint file and returns the tick
+// to go on from, or the start time if there is no file.
+func (r *run) load() (int, error) {
+	s := r.s
+	path := s.checkpoints.Path
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s.startTime, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var sn snapshot
+	if err := gob.NewDecoder(f).Decode(&sn); err != nil {
+		return 0, fmt.Errorf("%s: %v", path, err)
+	}
+	if sn.Seed != s.seed || sn.StartTime != s.startTime || sn.EndTime != s.endTime || sn.Tick != s.tick || sn.NServers != s.nServers {
+		return 0, fmt.Errorf("%s: saved from another simulation", path)
+	}
+	if !bytes.Equal(sn.Options, r.options) {
+		return 0, fmt.Errorf("%s: saved from the same simulation with other options", path)
+	}
+	for key, src := range s.streamSources {
+		if a, ok := src.(antitheticSource); ok {
+			src = a.Source
+		}
+		u, ok := src.(encoding.BinaryUnmarshaler)
+		b, saved := sn.Streams[key]
+		if !ok || !saved {
+			return 0, fmt.Errorf("%s: no state for stream %s", path, key)
+		}
+		if err := u.UnmarshalBinary(b); err != nil {
+			return 0, fmt.Errorf("%s: stream %s: %v", path, key, err)
+		}
+	}
+	s.nextServer = sn.NextServer
+
+	customers := make([]*Customer, len(sn.Customers))
+	for i, cs := range sn.Customers {
+		c := cs.Customer
+		c.booked, c.appointment, c.service, c.work = cs.Booked, cs.Appointment, cs.Service, cs.Work
+		c.preempted, c.preemptedAt, c.left = cs.Preempted, cs.PreemptedAt, cs.Left
+		customers[i] = &c
+	}
+	deref := func(is []int) []*Customer {
+		cs := make([]*Customer, len(is))
+		for i, j := range is {
+			cs[i] = customers[j]
+		}
+		return cs
+	}
+	r.queue = deref(sn.Queue)
+	for j, sv := range sn.Servers {
+		r.servers[j] = serverState{
+			batch: deref(sv.Batch), queue: deref(sv.Queue), offDuty: sv.OffDuty, broken: sv.Broken,
+			version: sv.Version, served: sv.Served, batches: sv.Batches, failures: sv.Failures, downtime: sv.Downtime,
+			freeAt: sv.FreeAt, lastClass: sv.LastClass, setupEnd: sv.SetupEnd, setups: sv.Setups, setupTime: sv.SetupTime,
+			slice: sv.Slice, rest: sv.Rest, sharedAt: sv.SharedAt,
+			standby: sv.Standby, calling: sv.Calling, dutySince: sv.DutySince, dutyTime: sv.DutyTime, idleSince: sv.IdleSince,
+		}
+	}
+	r.events = r.events[:0]
+	for _, e := range sn.Events {
+		ev := event{time: e.Time, kind: eventKind(e.Kind), server: e.Server, version: e.Version}
+		if e.Customer >= 0 {
+			ev.customer = customers[e.Customer]
+		}
+		r.events = append(r.events, ev)
+	}
+	r.busyTime = sn.BusyTime
+	r.customers, r.groups, r.totalWait, r.totalService, r.jockeys = sn.CustomerCount, sn.Groups, sn.TotalWait, sn.TotalService, sn.Jockeys
+	r.waits = histogram{sn.Waits.Counts, sn.Waits.N, sn.Waits.Sum, sn.Waits.Top}
+	if b := sn.BatchMeans; b != nil {
+		r.batchMeans = &batchMeans{k: b.K, size: b.Size, n: b.N, sums: b.Sums, sum: b.Sum}
+	}
+	if w := sn.Streaming; w != nil {
+		r.streaming = &streamingWaits{welford: welford{n: w.N, mean: w.Mean, m2: w.M2, max: w.Max}}
+		for _, q := range w.Quantiles {
+			r.streaming.quantiles = append(r.streaming.quantiles, q.restore())
+		}
+	}
+	r.interruptions, r.sentAway, r.preemptions, r.preemptionDelay = sn.Interruptions, sn.SentAway, sn.Preemptions, sn.PreemptionDelay
+	r.denied, r.lastFinish, r.abandoned, r.abandonWait = sn.Denied, sn.LastFinish, sn.Abandoned, sn.AbandonWait
+	for i, c := range sn.Classes {
+		r.classes[i] = classTally{c.Customers, c.Served, c.Abandoned, c.Wait, c.Service, c.Sojourn, histogram{c.Waits.Counts, c.Waits.N, c.Waits.Sum, c.Waits.Top}, nil}
+		if c.P90 != nil {
+			r.classes[i].p90 = c.P90.restore()
+		}
+	}
+	r.booked = r.booked[:0]
+	for _, b := range sn.Booked {
+		r.booked = append(r.booked, booking{b.Arrival, b.Appointment, b.Class})
+	}
+	r.noShows, r.bookedServed, r.appointmentDelay = sn.NoShows, sn.BookedServed, sn.AppointmentDelay
+	r.inSystem, r.lastEmpty, r.maxBacklog, r.maxBacklogTime = sn.InSystem, sn.LastEmpty, sn.MaxBacklog, sn.MaxBacklogTime
+	r.recoveredAt, r.overload = sn.RecoveredAt, sn.Overload
+	r.area, r.openArea, r.lastChange, r.timeInSystem = sn.Area, sn.OpenArea, sn.LastChange, sn.TimeInSystem
+	r.timeAt = sn.TimeAt
+	r.queueTicks, r.queueOverTicks, r.completed = sn.QueueTicks, sn.QueueOverTicks, sn.Completed
+	r.states, r.nextState = sn.States, sn.NextState
+	r.scaling = sn.Scaling
+	r.reportedTime, r.reportedCustomers = sn.Time, r.customers
+	return sn.Time, nil
+}
+
+func (q *p2Quantile) snapshot() *p2Snapshot {
+	return &p2Snapshot{q.p, q.n, q.heights, q.pos, q.desired, q.inc}
+}
+
+func (sn p2Snapshot) restore() *p2Quantile {
+	return &p2Quantile{sn.P, sn.N, sn.Heights, sn.Pos, sn.Desired, sn.Inc}
+}
+
+// fingerprint returns a hash of everything about the simulation that makes
+// its runs what they are: the times, rates and seed, the distributions,
+// the policies and every other option, down to their parameters. Random
+// streams, whose state a checkpoint saves, are left out, as are the
+// logger, the progress and the checkpoints; functions, such as hooks,
+// count only by whether they are set.
+func (s *Simulation) fingerprint() []byte {
+	h := sha256.New()
+	v := reflect.ValueOf(s).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		switch v.Type().Field(i).Name {
+		case "nextServer", "streamSources", "logger", "progress", "checkpoints":
+			continue
+		}
+		fmt.Fprintf(h, "%s:", v.Type().Field(i).Name)
+		hashValue(h, v.Field(i), map[uintptr]bool{})
+		h.Write([]byte{'\n'})
+	}
+	return h.Sum(nil)
+}
+
+var (
+	randType   = reflect.TypeOf(rand.Rand{})
+	sourceType = reflect.TypeOf((*rand.Source)(nil)).Elem()
+	loggerType = reflect.TypeOf(slog.Logger{})
+)
+
+// hashValue writes v to h, unexported fields and all, following pointers
+// once each.
+func hashValue(h hash.Hash, v reflect.Value, seen map[uintptr]bool) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			h.Write([]byte("nil"))
+			return
+		}
+		if seen[v.Pointer()] {
+			h.Write([]byte("seen"))
+			return
+		}
+		seen[v.Pointer()] = true
+		hashValue(h, v.Elem(), seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			h.Write([]byte("nil"))
+			return
+		}
+		if v.Elem().Type().Implements(sourceType) {
+			h.Write([]byte("source"))
+			return
+		}
+		fmt.Fprintf(h, "%s(", v.Elem().Type())
+		hashValue(h, v.Elem(), seen)
+		h.Write([]byte(")"))
+	case reflect.Struct:
+		if v.Type() == randType || v.Type() == loggerType {
+			h.Write([]byte("left out"))
+			return
+		}
+		h.Write([]byte("{"))
+		for i := 0; i < v.NumField(); i++ {
+			hashValue(h, v.Field(i), seen)
+			h.Write([]byte(","))
+		}
+		h.Write([]byte("}"))
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			h.Write([]byte("nil"))
+			return
+		}
+		h.Write([]byte("["))
+		for i := 0; i < v.Len(); i++ {
+			hashValue(h, v.Index(i), seen)
+			h.Write([]byte(","))
+		}
+		h.Write([]byte("]"))
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		h.Write([]byte("map["))
+		for _, k := range keys {
+			hashValue(h, k, seen)
+			h.Write([]byte(":"))
+			hashValue(h, v.MapIndex(k), seen)
+			h.Write([]byte(","))
+		}
+		h.Write([]byte("]"))
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		fmt.Fprintf(h, "%s %v", v.Kind(), !v.IsNil())
+	default:
+		// numbers, booleans and strings
+		fmt.Fprintf(h, "%v", v)
+	}
+}
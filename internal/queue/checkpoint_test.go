@@ -0,0 +1,81 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// checkpointed returns a simulation of ten hours saving its state to path
+// every hour, with the options opts on top of a few of its own.
+func checkpointed(t *testing.T, path string, resume bool, opts ...Option) *Simulation {
+	t.Helper()
+	service, err := parseDistributionFlag("lognormal,10,5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	patience, err := parseDistributionFlag("exp,30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts = append([]Option{WithServiceDistribution(service), WithPatience(patience), WithServerSelection(LeastBusy)}, opts...)
+	opts = append(opts, WithCheckpoint(Checkpoint{Path: path, Every: 1, Resume: resume}))
+	return NewSimulation(480, 1080, 3, 17, 6, 11, opts...)
+}
+
+func TestCheckpointResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.gob")
+	// the last save is at 17:00, an hour before the end
+	want, err := json.Marshal(checkpointed(t, path, false).Simulate(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+	r, err := checkpointed(t, path, true).SimulateContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := json.Marshal(r); string(got) != string(want) {
+		t.Errorf("resumed\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCheckpointRefusesOtherOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.gob")
+	checkpointed(t, path, false).Simulate(false)
+	longer, err := parseDistributionFlag("lognormal,11,5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, opt := range map[string]Option{
+		"service":    WithServiceDistribution(longer),
+		"policy":     WithServerSelection(RandomServer),
+		"rates":      WithServerRates(6, 6, 7),
+		"discipline": WithRoundRobin(2),
+		"queues":     WithSeparateQueues(true),
+		"cutoff":     WithCutoff(1000),
+		"hooks":      WithHooks(Hooks{OnDeparture: func(CustomerEvent) {}}),
+	} {
+		_, err := checkpointed(t, path, true, opt).SimulateContext(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "other options") {
+			t.Errorf("%s: got %v, want a refusal", name, err)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	a, b := checkpointed(t, filepath.Join(dir, "a.gob"), false), checkpointed(t, filepath.Join(dir, "b.gob"), true)
+	if string(a.fingerprint()) != string(b.fingerprint()) {
+		t.Error("the same simulation has two fingerprints")
+	}
+	a.Simulate(false)
+	if string(a.fingerprint()) != string(b.fingerprint()) {
+		t.Error("the fingerprint changes with a run")
+	}
+}
@@ -0,0 +1,75 @@
+package queue
+
+import (
+	"flag"
+	"fmt"
+)
+
+// WithPopulation makes the system closed: a fixed population of n
+// customers, the interactive users of a computer system, each thinking for
+// a time drawn from think, in minutes, then arriving for service and
+// thinking again once served or out of patience. Everyone starts out
+// thinking at startTime, and no one comes back after endTime. The arrival
+// rate and group sizes do not apply.
+func WithPopulation(n int, think ServiceDistribution) Option {
+	return func(s *Simulation) {
+		s.population = n
+		s.think = think
+	}
+}
+
+// schedulePopulation sends the whole population off to think at startTime.
+func (r *run) schedulePopulation() {
+	for range r.s.population {
+		r.think(r.s.startTime)
+	}
+}
+
+// think lets a customer who left at time t come back after a think time.
+func (r *run) think(t int) {
+	z := r.s.ticks(r.s.think.Sample(r.s.thinkRng))
+	r.events.push(event{time: t + z, kind: returnEvent})
+}
+
+func simulateClosed(seed int64, args []string) {
+	startTime := 0
+	serverRate := 6.0 // 6 customers per hour, or 10 minutes per customer
+
+	fs := flag.NewFlagSet("closed", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	nServers := fs.Int("servers", 1, "number of servers")
+	population := fs.Int("population", 20, "largest population to simulate, from 1 customer up")
+	think := fs.String("think", "exp,30", "think time `distribution` in minutes, e.g. exp,30")
+	hours := fs.Int("hours", 1000, "simulated hours per population")
+	fs.Parse(args)
+	checkServers("servers", *nServers)
+
+	dist, err := parseDistributionFlag(*think)
+	exitOnError(err)
+	if *population < 1 {
+		exitOnError(fmt.Errorf("want a population of at least 1, got %d", *population))
+	}
+
+	// Every population sees the same think and service times.
+	endTime := startTime + *hours*60
+	sims := make([]*Simulation, *population)
+	for n := range sims {
+		sims[n] = NewSimulation(startTime, endTime, *nServers, 0, serverRate, seed, WithPopulation(n+1, dist))
+	}
+	results := simulateAll(sims)
+
+	// the asymptotic bounds of operational analysis: throughput is at most
+	// N/(D+Z) and c/D, which meet at the saturation population N*
+	d, z := 60/serverRate, dist.Mean()
+	fmt.Printf("Service Demand     : %.2f minutes (%d servers)\n", d, *nServers)
+	fmt.Printf("Think Time         : %.2f minutes on average\n", z)
+	fmt.Printf("Saturation         : N* = %.2f customers\n", float64(*nServers)*(d+z)/d)
+	fmt.Println("population,throughput,response_time,utilization,throughput_bound,response_time_law")
+	for n, r := range results {
+		// throughput per hour, and response time in minutes from the
+		// interactive response time law R = N/X - Z
+		x := float64(r.TotalCustomers-r.Abandoned) / float64(r.TotalTime) * 60
+		bound := min(float64(n+1)/(d+z), float64(*nServers)/d) * 60
+		fmt.Printf("%d,%.4f,%.4f,%.4f,%.4f,%.4f\n", n+1, x, r.Little.W, meanUtilization(r), bound, float64(n+1)/x*60-z)
+	}
+}
@@ -0,0 +1,131 @@
+package queue
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"strings"
+)
+
+// WithCutoff stops issuing tickets at time t, before the doors close at
+// endTime. Customers arriving from then on are turned away, while those
+// already inside are still served.
+func WithCutoff(t int) Option {
+	return func(s *Simulation) {
+		s.cutoff = t
+		s.hasCutoff = true
+	}
+}
+
+// ClosingPolicy says what happens to the customers inside when the doors
+// close at endTime. No one comes in after closing either way.
+type ClosingPolicy int
+
+const (
+	// ServeEveryone drains the line: the servers work overtime until every
+	// customer inside has been served.
+	ServeEveryone ClosingPolicy = iota
+	// SendAwayAtClose sends the customers still in line home, and the
+	// servers only finish the customers they are serving.
+	SendAwayAtClose
+)
+
+// WithClosingPolicy sets what happens at closing time, ServeEveryone
+// unless set.
+func WithClosingPolicy(p ClosingPolicy) Option {
+	return func(s *Simulation) {
+		s.closing = p
+	}
+}
+
+// sendAway sends the customers in line home at closing time t.
+func (r *run) sendAway(t int) {
+	lines := []*[]*Customer{&r.queue}
+	for j := range r.servers {
+		lines = append(lines, &r.servers[j].queue)
+	}
+	for _, q := range lines {
+		for _, c := range *q {
+			r.sentAway++
+			r.timeInSystem += t - c.ArrivalTime
+			r.leave(t)
+			r.event(CustomerSentAway, t, c)
+			if r.logs(LevelCustomer) {
+				r.logAttrs(LevelCustomer, "customer sent away", slog.Int("customer", c.Index), r.at(t), r.durationAttr("wait", t-c.ArrivalTime))
+			}
+		}
+		*q = nil
+	}
+}
+
+// admit reports whether a group of size customers arriving at time t gets
+// tickets.
+func (r *run) admit(t int, size int) bool {
+	if r.s.hasCutoff && t >= r.s.cutoff {
+		r.denied += size
+		return false
+	}
+	return true
+}
+
+func simulateCutoffs(seed int64, args []string) {
+	startTime := 8 * 60 // 08:00
+	endTime := 16 * 60  // 16:00
+	customerRate := 5.8 // 5.8 customers per hour
+	serverRate := 6.0   // 6 customers per hour, or 10 minutes per customer
+
+	fs := flag.NewFlagSet("cutoff", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	nServers := fs.Int("servers", 2, "number of servers")
+	times := fs.String("cutoffs", "15:00,15:30,15:45,16:00", "comma-separated last ticket times to compare")
+	reps := fs.Int("reps", 1000, "number of replications to average over")
+	closing := fs.String("closing", "serve", "at closing time, serve everyone inside or send-away those still in line")
+	fs.Parse(args)
+	checkServers("servers", *nServers)
+
+	policy := ServeEveryone
+	switch *closing {
+	case "serve":
+	case "send-away":
+		policy = SendAwayAtClose
+	default:
+		exitOnError(fmt.Errorf("unknown closing policy %q", *closing))
+	}
+	var cutoffs []int
+	for _, v := range strings.Split(*times, ",") {
+		t, err := parseTime(v)
+		exitOnError(err)
+		cutoffs = append(cutoffs, t)
+	}
+
+	// Every cutoff sees the same customers.
+	rng := rand.New(rand.NewSource(seed))
+	var sims []*Simulation
+	for range *reps {
+		seed := rng.Int63()
+		for _, t := range cutoffs {
+			sims = append(sims, NewSimulation(startTime, endTime, *nServers, customerRate, serverRate, seed, WithCutoff(t), WithClosingPolicy(policy)))
+		}
+	}
+	results := simulateAll(sims)
+
+	fmt.Printf("Closing time %s, %d servers, %d replications\n", formatTime(endTime), *nServers, *reps)
+	fmt.Println("cutoff,served,denied,overtime_minutes,overtime_probability,average_wait_time,sent_away")
+	n := float64(*reps)
+	for i, t := range cutoffs {
+		var served, denied, overtime, late, wait, sentAway float64
+		for k := i; k < len(results); k += len(cutoffs) {
+			r := results[k]
+			served += float64(r.TotalCustomers-r.SentAway) / n
+			sentAway += float64(r.SentAway) / n
+			denied += float64(r.Denied) / n
+			overtime += float64(r.Overtime) / n
+			wait += r.AverageWaitTime / n
+			if r.Overtime > 0 {
+				late += 1 / n
+			}
+		}
+		fmt.Printf("%s,%.2f,%.2f,%.2f,%.4f,%.4f,%.2f\n", formatTime(t), served, denied, overtime, late, wait, sentAway)
+	}
+}
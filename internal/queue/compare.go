@@ -0,0 +1,119 @@
+package queue
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// PairedDifference summarizes the differences between two configurations
+// run on the same seeds, one pair per replication.
+type PairedDifference struct {
+	Baseline, Value float64 // means
+	Difference      float64
+	Low, High       float64 // confidence interval of the difference
+	// VarianceReduction is how much smaller the variance of the paired
+	// difference is than that of independent runs would be.
+	VarianceReduction float64
+}
+
+// Significant reports whether the confidence interval excludes zero.
+func (d PairedDifference) Significant() bool {
+	return d.Low > 0 || d.High < 0
+}
+
+// pairedDifference compares b against a, paired by replication, with a
+// Student's t confidence interval at the given level.
+func pairedDifference(a, b []float64, level float64) PairedDifference {
+	diffs := make([]float64, len(a))
+	for i := range a {
+		diffs[i] = b[i] - a[i]
+	}
+	ma, va := meanVariance(a)
+	mb, vb := meanVariance(b)
+	md, vd := meanVariance(diffs)
+	half := tQuantile(1-(1-level)/2, len(diffs)-1) * math.Sqrt(vd/float64(len(diffs)))
+	d := PairedDifference{Baseline: ma, Value: mb, Difference: md, Low: md - half, High: md + half}
+	if va+vb > 0 {
+		d.VarianceReduction = 1 - vd/(va+vb)
+	}
+	return d
+}
+
+func compareScenarios(seed int64, args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	reps := fs.Int("reps", 1000, "number of replications, each run by every scenario")
+	level := fs.Float64("level", 0.95, "confidence level of the intervals")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: queue compare [flags] SCENARIO SCENARIO...\n\n"+
+			"A scenario is a list of key=value pairs such as servers=3,policy=fastest,\n"+
+			"with keys "+scenarioKeys+".\n"+
+			"The first scenario is the baseline.\n\nflags:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	specs := fs.Args()
+	if len(specs) == 0 {
+		specs = []string{"servers=2", "servers=3"}
+	}
+	if len(specs) < 2 || *reps < 2 || *level <= 0 || *level >= 1 {
+		fs.Usage()
+		exitOnError(fmt.Errorf("need two or more scenarios, -reps >= 2 and 0 < -level < 1"))
+	}
+	var scenarios []Scenario
+	for _, spec := range specs {
+		sc, err := parseScenario(spec)
+		exitOnError(err)
+		sim, _ := sc.Simulation() // checked by parseScenario
+		warnUnstable(spec, sim)
+		scenarios = append(scenarios, sc)
+	}
+
+	// Common random numbers: replication k of every scenario uses the same
+	// seed, so all scenarios see the same arrivals and, server for server,
+	// the same service times.
+	rng := rand.New(rand.NewSource(seed))
+	var sims []*Simulation
+	for range *reps {
+		seed := rng.Int63()
+		for _, sc := range scenarios {
+			sc.Seed = seed
+			sim, _ := sc.Simulation() // checked by parseScenario
+			sims = append(sims, sim)
+		}
+	}
+	results := simulateAll(sims)
+
+	metrics := []struct {
+		name  string
+		value func(SimulationResult) float64
+	}{
+		{"customers", func(r SimulationResult) float64 { return float64(r.TotalCustomers) }},
+		{"average_wait_time", func(r SimulationResult) float64 { return r.AverageWaitTime }},
+		{"p90_wait_time", func(r SimulationResult) float64 { return float64(r.WaitQuantile(0.9)) }},
+		{"utilization", meanUtilization},
+		{"overtime_minutes", func(r SimulationResult) float64 { return float64(r.Overtime) }},
+	}
+	values := func(i int, f func(SimulationResult) float64) []float64 {
+		var xs []float64
+		for k := i; k < len(results); k += len(scenarios) {
+			xs = append(xs, f(results[k]))
+		}
+		return xs
+	}
+
+	fmt.Printf("Baseline           : %s\n", specs[0])
+	fmt.Printf("Replications       : %d, common random numbers\n", *reps)
+	fmt.Printf("Confidence Level   : %.0f%%\n", *level*100)
+	fmt.Println()
+	fmt.Println("scenario,metric,baseline,value,difference,ci_low,ci_high,significant,variance_reduction")
+	for i, spec := range specs[1:] {
+		for _, m := range metrics {
+			d := pairedDifference(values(0, m.value), values(i+1, m.value), *level)
+			fmt.Printf("%q,%s,%.4f,%.4f,%.4f,%.4f,%.4f,%t,%.4f\n", spec, m.name, d.Baseline, d.Value, d.Difference, d.Low, d.High, d.Significant(), d.VarianceReduction)
+		}
+	}
+}
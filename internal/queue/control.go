@@ -0,0 +1,261 @@
+package queue
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PolicyView is what an AdmissionPolicy or a RoutingPolicy sees of the
+// system when it decides. It is only valid during the call.
+type PolicyView struct {
+	r *run
+	t int
+}
+
+// Time returns the time of the decision, in minutes since midnight.
+func (v PolicyView) Time() float64 {
+	return v.r.s.minutes(v.t) - float64(v.r.s.day*24*60)
+}
+
+// Waiting returns the number of customers in line, in the shared line and
+// those of the servers.
+func (v PolicyView) Waiting() int {
+	n := len(v.r.queue)
+	for _, sv := range v.r.servers {
+		n += len(sv.queue)
+	}
+	return n
+}
+
+// InSystem returns the number of customers in the system.
+func (v PolicyView) InSystem() int {
+	return v.r.inSystem
+}
+
+// Servers returns the number of servers.
+func (v PolicyView) Servers() int {
+	return len(v.r.servers)
+}
+
+// Available reports whether server j is on duty and working.
+func (v PolicyView) Available(j int) bool {
+	return v.r.available(j)
+}
+
+// Serving returns the number of customers in service at server j.
+func (v PolicyView) Serving(j int) int {
+	return len(v.r.servers[j].batch)
+}
+
+// Line returns the length of server j's own line, with separate queues.
+func (v PolicyView) Line(j int) int {
+	return len(v.r.servers[j].queue)
+}
+
+// BusyTime returns the minutes of service server j has taken on so far,
+// including all of the service under way.
+func (v PolicyView) BusyTime(j int) float64 {
+	return v.r.s.minutes(v.r.busyTime[j])
+}
+
+// IdleSince returns when server j last finished a service, in minutes
+// since midnight, or the start if it has not yet.
+func (v PolicyView) IdleSince(j int) float64 {
+	return v.r.s.minutes(max(v.r.servers[j].freeAt, v.r.s.startTime)) - float64(v.r.s.day*24*60)
+}
+
+// ServiceRate returns the service rate of server j, in customers per hour.
+func (v PolicyView) ServiceRate(j int) float64 {
+	return v.r.s.serverRates[j]
+}
+
+// State returns the whole state of the system, which takes longer than the
+// other methods.
+func (v PolicyView) State() State {
+	return v.r.state(v.t)
+}
+
+// AdmissionPolicy decides whether an arriving customer may come in. It is
+// asked after the cutoff and before the OnArrival hook; a customer turned
+// away is counted in the result's Denied.
+type AdmissionPolicy interface {
+	Admit(v PolicyView, c Customer) bool
+}
+
+// RoutingPolicy decides which server takes customer c, in place of the
+// ServerSelectionPolicy. With a shared line the candidates are the idle
+// servers, in increasing order, and the policy may return -1 to leave the
+// customer waiting for now: it is asked again as customers arrive and
+// servers finish, and a customer is never left waiting while no server is
+// serving anyone. With separate queues the candidates are the servers with
+// the shortest lines, and with processor sharing those with the fewest
+// customers, and -1 means the first of them.
+type RoutingPolicy interface {
+	Route(v PolicyView, c Customer, candidates []int) int
+}
+
+// WithAdmission lets the admission policy p decide who comes in.
+func WithAdmission(p AdmissionPolicy) Option {
+	return func(s *Simulation) {
+		s.admission = p
+	}
+}
+
+// WithRouting lets the routing policy p decide which server takes whom.
+func WithRouting(p RoutingPolicy) Option {
+	return func(s *Simulation) {
+		s.routing = p
+	}
+}
+
+// MaxLine turns customers away once N are waiting, as customers balk at a
+// long line.
+type MaxLine struct{ N int }
+
+func (p MaxLine) Admit(v PolicyView, c Customer) bool {
+	return v.Waiting() < p.N
+}
+
+// MaxInSystem turns customers away once N are in the system, in line or in
+// service, as in an M/M/c/N queue with room for N.
+type MaxInSystem struct{ N int }
+
+func (p MaxInSystem) Admit(v PolicyView, c Customer) bool {
+	return v.InSystem() < p.N
+}
+
+// Reservation turns customers of the given classes of the catalog away
+// once Line customers are waiting, keeping the rest of the line for the
+// other classes.
+type Reservation struct {
+	Line    int
+	Classes []int
+}
+
+func (p Reservation) Admit(v PolicyView, c Customer) bool {
+	return v.Waiting() < p.Line || !slices.Contains(p.Classes, c.Class)
+}
+
+// ThresholdActivation keeps the servers numbered Base and up in reserve:
+// they only take a customer from the shared line while at least Line
+// customers are waiting, counting that customer, and go back to reserve
+// once the line is shorter when they finish.
+type ThresholdActivation struct {
+	Base, Line int
+}
+
+func (p ThresholdActivation) Route(v PolicyView, c Customer, candidates []int) int {
+	if candidates[0] < p.Base || v.Waiting() >= p.Line {
+		return candidates[0]
+	}
+	return -1
+}
+
+// LongestIdle picks the server that has been idle the longest, spreading
+// the work evenly.
+type LongestIdle struct{}
+
+func (LongestIdle) Route(v PolicyView, c Customer, candidates []int) int {
+	chosen := candidates[0]
+	for _, j := range candidates {
+		if v.IdleSince(j) < v.IdleSince(chosen) {
+			chosen = j
+		}
+	}
+	return chosen
+}
+
+// PreferenceOrder picks the first server of Order among the candidates, and
+// a server left out of Order only if there is no other.
+type PreferenceOrder struct{ Order []int }
+
+func (p PreferenceOrder) Route(v PolicyView, c Customer, candidates []int) int {
+	for _, j := range p.Order {
+		if slices.Contains(candidates, j) {
+			return j
+		}
+	}
+	return candidates[0]
+}
+
+// ParseAdmissionPolicy parses an admission policy given as NAME,PARAMS...:
+// max-line,N, max-in-system,N or reserve,LINE,CLASS... with the indices of
+// the classes in the catalog.
+func ParseAdmissionPolicy(spec string) (AdmissionPolicy, error) {
+	name, params, err := policyParams(spec)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case name == "max-line" && len(params) == 1:
+		return MaxLine{params[0]}, nil
+	case name == "max-in-system" && len(params) == 1:
+		return MaxInSystem{params[0]}, nil
+	case name == "reserve" && len(params) >= 2:
+		return Reservation{Line: params[0], Classes: params[1:]}, nil
+	}
+	return nil, fmt.Errorf("unknown admission policy %q, want max-line,N, max-in-system,N or reserve,LINE,CLASS...", spec)
+}
+
+// ParseRoutingPolicy parses a routing policy given as NAME,PARAMS...:
+// threshold,BASE,LINE, longest-idle or order,SERVER....
+func ParseRoutingPolicy(spec string) (RoutingPolicy, error) {
+	name, params, err := policyParams(spec)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case name == "threshold" && len(params) == 2:
+		return ThresholdActivation{Base: params[0], Line: params[1]}, nil
+	case name == "longest-idle" && len(params) == 0:
+		return LongestIdle{}, nil
+	case name == "order" && len(params) > 0:
+		return PreferenceOrder{Order: params}, nil
+	}
+	return nil, fmt.Errorf("unknown routing policy %q, want threshold,BASE,LINE, longest-idle or order,SERVER...", spec)
+}
+
+// policyParams splits NAME,PARAMS... into the name and the parameters, all
+// non-negative integers.
+func policyParams(spec string) (string, []int, error) {
+	parts := strings.Split(spec, ",")
+	var params []int
+	for _, p := range parts[1:] {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return "", nil, fmt.Errorf("invalid policy %q, want NAME,N...", spec)
+		}
+		params = append(params, n)
+	}
+	return parts[0], params, nil
+}
+
+// route picks which of candidates takes customer c at time t, with the
+// routing policy, or else the server selection policy. It returns -1 for
+// the customer to wait, if mayWait and some server is serving.
+func (r *run) route(t int, c *Customer, candidates []int, mayWait bool) int {
+	p := r.s.routing
+	if p == nil {
+		return r.s.selectServer(candidates, r.busyTime)
+	}
+	j := p.Route(PolicyView{r, t}, *c, candidates)
+	if slices.Contains(candidates, j) {
+		return j
+	}
+	if j < 0 && mayWait && r.serving() {
+		return -1
+	}
+	return candidates[0]
+}
+
+// serving reports whether any server is serving customers.
+func (r *run) serving() bool {
+	for j := range r.servers {
+		if len(r.servers[j].batch) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package queue
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+)
+
+// CostModel prices a run: every server costs ServerHour per scheduled hour,
+// and every customer costs WaitMinute per minute spent waiting, whether
+// served in the end or not.
+type CostModel struct {
+	ServerHour float64
+	WaitMinute float64
+}
+
+// Cost is the cost of a run, split into its parts.
+type Cost struct {
+	Servers, Waiting, Total float64
+}
+
+func (m CostModel) Cost(r SimulationResult) Cost {
+	hours, served := float64(0), 0
+	for _, sv := range r.Servers {
+		hours += float64(sv.ScheduledTime) / 60
+		served += sv.Customers
+	}
+	wait := r.AverageWaitTime*float64(served) + r.AverageAbandonWait*float64(r.Abandoned)
+	c := Cost{Servers: m.ServerHour * hours, Waiting: m.WaitMinute * wait}
+	c.Total = c.Servers + c.Waiting
+	return c
+}
+
+func simulateCosts(seed int64, args []string) {
+	startTime := 8 * 60 // 08:00
+	endTime := 16 * 60  // 16:00
+
+	fs := flag.NewFlagSet("cost", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	serverCost := fs.Float64("server-cost", 25.0, "cost of a server per hour")
+	waitCost := fs.Float64("wait-cost", 0.5, "cost of a customer waiting a minute")
+	customerRate := fs.Float64("rate", 30.0, "arrival rate, in customers per hour")
+	serverRate := fs.Float64("service-rate", 6.0, "service rate of a server, in customers per hour")
+	minServers := fs.Int("min-servers", 1, "smallest number of servers to try")
+	maxServers := fs.Int("max-servers", 12, "largest number of servers to try")
+	reps := fs.Int("reps", 200, "number of replications to average over")
+	fs.Parse(args)
+
+	if *minServers < 1 || *maxServers < *minServers {
+		exitOnError(fmt.Errorf("need 1 <= -min-servers <= -max-servers"))
+	}
+	model := CostModel{ServerHour: *serverCost, WaitMinute: *waitCost}
+
+	// Every number of servers sees the same customers.
+	rng := rand.New(rand.NewSource(seed))
+	span := *maxServers - *minServers + 1
+	var sims []*Simulation
+	for range *reps {
+		seed := rng.Int63()
+		for n := *minServers; n <= *maxServers; n++ {
+			sims = append(sims, NewSimulation(startTime, endTime, n, *customerRate, *serverRate, seed))
+		}
+	}
+	results := simulateAll(sims)
+
+	fmt.Printf("Arrival Rate       : %.2f customers/hour\n", *customerRate)
+	fmt.Printf("Service Rate       : %.2f customers/hour per server\n", *serverRate)
+	fmt.Printf("Costs              : %.2f per server hour, %.2f per customer minute waited\n", *serverCost, *waitCost)
+	fmt.Printf("Replications       : %d\n", *reps)
+	fmt.Println()
+	fmt.Println("servers,average_wait_time,server_cost,waiting_cost,total_cost")
+	best, bestCost := 0, float64(0)
+	n := float64(*reps)
+	for i := range span {
+		var wait float64
+		var cost Cost
+		for k := i; k < len(results); k += span {
+			c := model.Cost(results[k])
+			wait += results[k].AverageWaitTime / n
+			cost.Servers += c.Servers / n
+			cost.Waiting += c.Waiting / n
+			cost.Total += c.Total / n
+		}
+		if best == 0 || cost.Total < bestCost {
+			best, bestCost = *minServers+i, cost.Total
+		}
+		fmt.Printf("%d,%.4f,%.2f,%.2f,%.2f\n", *minServers+i, wait, cost.Servers, cost.Waiting, cost.Total)
+	}
+	fmt.Println()
+	fmt.Printf("Cheapest           : %d servers at %.2f per day\n", best, bestCost)
+}
@@ -0,0 +1,179 @@
+package queue
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Covariate multiplies the arrival and the service rates between Start
+// (inclusive) and End (exclusive), in minutes since midnight, as measured
+// demand or an outside influence such as the weather changes them: an
+// Arrival of 1.2 brings 20% more customers, and a Service of 0.8 makes
+// services that start then take 25% longer.
+type Covariate struct {
+	Start, End       int
+	Arrival, Service float64
+}
+
+// WithCovariates modulates the arrival rate, or that of the arrival profile
+// where one is set, and the service rates by the covariates. Where
+// covariates overlap the first applies, and outside them the rates are
+// unchanged.
+func WithCovariates(covariates ...Covariate) Option {
+	return func(s *Simulation) {
+		s.covariates = append(s.covariates, covariates...)
+	}
+}
+
+// ReadCovariates reads covariates from CSV with a header line and the
+// columns time, as HH:MM, and arrival and service, the multipliers, of which
+// either may be left out for 1. A row applies from its time until that of
+// the next, and the last one until midnight, e.g. hourly
+//
+//	time,arrival,service
+//	08:00,0.6,1
+//	09:00,1.1,1
+//	10:00,1.4,0.9
+func ReadCovariates(r io.Reader) ([]Covariate, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("no covariates")
+	}
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["time"]; !ok {
+		return nil, fmt.Errorf("want a header with time and arrival or service, got %s", strings.Join(records[0], ","))
+	}
+	multiplier := func(rec []string, name string) (float64, error) {
+		i, ok := columns[name]
+		if !ok {
+			return 1, nil
+		}
+		m, err := strconv.ParseFloat(strings.TrimSpace(rec[i]), 64)
+		if err != nil || m < 0 {
+			return 0, fmt.Errorf("invalid %s multiplier %q", name, rec[i])
+		}
+		return m, nil
+	}
+
+	var covariates []Covariate
+	for i, rec := range records[1:] {
+		t, err := parseTime(rec[columns["time"]])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+2, err)
+		}
+		if n := len(covariates); n > 0 && t <= covariates[n-1].Start {
+			return nil, fmt.Errorf("line %d: times must increase", i+2)
+		}
+		c := Covariate{Start: t, End: 24 * 60}
+		if c.Arrival, err = multiplier(rec, "arrival"); err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+2, err)
+		}
+		if c.Service, err = multiplier(rec, "service"); err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+2, err)
+		}
+		if c.Service == 0 {
+			return nil, fmt.Errorf("line %d: service multiplier must be positive", i+2)
+		}
+		if n := len(covariates); n > 0 {
+			covariates[n-1].End = t
+		}
+		covariates = append(covariates, c)
+	}
+	return covariates, nil
+}
+
+// LoadCovariates reads covariates from a CSV file, see ReadCovariates.
+func LoadCovariates(path string) ([]Covariate, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	covariates, err := ReadCovariates(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return covariates, nil
+}
+
+// NormalizeCovariates divides the arrival and the service multipliers by
+// their means over the covariates, so that a raw signal, such as hourly
+// foot-traffic counts, shapes the rates over the day while the base rates
+// stay their average. The covariates should be of equal length.
+func NormalizeCovariates(covariates []Covariate) []Covariate {
+	var arrival, service float64
+	for _, c := range covariates {
+		arrival += c.Arrival
+		service += c.Service
+	}
+	n := float64(len(covariates))
+	normalized := slices.Clone(covariates)
+	for i := range normalized {
+		if arrival > 0 {
+			normalized[i].Arrival *= n / arrival
+		}
+		normalized[i].Service *= n / service
+	}
+	return normalized
+}
+
+// modulateArrivals puts the covariates into the arrival profile: within
+// each, the rate of the profile, or the common customerRate, times the
+// multiplier. The new periods come first, to take precedence.
+func (s *Simulation) modulateArrivals() {
+	if len(s.covariates) == 0 {
+		return
+	}
+	var periods []RatePeriod
+	for _, c := range s.covariates {
+		// the profile changes rate at these times within c
+		cuts := []int{c.Start, c.End}
+		for _, p := range s.profile {
+			for _, t := range []int{p.Start, p.End} {
+				if t > c.Start && t < c.End {
+					cuts = append(cuts, t)
+				}
+			}
+		}
+		slices.Sort(cuts)
+		cuts = slices.Compact(cuts)
+		for i := 0; i+1 < len(cuts); i++ {
+			periods = append(periods, RatePeriod{Start: cuts[i], End: cuts[i+1], Rate: s.rateAt(cuts[i]) * c.Arrival})
+		}
+	}
+	s.profile = append(periods, s.profile...)
+}
+
+// rateAt returns the arrival rate at time t by the profile, or else the
+// common customerRate.
+func (s *Simulation) rateAt(t int) float64 {
+	for _, p := range s.profile {
+		if t >= p.Start && t < p.End {
+			return p.Rate
+		}
+	}
+	return s.customerRate
+}
+
+// serviceFactor returns the multiplier of the service rate for services
+// starting at time t.
+func (s *Simulation) serviceFactor(t int) float64 {
+	for _, c := range s.covariates {
+		if t >= c.Start && t < c.End {
+			return c.Service
+		}
+	}
+	return 1
+}
@@ -0,0 +1,28 @@
+package queue
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+)
+
+//go:embed dashboard.html
+var dashboardHTML string
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(dashboardHTML))
+
+// dashboard serves a page that runs scenarios through /simulate and charts
+// the line over time, the waits and the utilization of the servers, for
+// demonstrations without any other tools.
+func (srv *simulationServer) dashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	data := struct {
+		Scenario
+		Policies []string
+	}{srv.defaults(), serverSelectionPolicyNames}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	dashboardTemplate.Execute(w, data)
+}
@@ -0,0 +1,190 @@
+package queue
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WithDay places the simulation on the given day, counted from 0: its
+// startTime, endTime and every other time of day given in minutes are moved
+// by that many days, so that the days of a multi-day run keep apart in
+// logs, events and results, which read "day N HH:MM".
+func WithDay(day int) Option {
+	return func(s *Simulation) {
+		s.day = day
+	}
+}
+
+// WithArrivalMultiplier multiplies the arrival rate, and the rates of the
+// arrival profile, by m, such as 1.5 for a busy Saturday.
+func WithArrivalMultiplier(m float64) Option {
+	return func(s *Simulation) {
+		s.multiplier = m
+	}
+}
+
+// scaleRates applies the multiplier to the arrival rates.
+func (s *Simulation) scaleRates() {
+	s.customerRate *= s.multiplier
+	profile := make([]RatePeriod, len(s.profile))
+	for i, p := range s.profile {
+		profile[i] = RatePeriod{Start: p.Start, End: p.End, Rate: p.Rate * s.multiplier}
+	}
+	s.profile = profile
+}
+
+// Week holds a multiplier of the arrival rates for every day of the week,
+// indexed by time.Weekday.
+type Week [7]float64
+
+// NewWeek returns a week where every day has a multiplier of 1.
+func NewWeek() Week {
+	return Week{1, 1, 1, 1, 1, 1, 1}
+}
+
+// Days returns the simulations of n consecutive days from the weekday
+// first, each made by newDay with the options that place it on its day and
+// scale its arrivals by the multiplier of its weekday. The business closes
+// every night after serving everyone inside, so the days are independent
+// and can run in parallel.
+func (w Week) Days(n int, first time.Weekday, newDay func(day int, opts ...Option) *Simulation) []*Simulation {
+	sims := make([]*Simulation, n)
+	for d := range sims {
+		sims[d] = newDay(d, WithDay(d), WithArrivalMultiplier(w[(int(first)+d)%7]))
+	}
+	return sims
+}
+
+// parseWeekday accepts the English name of a day of the week or its first
+// three letters, in any case.
+func parseWeekday(s string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if l := strings.ToLower(s); l == name || l == name[:3] {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown day of the week %q", s)
+}
+
+// weekFlag parses repeated "DAY=MULTIPLIER" command line values into a
+// Week.
+type weekFlag struct{ week Week }
+
+func (f *weekFlag) String() string { return "" }
+
+func (f *weekFlag) Set(v string) error {
+	day, m, ok := strings.Cut(v, "=")
+	if !ok {
+		return fmt.Errorf("want DAY=MULTIPLIER, got %q", v)
+	}
+	d, err := parseWeekday(day)
+	if err != nil {
+		return err
+	}
+	x, err := strconv.ParseFloat(m, 64)
+	if err != nil || x < 0 {
+		return fmt.Errorf("invalid multiplier %q", m)
+	}
+	f.week[d] = x
+	return nil
+}
+
+// profileFlag parses repeated "HH:MM-HH:MM=RATE" command line values into
+// an arrival profile.
+type profileFlag []RatePeriod
+
+func (f *profileFlag) String() string { return "" }
+
+func (f *profileFlag) Set(v string) error {
+	window, rate, ok := strings.Cut(v, "=")
+	from, to, ok2 := strings.Cut(window, "-")
+	if !ok || !ok2 {
+		return fmt.Errorf("want HH:MM-HH:MM=RATE, got %q", v)
+	}
+	start, err := parseTime(from)
+	if err != nil {
+		return err
+	}
+	end, err := parseTime(to)
+	if err != nil {
+		return err
+	}
+	x, err := strconv.ParseFloat(rate, 64)
+	if err != nil || x < 0 {
+		return fmt.Errorf("invalid rate %q", rate)
+	}
+	*f = append(*f, RatePeriod{Start: start, End: end, Rate: x})
+	return nil
+}
+
+func simulateDays(seed int64, args []string) {
+	startTime := 8 * 60 // 08:00
+	endTime := 16 * 60  // 16:00
+	serverRate := 6.0   // 6 customers per hour, or 10 minutes per customer
+
+	week := weekFlag{NewWeek()}
+	week.week[time.Saturday] = 1.5
+	week.week[time.Sunday] = 0.5
+	var profile profileFlag
+
+	fs := flag.NewFlagSet("days", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	nServers := fs.Int("servers", 2, "number of servers")
+	customerRate := fs.Float64("rate", 5.8, "arrival rate outside the profile, in customers per hour")
+	nDays := fs.Int("days", 14, "number of days")
+	firstDay := fs.String("first", "monday", "day of the week of the first day")
+	fs.Var(&week, "weekday", "arrival rate multiplier of a day of the week as `DAY=MULTIPLIER`, by default sat=1.5 and sun=0.5; repeatable")
+	fs.Var(&profile, "profile", "arrival rate of a part of every day as `HH:MM-HH:MM=RATE`; repeatable")
+	reps := fs.Int("reps", 100, "number of replications of the whole run to average over")
+	fs.Parse(args)
+	checkServers("servers", *nServers)
+
+	first, err := parseWeekday(*firstDay)
+	exitOnError(err)
+	if *nDays < 1 {
+		exitOnError(fmt.Errorf("want at least one day, got %d", *nDays))
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	var sims []*Simulation
+	for range *reps {
+		sims = append(sims, week.week.Days(*nDays, first, func(day int, opts ...Option) *Simulation {
+			opts = append(opts, WithArrivalProfile(profile...))
+			return NewSimulation(startTime, endTime, *nServers, *customerRate, serverRate, rng.Int63(), opts...)
+		})...)
+	}
+	results := simulateAll(sims)
+
+	fmt.Printf("Days               : %d from %s, open %s-%s\n", *nDays, first, formatTime(startTime), formatTime(endTime))
+	fmt.Printf("Replications       : %d\n", *reps)
+	fmt.Println("day,weekday,multiplier,total_customers,average_wait_time,p90_wait_time,utilization,overtime")
+	var all histogram
+	var customers, utilization, overtime float64
+	for d := range *nDays {
+		var waits histogram
+		var day []SimulationResult
+		for i := d; i < len(results); i += *nDays {
+			day = append(day, results[i])
+			waits.merge(results[i].waits)
+		}
+		all.merge(waits)
+		n := average(day, func(r SimulationResult) float64 { return float64(r.TotalCustomers) })
+		util := average(day, meanUtilization)
+		over := average(day, func(r SimulationResult) float64 { return float64(r.Overtime) })
+		customers += n
+		utilization += util / float64(*nDays)
+		overtime += over
+		wd := time.Weekday((int(first) + d) % 7)
+		fmt.Printf("%d,%s,%.2f,%.2f,%.4f,%d,%.4f,%.2f\n", d+1, wd, week.week[wd], n, ratio(waits.sum, waits.n), waits.quantile(0.9), util, over)
+	}
+	fmt.Printf("Total Customers    : %.2f (%.2f per day)\n", customers, customers/float64(*nDays))
+	fmt.Printf("Average WaitTime   : %.6f minutes\n", all.mean())
+	fmt.Printf("P90 WaitTime       : %d minutes\n", all.quantile(0.9))
+	fmt.Printf("Utilization        : %.4f\n", utilization)
+	fmt.Printf("Overtime           : %.2f minutes in total\n", overtime)
+}
@@ -0,0 +1,613 @@
+package queue
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ServiceDistribution is a distribution of service times, in minutes, that
+// draws from a random stream owned by the caller. This lets every server
+// keep its own stream whatever is being served.
+type ServiceDistribution interface {
+	Sample(rng *rand.Rand) float64
+	Mean() float64
+}
+
+// Sample draws from the exponential distribution using rng.
+func (e *Exponential) Sample(rng *rand.Rand) float64 {
+	r := rng.Float64()
+	// Only midpoints within band of the inverse x need the CDF to tell which
+	// side of r they are on, far wider than the error of either, so the
+	// draws stay those of the bisection on the CDF alone at a fraction of
+	// the calls to math.Exp.
+	x := -math.Log1p(-r) / e.lambda
+	band := (1e-12 + 1e-13/(1-r)) / e.lambda
+	L := float64(0)
+	R := float64(1e100)
+	// the midpoints halve R for as long as they lie above x+band, so skip
+	// to the last of those halvings at once
+	if hi := x + band; hi > epsilon && hi < R {
+		if k := int(math.Log2(R/hi)) - 1; k > 0 {
+			R = math.Ldexp(R, -k)
+		}
+	}
+	for R-L > epsilon {
+		mid := (L + R) * 0.5
+		below := mid < x-band
+		if mid <= x+band && !below {
+			below = float64(1)-math.Exp(-e.lambda*mid) < r
+		}
+		if below {
+			L = mid
+		} else {
+			R = mid
+		}
+	}
+	return L
+}
+
+func (e *Exponential) Mean() float64 {
+	return 1 / e.lambda
+}
+
+func (e *Exponential) CDF(x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	return 1 - math.Exp(-e.lambda*x)
+}
+
+func (e *Exponential) SCV() float64 {
+	return 1
+}
+
+func (e *Exponential) String() string {
+	return fmt.Sprintf("exp(%g)", e.Mean())
+}
+
+// Deterministic is a constant time Value, such as an automated kiosk's,
+// give or take uniform noise of up to Noise either way.
+type Deterministic struct {
+	Value, Noise float64
+}
+
+func (d Deterministic) Sample(rng *rand.Rand) float64 {
+	if d.Noise == 0 {
+		return d.Value
+	}
+	return d.Value + d.Noise*(2*rng.Float64()-1)
+}
+
+func (d Deterministic) Mean() float64 {
+	return d.Value
+}
+
+func (d Deterministic) SCV() float64 {
+	return d.Noise * d.Noise / 3 / (d.Value * d.Value)
+}
+
+func (d Deterministic) String() string {
+	if d.Noise == 0 {
+		return fmt.Sprintf("const(%g)", d.Value)
+	}
+	return fmt.Sprintf("const(%g±%g)", d.Value, d.Noise)
+}
+
+// Uniform is the continuous uniform distribution on [Min, Max].
+type Uniform struct {
+	Min, Max float64
+}
+
+func (u Uniform) Sample(rng *rand.Rand) float64 {
+	return u.Min + (u.Max-u.Min)*rng.Float64()
+}
+
+func (u Uniform) Mean() float64 {
+	return (u.Min + u.Max) / 2
+}
+
+func (u Uniform) SCV() float64 {
+	m := u.Mean()
+	return (u.Max - u.Min) * (u.Max - u.Min) / 12 / (m * m)
+}
+
+func (u Uniform) String() string {
+	return fmt.Sprintf("uniform(%g,%g)", u.Min, u.Max)
+}
+
+// LogNormal is the log-normal distribution with the given mean and standard
+// deviation, a common fit for transaction durations.
+type LogNormal struct {
+	mean, sd float64
+	mu, sig  float64
+}
+
+func NewLogNormal(mean, sd float64) *LogNormal {
+	sig2 := math.Log(1 + sd*sd/(mean*mean))
+	return &LogNormal{
+		mean: mean,
+		sd:   sd,
+		mu:   math.Log(mean) - sig2/2,
+		sig:  math.Sqrt(sig2),
+	}
+}
+
+func (l *LogNormal) Sample(rng *rand.Rand) float64 {
+	return math.Exp(l.mu + l.sig*rng.NormFloat64())
+}
+
+func (l *LogNormal) Mean() float64 {
+	return l.mean
+}
+
+func (l *LogNormal) SCV() float64 {
+	return l.sd * l.sd / (l.mean * l.mean)
+}
+
+func (l *LogNormal) String() string {
+	return fmt.Sprintf("lognormal(%g,%g)", l.mean, l.sd)
+}
+
+// Empirical is the distribution of observed values. It either resamples
+// the observations, or with interpolation draws from the piecewise linear
+// quantile function through them, which also gives values in between.
+type Empirical struct {
+	values      []float64 // sorted
+	interpolate bool
+	mean        float64
+}
+
+func NewEmpirical(values []float64, interpolate bool) (*Empirical, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("empirical: no observations")
+	}
+	e := &Empirical{values: append([]float64(nil), values...), interpolate: interpolate}
+	for _, v := range e.values {
+		if !validMinutes(v) {
+			return nil, fmt.Errorf("empirical: observation %g is not from 0 to %g", v, maxMinutes)
+		}
+	}
+	sort.Float64s(e.values)
+	n := len(e.values)
+	sum := float64(0)
+	for _, v := range e.values {
+		sum += v
+	}
+	e.mean = sum / float64(n)
+	if interpolate && n > 1 {
+		// the quantile function is linear between observations, so the
+		// end points only count half
+		e.mean = (sum - (e.values[0]+e.values[n-1])/2) / float64(n-1)
+	}
+	return e, nil
+}
+
+// ReadEmpirical reads observations, one per line, taking the first column
+// of CSV lines. Lines that are not a number, like a header, are skipped.
+func ReadEmpirical(r io.Reader, interpolate bool) (*Empirical, error) {
+	var values []float64
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		field, _, _ := strings.Cut(sc.Text(), ",")
+		if v, err := strconv.ParseFloat(strings.TrimSpace(field), 64); err == nil {
+			values = append(values, v)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return NewEmpirical(values, interpolate)
+}
+
+// LoadEmpirical reads observations from a file, see ReadEmpirical.
+func LoadEmpirical(path string, interpolate bool) (*Empirical, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	e, err := ReadEmpirical(f, interpolate)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return e, nil
+}
+
+func (e *Empirical) Sample(rng *rand.Rand) float64 {
+	if !e.interpolate || len(e.values) == 1 {
+		return e.values[rng.Intn(len(e.values))]
+	}
+	pos := rng.Float64() * float64(len(e.values)-1)
+	i := int(pos)
+	return e.values[i] + (pos-float64(i))*(e.values[i+1]-e.values[i])
+}
+
+func (e *Empirical) Mean() float64 {
+	return e.mean
+}
+
+func (e *Empirical) String() string {
+	if e.interpolate {
+		return fmt.Sprintf("empirical(%d observations, interpolated)", len(e.values))
+	}
+	return fmt.Sprintf("empirical(%d observations)", len(e.values))
+}
+
+// Hyperexponential is a mixture of exponential distributions: with
+// probability Probs[i] a time is drawn from the exponential distribution of
+// mean Means[i]. Its squared coefficient of variation is at least 1, so it
+// models service times more variable than the exponential, such as mostly
+// quick transactions with the odd very long one.
+type Hyperexponential struct {
+	Probs, Means []float64
+}
+
+// NewHyperexponential returns the mixture of exponentials of the given
+// means with the given branch probabilities, which must add up to 1.
+func NewHyperexponential(probs, means []float64) (*Hyperexponential, error) {
+	if len(probs) == 0 || len(probs) != len(means) {
+		return nil, fmt.Errorf("hyperexp: want as many probabilities as means")
+	}
+	sum := float64(0)
+	for i, p := range probs {
+		if means[i] <= 0 {
+			return nil, fmt.Errorf("hyperexp: mean %g is not positive", means[i])
+		}
+		sum += p
+	}
+	if math.Abs(sum-1) > 1e-6 {
+		return nil, fmt.Errorf("hyperexp: probabilities add up to %g, not 1", sum)
+	}
+	return &Hyperexponential{Probs: probs, Means: means}, nil
+}
+
+func (h *Hyperexponential) Sample(rng *rand.Rand) float64 {
+	u := rng.Float64()
+	i := 0
+	for ; i < len(h.Probs)-1 && u >= h.Probs[i]; i++ {
+		u -= h.Probs[i]
+	}
+	return -h.Means[i] * math.Log(1-rng.Float64())
+}
+
+func (h *Hyperexponential) Mean() float64 {
+	m := float64(0)
+	for i, p := range h.Probs {
+		m += p * h.Means[i]
+	}
+	return m
+}
+
+// SCV returns the squared coefficient of variation, the variance over the
+// squared mean.
+func (h *Hyperexponential) SCV() float64 {
+	m2 := float64(0)
+	for i, p := range h.Probs {
+		m2 += 2 * p * h.Means[i] * h.Means[i]
+	}
+	m := h.Mean()
+	return m2/(m*m) - 1
+}
+
+func (h *Hyperexponential) String() string {
+	var b strings.Builder
+	for i, p := range h.Probs {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%g:%g", p, h.Means[i])
+	}
+	return fmt.Sprintf("hyperexp(%s)", b.String())
+}
+
+// PhaseType is the distribution of the time a customer takes to pass
+// through a network of exponential phases: it starts in phase i with
+// probability Initial[i], spends a time of mean Means[i] there, then moves
+// to phase j with probability Next[i][j] or is done with the probability
+// left over. Any positive distribution can be approximated this way, and
+// the Erlang, hyperexponential and Coxian distributions are special cases.
+// The time is 0 with the probability that Initial leaves over.
+type PhaseType struct {
+	Initial []float64
+	Means   []float64
+	Next    [][]float64
+
+	mean, scv float64
+}
+
+// NewPhaseType checks the phases, every one of which must eventually lead
+// out, and returns their distribution.
+func NewPhaseType(initial, means []float64, next [][]float64) (*PhaseType, error) {
+	n := len(initial)
+	if n == 0 || len(means) != n || len(next) != n {
+		return nil, fmt.Errorf("phase-type: want the same number of phases throughout")
+	}
+	if sum := sumOf(initial); sum > 1+1e-6 {
+		return nil, fmt.Errorf("phase-type: initial probabilities add up to %g, more than 1", sum)
+	}
+	for i, row := range next {
+		if len(row) != n {
+			return nil, fmt.Errorf("phase-type: phase %d has %d next phases, want %d", i+1, len(row), n)
+		}
+		if sum := sumOf(row); sum > 1+1e-6 {
+			return nil, fmt.Errorf("phase-type: phase %d moves on with probability %g, more than 1", i+1, sum)
+		}
+		if means[i] <= 0 {
+			return nil, fmt.Errorf("phase-type: phase %d has mean %g, not positive", i+1, means[i])
+		}
+	}
+
+	// The expected times to the end from every phase, τ, solve
+	// (I-P)τ = means, and the second moments 2u solve (I-P)u = diag(means)τ.
+	a := make([][]float64, n)
+	for i := range a {
+		a[i] = make([]float64, n)
+		for j := range a[i] {
+			a[i][j] = -next[i][j]
+		}
+		a[i][i]++
+	}
+	tau, ok := solve(a, means)
+	if !ok {
+		return nil, fmt.Errorf("phase-type: some phases never lead out")
+	}
+	b := make([]float64, n)
+	for i := range b {
+		b[i] = means[i] * tau[i]
+	}
+	u, _ := solve(a, b)
+	mean, m2 := float64(0), float64(0)
+	for i, p := range initial {
+		mean += p * tau[i]
+		m2 += 2 * p * u[i]
+	}
+	scv := float64(0)
+	if mean > 0 {
+		scv = m2/(mean*mean) - 1
+	}
+	return &PhaseType{Initial: initial, Means: means, Next: next, mean: mean, scv: scv}, nil
+}
+
+// ReadPhaseType reads the phases of a phase-type distribution from CSV, a
+// line per phase with its initial probability, mean in minutes, and the
+// probabilities of moving on to each phase, e.g. for a Coxian distribution
+// of a 2-minute phase followed by a 30-minute one 30% of the time:
+//
+//	initial,mean,to1,to2
+//	1,2,0,0.3
+//	0,30,0,0
+//
+// Lines that do not start with a number, like a header, are skipped.
+func ReadPhaseType(r io.Reader) (*PhaseType, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var initial, means []float64
+	var next [][]float64
+	for line, rec := range records {
+		if _, err := strconv.ParseFloat(rec[0], 64); err != nil {
+			continue
+		}
+		row := make([]float64, len(rec))
+		for i, v := range rec {
+			if row[i], err = strconv.ParseFloat(v, 64); err != nil || !validMinutes(row[i]) {
+				return nil, fmt.Errorf("phase-type: line %d, column %d: want a number from 0 to %g", line+1, i+1, maxMinutes)
+			}
+		}
+		if len(row) < 2 {
+			return nil, fmt.Errorf("phase-type: phase %d has no mean", len(means)+1)
+		}
+		initial, means, next = append(initial, row[0]), append(means, row[1]), append(next, row[2:])
+	}
+	return NewPhaseType(initial, means, next)
+}
+
+// LoadPhaseType reads the phases of a phase-type distribution from a file,
+// see ReadPhaseType.
+func LoadPhaseType(path string) (*PhaseType, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p, err := ReadPhaseType(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return p, nil
+}
+
+func (p *PhaseType) Sample(rng *rand.Rand) float64 {
+	x := float64(0)
+	for i := pick(rng, p.Initial); i >= 0; i = pick(rng, p.Next[i]) {
+		x -= p.Means[i] * math.Log(1-rng.Float64())
+	}
+	return x
+}
+
+func (p *PhaseType) Mean() float64 {
+	return p.mean
+}
+
+// SCV returns the squared coefficient of variation, the variance over the
+// squared mean.
+func (p *PhaseType) SCV() float64 {
+	return p.scv
+}
+
+func (p *PhaseType) String() string {
+	return fmt.Sprintf("phase-type(%d phases, mean %.4g, scv %.4g)", len(p.Means), p.mean, p.scv)
+}
+
+// pick draws an index according to probs, or -1 with the probability they
+// leave over.
+func pick(rng *rand.Rand, probs []float64) int {
+	u := rng.Float64()
+	for i, q := range probs {
+		if u < q {
+			return i
+		}
+		u -= q
+	}
+	return -1
+}
+
+func sumOf(xs []float64) float64 {
+	sum := float64(0)
+	for _, x := range xs {
+		sum += x
+	}
+	return sum
+}
+
+// solve solves the linear system ax = b by Gaussian elimination with
+// partial pivoting, reporting false if a is singular. a and b are left
+// as they were.
+func solve(a [][]float64, b []float64) ([]float64, bool) {
+	n := len(b)
+	m := make([][]float64, n)
+	for i := range m {
+		m[i] = append(append(make([]float64, 0, n+1), a[i]...), b[i])
+	}
+	for c := range n {
+		p := c
+		for i := c + 1; i < n; i++ {
+			if math.Abs(m[i][c]) > math.Abs(m[p][c]) {
+				p = i
+			}
+		}
+		if math.Abs(m[p][c]) < epsilon {
+			return nil, false
+		}
+		m[c], m[p] = m[p], m[c]
+		for i := c + 1; i < n; i++ {
+			f := m[i][c] / m[c][c]
+			for j := c; j <= n; j++ {
+				m[i][j] -= f * m[c][j]
+			}
+		}
+	}
+	x := make([]float64, n)
+	for i := n - 1; i >= 0; i-- {
+		s := m[i][n]
+		for j := i + 1; j < n; j++ {
+			s -= m[i][j] * x[j]
+		}
+		x[i] = s / m[i][i]
+	}
+	return x, true
+}
+
+// maxMinutes bounds every time of a service distribution, about two years,
+// so that no time drawn from one overflows the clock.
+const maxMinutes = 1e6
+
+// validMinutes reports whether x is a time in minutes a distribution may
+// take, neither negative, nor NaN or infinite, nor more than maxMinutes.
+func validMinutes(x float64) bool {
+	return x >= 0 && x <= maxMinutes
+}
+
+// ParseDistribution returns the service distribution with the given name
+// and parameters, all in minutes and at most maxMinutes:
+//
+//	exp        mean
+//	const      value, and optionally the noise either way
+//	uniform    min, max
+//	lognormal  mean, standard deviation
+//	hyperexp   probability and mean of every branch, e.g. 0.9,5,0.1,55
+//	phase      file of phases, see ReadPhaseType
+//	empirical  file of observations, and optionally "interpolate"
+func ParseDistribution(name string, params []string) (ServiceDistribution, error) {
+	switch name {
+	case "empirical":
+		if len(params) < 1 || len(params) > 2 || (len(params) == 2 && params[1] != "interpolate") {
+			return nil, fmt.Errorf("empirical takes a file and optionally \"interpolate\"")
+		}
+		return LoadEmpirical(params[0], len(params) == 2)
+	case "phase":
+		if len(params) != 1 {
+			return nil, fmt.Errorf("phase takes a file of phases")
+		}
+		return LoadPhaseType(params[0])
+	}
+	p := make([]float64, len(params))
+	for i, v := range params {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || !validMinutes(f) {
+			return nil, fmt.Errorf("%s: invalid parameter %q, want a number from 0 to %g", name, v, maxMinutes)
+		}
+		p[i] = f
+	}
+	want := func(n int) error {
+		if len(p) != n {
+			return fmt.Errorf("%s takes %d parameters, got %d", name, n, len(p))
+		}
+		return nil
+	}
+	switch name {
+	case "exp":
+		if err := want(1); err != nil {
+			return nil, err
+		}
+		if p[0] == 0 {
+			return nil, fmt.Errorf("exp: mean must be positive")
+		}
+		return &Exponential{lambda: 1 / p[0]}, nil
+	case "const":
+		if len(p) < 1 || len(p) > 2 {
+			return nil, fmt.Errorf("const takes a value and optionally the noise, got %d parameters", len(p))
+		}
+		if p[0] == 0 {
+			return nil, fmt.Errorf("const: value must be positive")
+		}
+		d := Deterministic{Value: p[0]}
+		if len(p) == 2 {
+			d.Noise = p[1]
+		}
+		if d.Noise > d.Value {
+			return nil, fmt.Errorf("const: noise %g is more than the value %g", d.Noise, d.Value)
+		}
+		return d, nil
+	case "uniform":
+		if err := want(2); err != nil {
+			return nil, err
+		}
+		if p[1] < p[0] {
+			return nil, fmt.Errorf("uniform: max %g is below min %g", p[1], p[0])
+		}
+		if p[1] == 0 {
+			return nil, fmt.Errorf("uniform: max must be positive")
+		}
+		return Uniform{p[0], p[1]}, nil
+	case "lognormal":
+		if err := want(2); err != nil {
+			return nil, err
+		}
+		if p[0] == 0 {
+			return nil, fmt.Errorf("lognormal: mean must be positive")
+		}
+		return NewLogNormal(p[0], p[1]), nil
+	case "hyperexp":
+		if len(p) == 0 || len(p)%2 != 0 {
+			return nil, fmt.Errorf("hyperexp takes a probability and a mean per branch, got %d parameters", len(p))
+		}
+		var probs, means []float64
+		for i := 0; i < len(p); i += 2 {
+			probs, means = append(probs, p[i]), append(means, p[i+1])
+		}
+		return NewHyperexponential(probs, means)
+	}
+	return nil, fmt.Errorf("unknown distribution %q", name)
+}
@@ -0,0 +1,145 @@
+package queue
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestParseDistribution(t *testing.T) {
+	for _, tc := range []struct {
+		spec string
+		mean float64
+	}{
+		{"exp,10", 10},
+		{"const,4", 4},
+		{"const,4,1", 4},
+		{"uniform,2,6", 4},
+		{"uniform,0,1e6", 5e5},
+		{"lognormal,10,5", 10},
+		{"hyperexp,0.9,5,0.1,55", 10},
+	} {
+		d, err := parseDistributionFlag(tc.spec)
+		if err != nil {
+			t.Errorf("%s: %v", tc.spec, err)
+			continue
+		}
+		if m := d.Mean(); m < tc.mean*(1-1e-9) || m > tc.mean*(1+1e-9) {
+			t.Errorf("%s: mean %g, want %g", tc.spec, m, tc.mean)
+		}
+	}
+}
+
+func TestParseDistributionRejects(t *testing.T) {
+	for _, spec := range []string{
+		"exp,0",
+		"exp,-1",
+		"exp,NaN",
+		"exp,Inf",
+		"exp,+Inf",
+		"exp,1e300",
+		"exp,1,2",
+		"exp,ten",
+		"const,0",
+		"const,4,5",
+		"const,-Inf",
+		"uniform,0,0",
+		"uniform,6,2",
+		"uniform,0,1e300",
+		"uniform,NaN,1",
+		"lognormal,0,1",
+		"lognormal,NaN,1",
+		"lognormal,10,Inf",
+		"hyperexp,0.5,5",
+		"hyperexp,0.5,5,0.5,Inf",
+		"hyperexp,0.5,5,0.5,0",
+		"gamma,2,3",
+		"phase,a,b",
+		"empirical,a,b",
+	} {
+		if d, err := parseDistributionFlag(spec); err == nil {
+			t.Errorf("%s: got %v, want an error", spec, d)
+		}
+	}
+}
+
+func TestReadEmpiricalRejects(t *testing.T) {
+	for _, in := range []string{"", "minutes\n", "1\n-2\n", "1\n2e6\n", "1\nInf\n", "1\nNaN\n"} {
+		if e, err := ReadEmpirical(strings.NewReader(in), false); err == nil {
+			t.Errorf("%q: got %v, want an error", in, e)
+		}
+	}
+}
+
+func TestReadPhaseType(t *testing.T) {
+	p, err := ReadPhaseType(strings.NewReader("initial,mean,to1,to2\n1,2,0,0.3\n0,30,0,0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := p.Mean(); m < 11-1e-9 || m > 11+1e-9 {
+		t.Errorf("mean %g, want 11", m)
+	}
+	for _, in := range []string{
+		"1,NaN\n",
+		"1,Inf\n",
+		"1,2,0,-0.5\n",
+		"1,2,1\n",
+		"1\n",
+	} {
+		if p, err := ReadPhaseType(strings.NewReader(in)); err == nil {
+			t.Errorf("%q: got %v, want an error", in, p)
+		}
+	}
+}
+
+func TestReadPhaseTypeHidesContent(t *testing.T) {
+	_, err := ReadPhaseType(strings.NewReader("1,secret\n"))
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("got %v, want an error without the field", err)
+	}
+}
+
+func TestSamplers(t *testing.T) {
+	phase, err := NewPhaseType([]float64{1, 0}, []float64{2, 30}, [][]float64{{0, 0.3}, {0, 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	empirical, err := NewEmpirical([]float64{5, 7, 12, 30}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interpolated, err := NewEmpirical([]float64{5, 7, 12, 30}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dists := map[string]ServiceDistribution{"phase": phase, "empirical": empirical, "interpolated": interpolated}
+	for _, spec := range []string{"exp,10", "exp,0.01", "const,4", "uniform,2,6", "lognormal,10,5", "lognormal,3,12", "hyperexp,0.9,5,0.1,55"} {
+		d, err := parseDistributionFlag(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dists[spec] = d
+	}
+	const n = 200000
+	for name, d := range dists {
+		rng := rand.New(rand.NewSource(1))
+		xs := make([]float64, n)
+		for i := range xs {
+			if xs[i] = d.Sample(rng); !(xs[i] >= 0) || math.IsInf(xs[i], 0) {
+				t.Fatalf("%s: sampled %g", name, xs[i])
+			}
+		}
+		mean, variance := meanVariance(xs)
+		// five standard errors, which a right sampler misses once in
+		// millions of seeds
+		if se := math.Sqrt(variance / n); math.Abs(mean-d.Mean()) > 5*se+1e-9*d.Mean() {
+			t.Errorf("%s: sample mean %g, want %g within %g", name, mean, d.Mean(), 5*se)
+		}
+		if v, ok := d.(interface{ SCV() float64 }); ok {
+			if scv := variance / (mean * mean); math.Abs(scv-v.SCV()) > 0.05*max(v.SCV(), 0.1) {
+				t.Errorf("%s: sample SCV %g, want %g", name, scv, v.SCV())
+			}
+		}
+	}
+}
@@ -0,0 +1,787 @@
+package queue
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"time"
+)
+
+type eventKind int
+
+const (
+	// A server going off duty at the moment it finishes a customer does not
+	// take the next one, while one coming on duty finds the line as left by
+	// all departures at that time.
+	shiftEndEvent eventKind = iota
+	departureEvent
+	shiftStartEvent
+	failureEvent
+	repairEvent
+	abandonEvent
+	returnEvent // of a customer of a closed system
+	scaleStepEvent
+	scaleUpEvent
+	scaleDownEvent
+	serversEvent // of a Stepper
+)
+
+// event is something scheduled to happen to a server at a given time. Events
+// at the same time are handled in order of kind, then server index. A
+// departure is void unless its version matches that of the server, which
+// changes whenever a service is cut short, and a server going on standby
+// unless it has been idle since its version. Abandonments name the
+// customer that runs out of patience, and a change of the number of
+// servers on duty the number in place of a server.
+type event struct {
+	time     int
+	kind     eventKind
+	server   int
+	version  int
+	customer *Customer
+}
+
+type eventQueue []event
+
+func (q eventQueue) Len() int { return len(q) }
+
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].time != q[j].time {
+		return q[i].time < q[j].time
+	}
+	if q[i].kind != q[j].kind {
+		return q[i].kind < q[j].kind
+	}
+	return q[i].server < q[j].server
+}
+
+func (q eventQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+// push adds event e. Like container/heap, which it mirrors so that events
+// come out in the same order, but without boxing every event in an
+// interface.
+func (q *eventQueue) push(e event) {
+	*q = append(*q, e)
+	h := *q
+	for j := len(h) - 1; ; {
+		i := (j - 1) / 2 // parent
+		if i == j || !h.Less(j, i) {
+			break
+		}
+		h.Swap(i, j)
+		j = i
+	}
+}
+
+// pop removes and returns the first event.
+func (q *eventQueue) pop() event {
+	h := *q
+	n := len(h) - 1
+	h.Swap(0, n)
+	for i := 0; ; {
+		j := 2*i + 1
+		if j >= n || j < 0 {
+			break
+		}
+		if j2 := j + 1; j2 < n && h.Less(j2, j) {
+			j = j2
+		}
+		if !h.Less(j, i) {
+			break
+		}
+		h.Swap(i, j)
+		i = j
+	}
+	e := h[n]
+	*q = h[:n]
+	return e
+}
+
+type serverState struct {
+	batch   []*Customer // in service, empty when idle
+	queue   []*Customer // own line, only used with separate queues
+	offDuty bool
+	broken  bool
+	version int
+	served  int
+	batches int
+
+	failures, downtime int
+
+	// for setup times: when the server last finished, the class it served
+	// and when its current setup ends
+	freeAt, lastClass int
+	setupEnd          int
+	setups, setupTime int
+
+	// the work of the current round-robin time slice, and that left after
+	// it
+	slice, rest int
+
+	// for processor sharing: when the customers' work left was last
+	// brought up to date
+	sharedAt int
+
+	// for autoscaling: whether the server is on standby or called in, and
+	// since when it has been on duty, or idle, and how long it was on
+	// duty before
+	standby, calling               bool
+	dutySince, dutyTime, idleSince int
+}
+
+// run holds the mutable state of one call to Simulate.
+type run struct {
+	s    *Simulation
+	log  *slog.Logger
+	emit func(CustomerEvent)
+	// the customer events since the last pause of a Stepper
+	stepped []CustomerEvent
+
+	events  eventQueue
+	queue   []*Customer // the shared line
+	servers []serverState
+	// customers not yet let in, allocated a slab at a time, and the group
+	// arriving
+	slab     []Customer
+	arriving []*Customer
+
+	busyTime   []int
+	candidates []int
+
+	customers    int
+	groups       int
+	waits        histogram
+	streaming    *streamingWaits // instead of waits, with streaming statistics
+	batchMeans   *batchMeans
+	totalWait    int
+	totalService int
+	jockeys      int
+
+	interruptions   int
+	sentAway        int
+	preemptions     int
+	preemptionDelay int
+	denied          int
+	lastFinish      int
+
+	abandoned   int
+	abandonWait int
+
+	classes []classTally // with a catalog
+
+	booked           []booking
+	noShows          int
+	bookedServed     int
+	appointmentDelay int
+
+	inSystem                   int
+	lastEmpty                  int
+	maxBacklog, maxBacklogTime int
+	recoveredAt                int
+	overload                   *OverloadStats
+
+	// area is the integral of inSystem up to lastChange, and openArea
+	// that up to endTime
+	area, openArea int
+	lastChange     int
+	timeInSystem   int
+	// timeAt holds the ticks spent with n customers in the system, up to
+	// lastChange
+	timeAt []int
+
+	// ticks measured for the SLA, and those with too long a line
+	queueTicks, queueOverTicks int
+
+	// the states recorded for WithStates, and the index of the next time
+	states    []State
+	nextState int
+
+	scaling *ScalingStats // with autoscaling
+
+	// customers served, for stopping criteria
+	completed int
+	began     time.Time
+	stoppedBy string
+
+	// simulated time and customers up to the last progress report
+	reportedTime, reportedCustomers int
+
+	// the run gives up with err once ctx is done, checked every simulated
+	// hour and every cancelCheck events
+	ctx     context.Context
+	err     error
+	handled int
+
+	// the fingerprint of the options, with a Checkpoint
+	options []byte
+}
+
+const cancelCheck = 4096
+
+func (s *Simulation) newRun(log *slog.Logger) *run {
+	r := &run{
+		s:           s,
+		log:         log,
+		ctx:         context.Background(),
+		servers:     make([]serverState, s.nServers),
+		busyTime:    make([]int, s.nServers),
+		candidates:  make([]int, 0, s.nServers),
+		lastEmpty:   -1,
+		recoveredAt: -1,
+		lastChange:  s.startTime,
+
+		reportedTime: s.startTime,
+	}
+	if s.stop != nil {
+		r.began = time.Now()
+	}
+	if len(s.classes) > 0 {
+		r.classes = make([]classTally, len(s.classes))
+	}
+	if s.streaming {
+		r.streaming = newStreamingWaits()
+		for i := range r.classes {
+			r.classes[i].p90 = newP2Quantile(0.9)
+		}
+	}
+	if start, end, ok := s.overloadWindow(); ok {
+		r.overload = &OverloadStats{PeakStart: start, PeakEnd: end, LastEmptyTime: -1}
+	}
+	if s.batchMeans > 0 {
+		r.batchMeans = newBatchMeans(s.batchMeans)
+	}
+	for j := range r.servers {
+		r.servers[j].freeAt, r.servers[j].lastClass = -1, -1
+	}
+	r.scheduleScaling()
+	r.scheduleShifts()
+	r.scheduleFailures()
+	r.schedulePopulation()
+	r.book()
+	return r
+}
+
+// advance handles every event scheduled up to and including time t.
+func (r *run) advance(t int) {
+	for r.err == nil && len(r.events) > 0 && r.events[0].time <= t {
+		e := r.events.pop()
+		switch e.kind {
+		case departureEvent:
+			if e.version == r.servers[e.server].version {
+				r.depart(e.server, e.time)
+			}
+		case shiftStartEvent:
+			r.shiftStart(e.server, e.time)
+		case shiftEndEvent:
+			r.shiftEnd(e.server, e.time)
+		case failureEvent:
+			r.fail(e.server, e.time)
+		case repairEvent:
+			r.repair(e.server, e.time)
+		case abandonEvent:
+			r.abandon(e.customer, e.time)
+		case returnEvent:
+			if e.time < r.s.endTime {
+				r.arrive(e.time, 1)
+			}
+		case scaleStepEvent:
+			r.scaleStep(e.time)
+		case scaleUpEvent:
+			r.comeOnDuty(e.server, e.time, "line")
+		case scaleDownEvent:
+			r.standBy(e.server, e.time, e.version, "idle")
+		case serversEvent:
+			r.setServers(e.server, e.time)
+		}
+		r.pause()
+		if r.handled++; r.handled%cancelCheck == 0 {
+			r.err = r.ctx.Err()
+		}
+	}
+}
+
+// arrive lets a group of size customers walk in at time t.
+func (r *run) arrive(t int, size int) {
+	if !r.admit(t, size) {
+		return
+	}
+	group := r.arriving[:0]
+	for range size {
+		if c := r.newCustomer(t, -1); c != nil {
+			group = append(group, c)
+		}
+	}
+	if len(group) == 0 {
+		return
+	}
+	r.arriving = group
+	r.groups++
+	r.join(t, group...)
+	r.scaleUp(t)
+}
+
+// newCustomer lets a customer of the given class in at time t, or returns
+// nil if the admission policy or the OnArrival hook turns the customer
+// away. A negative class is
+// drawn from the catalog.
+func (r *run) newCustomer(t int, class int) *Customer {
+	if class < 0 {
+		class = r.s.drawClass()
+	}
+	c := r.newSlot()
+	*c = Customer{Index: r.customers + 1, ArrivalTime: t, Class: class}
+	if !r.admitted(t, c) {
+		return nil
+	}
+	r.customers++
+	r.slab = r.slab[1:]
+	if r.classes != nil {
+		r.classes[class].customers++
+	}
+	r.enter(t)
+	r.event(CustomerArrived, t, c)
+	if r.logs(LevelDebug) {
+		r.logAttrs(LevelDebug, "customer arrived", slog.Int("customer", c.Index), r.at(t), slog.Int("in_system", r.inSystem))
+	}
+	r.schedulePatience(c, t)
+	return c
+}
+
+// newSlot returns a new, zero customer. A customer turned away leaves its
+// slot for the next one.
+func (r *run) newSlot() *Customer {
+	if len(r.slab) == 0 {
+		r.slab = make([]Customer, 256)
+	}
+	return &r.slab[0]
+}
+
+// join puts customers in line at time t. A group stays together and may be
+// served as soon as a server is free.
+func (r *run) join(t int, cs ...*Customer) {
+	if r.s.sharing {
+		for _, c := range cs {
+			r.joinShared(t, c)
+		}
+		return
+	}
+	if !r.s.separateQueues {
+		r.queue = r.s.enqueue(r.queue, cs...)
+		r.dispatch(t)
+		if r.s.preemptive {
+			r.preempt(t)
+		}
+		return
+	}
+
+	// join the shortest line of an available server, counting the customers
+	// in service
+	shortest := -1
+	r.candidates = r.candidates[:0]
+	open := r.nAvailableFor(cs[0]) > 0
+	for j := range r.servers {
+		if !r.serves(j, cs[0]) || !r.available(j) && open {
+			continue
+		}
+		n := r.lineLength(j)
+		if n < shortest || shortest == -1 {
+			shortest = n
+			r.candidates = r.candidates[:0]
+		}
+		if n == shortest {
+			r.candidates = append(r.candidates, j)
+		}
+	}
+	j := r.route(t, cs[0], r.candidates, false)
+	r.servers[j].queue = r.s.enqueue(r.servers[j].queue, cs...)
+	if r.idle(j) {
+		r.next(j, t)
+	}
+}
+
+// dispatch lets idle servers take customers from the shared line at time t.
+func (r *run) dispatch(t int) {
+	for r.ready(len(r.queue), t) {
+		// with skills, the first customer an idle server can serve
+		var c *Customer
+		r.candidates = r.candidates[:0]
+		for _, c = range r.queue {
+			for j := range r.servers {
+				if r.idle(j) && r.serves(j, c) {
+					r.candidates = append(r.candidates, j)
+				}
+			}
+			if len(r.candidates) > 0 || r.s.skilled == nil {
+				break
+			}
+		}
+		if len(r.candidates) == 0 {
+			return
+		}
+		j := r.route(t, c, r.candidates, true)
+		switch {
+		case j < 0:
+			return
+		case r.s.sharing:
+			r.next(j, t)
+		default:
+			r.take(j, t)
+		}
+	}
+}
+
+// ready reports whether a line of n customers is long enough to start a
+// batch at time t. After closing time any customer is enough.
+func (r *run) ready(n int, t int) bool {
+	return n > 0 && (n >= r.s.minBatch || t >= r.s.endTime)
+}
+
+// closeDoors starts batches that were waiting to fill up when the doors
+// close at time t.
+func (r *run) closeDoors(t int) {
+	r.advance(t)
+	r.openArea = r.area + r.inSystem*(t-r.lastChange)
+	if r.s.closing == SendAwayAtClose {
+		r.sendAway(t)
+		return
+	}
+	if !r.s.separateQueues {
+		r.dispatch(t)
+		return
+	}
+	for j := range r.servers {
+		if r.idle(j) {
+			r.next(j, t)
+		}
+	}
+}
+
+// available reports whether server j is on duty and working.
+func (r *run) available(j int) bool {
+	return !r.servers[j].offDuty && !r.servers[j].broken && !r.servers[j].standby
+}
+
+// idle reports whether server j is available and not serving anyone.
+func (r *run) idle(j int) bool {
+	return len(r.servers[j].batch) == 0 && r.available(j)
+}
+
+// nAvailable returns the number of available servers.
+func (r *run) nAvailable() int {
+	n := 0
+	for j := range r.servers {
+		if r.available(j) {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *run) lineLength(j int) int {
+	return len(r.servers[j].queue) + len(r.servers[j].batch)
+}
+
+// depart finishes the service at server j at time t.
+func (r *run) depart(j int, t int) {
+	if r.s.sharing {
+		r.shareDepart(j, t)
+		return
+	}
+	if r.s.quantum > 0 && r.sliceEnd(j, t) {
+		return
+	}
+	for _, c := range r.servers[j].batch {
+		r.timeInSystem += c.SpentTime()
+		if r.classes != nil {
+			r.classes[c.Class].sojourn += c.SpentTime()
+		}
+		r.completed++
+		r.leave(t)
+		r.event(CustomerServed, t, c)
+		if r.logs(LevelDebug) {
+			r.logAttrs(LevelDebug, "customer left", slog.Int("customer", c.Index), r.at(t), slog.Int("server", j))
+		}
+	}
+	r.servers[j].batch = r.servers[j].batch[:0]
+	r.servers[j].freeAt = t
+	r.lastFinish = max(r.lastFinish, t)
+	if r.available(j) {
+		r.next(j, t)
+	} else if r.s.routing != nil && !r.s.separateQueues {
+		// customers a routing policy kept waiting for this server
+		r.dispatch(t)
+	}
+	r.scheduleIdle(j, t)
+}
+
+// next lets the idle server j take the next customers at time t.
+func (r *run) next(j int, t int) {
+	if r.s.sharing {
+		for len(r.queue) > 0 {
+			c := r.queue[0]
+			r.queue = r.queue[1:]
+			r.share(j, t, c)
+		}
+		return
+	}
+	if !r.s.separateQueues {
+		// a routing policy may keep the server for later
+		i := r.firstServed(j)
+		if i >= 0 && r.ready(len(r.queue), t) && (r.s.routing == nil || r.route(t, r.queue[i], []int{j}, true) >= 0) {
+			r.take(j, t)
+		}
+		return
+	}
+
+	if q := r.servers[j].queue; r.ready(len(q), t) {
+		n := min(len(q), r.s.maxBatch)
+		r.servers[j].queue = q[n:]
+		r.start(j, t, q[:n])
+		if len(r.servers[j].queue) == 0 {
+			r.servers[j].queue = q[:0]
+		}
+		return
+	}
+	if r.s.jockeying {
+		// the last customer of the longest line moves over
+		longest := -1
+		for k := range r.servers {
+			if n := len(r.servers[k].queue); n > 0 && r.serves(j, r.servers[k].queue[n-1]) && (longest == -1 || n > len(r.servers[longest].queue)) {
+				longest = k
+			}
+		}
+		if longest != -1 {
+			q := r.servers[longest].queue
+			r.servers[longest].queue = q[:len(q)-1]
+			r.jockeys++
+			r.start(j, t, q[len(q)-1:])
+		}
+	}
+}
+
+// take lets server j take the next batch from the shared line at time t.
+func (r *run) take(j int, t int) {
+	if r.s.skilled != nil {
+		r.takeSkilled(j, t)
+		return
+	}
+	n := min(len(r.queue), r.s.maxBatch)
+	batch := r.queue[:n]
+	r.queue = r.queue[n:]
+	r.start(j, t, batch)
+	if len(r.queue) == 0 {
+		// start copied the batch, so the line starts over in its memory
+		r.queue = batch[:0]
+	}
+}
+
+// start puts a batch of customers into service at server j at time t. The
+// batch takes one service time; customers whose service was interrupted
+// need at least the work they have left.
+func (r *run) start(j int, t int, batch []*Customer) {
+	sv := &r.servers[j]
+	sv.batch = append(sv.batch[:0], batch...)
+	sv.batches++
+
+	work := -1
+	for _, c := range sv.batch {
+		if c.Interruptions == 0 && work == -1 {
+			work = r.serviceTime(j, c, t)
+		}
+	}
+	for _, c := range sv.batch {
+		if c.Interruptions == 0 {
+			c.service, c.work = work, work
+		}
+		work = max(work, c.work)
+	}
+	setup := r.setupTime(j, t, sv.batch[0].Class)
+	sv.setupEnd = t + setup
+	// with round robin, the batch runs for a time slice at most
+	run := work
+	if r.s.quantum > 0 {
+		run = min(work, r.s.quantum)
+	}
+	sv.slice, sv.rest = run, work-run
+
+	for _, c := range sv.batch {
+		first := c.Interruptions == 0
+		if first {
+			c.ServedTime = t + setup
+			r.served(j, c, t)
+		}
+		if c.preempted {
+			r.preemptionDelay += t - c.preemptedAt
+			c.preempted = false
+		}
+		c.Server = j
+		c.FinishTime = t + setup + run
+		r.event(CustomerStarted, t, c)
+
+		if !r.logs(LevelCustomer) {
+			continue
+		}
+		if !first {
+			r.logAttrs(LevelCustomer, "customer resumed", slog.Int("customer", c.Index), r.at(t), slog.Int("server", j), r.clockAttr("finish", c.FinishTime))
+			continue
+		}
+		r.logServed(c, c.work)
+	}
+	r.busyTime[j] += setup + run
+	r.events.push(event{time: t + setup + run, kind: departureEvent, server: j, version: sv.version})
+}
+
+// served counts customer c, whose service at server j first begins at
+// c.ServedTime, in the statistics of the customers served.
+func (r *run) served(j int, c *Customer, t int) {
+	r.servers[j].served++
+	if r.streaming != nil {
+		r.streaming.add(c.WaitTime())
+	} else {
+		r.waits.add(c.WaitTime())
+	}
+	if r.batchMeans != nil {
+		r.batchMeans.add(r.s.minutes(c.WaitTime()))
+	}
+	r.totalWait += c.WaitTime()
+	r.totalService += c.service
+	if r.classes != nil {
+		tally := &r.classes[c.Class]
+		tally.served++
+		tally.wait += c.WaitTime()
+		if tally.p90 != nil {
+			tally.p90.add(float64(c.WaitTime()))
+		} else {
+			tally.waits.add(c.WaitTime())
+		}
+		tally.service += c.service
+	}
+	if c.booked {
+		r.bookedServed++
+		r.appointmentDelay += max(0, t-c.appointment)
+	}
+}
+
+// logServed logs customer c, served with the given work.
+func (r *run) logServed(c *Customer, work int) {
+	attrs := []slog.Attr{slog.Int("customer", c.Index)}
+	if len(r.s.classes) > 0 {
+		attrs = append(attrs, slog.String("class", r.s.classes[c.Class].Name))
+	}
+	attrs = append(attrs,
+		r.clockAttr("arrival", c.ArrivalTime),
+		r.clockAttr("served", c.ServedTime),
+		slog.Int("server", c.Server),
+		r.durationAttr("wait", c.WaitTime()),
+		r.clockAttr("finish", c.FinishTime),
+		r.durationAttr("service", work))
+	r.logAttrs(LevelCustomer, "customer served", attrs...)
+}
+
+func (r *run) result() SimulationResult {
+	// times count ticks up to here, and minutes in the result
+	k := r.s.tick
+	servers := make([]ServerStats, len(r.servers))
+	for j := range servers {
+		scheduled := r.s.scheduledTime(j)
+		if r.scaling != nil {
+			scheduled = r.dutyTime(j, max(r.s.endTime, r.lastFinish))
+		}
+		servers[j] = ServerStats{
+			Customers:     r.servers[j].served,
+			Batches:       r.servers[j].batches,
+			BusyTime:      r.busyTime[j] / k,
+			ScheduledTime: scheduled / k,
+			Utilization:   ratio(r.busyTime[j], scheduled),
+			Failures:      r.servers[j].failures,
+			Downtime:      r.servers[j].downtime / k,
+			Overtime:      max(0, r.servers[j].freeAt-r.s.endTime) / k,
+			Setups:        r.servers[j].setups,
+			SetupTime:     r.servers[j].setupTime / k,
+		}
+	}
+	batches := 0
+	for _, sv := range r.servers {
+		batches += sv.batches
+	}
+	served := r.customers - r.abandoned - r.sentAway
+	little, littleOpen := r.littlesLaw()
+	var batchMeans []float64
+	if r.batchMeans != nil {
+		batchMeans = r.batchMeans.means()
+	}
+	return SimulationResult{
+		TotalTime:               (r.s.endTime - r.s.startTime) / k,
+		TotalCustomers:          r.customers,
+		TotalServers:            r.s.nServers,
+		AverageWaitTime:         ratio(r.totalWait, served) / float64(k),
+		AverageServiceTime:      ratio(r.totalService, served) / float64(k),
+		WaitStdDev:              math.Sqrt(r.waitVariance()) / float64(k),
+		Jockeys:                 r.jockeys,
+		Overload:                r.overloadStats(),
+		Servers:                 servers,
+		Interruptions:           r.interruptions,
+		Preemptions:             r.preemptions,
+		AveragePreemptionDelay:  ratio(r.preemptionDelay, r.preemptions) / float64(k),
+		Denied:                  r.denied,
+		SentAway:                r.sentAway,
+		LastFinishTime:          r.lastFinish / k,
+		Overtime:                max(0, r.lastFinish-r.s.endTime) / k,
+		AverageGroupSize:        ratio(r.customers, r.groups),
+		AverageBatchSize:        ratio(served, batches),
+		Abandoned:               r.abandoned,
+		AverageAbandonWait:      ratio(r.abandonWait, r.abandoned) / float64(k),
+		NoShows:                 r.noShows,
+		AverageAppointmentDelay: ratio(r.appointmentDelay, r.bookedServed) / float64(k),
+		Little:                  little,
+		LittleOpen:              littleOpen,
+		Pn:                      r.pn(),
+		BatchMeans:              batchMeans,
+		Classes:                 r.classStats(),
+		Stopped:                 r.stoppedBy,
+		SLA:                     r.slaStats(),
+		States:                  r.states,
+		Scaling:                 r.scalingStats(max(r.s.endTime, r.lastFinish)),
+		waits:                   r.waits,
+		streaming:               r.streaming,
+		tick:                    k,
+	}
+}
+
+// waitVariance returns the sample variance of the waits of the customers
+// served, in ticks squared.
+func (r *run) waitVariance() float64 {
+	if r.streaming != nil {
+		return r.streaming.variance()
+	}
+	return r.waits.variance()
+}
+
+// waitsWithin returns the fraction of the customers served who waited at
+// most v ticks, 0 if none were.
+func (r *run) waitsWithin(v float64) float64 {
+	if r.streaming != nil {
+		return r.streaming.within(v)
+	}
+	if r.waits.n == 0 {
+		return 0
+	}
+	return r.waits.within(int(v))
+}
+
+// longestWait returns the longest wait of a customer served, in ticks.
+func (r *run) longestWait() float64 {
+	if r.streaming != nil {
+		return r.streaming.max
+	}
+	return float64(r.waits.max())
+}
+
+// ratio returns a/b, or 0 if b is 0, so that a run without customers has
+// averages of 0 rather than NaN.
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
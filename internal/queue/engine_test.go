@@ -0,0 +1,179 @@
+package queue
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// invariants records what hooks see of a run and checks it against the
+// result.
+type invariants struct {
+	t                             *testing.T
+	arrivals, denied              int
+	departures, reneges, services int
+	waits                         int // in ticks, of the customers served
+	gone                          map[int]bool
+}
+
+func newInvariants(t *testing.T) *invariants {
+	return &invariants{t: t, gone: map[int]bool{}}
+}
+
+func (v *invariants) hooks() Hooks {
+	leave := func(e CustomerEvent) {
+		c := e.Customer
+		if v.gone[c.Index] {
+			v.t.Errorf("customer %d left twice", c.Index)
+		}
+		v.gone[c.Index] = true
+		if e.Time < c.ArrivalTime {
+			v.t.Errorf("customer %d left at %d before arriving at %d", c.Index, e.Time, c.ArrivalTime)
+		}
+	}
+	return Hooks{
+		OnArrival: func(e CustomerEvent) bool {
+			// turn away every 17th customer, to count the denials too
+			if v.arrivals++; v.arrivals%17 == 0 {
+				v.denied++
+				return false
+			}
+			return true
+		},
+		OnServiceStart: func(e CustomerEvent) {
+			v.services++
+			if c := e.Customer; c.ServedTime < c.ArrivalTime || e.Time < c.ArrivalTime {
+				v.t.Errorf("customer %d arrived at %d, served from %d at %d", c.Index, c.ArrivalTime, c.ServedTime, e.Time)
+			}
+		},
+		OnDeparture: func(e CustomerEvent) {
+			leave(e)
+			v.departures++
+			c := e.Customer
+			if c.FinishTime != e.Time || c.ServedTime > c.FinishTime || c.WaitTime() < 0 {
+				v.t.Errorf("customer %d arrived at %d, served from %d to %d, left at %d", c.Index, c.ArrivalTime, c.ServedTime, c.FinishTime, e.Time)
+			}
+			v.waits += c.WaitTime()
+		},
+		OnRenege: func(e CustomerEvent) {
+			leave(e)
+			v.reneges++
+		},
+	}
+}
+
+// check checks the result r of the run against what the hooks saw.
+func (v *invariants) check(r SimulationResult) {
+	t := v.t
+	t.Helper()
+	if v.departures == 0 {
+		t.Fatal("no customer was served")
+	}
+	// every customer let in leaves once, served, out of patience or sent away
+	if r.TotalCustomers != v.arrivals-v.denied || r.TotalCustomers != v.departures+v.reneges+r.SentAway {
+		t.Errorf("%d customers, %d arrivals, %d denied, %d served, %d reneged, %d sent away", r.TotalCustomers, v.arrivals, v.denied, v.departures, v.reneges, r.SentAway)
+	}
+	if r.Denied < v.denied || r.Abandoned != v.reneges {
+		t.Errorf("denied %d, abandoned %d, want %d and %d", r.Denied, r.Abandoned, v.denied, v.reneges)
+	}
+	served := 0
+	for _, sv := range r.Servers {
+		served += sv.Customers
+	}
+	if served != v.departures {
+		t.Errorf("the servers served %d, %d departed", served, v.departures)
+	}
+	if v.services < v.departures {
+		t.Errorf("%d services started, %d departed", v.services, v.departures)
+	}
+	want := float64(v.waits) / float64(v.departures) / float64(max(r.tick, 1))
+	if math.Abs(r.AverageWaitTime-want) > 1e-9*max(want, 1) {
+		t.Errorf("average wait %g, the hooks saw %g", r.AverageWaitTime, want)
+	}
+	// over the whole run, from and back to an empty system, Little's law
+	// holds exactly
+	if d := r.Little.Discrepancy(); math.Abs(d) > 1e-9 {
+		t.Errorf("Little's law %+v is off by %g", r.Little, d)
+	}
+	sum := 0.0
+	for _, p := range r.Pn {
+		if p < 0 {
+			t.Errorf("Pn %v", r.Pn)
+		}
+		sum += p
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Errorf("Pn sums to %g", sum)
+	}
+}
+
+func TestEngineInvariants(t *testing.T) {
+	patience, err := parseDistributionFlag("exp,20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an overloaded day, so that lines are long at closing time; exercised
+	// reports whether the run did what the options are there for
+	for _, tc := range []struct {
+		name      string
+		opts      []Option
+		exercised func(SimulationResult, *invariants) bool
+	}{
+		{"plain", nil, nil},
+		{"patience", []Option{WithPatience(patience)}, func(_ SimulationResult, v *invariants) bool { return v.reneges > 0 }},
+		{"send away", []Option{WithClosingPolicy(SendAwayAtClose)}, func(r SimulationResult, _ *invariants) bool { return r.SentAway > 0 }},
+		{"breakdowns", []Option{WithBreakdowns(Breakdowns{TimeToFailure: 120, RepairTime: 15})}, func(r SimulationResult, _ *invariants) bool { return r.Interruptions > 0 }},
+		{"separate queues", []Option{WithSeparateQueues(true)}, func(r SimulationResult, _ *invariants) bool { return r.Jockeys > 0 }},
+		{"round robin", []Option{WithRoundRobin(2)}, func(_ SimulationResult, v *invariants) bool { return v.services > v.departures }},
+		{"groups", []Option{WithGroupArrivals(2.5)}, func(r SimulationResult, _ *invariants) bool { return r.AverageGroupSize > 1 }},
+		{"server rates", []Option{WithServerRates(4, 8, 6)}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			v := newInvariants(t)
+			r := NewSimulation(480, 960, 3, 20, 6, 5, append(tc.opts, WithHooks(v.hooks()))...).Simulate(false)
+			v.check(r)
+			if tc.exercised != nil && !tc.exercised(r, v) {
+				t.Errorf("the run did not exercise %s: %+v", tc.name, r)
+			}
+		})
+	}
+}
+
+func TestEngineFIFO(t *testing.T) {
+	// one server and one line serves the customers in order of arrival
+	last, lastArrival, lastLeft := 0, 0, 0
+	s := NewSimulation(480, 960, 1, 8, 9, 2, WithHooks(Hooks{
+		OnServiceStart: func(e CustomerEvent) {
+			c := e.Customer
+			if c.Index <= last || c.ArrivalTime < lastArrival {
+				t.Errorf("customer %d, arrived at %d, started after customer %d, arrived at %d", c.Index, c.ArrivalTime, last, lastArrival)
+			}
+			last, lastArrival = c.Index, c.ArrivalTime
+		},
+		OnDeparture: func(e CustomerEvent) {
+			if e.Time < lastLeft || e.Customer.Index != last {
+				t.Errorf("customer %d left at %d, after customer %d at %d", e.Customer.Index, e.Time, last, lastLeft)
+			}
+			lastLeft = e.Time
+		},
+	}))
+	if r := s.Simulate(false); r.TotalCustomers != last {
+		t.Errorf("%d customers, the last served was %d", r.TotalCustomers, last)
+	}
+}
+
+func TestEngineDeterministic(t *testing.T) {
+	run := func(seed int64) string {
+		b, err := json.Marshal(NewSimulation(480, 960, 2, 11, 6, seed).Simulate(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	if a, b := run(3), run(3); a != b {
+		t.Errorf("the same seed gave\n%s\nand\n%s", a, b)
+	}
+	if run(3) == run(4) {
+		t.Error("seeds 3 and 4 gave the same run")
+	}
+}
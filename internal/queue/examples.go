@@ -0,0 +1,401 @@
+package queue
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+// An example is a worked study of a realistic system. Besides printing its
+// report, it checks that the results hang together, so that running all of
+// them exercises most of the simulator end to end.
+type example struct {
+	name        string
+	description string
+	run         func(seed int64, reps int, c *checker)
+}
+
+var examples = []example{
+	{"bank", "bank branch staffing over a day with a lunch rush and staggered breaks", bankExample},
+	{"clinic", "clinic with doctors on shifts, a booking calendar and walk-ins", clinicExample},
+	{"callcenter", "call center where callers hang up when kept waiting", callCenterExample},
+	{"web", "web service adding instances on a schedule for the midday peak", webExample},
+}
+
+// checker collects the checks an example makes and the ones that failed.
+type checker struct {
+	checks   int
+	failures []string
+}
+
+func (c *checker) expect(ok bool, format string, args ...any) {
+	c.checks++
+	if !ok {
+		c.failures = append(c.failures, fmt.Sprintf(format, args...))
+	}
+}
+
+// checkResult makes the checks that hold for any run: every customer is
+// either served or gives up, and no server is busy longer than the doors
+// are open plus the overtime.
+func (c *checker) checkResult(r SimulationResult) {
+	served := 0
+	for j, sv := range r.Servers {
+		served += sv.Customers
+		c.expect(sv.BusyTime >= 0 && sv.BusyTime <= r.TotalTime+r.Overtime, "server %d busy for %d minutes in a %d minute day", j, sv.BusyTime, r.TotalTime+r.Overtime)
+	}
+	c.expect(served+r.Abandoned == r.TotalCustomers, "%d served and %d abandoned out of %d customers", served, r.Abandoned, r.TotalCustomers)
+	c.expect(served == 0 || r.AverageWaitTime >= 0, "average wait time %f", r.AverageWaitTime)
+	c.expect(r.Overtime >= 0, "overtime %d", r.Overtime)
+}
+
+// replicate runs reps replications of n configurations, where sim returns
+// configuration i with the given seed. Every configuration sees the same
+// seeds, and the results come back per configuration.
+func replicate(seed int64, reps, n int, sim func(i int, seed int64) *Simulation, c *checker) [][]SimulationResult {
+	rng := rand.New(rand.NewSource(seed))
+	seeds := make([]int64, reps)
+	for k := range seeds {
+		seeds[k] = rng.Int63()
+	}
+	var sims []*Simulation
+	for i := range n {
+		for _, seed := range seeds {
+			sims = append(sims, sim(i, seed))
+		}
+	}
+	results := simulateAll(sims)
+	for _, r := range results {
+		c.checkResult(r)
+	}
+	byConfig := make([][]SimulationResult, n)
+	for i := range byConfig {
+		byConfig[i] = results[i*reps : (i+1)*reps]
+	}
+	return byConfig
+}
+
+// average returns the mean of f over results.
+func average(results []SimulationResult, f func(SimulationResult) float64) float64 {
+	total := float64(0)
+	for _, r := range results {
+		total += f(r)
+	}
+	return total / float64(len(results))
+}
+
+func meanUtilization(r SimulationResult) float64 {
+	total := float64(0)
+	for _, sv := range r.Servers {
+		total += sv.Utilization
+	}
+	return total / float64(len(r.Servers))
+}
+
+func bankExample(seed int64, reps int, c *checker) {
+	startTime := 9 * 60 // 09:00
+	endTime := 17 * 60  // 17:00
+	customerRate := 18.0
+	lunchRush := RatePeriod{Start: 12 * 60, End: 14 * 60, Rate: 30}
+	target := 5.0
+	catalog := []CustomerClass{
+		{Name: "deposit", Frequency: 0.40, Service: &Exponential{lambda: 1.0 / 4}},
+		{Name: "withdrawal", Frequency: 0.30, Service: Uniform{2, 6}},
+		{Name: "account opening", Frequency: 0.10, Service: NewLogNormal(25, 10)},
+		{Name: "loan application", Frequency: 0.05, Service: NewLogNormal(40, 15)},
+		{Name: "inquiry", Frequency: 0.15, Service: &Exponential{lambda: 1.0 / 6}},
+	}
+	minTellers, maxTellers := 3, 8
+
+	results := replicate(seed, reps, maxTellers-minTellers+1, func(i int, seed int64) *Simulation {
+		n := minTellers + i
+		opts := []Option{WithCatalog(catalog), WithArrivalProfile(lunchRush)}
+		for j := range n {
+			// half-hour lunches from 11:00 to 15:00, two tellers at a time
+			// at most
+			lunch := 11*60 + 30*(j%8)
+			opts = append(opts, WithBreaks(j, Shift{lunch, lunch + 30}))
+		}
+		return NewSimulation(startTime, endTime, n, customerRate, 6.0, seed, opts...)
+	}, c)
+
+	s := NewSimulation(startTime, endTime, 1, customerRate, 6.0, seed, WithCatalog(catalog))
+	fmt.Printf("Opening Hours      : %s-%s\n", formatTime(startTime), formatTime(endTime))
+	fmt.Printf("Arrival Rate       : %.2f customers/hour, %.2f during %s-%s\n", customerRate, lunchRush.Rate, formatTime(lunchRush.Start), formatTime(lunchRush.End))
+	fmt.Printf("Transaction Mix    : %s\n", formatMix(catalog))
+	fmt.Printf("Mean ServiceTime   : %.2f minutes\n", s.meanServiceTime(0))
+	fmt.Printf("Replications       : %d\n", reps)
+	fmt.Println()
+	fmt.Println("tellers,average_wait_time,utilization,overtime_minutes")
+	recommended := -1
+	prevWait := float64(0)
+	for i, rs := range results {
+		n := minTellers + i
+		wait := average(rs, func(r SimulationResult) float64 { return r.AverageWaitTime })
+		utilization := average(rs, meanUtilization)
+		overtime := average(rs, func(r SimulationResult) float64 { return float64(r.Overtime) })
+		fmt.Printf("%d,%.4f,%.4f,%.2f\n", n, wait, utilization, overtime)
+		if i > 0 {
+			c.expect(wait <= prevWait+0.1, "average wait rises from %.2f to %.2f minutes with %d tellers", prevWait, wait, n)
+		}
+		if recommended == -1 && wait <= target {
+			recommended = n
+		}
+		prevWait = wait
+	}
+	fmt.Println()
+	c.expect(recommended != -1, "no staffing up to %d tellers meets the %.0f minute target", maxTellers, target)
+	fmt.Printf("Recommendation     : %d tellers for an average wait of at most %.0f minutes\n", recommended, target)
+}
+
+func clinicExample(seed int64, reps int, c *checker) {
+	startTime := 8 * 60 // 08:00
+	endTime := 16 * 60  // 16:00
+	lastWalkIn := 15*60 + 30
+	customerRate := 2.0 // walk-ins
+	noShow := 0.1
+	lateness := Uniform{-10, 10}
+	visits := []CustomerClass{
+		{Name: "checkup", Frequency: 0.5, Service: Uniform{10, 20}},
+		{Name: "consultation", Frequency: 0.3, Service: NewLogNormal(20, 8)},
+		{Name: "vaccination", Frequency: 0.2, Service: Uniform{3, 7}},
+	}
+	doctors := []struct {
+		name          string
+		shift, breaks []Shift
+	}{
+		{"morning", []Shift{{8 * 60, 12 * 60}}, nil},
+		{"full day", []Shift{{8 * 60, 16 * 60}}, []Shift{{12 * 60, 13 * 60}}},
+		{"afternoon", []Shift{{12 * 60, 16 * 60}}, nil},
+	}
+
+	// every doctor on duty has a slot every 20 minutes until 15:40, taken by
+	// a rotation of visit types
+	rotation := []string{"checkup", "consultation", "checkup", "vaccination", "checkup"}
+	var appointments []Appointment
+	for t := startTime; t < endTime-20; t += 20 {
+		for _, d := range doctors {
+			onDuty := false
+			for _, w := range d.shift {
+				onDuty = onDuty || (t >= w.Start && t < w.End)
+			}
+			for _, b := range d.breaks {
+				onDuty = onDuty && (t < b.Start || t >= b.End)
+			}
+			if onDuty {
+				appointments = append(appointments, Appointment{Time: t, Category: rotation[len(appointments)%len(rotation)]})
+			}
+		}
+	}
+
+	results := replicate(seed, reps, 1, func(i int, seed int64) *Simulation {
+		opts := []Option{WithCatalog(visits), WithCutoff(lastWalkIn), WithAppointments(appointments, noShow, lateness)}
+		for j, d := range doctors {
+			opts = append(opts, WithShifts(j, d.shift...), WithBreaks(j, d.breaks...))
+		}
+		return NewSimulation(startTime, endTime, len(doctors), customerRate, 6.0, seed, opts...)
+	}, c)[0]
+
+	fmt.Printf("Opening Hours      : %s-%s, last walk-in at %s\n", formatTime(startTime), formatTime(endTime), formatTime(lastWalkIn))
+	fmt.Printf("Appointments       : %d, %.0f%% no-shows, up to %.0f minutes early or late\n", len(appointments), noShow*100, lateness.Max)
+	fmt.Printf("Walk-ins           : %.2f patients/hour\n", customerRate)
+	fmt.Printf("Visit Mix          : %s\n", formatMix(visits))
+	fmt.Printf("Replications       : %d\n", reps)
+	fmt.Println()
+	fmt.Println("doctor,scheduled_hours,patients,utilization")
+	for j, d := range doctors {
+		scheduled := results[0].Servers[j].ScheduledTime
+		want := 0
+		for _, w := range d.shift {
+			want += w.End - w.Start
+		}
+		for _, b := range d.breaks {
+			want -= b.End - b.Start
+		}
+		c.expect(scheduled == want, "%s doctor scheduled for %d minutes, want %d", d.name, scheduled, want)
+		patients := average(results, func(r SimulationResult) float64 { return float64(r.Servers[j].Customers) })
+		utilization := average(results, func(r SimulationResult) float64 { return r.Servers[j].Utilization })
+		c.expect(patients > 0, "%s doctor sees no patients", d.name)
+		fmt.Printf("%s,%.2f,%.2f,%.4f\n", d.name, float64(scheduled)/60, patients, utilization)
+	}
+	fmt.Println()
+
+	late := average(results, func(r SimulationResult) float64 {
+		if r.Overtime > 0 {
+			return 1
+		}
+		return 0
+	})
+	denied := average(results, func(r SimulationResult) float64 { return float64(r.Denied) })
+	c.expect(denied > 0, "no walk-ins turned away after %s", formatTime(lastWalkIn))
+	noShows := average(results, func(r SimulationResult) float64 { return float64(r.NoShows) })
+	c.expect(noShows > 0 && noShows < float64(len(appointments)), "%.2f no-shows out of %d appointments", noShows, len(appointments))
+	delay := average(results, func(r SimulationResult) float64 { return r.AverageAppointmentDelay })
+	c.expect(delay >= 0, "patients seen %.2f minutes after their appointment", delay)
+	fmt.Printf("Patients Seen      : %.2f\n", average(results, func(r SimulationResult) float64 { return float64(r.TotalCustomers) }))
+	fmt.Printf("Turned Away        : %.2f walk-ins\n", denied)
+	fmt.Printf("No-Shows           : %.2f\n", noShows)
+	fmt.Printf("Appointment Delay  : %.6f minutes\n", delay)
+	fmt.Printf("Average WaitTime   : %.6f minutes\n", average(results, func(r SimulationResult) float64 { return r.AverageWaitTime }))
+	fmt.Printf("Average Overtime   : %.2f minutes (%.1f%% of days)\n", average(results, func(r SimulationResult) float64 { return float64(r.Overtime) }), late*100)
+}
+
+func callCenterExample(seed int64, reps int, c *checker) {
+	startTime := 8 * 60 // 08:00
+	endTime := 20 * 60  // 20:00
+	callRate := 60.0
+	serviceRate := 12.0 // 5 minutes per call
+	patience := &Exponential{lambda: 1.0 / 3}
+	minAgents, maxAgents := 4, 8
+
+	// The last configuration is the largest team with callers who never
+	// hang up, to show what abandonment hides.
+	n := maxAgents - minAgents + 1
+	results := replicate(seed, reps, n+1, func(i int, seed int64) *Simulation {
+		if i == n {
+			return NewSimulation(startTime, endTime, maxAgents, callRate, serviceRate, seed)
+		}
+		return NewSimulation(startTime, endTime, minAgents+i, callRate, serviceRate, seed, WithPatience(patience))
+	}, c)
+
+	fmt.Printf("Opening Hours      : %s-%s\n", formatTime(startTime), formatTime(endTime))
+	fmt.Printf("Call Rate          : %.2f calls/hour, %.2f minutes each\n", callRate, 60/serviceRate)
+	fmt.Printf("Offered Load       : %.2f busy agents\n", callRate/serviceRate)
+	fmt.Printf("Mean Patience      : %.2f minutes\n", patience.Mean())
+	fmt.Printf("Replications       : %d\n", reps)
+	fmt.Println()
+	fmt.Println("agents,calls,abandoned_fraction,average_wait_answered,average_wait_abandoned,utilization")
+	prev := float64(1)
+	for i := range n {
+		rs := results[i]
+		abandoned := average(rs, func(r SimulationResult) float64 { return float64(r.Abandoned) / float64(r.TotalCustomers) })
+		fmt.Printf("%d,%.2f,%.4f,%.4f,%.4f,%.4f\n", minAgents+i,
+			average(rs, func(r SimulationResult) float64 { return float64(r.TotalCustomers) }),
+			abandoned,
+			average(rs, func(r SimulationResult) float64 { return r.AverageWaitTime }),
+			average(rs, func(r SimulationResult) float64 { return r.AverageAbandonWait }),
+			average(rs, meanUtilization))
+		c.expect(abandoned <= prev, "more callers hang up with %d agents than with %d", minAgents+i, minAgents+i-1)
+		prev = abandoned
+	}
+	c.expect(average(results[0], func(r SimulationResult) float64 { return float64(r.Abandoned) }) > 0, "nobody hangs up with %d agents", minAgents)
+	fmt.Println()
+
+	patient := results[n]
+	c.expect(average(patient, func(r SimulationResult) float64 { return float64(r.Abandoned) }) == 0, "callers without a patience limit hang up")
+	fmt.Printf("Without Abandonment: %d agents, average wait %.4f minutes (vs %.4f)\n", maxAgents,
+		average(patient, func(r SimulationResult) float64 { return r.AverageWaitTime }),
+		average(results[n-1], func(r SimulationResult) float64 { return r.AverageWaitTime }))
+}
+
+func webExample(seed int64, reps int, c *checker) {
+	startTime := 8 * 60 // 08:00
+	endTime := 18 * 60  // 18:00
+	requestRate := 60.0
+	peak := RatePeriod{Start: 10 * 60, End: 14 * 60, Rate: 150}
+	serviceRate := 15.0 // 4 minutes per request
+	scaleUp := Shift{9*60 + 45, 14*60 + 15}
+
+	configs := []struct {
+		name           string
+		always, onPeak int
+	}{
+		{"fixed 6", 6, 0},
+		{"fixed 12", 12, 0},
+		{"scheduled 6+6", 6, 6},
+	}
+	results := replicate(seed, reps, len(configs), func(i int, seed int64) *Simulation {
+		cfg := configs[i]
+		opts := []Option{WithArrivalProfile(peak)}
+		for j := cfg.always; j < cfg.always+cfg.onPeak; j++ {
+			opts = append(opts, WithShifts(j, scaleUp))
+		}
+		return NewSimulation(startTime, endTime, cfg.always+cfg.onPeak, requestRate, serviceRate, seed, opts...)
+	}, c)
+
+	fmt.Printf("Request Rate       : %.2f requests/hour, %.2f during %s-%s\n", requestRate, peak.Rate, formatTime(peak.Start), formatTime(peak.End))
+	fmt.Printf("Instance Capacity  : %.2f requests/hour\n", serviceRate)
+	fmt.Printf("Scale Up Window    : %s\n", scaleUp)
+	fmt.Printf("Replications       : %d\n", reps)
+	fmt.Println()
+	fmt.Println("config,instance_hours,average_wait_time,utilization,overtime_minutes")
+	var hours, wait []float64
+	for i, cfg := range configs {
+		rs := results[i]
+		h := average(rs, func(r SimulationResult) float64 {
+			total := 0
+			for _, sv := range r.Servers {
+				total += sv.ScheduledTime
+			}
+			return float64(total) / 60
+		})
+		w := average(rs, func(r SimulationResult) float64 { return r.AverageWaitTime })
+		fmt.Printf("%s,%.2f,%.4f,%.4f,%.2f\n", cfg.name, h, w, average(rs, meanUtilization), average(rs, func(r SimulationResult) float64 { return float64(r.Overtime) }))
+		hours = append(hours, h)
+		wait = append(wait, w)
+	}
+	fmt.Println()
+	c.expect(wait[2] < wait[0]/2, "scaling up does not halve the wait (%.2f vs %.2f minutes)", wait[2], wait[0])
+	c.expect(hours[2] < hours[1], "scheduled scaling costs %.2f instance hours, no less than %.2f for a fixed fleet", hours[2], hours[1])
+	fmt.Printf("Savings            : %.2f instance hours for %.4f more minutes of wait than the fixed 12\n", hours[1]-hours[2], wait[2]-wait[1])
+}
+
+// runExamples runs the named examples, or all of them, and reports an error
+// if any of their checks failed.
+func runExamples(seed int64, args []string) error {
+	fs := flag.NewFlagSet("example", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	reps := fs.Int("reps", 200, "number of replications to average over")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: queue example [flags] [name...]\n\nexamples:")
+		for _, e := range examples {
+			fmt.Fprintf(fs.Output(), "  %-11s %s\n", e.name, e.description)
+		}
+		fmt.Fprintln(fs.Output(), "\nflags:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	run := examples
+	if fs.NArg() > 0 {
+		run = nil
+		for _, name := range fs.Args() {
+			found := false
+			for _, e := range examples {
+				if e.name == name {
+					run = append(run, e)
+					found = true
+				}
+			}
+			if !found {
+				fs.Usage()
+				os.Exit(2)
+			}
+		}
+	}
+
+	var failed []string
+	for i, e := range run {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("== %s: %s\n\n", e.name, e.description)
+		c := &checker{}
+		e.run(seed, *reps, c)
+		fmt.Println()
+		if len(c.failures) > 0 {
+			for _, f := range c.failures {
+				fmt.Printf("FAIL %s: %s\n", e.name, f)
+			}
+			failed = append(failed, e.name)
+			continue
+		}
+		fmt.Printf("PASS: %d checks\n", c.checks)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("example: checks failed in %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package queue
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+// Observation is one customer in a log of real arrivals: the arrival time,
+// in minutes since midnight, and how long the service took, in minutes.
+type Observation struct {
+	Arrival float64
+	Service float64
+}
+
+// ReadObservations reads a log from CSV with a header line and the columns
+// arrival, as HH:MM or HH:MM:SS, and service minutes, e.g.
+//
+//	arrival,service
+//	08:06:13,8.20
+//	08:32:55,6.27
+func ReadObservations(r io.Reader) ([]Observation, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var log []Observation
+	for i, rec := range records[min(1, len(records)):] {
+		if len(rec) < 2 {
+			return nil, fmt.Errorf("line %d: want arrival,service", i+2)
+		}
+		arrival, err := parseClock(rec[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+2, err)
+		}
+		service, err := strconv.ParseFloat(rec[1], 64)
+		if err != nil || service < 0 {
+			return nil, fmt.Errorf("line %d: invalid service time %q", i+2, rec[1])
+		}
+		log = append(log, Observation{Arrival: arrival, Service: service})
+	}
+	if len(log) < 2 {
+		return nil, fmt.Errorf("need at least two observations")
+	}
+	sort.SliceStable(log, func(i, j int) bool { return log[i].Arrival < log[j].Arrival })
+	return log, nil
+}
+
+// LoadObservations reads a log from a CSV file, see ReadObservations.
+func LoadObservations(path string) ([]Observation, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	log, err := ReadObservations(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return log, nil
+}
+
+// Fit holds maximum likelihood estimates of the arrival and service rates
+// of a log, in customers per hour, assuming Poisson arrivals and
+// exponential service times, with Kolmogorov-Smirnov tests of both
+// assumptions.
+type Fit struct {
+	Customers                 int
+	FirstArrival, LastArrival float64
+
+	CustomerRate, ServerRate float64
+	// approximate 95% confidence intervals of the rates
+	CustomerRateLo, CustomerRateHi float64
+	ServerRateLo, ServerRateHi     float64
+	// ServiceCV is the coefficient of variation of the service times,
+	// which is 1 for the exponential distribution.
+	ServiceCV float64
+
+	InterarrivalKS, InterarrivalP float64
+	ServiceKS, ServiceP           float64
+}
+
+// FitObservations estimates the rates of a log sorted by arrival time, as
+// read by ReadObservations.
+func FitObservations(log []Observation) (Fit, error) {
+	if len(log) < 2 {
+		return Fit{}, fmt.Errorf("need at least two observations")
+	}
+	f := Fit{Customers: len(log), FirstArrival: log[0].Arrival, LastArrival: log[len(log)-1].Arrival}
+	var gaps, served []float64
+	for i, o := range log {
+		if i > 0 {
+			gaps = append(gaps, o.Arrival-log[i-1].Arrival)
+		}
+		served = append(served, o.Service)
+	}
+
+	// The MLE of an exponential rate is one over the sample mean.
+	meanGap := (f.LastArrival - f.FirstArrival) / float64(len(gaps))
+	meanService, sq := float64(0), float64(0)
+	for _, s := range served {
+		meanService += s / float64(len(served))
+	}
+	for _, s := range served {
+		sq += (s - meanService) * (s - meanService) / float64(len(served)-1)
+	}
+	if meanGap <= 0 || meanService <= 0 {
+		return Fit{}, fmt.Errorf("arrivals or service times are all zero")
+	}
+	f.CustomerRate = 60 / meanGap
+	f.ServerRate = 60 / meanService
+	f.ServiceCV = math.Sqrt(sq) / meanService
+	// the MLE of a rate has a standard error of rate/sqrt(n)
+	ea, es := 1.96/math.Sqrt(float64(len(gaps))), 1.96/math.Sqrt(float64(len(served)))
+	f.CustomerRateLo, f.CustomerRateHi = f.CustomerRate*(1-ea), f.CustomerRate*(1+ea)
+	f.ServerRateLo, f.ServerRateHi = f.ServerRate*(1-es), f.ServerRate*(1+es)
+
+	arrivals := &Exponential{lambda: 1 / meanGap}
+	service := &Exponential{lambda: 1 / meanService}
+	f.InterarrivalKS = ksStatistic(gaps, arrivals.CDF)
+	f.InterarrivalP = ksPValue(f.InterarrivalKS, len(gaps))
+	f.ServiceKS = ksStatistic(served, service.CDF)
+	f.ServiceP = ksPValue(f.ServiceKS, len(served))
+	return f, nil
+}
+
+// Simulation returns a simulation of nServers servers with the fitted
+// rates.
+func (f Fit) Simulation(startTime, endTime, nServers int, seed int64, opts ...Option) *Simulation {
+	return NewSimulation(startTime, endTime, nServers, f.CustomerRate, f.ServerRate, seed, opts...)
+}
+
+func fitLog(seed int64, args []string) {
+	fs := flag.NewFlagSet("fit", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	path := fs.String("log", "observed.csv", "CSV `file` of arrival times and service minutes")
+	nServers := fs.Int("servers", 2, "number of servers to simulate with the fitted rates")
+	reps := fs.Int("reps", 1000, "number of replications to average over")
+	fs.Parse(args)
+	checkServers("servers", *nServers)
+
+	log, err := LoadObservations(*path)
+	exitOnError(err)
+	f, err := FitObservations(log)
+	exitOnError(err)
+
+	fit := func(p float64) string {
+		if p < 0.05 {
+			return "rejected at 5%"
+		}
+		return "not rejected"
+	}
+	fmt.Printf("Observations       : %d customers, %s to %s\n", f.Customers, formatClock(f.FirstArrival), formatClock(f.LastArrival))
+	fmt.Printf("Arrival Rate       : %.4f customers/hour (95%% CI %.4f-%.4f)\n", f.CustomerRate, f.CustomerRateLo, f.CustomerRateHi)
+	fmt.Printf("Service Rate       : %.4f customers/hour (95%% CI %.4f-%.4f), %.4f minutes each\n", f.ServerRate, f.ServerRateLo, f.ServerRateHi, 60/f.ServerRate)
+	fmt.Printf("Service CV         : %.4f (1 for exponential)\n", f.ServiceCV)
+	fmt.Printf("Interarrival Fit   : KS D = %.4f, p = %.4f, exponential %s\n", f.InterarrivalKS, f.InterarrivalP, fit(f.InterarrivalP))
+	fmt.Printf("Service Fit        : KS D = %.4f, p = %.4f, exponential %s\n", f.ServiceKS, f.ServiceP, fit(f.ServiceP))
+	fmt.Println()
+
+	// simulate whole hours around the observed arrivals
+	startTime := int(f.FirstArrival) / 60 * 60
+	endTime := (int(f.LastArrival)/60 + 1) * 60
+	rng := rand.New(rand.NewSource(seed))
+	sims := make([]*Simulation, *reps)
+	for i := range sims {
+		sims[i] = f.Simulation(startTime, endTime, *nServers, rng.Int63())
+	}
+	wait := float64(0)
+	for _, r := range simulateAll(sims) {
+		wait += r.AverageWaitTime / float64(*reps)
+	}
+	fmt.Printf("Simulation         : NewSimulation(%d, %d, %d, %.4f, %.4f, seed)\n", startTime, endTime, *nServers, f.CustomerRate, f.ServerRate)
+	fmt.Printf("Average WaitTime   : %.6f minutes over %d replications of %s-%s\n", wait, *reps, formatTime(startTime), formatTime(endTime))
+}
@@ -0,0 +1,122 @@
+package queue
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Segment is a stretch of time a server spent serving a customer, cut short
+// if a breakdown interrupted it, in clock ticks.
+type Segment struct {
+	Server, Customer int
+	Start, End       int
+	Interrupted      bool
+}
+
+// timeline collects the segments of every server from the events of a run.
+type timeline struct {
+	segments []Segment
+	open     map[int]int // segment of every customer in service
+}
+
+func newTimeline() *timeline {
+	return &timeline{open: map[int]int{}}
+}
+
+func (tl *timeline) add(e CustomerEvent) {
+	c := e.Customer
+	switch e.Kind {
+	case CustomerStarted:
+		tl.open[c.Index] = len(tl.segments)
+		tl.segments = append(tl.segments, Segment{Server: c.Server, Customer: c.Index, Start: e.Time})
+	case CustomerServed, CustomerInterrupted:
+		i, ok := tl.open[c.Index]
+		if !ok {
+			return
+		}
+		delete(tl.open, c.Index)
+		tl.segments[i].End = e.Time
+		tl.segments[i].Interrupted = e.Kind == CustomerInterrupted
+	}
+}
+
+// writeGanttCSV writes the segments of a run with the given clock ticks per
+// minute as CSV, times in minutes since midnight.
+func writeGanttCSV(w io.Writer, segments []Segment, tick int) error {
+	k := float64(tick)
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "server,customer,start,end,interrupted")
+	for _, sg := range segments {
+		fmt.Fprintf(bw, "%d,%d,%g,%g,%t\n", sg.Server, sg.Customer, float64(sg.Start)/k, float64(sg.End)/k, sg.Interrupted)
+	}
+	return bw.Flush()
+}
+
+// writeGanttSVG draws the segments as a Gantt chart, a row per server from
+// start to the end of the last segment, with the closing time end dashed.
+// Every customer has a color of its own, and interrupted segments a red
+// outline. start and end are in minutes and the segments in clock ticks,
+// tick to the minute.
+func writeGanttSVG(w io.Writer, segments []Segment, nServers, start, end, tick int) error {
+	const (
+		left, right, top = 80, 20, 20
+		width            = 1000
+		row, bar         = 30, 20
+	)
+	stop := end
+	for _, sg := range segments {
+		stop = max(stop, (sg.End+tick-1)/tick)
+	}
+	scale := float64(width-left-right) / float64(max(stop-start, 1))
+	x := func(t float64) float64 { return left + (t-float64(start))*scale }
+	minutes := func(t int) float64 { return float64(t) / float64(tick) }
+	clock := func(t float64) string {
+		if tick == 1 {
+			return formatTime(int(t))
+		}
+		return formatClock(t)
+	}
+	height := top + nServers*row + 30
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="11">`+"\n", width, height)
+	for j := range nServers {
+		y := top + j*row
+		fmt.Fprintf(bw, `<text x="%d" y="%d">server %d</text>`+"\n", 8, y+bar-6, j)
+		fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" fill="#f4f4f4"/>`+"\n", left, y, width-left-right, bar)
+	}
+	for _, sg := range segments {
+		stroke := ""
+		if sg.Interrupted {
+			stroke = ` stroke="#c00" stroke-width="2"`
+		}
+		fmt.Fprintf(bw, `<rect x="%.2f" y="%d" width="%.2f" height="%d" fill="hsl(%d,55%%,60%%)"%s><title>customer %d, %s-%s</title></rect>`+"\n",
+			x(minutes(sg.Start)), top+sg.Server*row, minutes(sg.End-sg.Start)*scale, bar, sg.Customer*137%360, stroke, sg.Customer, clock(minutes(sg.Start)), clock(minutes(sg.End)))
+	}
+	axis := top + nServers*row
+	for t := start - start%60; t <= stop; t += 60 {
+		if t < start {
+			continue
+		}
+		fmt.Fprintf(bw, `<line x1="%.2f" y1="%d" x2="%.2f" y2="%d" stroke="#888"/>`+"\n", x(float64(t)), axis-row+bar, x(float64(t)), axis+4)
+		fmt.Fprintf(bw, `<text x="%.2f" y="%d" text-anchor="middle">%s</text>`+"\n", x(float64(t)), axis+16, formatTime(t))
+	}
+	fmt.Fprintf(bw, `<line x1="%.2f" y1="%d" x2="%.2f" y2="%d" stroke="#000" stroke-dasharray="4"/>`+"\n", x(float64(end)), top, x(float64(end)), axis)
+	fmt.Fprintln(bw, "</svg>")
+	return bw.Flush()
+}
+
+// writeFile creates the file at path and fills it with write.
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
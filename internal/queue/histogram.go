@@ -0,0 +1,123 @@
+package queue
+
+import "math/bits"
+
+// histogram counts non-negative whole-tick durations, so that quantiles
+// can be read off without keeping every sample. Durations below
+// histogramExact are counted exactly; longer ones in buckets of a 1024th of
+// their power of two, so that however long the waits the counts take at
+// most about 900 KB and quantiles are off by less than 0.1%.
+type histogram struct {
+	counts []int // by bucket
+	n      int
+	sum    int
+	top    int // the largest sample
+}
+
+const (
+	histogramExactBits  = 16
+	histogramExact      = 1 << histogramExactBits
+	histogramBucketBits = 10 // buckets per power of two above histogramExact, as bits
+)
+
+// bucket returns the index in counts of the bucket of v.
+func bucket(v int) int {
+	if v < histogramExact {
+		return v
+	}
+	octave := bits.Len(uint(v)) - 1
+	shift := octave - histogramBucketBits
+	return histogramExact + (octave-histogramExactBits)<<histogramBucketBits + v>>shift - 1<<histogramBucketBits
+}
+
+// bucketBounds returns the smallest and the largest value of bucket i.
+func bucketBounds(i int) (int, int) {
+	if i < histogramExact {
+		return i, i
+	}
+	k := i - histogramExact
+	shift := k>>histogramBucketBits + histogramExactBits - histogramBucketBits
+	lo := (k&(1<<histogramBucketBits-1) + 1<<histogramBucketBits) << shift
+	return lo, lo + 1<<shift - 1
+}
+
+func (h *histogram) add(v int) {
+	v = max(v, 0)
+	i := bucket(v)
+	for len(h.counts) <= i {
+		h.counts = append(h.counts, 0)
+	}
+	h.counts[i]++
+	h.n++
+	h.sum += v
+	h.top = max(h.top, v)
+}
+
+// mean returns the mean, 0 with no samples.
+func (h *histogram) mean() float64 {
+	return ratio(h.sum, h.n)
+}
+
+// variance returns the sample variance, 0 with fewer than two samples.
+// Samples in a bucket count as its midpoint.
+func (h *histogram) variance() float64 {
+	if h.n < 2 {
+		return 0
+	}
+	m, ss := h.mean(), float64(0)
+	for i, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		lo, hi := bucketBounds(i)
+		v := float64(lo+hi) / 2
+		ss += float64(c) * (v - m) * (v - m)
+	}
+	return ss / float64(h.n-1)
+}
+
+// quantile returns the smallest value v such that at least a fraction q of
+// the samples are at most v, or above histogramExact the largest value of
+// its bucket.
+func (h *histogram) quantile(q float64) int {
+	need := q * float64(h.n)
+	seen := 0
+	for i, c := range h.counts {
+		seen += c
+		if c > 0 && float64(seen) >= need {
+			_, hi := bucketBounds(i)
+			return min(hi, h.top)
+		}
+	}
+	return h.max()
+}
+
+func (h *histogram) max() int {
+	return h.top
+}
+
+// within returns the fraction of the samples that are at most v, counting
+// the samples in the bucket of v.
+func (h *histogram) within(v int) float64 {
+	seen, last := 0, bucket(v)
+	for i, c := range h.counts {
+		if i > last {
+			break
+		}
+		seen += c
+	}
+	return float64(seen) / float64(h.n)
+}
+
+// merge adds the samples of o.
+func (h *histogram) merge(o histogram) {
+	for len(h.counts) < len(o.counts) {
+		h.counts = append(h.counts, 0)
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	h.n += o.n
+	h.sum += o.sum
+	h.top = max(h.top, o.top)
+}
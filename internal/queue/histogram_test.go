@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestHistogramExact(t *testing.T) {
+	var h histogram
+	for _, v := range []int{5, 1, 3, 3, 9, 0, 7, -2} {
+		h.add(v)
+	}
+	for _, tc := range []struct {
+		q    float64
+		want int
+	}{{0, 0}, {0.25, 0}, {0.5, 3}, {0.75, 5}, {0.9, 9}, {1, 9}} {
+		if got := h.quantile(tc.q); got != tc.want {
+			t.Errorf("quantile(%g) = %d, want %d", tc.q, got, tc.want)
+		}
+	}
+	if h.max() != 9 || h.n != 8 || h.sum != 28 {
+		t.Errorf("max %d, n %d, sum %d, want 9, 8 and 28", h.max(), h.n, h.sum)
+	}
+	if got := h.within(3); got != 5.0/8 {
+		t.Errorf("within(3) = %g, want %g", got, 5.0/8)
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	last := -1
+	for v := 0; v < 1<<22; v += 1 + v/5000 {
+		i := bucket(v)
+		lo, hi := bucketBounds(i)
+		if v < lo || v > hi {
+			t.Fatalf("%d is in bucket %d of [%d, %d]", v, i, lo, hi)
+		}
+		if i < last {
+			t.Fatalf("bucket(%d) = %d comes before bucket %d", v, i, last)
+		}
+		if float64(hi-lo) > float64(lo)/1000 {
+			t.Fatalf("bucket %d of [%d, %d] is too wide", i, lo, hi)
+		}
+		last = i
+	}
+	if lo, hi := bucketBounds(bucket(math.MaxInt)); hi != math.MaxInt || lo > hi {
+		t.Errorf("the last bucket is [%d, %d]", lo, hi)
+	}
+}
+
+func TestHistogramBounded(t *testing.T) {
+	var h histogram
+	h.add(1e12 * 60)
+	h.add(3)
+	if len(h.counts) > 120000 {
+		t.Errorf("%d counts for a wait of 6e13 ticks", len(h.counts))
+	}
+	if h.max() != 1e12*60 || h.quantile(1) != 1e12*60 || h.quantile(0.5) != 3 {
+		t.Errorf("max %d, median %d", h.max(), h.quantile(0.5))
+	}
+}
+
+func TestHistogramLongWaits(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var h histogram
+	top := 0
+	for range 100000 {
+		v := int(rng.ExpFloat64() * 1e6)
+		top = max(top, v)
+		h.add(v)
+	}
+	// the median of the exponential of mean 1e6
+	want := 1e6 * math.Ln2
+	if got := float64(h.quantile(0.5)); math.Abs(got-want) > 0.02*want {
+		t.Errorf("median %g, want about %g", got, want)
+	}
+	if h.max() != top {
+		t.Errorf("max %d, want %d", h.max(), top)
+	}
+	sd := math.Sqrt(h.variance())
+	if math.Abs(sd-1e6) > 0.02*1e6 {
+		t.Errorf("standard deviation %g, want about 1e6", sd)
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	var a, b, all histogram
+	for v := range 1000 {
+		w := v * v * 7
+		all.add(w)
+		if v%3 == 0 {
+			a.add(w)
+		} else {
+			b.add(w)
+		}
+	}
+	a.merge(b)
+	for _, q := range []float64{0.1, 0.5, 0.9, 0.99, 1} {
+		if a.quantile(q) != all.quantile(q) {
+			t.Errorf("quantile(%g) of the merge %d, want %d", q, a.quantile(q), all.quantile(q))
+		}
+	}
+	if a.n != all.n || a.sum != all.sum || a.max() != all.max() {
+		t.Errorf("merge has n %d, sum %d, max %d, want %d, %d, %d", a.n, a.sum, a.max(), all.n, all.sum, all.max())
+	}
+}
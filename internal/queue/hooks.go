@@ -0,0 +1,58 @@
+package queue
+
+// Hooks are functions a run calls as things happen to customers, to collect
+// statistics of one's own or to decide who comes in without changing the
+// engine. Any may be nil. They are called on the goroutine of the run, in
+// order of time, so hooks shared by simulations run at once, as by
+// simulateAll, must guard their own state.
+type Hooks struct {
+	// OnArrival is called as a customer comes in, with InSystem and
+	// Waiting counting those already inside. Returning false turns the
+	// customer away, counted in the result's Denied; a customer of a
+	// closed system turned away does not come back. Whether or not it
+	// does, the random numbers of the run stay the same.
+	OnArrival func(CustomerEvent) bool
+	// OnServiceStart is called as a server starts, or resumes, the
+	// service of a customer.
+	OnServiceStart func(CustomerEvent)
+	// OnDeparture is called as a customer leaves after service.
+	OnDeparture func(CustomerEvent)
+	// OnRenege is called as a customer leaves the line out of patience,
+	// see WithPatience.
+	OnRenege func(CustomerEvent)
+}
+
+// WithHooks has the run call the hooks h.
+func WithHooks(h Hooks) Option {
+	return func(s *Simulation) {
+		s.hooks = &h
+	}
+}
+
+// admitted asks the admission policy and the OnArrival hook, if any,
+// whether customer c, arriving at time t, may come in.
+func (r *run) admitted(t int, c *Customer) bool {
+	h := r.s.hooks
+	admit := r.s.admission == nil || r.s.admission.Admit(PolicyView{r, t}, *c)
+	if admit && (h == nil || h.OnArrival == nil || h.OnArrival(r.customerEvent(CustomerArrived, t, c))) {
+		return true
+	}
+	r.denied++
+	return false
+}
+
+// call passes event e to the hook for its kind, if any.
+func (h *Hooks) call(e CustomerEvent) {
+	var f func(CustomerEvent)
+	switch e.Kind {
+	case CustomerStarted:
+		f = h.OnServiceStart
+	case CustomerServed:
+		f = h.OnDeparture
+	case CustomerAbandoned:
+		f = h.OnRenege
+	}
+	if f != nil {
+		f(e)
+	}
+}
@@ -0,0 +1,52 @@
+package queue
+
+// LittlesLaw holds the three quantities of Little's law, L = λW, each
+// measured on its own: L as the time average of the number of customers in
+// the system, λ from the number of arrivals, and W from the arrival and
+// departure times of every customer, served or abandoned.
+type LittlesLaw struct {
+	L      float64 // customers
+	Lambda float64 // customers per minute
+	W      float64 // minutes
+}
+
+// Discrepancy returns L-λW relative to L.
+func (l LittlesLaw) Discrepancy() float64 {
+	if l.L == 0 {
+		return 0
+	}
+	return (l.L - l.Lambda*l.W) / l.L
+}
+
+// accumulate adds the customers in the system since the last change to the
+// area under the count, and the time to that spent with as many, at time t.
+func (r *run) accumulate(t int) {
+	r.area += r.inSystem * (t - r.lastChange)
+	if len(r.timeAt) <= r.inSystem {
+		r.timeAt = append(r.timeAt, make([]int, r.inSystem+1-len(r.timeAt))...)
+	}
+	r.timeAt[r.inSystem] += t - r.lastChange
+	r.lastChange = t
+}
+
+// littlesLaw returns Little's law over the whole run and over the opening
+// hours. The run starts and ends empty, so the law holds exactly over the
+// whole of it and any discrepancy is a bookkeeping error. Over the opening
+// hours the customers still in the system at endTime bias it.
+func (r *run) littlesLaw() (all, open LittlesLaw) {
+	if r.customers == 0 {
+		return
+	}
+	// spans count ticks, and λ and W are in minutes
+	k := float64(r.s.tick)
+	w := float64(r.timeInSystem) / float64(r.customers) / k
+	if span := float64(r.lastChange - r.s.startTime); span > 0 {
+		all = LittlesLaw{L: float64(r.area) / span, Lambda: float64(r.customers) / span * k, W: w}
+	} else {
+		// everyone came and went at startTime
+		all = LittlesLaw{W: w}
+	}
+	hours := float64(r.s.endTime - r.s.startTime)
+	open = LittlesLaw{L: float64(r.openArea) / hours, Lambda: float64(r.customers) / hours * k, W: w}
+	return all, open
+}
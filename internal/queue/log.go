@@ -0,0 +1,117 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+)
+
+// Log levels of a simulation, from the least to the most output: Quiet only
+// logs warnings, Summary a line per run, Customer every customer and Debug
+// every event.
+const (
+	LevelQuiet    = slog.LevelWarn
+	LevelSummary  = slog.LevelInfo
+	LevelCustomer = slog.Level(-2)
+	LevelDebug    = slog.LevelDebug
+)
+
+var logLevelNames = map[slog.Level]string{
+	LevelQuiet:    "quiet",
+	LevelSummary:  "summary",
+	LevelCustomer: "customer",
+	LevelDebug:    "debug",
+}
+
+// ParseLogLevel parses quiet, summary, customer or debug.
+func ParseLogLevel(s string) (slog.Level, error) {
+	for level, name := range logLevelNames {
+		if name == s {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q, want quiet, summary, customer or debug", s)
+}
+
+// WithLogger logs the simulation to l, at the levels LevelQuiet, which only
+// warns of an unstable queue, LevelSummary, LevelCustomer and LevelDebug.
+// Records carry the simulated time as "at"; the handler's own time is the
+// wall clock.
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Simulation) {
+		s.logger = l
+	}
+}
+
+// newTextHandler returns a handler writing text lines at the given level
+// and above, without the wall clock time and with the level names of
+// ParseLogLevel.
+func newTextHandler(w io.Writer, level slog.Level) slog.Handler {
+	return slog.NewTextHandler(w, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) > 0 {
+				return a
+			}
+			switch a.Key {
+			case slog.TimeKey:
+				return slog.Attr{}
+			case slog.LevelKey:
+				if name, ok := logLevelNames[a.Value.Any().(slog.Level)]; ok {
+					return slog.String(a.Key, name)
+				}
+			}
+			return a
+		},
+	})
+}
+
+// newLogger returns a logger for the command line at the named level,
+// writing to the file at path, or to standard output if path is empty, and
+// a function that closes the file.
+func newLogger(level, path string) (*slog.Logger, func() error, error) {
+	l, err := ParseLogLevel(level)
+	if err != nil {
+		return nil, nil, err
+	}
+	if path == "" {
+		return slog.New(newTextHandler(os.Stdout, l)), func() error { return nil }, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return slog.New(newTextHandler(f, l)), f.Close, nil
+}
+
+// logs reports whether the run logs at level, so that the attributes of a
+// record are only built when needed.
+func (r *run) logs(level slog.Level) bool {
+	return r.log != nil && r.log.Enabled(context.Background(), level)
+}
+
+func (r *run) logAttrs(level slog.Level, msg string, attrs ...slog.Attr) {
+	r.log.LogAttrs(context.Background(), level, msg, attrs...)
+}
+
+// at is the attribute of a simulated time t, in ticks.
+func (r *run) at(t int) slog.Attr {
+	return r.clockAttr("at", t)
+}
+
+// clockAttr is an attribute of a time of day t, in ticks.
+func (r *run) clockAttr(key string, t int) slog.Attr {
+	return slog.String(key, r.s.clock(t))
+}
+
+// durationAttr is an attribute of a duration d, in ticks, written in
+// minutes to four decimals.
+func (r *run) durationAttr(key string, d int) slog.Attr {
+	if r.s.tick == 1 {
+		return slog.Int(key, d)
+	}
+	return slog.Float64(key, math.Round(r.s.minutes(d)*1e4)/1e4)
+}
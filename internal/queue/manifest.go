@@ -0,0 +1,376 @@
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version is the version of the simulation engine. It changes whenever the
+// same scenario and seed may give different numbers.
+const Version = "1.0"
+
+// Manifest is what it takes to run a result again: the command line that
+// ran it, or the scenario for a run of the HTTP API, the files it read, the
+// seed, from which the seeds of all replications derive, the engine
+// version, the commit the program was built from, if known, and when it
+// ran.
+type Manifest struct {
+	Command  string    `json:"command"`
+	Args     []string  `json:"args,omitempty"`
+	Scenario *Scenario `json:"scenario,omitempty"`
+	Inputs   []Input   `json:"inputs,omitempty"`
+	Seed     int64     `json:"seed"`
+	Version  string    `json:"version"`
+	// Commit ends in -dirty if the program was built from modified files.
+	Commit string    `json:"commit,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// Input is a file a command read, such as a catalog or the observations of
+// an empirical distribution, with its SHA-256 and, up to maxInputContent
+// bytes, its contents.
+type Input struct {
+	Path    string `json:"path"`
+	SHA256  string `json:"sha256"`
+	Content []byte `json:"content,omitempty"`
+}
+
+const maxInputContent = 1 << 20
+
+// inputs are the files read so far through openInput, for the manifest.
+var inputs struct {
+	mu    sync.Mutex
+	files []Input
+}
+
+// openInput opens a file the simulation reads and notes it in the inputs.
+func openInput(path string) (io.ReadCloser, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(b)
+	in := Input{Path: path, SHA256: hex.EncodeToString(sum[:])}
+	if len(b) <= maxInputContent {
+		in.Content = b
+	}
+	inputs.mu.Lock()
+	defer inputs.mu.Unlock()
+	if !slices.ContainsFunc(inputs.files, func(f Input) bool { return f.Path == in.Path && f.SHA256 == in.SHA256 }) {
+		inputs.files = append(inputs.files, in)
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+// readInputs returns the inputs read so far.
+func readInputs() []Input {
+	inputs.mu.Lock()
+	defer inputs.mu.Unlock()
+	return slices.Clone(inputs.files)
+}
+
+func newManifest(command string, args []string, seed int64) Manifest {
+	return Manifest{Command: command, Args: args, Seed: seed, Version: Version, Commit: buildCommit(), Time: time.Now().UTC().Truncate(time.Second)}
+}
+
+// scenarioManifest is the manifest of a run of scenario sc by the HTTP API.
+func scenarioManifest(sc Scenario) Manifest {
+	m := newManifest("serve", nil, sc.Seed)
+	m.Scenario = &sc
+	return m
+}
+
+// buildCommit returns the commit the program was built from, as the go
+// command records it when building a module in a repository, or "".
+func buildCommit() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	var commit string
+	dirty := false
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			commit = s.Value
+		case "vcs.modified":
+			dirty = s.Value == "true"
+		}
+	}
+	if commit != "" && dirty {
+		commit += "-dirty"
+	}
+	return commit
+}
+
+// commandSeed returns the seed a command runs with: that of its -seed flag,
+// or seed if there is none.
+func commandSeed(args []string, seed int64) int64 {
+	for i := 0; i < len(args); i++ {
+		name, value, ok := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasPrefix(args[i], "-") || name != "seed" {
+			continue
+		}
+		if !ok && i+1 < len(args) {
+			value = args[i+1]
+		}
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			seed = n
+		}
+	}
+	return seed
+}
+
+// isCommand reports whether cmd is one of the commands of usage.
+func isCommand(cmd string) bool {
+	for _, line := range strings.Split(usage, "\n") {
+		if f := strings.Fields(line); strings.HasPrefix(line, "  ") && len(f) > 0 && f[0] == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+// manifestPrefix starts the line of the manifest that a command writes to
+// standard error once it is done.
+const manifestPrefix = "# manifest: "
+
+func printManifest(w io.Writer, m Manifest) {
+	b, _ := json.Marshal(m)
+	fmt.Fprintln(w, manifestPrefix+string(b))
+}
+
+// recorded is a manifest found in an export, with the result recorded next
+// to it, if any.
+type recorded struct {
+	Manifest Manifest
+	Result   *SimulationResult
+}
+
+// readManifest finds the manifest in a file the simulator wrote: the output
+// of a command, a response of the HTTP API or a store of experiments, of
+// which it takes experiment id.
+func readManifest(path string, id int) (recorded, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return recorded{}, err
+	}
+	if bytes.HasPrefix(b, []byte(sqliteHeader)) {
+		return storedManifest(path, id)
+	}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(nil, 64<<20)
+	for sc.Scan() {
+		line := sc.Bytes()
+		if rest, ok := bytes.CutPrefix(line, []byte(manifestPrefix)); ok {
+			var m Manifest
+			if err := json.Unmarshal(rest, &m); err != nil {
+				return recorded{}, fmt.Errorf("%s: invalid manifest: %v", path, err)
+			}
+			return recorded{Manifest: m}, nil
+		}
+		if !bytes.HasPrefix(bytes.TrimSpace(line), []byte("{")) {
+			continue
+		}
+		// a response of the HTTP API
+		var v struct {
+			Manifest *Manifest        `json:"manifest"`
+			Result   SimulationResult `json:"result"`
+		}
+		if err := json.Unmarshal(line, &v); err != nil {
+			return recorded{}, fmt.Errorf("%s: %v", path, err)
+		}
+		if v.Manifest != nil {
+			return recorded{Manifest: *v.Manifest, Result: &v.Result}, nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return recorded{}, err
+	}
+	return recorded{}, fmt.Errorf("no manifest in %s", path)
+}
+
+// storedManifest finds experiment id in the store of experiments at path.
+func storedManifest(path string, id int) (recorded, error) {
+	all, err := readStore(path)
+	if err != nil {
+		return recorded{}, err
+	}
+	if id <= 0 {
+		return recorded{}, fmt.Errorf("%s is a store of experiments, give the -id of one", path)
+	}
+	for _, e := range all {
+		if e.ID == id {
+			return e.recorded(), nil
+		}
+	}
+	return recorded{}, fmt.Errorf("no experiment %d in %s", id, path)
+}
+
+// recorded returns the manifest of a stored experiment, with its result.
+func (e Experiment) recorded() recorded {
+	m := Manifest{Command: e.Command, Args: e.Args, Seed: e.Scenario.Seed, Version: e.Version, Commit: e.Commit, Time: e.Time}
+	if e.Command == "serve" {
+		m.Scenario = &e.Scenario
+	}
+	return recorded{Manifest: m, Result: &e.Result}
+}
+
+// withoutFlag returns args without the flag name and its value.
+func withoutFlag(args []string, name string) []string {
+	var kept []string
+	for i := 0; i < len(args); i++ {
+		flag, _, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasPrefix(args[i], "-") || flag != name {
+			kept = append(kept, args[i])
+			continue
+		}
+		if !hasValue {
+			i++
+		}
+	}
+	return kept
+}
+
+func replay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	id := fs.Int("id", 0, "with a store of experiments, the `ID` of the one to run again")
+	output := fs.String("output", "", "the standard output of the command run, to check the new one against")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: queue replay [flags] FILE\n\n"+
+			"Runs again the command or scenario whose manifest is in FILE: what a command\n"+
+			"wrote to standard error, a response of the HTTP API or, with -id, a store of\n"+
+			"experiments. A scenario is checked against the result recorded with it, and\n"+
+			"a command against its output given with -output.\n\nflags:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	rec, err := readManifest(fs.Arg(0), *id)
+	exitOnError(err)
+	m := rec.Manifest
+	if m.Version == "" {
+		fmt.Fprintf(os.Stderr, "warning: recorded with an unknown engine version, this is %s, the numbers may differ\n", Version)
+	} else if m.Version != Version {
+		fmt.Fprintf(os.Stderr, "warning: recorded with engine version %s, this is %s, the numbers may differ\n", m.Version, Version)
+	} else if commit := buildCommit(); m.Commit != "" && commit != "" && m.Commit != commit {
+		fmt.Fprintf(os.Stderr, "warning: recorded at commit %s, this is %s\n", m.Commit, commit)
+	}
+
+	if m.Scenario == nil {
+		replayCommand(m, *output)
+		return
+	}
+	sim, err := m.Scenario.Simulation()
+	exitOnError(err)
+	result := sim.Simulate(false)
+	printManifest(os.Stderr, scenarioManifest(*m.Scenario))
+	b, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(b))
+	if rec.Result == nil {
+		return
+	}
+	// compare as JSON, the form the result was recorded in
+	want, _ := json.Marshal(rec.Result)
+	got, _ := json.Marshal(result)
+	if !bytes.Equal(got, want) {
+		fmt.Fprintln(os.Stderr, "replay: the result differs from the one recorded")
+		os.Exit(1)
+	}
+	fmt.Fprintln(os.Stderr, "replay: the result is identical to the one recorded")
+}
+
+// replayCommand runs the command of manifest m again, in a process of its
+// own, and compares its output with that in the file output, if given.
+// Input files changed since are replaced by the copies in the manifest.
+func replayCommand(m Manifest, output string) {
+	// the experiment is not stored again
+	args := withoutFlag(m.Args, "store")
+	dir := ""
+	for i, in := range m.Inputs {
+		b, err := os.ReadFile(in.Path)
+		sum := sha256.Sum256(b)
+		if err == nil && hex.EncodeToString(sum[:]) == in.SHA256 {
+			continue
+		}
+		if in.Content == nil {
+			exitOnError(fmt.Errorf("%s is not the file the command read, which is too large to be in the manifest", in.Path))
+		}
+		if dir == "" {
+			dir, err = os.MkdirTemp("", "replay")
+			exitOnError(err)
+			defer os.RemoveAll(dir)
+		}
+		copied := filepath.Join(dir, strconv.Itoa(i)+"-"+filepath.Base(in.Path))
+		exitOnError(os.WriteFile(copied, in.Content, 0o644))
+		var replaced bool
+		if args, replaced = replacePath(args, in.Path, copied); !replaced {
+			exitOnError(fmt.Errorf("%s is not the file the command read, put back the one whose SHA-256 is %s", in.Path, in.SHA256))
+		}
+		fmt.Fprintf(os.Stderr, "replay: %s has changed, reading the copy in the manifest\n", in.Path)
+	}
+
+	exe, err := os.Executable()
+	exitOnError(err)
+	var out bytes.Buffer
+	c := exec.Command(exe, append([]string{m.Command}, args...)...)
+	c.Stdout, c.Stderr = io.MultiWriter(os.Stdout, &out), os.Stderr
+	if err := c.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, "replay:", err)
+		os.Exit(1)
+	}
+	if output == "" {
+		return
+	}
+	want, err := os.ReadFile(output)
+	exitOnError(err)
+	// outputs from before the manifest went to standard error start with it
+	if bytes.HasPrefix(want, []byte(manifestPrefix)) {
+		if _, rest, ok := bytes.Cut(want, []byte("\n")); ok {
+			want = rest
+		}
+	}
+	if !bytes.Equal(out.Bytes(), want) {
+		fmt.Fprintf(os.Stderr, "replay: the output differs from %s\n", output)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "replay: the output is identical to %s\n", output)
+}
+
+// replacePath returns args with the file path, as an argument, a flag
+// value or an element of a comma-separated one, replaced by to, and whether
+// it was found.
+func replacePath(args []string, path, to string) ([]string, bool) {
+	found := false
+	replaced := make([]string, len(args))
+	for i, arg := range args {
+		parts := strings.Split(arg, ",")
+		for j, part := range parts {
+			if part == path {
+				parts[j], found = to, true
+			} else if name, value, ok := strings.Cut(part, "="); ok && j == 0 && value == path && strings.HasPrefix(name, "-") {
+				parts[j], found = name+"="+to, true
+			}
+		}
+		replaced[i] = strings.Join(parts, ",")
+	}
+	return replaced, found
+}
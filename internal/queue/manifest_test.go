@@ -0,0 +1,57 @@
+package queue
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestOpenInputRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "waits.csv")
+	if err := os.WriteFile(path, []byte("5\n7\n12\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseDistributionFlag("empirical," + path); err != nil {
+		t.Fatal(err)
+	}
+	all := readInputs()
+	i := slices.IndexFunc(all, func(in Input) bool { return in.Path == path })
+	if i < 0 {
+		t.Fatalf("%s is not in the inputs", path)
+	}
+	// as sha256sum has it
+	if in := all[i]; in.SHA256 != "ce956db5b19a85a84a3de111074183cddb298c85ceb63d7cf008360fa68b3df1" || string(in.Content) != "5\n7\n12\n" {
+		t.Errorf("recorded %+v", in)
+	}
+}
+
+func TestReplacePath(t *testing.T) {
+	args := []string{"-service", "empirical,waits.csv", "-catalog=waits.csv", "-patience", "phase,old/waits.csv", "waits.csv"}
+	got, ok := replacePath(args, "waits.csv", "/tmp/w.csv")
+	want := []string{"-service", "empirical,/tmp/w.csv", "-catalog=/tmp/w.csv", "-patience", "phase,old/waits.csv", "/tmp/w.csv"}
+	if !ok || !slices.Equal(got, want) {
+		t.Errorf("got %q, %v, want %q", got, ok, want)
+	}
+	if _, ok := replacePath([]string{"-servers", "2"}, "waits.csv", "/tmp/w.csv"); ok {
+		t.Error("replaced a path that is not there")
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	// standard error, with progress before the manifest
+	path := filepath.Join(t.TempDir(), "run.txt")
+	err := os.WriteFile(path, []byte(" 50.0% simulated, 10 customers, 1s elapsed, 1s to go\n"+
+		manifestPrefix+`{"command":"once","args":["-servers","3"],"inputs":[{"path":"c.csv","sha256":"00","content":"YQ=="}],"seed":7,"version":"1.0","time":"2026-01-02T03:04:05Z"}`+"\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := readManifest(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := rec.Manifest
+	if m.Command != "once" || !slices.Equal(m.Args, []string{"-servers", "3"}) || m.Seed != 7 || len(m.Inputs) != 1 || string(m.Inputs[0].Content) != "a" || rec.Result != nil {
+		t.Errorf("got %+v", rec)
+	}
+}
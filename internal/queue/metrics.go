@@ -0,0 +1,141 @@
+package queue
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// serverMetrics follows the simulations of a server for Prometheus to
+// scrape, in its text format, so that simulated and real queues can be
+// graphed side by side. Counters add up over every run; gauges describe the
+// runs in progress, labeled by run.
+type serverMetrics struct {
+	mu      sync.Mutex
+	runs    int
+	active  map[int]*runMetrics
+	arrived int
+	served  int
+	left    int // abandoned
+	waited  int // customers who started service
+	waitSum int // their minutes waited
+}
+
+// runMetrics is the state of a run in progress.
+type runMetrics struct {
+	start, clock      int
+	inSystem, waiting int
+	busy              []int // customers in service per server
+	busyTime          []int
+	waited, waitSum   int
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{active: map[int]*runMetrics{}}
+}
+
+// begin registers a run of nServers starting at start and returns its
+// number.
+func (m *serverMetrics) begin(start, nServers int) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runs++
+	m.active[m.runs] = &runMetrics{start: start, clock: start, busy: make([]int, nServers), busyTime: make([]int, nServers)}
+	return m.runs
+}
+
+// end drops the gauges of the run, which is done.
+func (m *serverMetrics) end(id int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.active, id)
+}
+
+func (m *serverMetrics) observe(id int, e CustomerEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.active[id]
+	for j, n := range r.busy {
+		if n > 0 {
+			r.busyTime[j] += e.Time - r.clock
+		}
+	}
+	r.clock = e.Time
+	r.inSystem, r.waiting = e.InSystem, e.Waiting
+
+	c := e.Customer
+	switch e.Kind {
+	case CustomerArrived:
+		m.arrived++
+	case CustomerStarted:
+		r.busy[c.Server]++
+		if c.Interruptions == 0 {
+			m.waited++
+			m.waitSum += c.WaitTime()
+			r.waited++
+			r.waitSum += c.WaitTime()
+		}
+	case CustomerInterrupted:
+		r.busy[c.Server]--
+	case CustomerServed:
+		r.busy[c.Server]--
+		m.served++
+	case CustomerAbandoned:
+		m.left++
+	}
+}
+
+func (m *serverMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+func (m *serverMetrics) write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bw := bufio.NewWriter(w)
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(bw, "# HELP queue_simulation_%s %s\n", name, help)
+		fmt.Fprintf(bw, "# TYPE queue_simulation_%s %s\n", name, kind)
+	}
+	metric("runs_total", "counter", "Simulations started.")
+	fmt.Fprintf(bw, "queue_simulation_runs_total %d\n", m.runs)
+	metric("runs_active", "gauge", "Simulations in progress.")
+	fmt.Fprintf(bw, "queue_simulation_runs_active %d\n", len(m.active))
+	metric("customers_arrived_total", "counter", "Customers arrived in all simulations.")
+	fmt.Fprintf(bw, "queue_simulation_customers_arrived_total %d\n", m.arrived)
+	metric("customers_served_total", "counter", "Customers served in all simulations.")
+	fmt.Fprintf(bw, "queue_simulation_customers_served_total %d\n", m.served)
+	metric("customers_abandoned_total", "counter", "Customers who left the line without service in all simulations.")
+	fmt.Fprintf(bw, "queue_simulation_customers_abandoned_total %d\n", m.left)
+	metric("wait_minutes", "summary", "Simulated minutes customers waited before service.")
+	fmt.Fprintf(bw, "queue_simulation_wait_minutes_sum %d\n", m.waitSum)
+	fmt.Fprintf(bw, "queue_simulation_wait_minutes_count %d\n", m.waited)
+
+	ids := make([]int, 0, len(m.active))
+	for id := range m.active {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	gauge := func(name, help string, value func(r *runMetrics) float64) {
+		metric(name, "gauge", help)
+		for _, id := range ids {
+			fmt.Fprintf(bw, "queue_simulation_%s{run=\"%d\"} %g\n", name, id, value(m.active[id]))
+		}
+	}
+	gauge("time_minutes", "Simulated time of the run, in minutes since midnight.", func(r *runMetrics) float64 { return float64(r.clock) })
+	gauge("queue_length", "Customers in line.", func(r *runMetrics) float64 { return float64(r.waiting) })
+	gauge("customers_in_system", "Customers in line or in service.", func(r *runMetrics) float64 { return float64(r.inSystem) })
+	gauge("average_wait_minutes", "Average wait of the customers served so far.", func(r *runMetrics) float64 { return ratio(r.waitSum, r.waited) })
+	metric("server_utilization", "gauge", "Fraction of the simulated time so far that a server was busy.")
+	for _, id := range ids {
+		r := m.active[id]
+		for j, busy := range r.busyTime {
+			fmt.Fprintf(bw, "queue_simulation_server_utilization{run=\"%d\",server=\"%d\"} %g\n", id, j, ratio(busy, r.clock-r.start))
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,155 @@
+package queue
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// MixChange scales the frequency of one category of a catalog, e.g. by 1.2
+// for 20% more loan applications. The arrival rate stays the same, so the
+// other categories lose share accordingly.
+type MixChange struct {
+	Category string
+	Factor   float64
+}
+
+// ShiftMix returns a copy of classes with the changes applied.
+func ShiftMix(classes []CustomerClass, changes ...MixChange) ([]CustomerClass, error) {
+	shifted := append([]CustomerClass(nil), classes...)
+	for _, ch := range changes {
+		found := false
+		for i := range shifted {
+			if shifted[i].Name == ch.Category {
+				shifted[i].Frequency *= ch.Factor
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown category %q", ch.Category)
+		}
+	}
+	return shifted, nil
+}
+
+// mixFlag parses repeated "CATEGORY=+N%" command line values.
+type mixFlag []MixChange
+
+func (f *mixFlag) String() string { return "" }
+
+func (f *mixFlag) Set(v string) error {
+	category, change, ok := strings.Cut(v, "=")
+	pct, ok2 := strings.CutSuffix(change, "%")
+	if !ok || !ok2 {
+		return fmt.Errorf("want CATEGORY=+N%%, got %q", v)
+	}
+	p, err := strconv.ParseFloat(pct, 64)
+	if err != nil || p <= -100 {
+		return fmt.Errorf("invalid change %q", change)
+	}
+	*f = append(*f, MixChange{Category: category, Factor: 1 + p/100})
+	return nil
+}
+
+func formatMix(classes []CustomerClass) string {
+	total := float64(0)
+	for _, c := range classes {
+		total += c.Frequency
+	}
+	var parts []string
+	for _, c := range classes {
+		parts = append(parts, fmt.Sprintf("%s %.1f%%", c.Name, 100*c.Frequency/total))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func simulateMix(seed int64, args []string) {
+	startTime := 8 * 60 // 08:00
+	endTime := 16 * 60  // 16:00
+	serverRate := 6.0   // only seeds the servers, service times come from the catalog
+
+	fs := flag.NewFlagSet("mix", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	catalog := fs.String("catalog", "catalog.csv", "CSV `file` of transaction categories")
+	customerRate := fs.Float64("rate", 20.0, "arrival rate, in customers per hour")
+	maxServers := fs.Int("max-servers", 6, "largest number of servers to try")
+	target := fs.Float64("target", 5.0, "average wait time, in minutes, that staffing must meet")
+	reps := fs.Int("reps", 200, "number of replications to average over")
+	var changes mixFlag
+	fs.Var(&changes, "change", "change to the share of a category as `CATEGORY=+N%`, e.g. \"loan application=+20%\"; repeatable")
+	fs.Parse(args)
+	checkServers("max-servers", *maxServers)
+
+	baseline, err := LoadCatalog(*catalog)
+	exitOnError(err)
+	if len(changes) == 0 {
+		changes = mixFlag{{Category: "loan application", Factor: 1.2}}
+	}
+	shifted, err := ShiftMix(baseline, changes...)
+	exitOnError(err)
+
+	// Both mixes see the same arrival and service streams for every number
+	// of servers.
+	mixes := [][]CustomerClass{baseline, shifted}
+	rng := rand.New(rand.NewSource(seed))
+	var sims []*Simulation
+	for range *reps {
+		seed := rng.Int63()
+		for nServers := 1; nServers <= *maxServers; nServers++ {
+			for _, classes := range mixes {
+				sims = append(sims, NewSimulation(startTime, endTime, nServers, *customerRate, serverRate, seed, WithCatalog(classes)))
+			}
+		}
+	}
+	results := simulateAll(sims)
+
+	var means, loads []float64
+	for _, classes := range mixes {
+		s := NewSimulation(startTime, endTime, 1, *customerRate, serverRate, seed, WithCatalog(classes))
+		means = append(means, s.meanServiceTime(0))
+		loads = append(loads, *customerRate*s.meanServiceTime(0)/60)
+	}
+	var desc []string
+	for _, ch := range changes {
+		desc = append(desc, fmt.Sprintf("%s %+.0f%%", ch.Category, 100*(ch.Factor-1)))
+	}
+	fmt.Printf("Arrival Rate       : %.2f customers/hour, %d replications\n", *customerRate, *reps)
+	fmt.Printf("Baseline Mix       : %s\n", formatMix(baseline))
+	fmt.Printf("Shifted Mix        : %s (%s)\n", formatMix(shifted), strings.Join(desc, ", "))
+	fmt.Printf("Mean ServiceTime   : %.2f -> %.2f minutes\n", means[0], means[1])
+	fmt.Printf("Offered Load       : %.2f -> %.2f busy servers\n", loads[0], loads[1])
+	fmt.Println()
+
+	fmt.Println("servers,baseline_wait,shifted_wait,baseline_utilization,shifted_utilization")
+	needed := []int{-1, -1}
+	n := float64(*reps)
+	for nServers := 1; nServers <= *maxServers; nServers++ {
+		var wait, utilization [2]float64
+		for k := 2 * (nServers - 1); k < len(results); k += 2 * *maxServers {
+			for m := range mixes {
+				r := results[k+m]
+				wait[m] += r.AverageWaitTime / n
+				for _, sv := range r.Servers {
+					utilization[m] += sv.Utilization / n / float64(nServers)
+				}
+			}
+		}
+		for m := range mixes {
+			if needed[m] == -1 && wait[m] <= *target {
+				needed[m] = nServers
+			}
+		}
+		fmt.Printf("%d,%.4f,%.4f,%.4f,%.4f\n", nServers, wait[0], wait[1], utilization[0], utilization[1])
+	}
+	fmt.Println()
+
+	staffing := func(n int) string {
+		if n == -1 {
+			return fmt.Sprintf("more than %d", *maxServers)
+		}
+		return strconv.Itoa(n)
+	}
+	fmt.Printf("Servers Needed     : %s -> %s (average wait at most %.2f minutes)\n", staffing(needed[0]), staffing(needed[1]), *target)
+}
@@ -0,0 +1,458 @@
+package queue
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+)
+
+// Station is one stage of a service network, with its own servers and
+// service time distribution. A station serves its line first come, first
+// served.
+type Station struct {
+	Name    string
+	Servers int
+	Service ServiceDistribution
+	// Routes lists where customers go after being served here. Whatever
+	// probability is left over leaves the network.
+	Routes []Route
+	// ArrivalRate is the rate, in customers per hour, at which customers
+	// arrive here from outside, besides those arriving at the first station
+	// at the network's customer rate.
+	ArrivalRate float64
+}
+
+// Route sends a customer to station To with the given probability.
+type Route struct {
+	To          int
+	Probability float64
+}
+
+// Tandem chains stations so that every customer visits them in order.
+func Tandem(stations ...Station) []Station {
+	for i := range stations {
+		stations[i].Routes = nil
+		if i+1 < len(stations) {
+			stations[i].Routes = []Route{{To: i + 1, Probability: 1}}
+		}
+	}
+	return stations
+}
+
+// WithRoutingMatrix sets the routes of the stations from a matrix where
+// p[i][j] is the probability that a customer served at station i goes on
+// to station j. Routes may lead back to stations already visited, e.g. for
+// rework. The rest of each row is the probability of leaving.
+func WithRoutingMatrix(stations []Station, p [][]float64) ([]Station, error) {
+	if len(p) != len(stations) {
+		return nil, fmt.Errorf("routing matrix has %d rows for %d stations", len(p), len(stations))
+	}
+	for i, row := range p {
+		if len(row) != len(stations) {
+			return nil, fmt.Errorf("routing matrix row %d has %d columns for %d stations", i, len(row), len(stations))
+		}
+		stations[i].Routes = nil
+		total := float64(0)
+		for j, pij := range row {
+			if pij < 0 {
+				return nil, fmt.Errorf("negative routing probability from %s to %s", stations[i].Name, stations[j].Name)
+			}
+			if pij > 0 {
+				stations[i].Routes = append(stations[i].Routes, Route{To: j, Probability: pij})
+			}
+			total += pij
+		}
+		if total > 1+epsilon {
+			return nil, fmt.Errorf("routing probabilities from %s add up to %g", stations[i].Name, total)
+		}
+	}
+	return stations, nil
+}
+
+// Network simulates customers arriving at the first station and flowing
+// through the others along their routes until they leave.
+type Network struct {
+	startTime, endTime int
+	customerRate       float64
+	stations           []Station
+
+	customerDist *Poisson
+	externalDist []*Poisson
+	serverRng    [][]*rand.Rand
+	routeRng     *rand.Rand
+}
+
+func NewNetwork(startTime, endTime int, customerRate float64, stations []Station, seed int64) *Network {
+	serverRng := make([][]*rand.Rand, len(stations))
+	for i, st := range stations {
+		for k := range st.Servers {
+			serverRng[i] = append(serverRng[i], rand.New(newStream(seed, serviceStream, i, k)))
+		}
+	}
+	n := &Network{
+		startTime:    startTime,
+		endTime:      endTime,
+		customerRate: customerRate,
+		stations:     stations,
+		customerDist: newPoisson(customerRate/60, 100, rand.New(newStream(seed, arrivalStream))),
+		externalDist: make([]*Poisson, len(stations)),
+		serverRng:    serverRng,
+		routeRng:     rand.New(newStream(seed, routingStream)),
+	}
+	for i, st := range stations {
+		if st.ArrivalRate > 0 {
+			n.externalDist[i] = newPoisson(st.ArrivalRate/60, 100, rand.New(newStream(seed, arrivalStream, i)))
+		}
+	}
+	return n
+}
+
+// TrafficRates solves the traffic equations of the network, giving the
+// long-run rate at which customers arrive at each station, in customers
+// per hour, counting both outside arrivals and those routed there. It fails
+// if customers can be routed around forever without leaving.
+func (n *Network) TrafficRates() ([]float64, error) {
+	// lambda = gamma + P^T lambda, solved as (I - P^T) lambda = gamma by
+	// Gaussian elimination with partial pivoting
+	k := len(n.stations)
+	a := make([][]float64, k)
+	for i := range a {
+		a[i] = make([]float64, k+1)
+		a[i][i] = 1
+		a[i][k] = n.stations[i].ArrivalRate
+	}
+	a[0][k] += n.customerRate
+	for i, st := range n.stations {
+		for _, route := range st.Routes {
+			a[route.To][i] -= route.Probability
+		}
+	}
+	for col := range k {
+		pivot := col
+		for row := col + 1; row < k; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < epsilon {
+			return nil, fmt.Errorf("customers can be routed around %s forever without leaving", n.stations[col].Name)
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for row := range k {
+			if row == col {
+				continue
+			}
+			f := a[row][col] / a[col][col]
+			for c := col; c <= k; c++ {
+				a[row][c] -= f * a[col][c]
+			}
+		}
+	}
+	rates := make([]float64, k)
+	for i := range rates {
+		rates[i] = a[i][k] / a[i][i]
+	}
+	return rates, nil
+}
+
+// StationStats summarizes one station. Customers counts visits, so a
+// customer that comes back is counted again. Utilization is measured until
+// the last customer has left.
+type StationStats struct {
+	Name               string
+	Customers          int
+	AverageWaitTime    float64
+	AverageServiceTime float64
+	Utilization        float64
+}
+
+// NetworkResult summarizes a network run. Sojourn times run from arrival
+// at the network until leaving it. AverageInNetwork is the time-average
+// number of customers in the network until the last one has left, and
+// AverageVisits the number of services a customer gets on the way through.
+type NetworkResult struct {
+	TotalTime          int
+	TotalCustomers     int
+	Stations           []StationStats
+	AverageSojournTime float64
+	SojournP50         int
+	SojournP90         int
+	MaxSojournTime     int
+	AverageInNetwork   float64
+	AverageVisits      float64
+}
+
+type netCustomer struct {
+	arrival  int // arrival at the network
+	queuedAt int // arrival at the current station
+	visits   int
+}
+
+type netStation struct {
+	queue   []*netCustomer
+	busy    []*netCustomer
+	wait    int
+	service int
+	visits  int
+}
+
+// netRun holds the mutable state of one call to Network.Simulate.
+type netRun struct {
+	n        *Network
+	events   eventQueue
+	stations []netStation
+	offset   []int // global index of the first server of each station
+	sojourn  histogram
+	last     int // time of the last departure
+
+	// inNetwork customers have been in the network since lastChange, and
+	// area is the integral of their number over time before that
+	inNetwork  int
+	lastChange int
+	area       int
+	visits     int
+}
+
+func (n *Network) Simulate() NetworkResult {
+	r := &netRun{n: n, stations: make([]netStation, len(n.stations))}
+	total := 0
+	for i, st := range n.stations {
+		r.stations[i].busy = make([]*netCustomer, st.Servers)
+		r.offset = append(r.offset, total)
+		total += st.Servers
+	}
+
+	customers := 0
+	r.lastChange = n.startTime
+	for t := n.startTime; t < n.endTime; t++ {
+		for i := range n.stations {
+			k := 0
+			if i == 0 {
+				k = n.customerDist.Get()
+			}
+			if n.externalDist[i] != nil {
+				k += n.externalDist[i].Get()
+			}
+			for ik := 0; ik < k; ik++ {
+				r.advance(t)
+				customers++
+				r.count(t, 1)
+				r.join(i, &netCustomer{arrival: t}, t)
+			}
+		}
+	}
+	r.advance(math.MaxInt)
+
+	result := NetworkResult{
+		TotalTime:          n.endTime - n.startTime,
+		TotalCustomers:     customers,
+		AverageSojournTime: r.sojourn.mean(),
+		SojournP50:         r.sojourn.quantile(0.5),
+		SojournP90:         r.sojourn.quantile(0.9),
+		MaxSojournTime:     r.sojourn.max(),
+		AverageVisits:      ratio(r.visits, r.sojourn.n),
+	}
+	span := max(n.endTime, r.last) - n.startTime
+	result.AverageInNetwork = float64(r.area) / float64(span)
+	for i, st := range n.stations {
+		ns := r.stations[i]
+		result.Stations = append(result.Stations, StationStats{
+			Name:               st.Name,
+			Customers:          ns.visits,
+			AverageWaitTime:    ratio(ns.wait, ns.visits),
+			AverageServiceTime: ratio(ns.service, ns.visits),
+			Utilization:        float64(ns.service) / float64(st.Servers*span),
+		})
+	}
+	return result
+}
+
+// station returns the station and server index of global server g.
+func (r *netRun) station(g int) (int, int) {
+	i := len(r.offset) - 1
+	for r.offset[i] > g {
+		i--
+	}
+	return i, g - r.offset[i]
+}
+
+func (r *netRun) advance(t int) {
+	for len(r.events) > 0 && r.events[0].time <= t {
+		e := r.events.pop()
+		i, j := r.station(e.server)
+		r.depart(i, j, e.time)
+	}
+}
+
+// join puts customer c in line at station i at time t.
+func (r *netRun) join(i int, c *netCustomer, t int) {
+	c.queuedAt = t
+	ns := &r.stations[i]
+	for j, b := range ns.busy {
+		if b == nil {
+			r.start(i, j, c, t)
+			return
+		}
+	}
+	ns.queue = append(ns.queue, c)
+}
+
+// count changes the number of customers in the network by d at time t.
+func (r *netRun) count(t int, d int) {
+	r.area += r.inNetwork * (t - r.lastChange)
+	r.inNetwork += d
+	r.lastChange = t
+}
+
+func (r *netRun) start(i, j int, c *netCustomer, t int) {
+	ns := &r.stations[i]
+	c.visits++
+	service := int(math.Round(r.n.stations[i].Service.Sample(r.n.serverRng[i][j])))
+	ns.busy[j] = c
+	ns.visits++
+	ns.wait += t - c.queuedAt
+	ns.service += service
+	r.events.push(event{time: t + service, kind: departureEvent, server: r.offset[i] + j})
+}
+
+// depart finishes the service at server j of station i at time t and sends
+// the customer on.
+func (r *netRun) depart(i, j int, t int) {
+	ns := &r.stations[i]
+	c := ns.busy[j]
+	ns.busy[j] = nil
+	r.last = t
+	if len(ns.queue) > 0 {
+		next := ns.queue[0]
+		ns.queue = ns.queue[1:]
+		r.start(i, j, next, t)
+	}
+
+	x := r.n.routeRng.Float64()
+	for _, route := range r.n.stations[i].Routes {
+		x -= route.Probability
+		if x < 0 {
+			r.join(route.To, c, t)
+			return
+		}
+	}
+	r.sojourn.add(t - c.arrival)
+	r.visits += c.visits
+	r.count(t, -1)
+}
+
+// airport is check-in, security and boarding, where one passenger in ten is
+// picked for secondary screening after security.
+func airport() []Station {
+	stations := Tandem(
+		Station{Name: "check-in", Servers: 4, Service: &Exponential{lambda: 1.0 / 4}},
+		Station{Name: "security", Servers: 3, Service: Uniform{1, 4}},
+		Station{Name: "screening", Servers: 1, Service: &Exponential{lambda: 1.0 / 5}},
+		Station{Name: "boarding", Servers: 2, Service: Uniform{0.5, 1.5}},
+	)
+	stations[1].Routes = []Route{{To: 3, Probability: 0.9}, {To: 2, Probability: 0.1}}
+	return stations
+}
+
+// rework is an assembly line where one part in five fails inspection and is
+// inspected again after rework. Parts bought in go straight to inspection.
+func rework() []Station {
+	stations, err := WithRoutingMatrix([]Station{
+		{Name: "assembly", Servers: 3, Service: &Exponential{lambda: 1.0 / 10}},
+		{Name: "inspection", Servers: 1, Service: Uniform{1, 4}, ArrivalRate: 2},
+		{Name: "rework", Servers: 1, Service: NewLogNormal(12, 4)},
+	}, [][]float64{
+		{0, 1, 0},
+		{0, 0, 0.2},
+		{0, 1, 0},
+	})
+	if err != nil {
+		panic(err)
+	}
+	return stations
+}
+
+var networkModels = []struct {
+	name     string
+	rate     float64
+	stations func() []Station
+}{
+	{"airport", 50, airport},
+	{"rework", 15, rework},
+}
+
+func simulateNetwork(seed int64, args []string) {
+	startTime := 6 * 60 // 06:00
+	endTime := 14 * 60  // 14:00
+
+	fs := flag.NewFlagSet("network", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	model := fs.String("model", "airport", "network to simulate: airport, or rework for an assembly line with a rework loop")
+	customerRate := fs.Float64("rate", 0, "arrival rate at the first station, in customers per hour (default 50 for airport, 15 for rework)")
+	fs.Parse(args)
+
+	var stations []Station
+	for _, m := range networkModels {
+		if m.name == *model {
+			stations = m.stations()
+			if *customerRate == 0 {
+				*customerRate = m.rate
+			}
+		}
+	}
+	if stations == nil {
+		exitOnError(fmt.Errorf("unknown network %q", *model))
+	}
+	n := NewNetwork(startTime, endTime, *customerRate, stations, seed)
+	rates, err := n.TrafficRates()
+	exitOnError(err)
+	result := n.Simulate()
+
+	var names []string
+	for _, st := range stations {
+		names = append(names, st.Name)
+	}
+	fmt.Printf("Stations           : %s\n", strings.Join(names, ", "))
+	fmt.Printf("Simulation Time    : %d hours\n", result.TotalTime/60)
+	fmt.Printf("Total Customers    : %d (%.6f customers/hour)\n", result.TotalCustomers, float64(result.TotalCustomers)/(float64(result.TotalTime)/float64(60)))
+	fmt.Println()
+	fmt.Printf("routing,%s,exit\n", strings.Join(names, ","))
+	for _, st := range stations {
+		row := make([]float64, len(stations))
+		exit := float64(1)
+		for _, route := range st.Routes {
+			row[route.To] += route.Probability
+			exit -= route.Probability
+		}
+		fmt.Printf("%s", st.Name)
+		for _, p := range row {
+			fmt.Printf(",%.2f", p)
+		}
+		fmt.Printf(",%.2f\n", max(exit, 0))
+	}
+	fmt.Println()
+	fmt.Println("station,servers,arrival_rate,load,visits,average_wait_time,average_service_time,utilization")
+	var unstable []string
+	external, total := *customerRate, float64(0)
+	for i, st := range result.Stations {
+		load := rates[i] * stations[i].Service.Mean() / 60 / float64(stations[i].Servers)
+		if load >= 1 {
+			unstable = append(unstable, fmt.Sprintf("%s (load %.2f)", st.Name, load))
+		}
+		external += stations[i].ArrivalRate
+		total += rates[i]
+		fmt.Printf("%s,%d,%.4f,%.4f,%d,%.4f,%.4f,%.4f\n", st.Name, stations[i].Servers, rates[i], load, st.Customers, st.AverageWaitTime, st.AverageServiceTime, st.Utilization)
+	}
+	fmt.Println()
+	if len(unstable) > 0 {
+		fmt.Printf("Unstable Stations  : %s\n", strings.Join(unstable, ", "))
+	}
+	fmt.Printf("Average Visits     : %.4f services per customer (%.4f expected)\n", result.AverageVisits, total/external)
+	fmt.Printf("Average In Network : %.4f customers\n", result.AverageInNetwork)
+	fmt.Printf("Average Sojourn    : %.6f minutes\n", result.AverageSojournTime)
+	fmt.Printf("Median Sojourn     : %d minutes\n", result.SojournP50)
+	fmt.Printf("90th Pct Sojourn   : %d minutes\n", result.SojournP90)
+	fmt.Printf("Max Sojourn        : %d minutes\n", result.MaxSojournTime)
+}
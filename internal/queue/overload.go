@@ -0,0 +1,213 @@
+package queue
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+)
+
+// OverloadStats describes how the system copes with a period in which
+// customers arrive faster than the servers can serve them. Backlogs count
+// every customer in the system, waiting or in service.
+type OverloadStats struct {
+	// PeakStart and PeakEnd bound the overloaded period.
+	PeakStart, PeakEnd int
+
+	BacklogAtStart, BacklogAtEnd int
+	// GrowthRate is how fast the backlog grew during the peak, in
+	// customers per hour.
+	GrowthRate float64
+
+	MaxBacklog     int
+	MaxBacklogTime int
+
+	// RecoveryTime is the number of minutes after PeakEnd until the backlog
+	// first fell back to BacklogAtStart, or -1 if it never did.
+	RecoveryTime int
+	// LastEmptyTime is the last time up to endTime at which the system was
+	// empty, or -1 if it never was.
+	LastEmptyTime int
+}
+
+// capacity returns the combined service rate of all servers, in customers
+// per hour.
+func (s *Simulation) capacity() float64 {
+	total := float64(0)
+	for j := range s.serverRates {
+		total += float64(60) / s.meanServiceTime(j)
+	}
+	return total
+}
+
+// overloadWindow returns the span from the start of the first to the end of
+// the last period in which the arrival rate reaches the service capacity.
+func (s *Simulation) overloadWindow() (start, end int, ok bool) {
+	capacity := s.capacity()
+	if s.customerRate >= capacity {
+		return s.startTime, s.endTime, true
+	}
+	for _, p := range s.profile {
+		if p.Rate < capacity {
+			continue
+		}
+		if !ok || p.Start < start {
+			start = p.Start
+		}
+		if !ok || p.End > end {
+			end = p.End
+		}
+		ok = true
+	}
+	return max(start, s.startTime), min(end, s.endTime), ok
+}
+
+// tick records the backlog at the boundaries of the overloaded period. It is
+// called at the start of every simulated minute and once more at endTime.
+func (r *run) tick(t int) {
+	if r.overload == nil {
+		return
+	}
+	o := r.overload
+	if t == o.PeakStart || t == o.PeakEnd || t == r.s.endTime {
+		r.advance(t)
+	}
+	if t == o.PeakStart {
+		o.BacklogAtStart = r.inSystem
+	}
+	if t == o.PeakEnd {
+		o.BacklogAtEnd = r.inSystem
+		if r.inSystem <= o.BacklogAtStart {
+			r.recoveredAt = t
+		}
+	}
+	if t == r.s.endTime && r.inSystem == 0 {
+		o.LastEmptyTime = t
+	}
+}
+
+// enter and leave keep count of the customers in the system.
+func (r *run) enter(t int) {
+	if r.inSystem == 0 && t <= r.s.endTime {
+		r.lastEmpty = t
+	}
+	r.accumulate(t)
+	r.inSystem++
+	if r.inSystem > r.maxBacklog {
+		r.maxBacklog, r.maxBacklogTime = r.inSystem, t
+	}
+}
+
+func (r *run) leave(t int) {
+	r.accumulate(t)
+	r.inSystem--
+	if r.s.population > 0 {
+		r.think(t)
+	}
+	if o := r.overload; o != nil && r.recoveredAt < 0 && t >= o.PeakEnd && r.inSystem <= o.BacklogAtStart {
+		r.recoveredAt = t
+	}
+}
+
+func (r *run) overloadStats() *OverloadStats {
+	o := r.overload
+	if o == nil {
+		return nil
+	}
+	k := r.s.tick
+	if hours := float64(o.PeakEnd-o.PeakStart) / 60 / float64(k); hours > 0 {
+		o.GrowthRate = float64(o.BacklogAtEnd-o.BacklogAtStart) / hours
+	}
+	o.MaxBacklog, o.MaxBacklogTime = r.maxBacklog, r.maxBacklogTime
+	o.RecoveryTime = -1
+	if r.recoveredAt >= 0 {
+		o.RecoveryTime = r.recoveredAt - o.PeakEnd
+	}
+	if o.LastEmptyTime < 0 {
+		o.LastEmptyTime = r.lastEmpty
+	}
+
+	// from ticks to minutes
+	stats := *o
+	stats.PeakStart, stats.PeakEnd = o.PeakStart/k, o.PeakEnd/k
+	stats.MaxBacklogTime /= k
+	if stats.RecoveryTime > 0 {
+		stats.RecoveryTime /= k
+	}
+	if stats.LastEmptyTime > 0 {
+		stats.LastEmptyTime /= k
+	}
+	return &stats
+}
+
+func simulateOverload(seed int64, args []string) {
+	startTime := 8 * 60 // 08:00
+	endTime := 16 * 60  // 16:00
+	serverRate := 6.0   // 6 customers per hour, or 10 minutes per customer
+
+	fs := flag.NewFlagSet("overload", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	nServers := fs.Int("servers", 2, "number of servers")
+	customerRate := fs.Float64("rate", 8.0, "arrival rate outside the peak, in customers per hour")
+	peakRate := fs.Float64("peak-rate", 18.0, "arrival rate during the peak, in customers per hour")
+	peakStart := fs.String("peak-start", "11:00", "start of the peak")
+	peakEnd := fs.String("peak-end", "13:00", "end of the peak")
+	reps := fs.Int("reps", 100, "number of replications to average over")
+	fs.Parse(args)
+	checkServers("servers", *nServers)
+
+	start, err := parseTime(*peakStart)
+	exitOnError(err)
+	end, err := parseTime(*peakEnd)
+	exitOnError(err)
+	if end <= start {
+		exitOnError(fmt.Errorf("peak ends at %s before it starts at %s", *peakEnd, *peakStart))
+	}
+
+	peak := RatePeriod{Start: start, End: end, Rate: *peakRate}
+	rng := rand.New(rand.NewSource(seed))
+	sims := make([]*Simulation, *reps)
+	for i := range sims {
+		sims[i] = NewSimulation(startTime, endTime, *nServers, *customerRate, serverRate, rng.Int63(), WithArrivalProfile(peak))
+	}
+	printOverload(sims[0], peak, simulateAll(sims))
+}
+
+func printOverload(s *Simulation, peak RatePeriod, results []SimulationResult) {
+	capacity := s.capacity()
+	fmt.Printf("Arrival Rate       : %.2f customers/hour, %.2f during %s-%s\n", s.customerRate, peak.Rate, formatTime(peak.Start), formatTime(peak.End))
+	fmt.Printf("Service Capacity   : %.2f customers/hour (%d servers)\n", capacity, s.nServers)
+	fmt.Printf("Peak Utilization   : %.2f\n", peak.Rate/capacity)
+	if results[0].Overload == nil {
+		fmt.Println("The arrival rate never exceeds the service capacity.")
+		return
+	}
+
+	n := float64(len(results))
+	var atStart, atEnd, growth, maxBacklog, recovery, lastEmpty, wait float64
+	recovered := 0
+	for _, r := range results {
+		o := r.Overload
+		atStart += float64(o.BacklogAtStart) / n
+		atEnd += float64(o.BacklogAtEnd) / n
+		growth += o.GrowthRate / n
+		maxBacklog += float64(o.MaxBacklog) / n
+		lastEmpty += float64(o.LastEmptyTime) / n
+		wait += r.AverageWaitTime / n
+		if o.RecoveryTime >= 0 {
+			recovery += float64(o.RecoveryTime)
+			recovered++
+		}
+	}
+	fmt.Printf("Replications       : %d\n", len(results))
+	fmt.Printf("Backlog at %s   : %.2f customers\n", formatTime(peak.Start), atStart)
+	fmt.Printf("Backlog at %s   : %.2f customers\n", formatTime(peak.End), atEnd)
+	fmt.Printf("Backlog Growth     : %.2f customers/hour (arrival rate - capacity = %.2f)\n", growth, peak.Rate-capacity)
+	fmt.Printf("Max Backlog        : %.2f customers\n", maxBacklog)
+	if recovered > 0 {
+		fmt.Printf("Recovery Time      : %.2f minutes after %s (%d of %d runs recovered)\n", recovery/float64(recovered), formatTime(peak.End), recovered, len(results))
+	} else {
+		fmt.Printf("Recovery Time      : never\n")
+	}
+	fmt.Printf("Last Empty Time    : %s on average\n", formatTime(int(lastEmpty+0.5)))
+	fmt.Printf("Average WaitTime   : %.6f minutes\n", wait)
+}
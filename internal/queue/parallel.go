@@ -0,0 +1,61 @@
+package queue
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// simulateAll runs sims on up to GOMAXPROCS goroutines and returns their
+// results in the same order. Every Simulation owns its random streams, so the
+// results do not depend on how the runs are scheduled.
+func simulateAll(sims []*Simulation) []SimulationResult {
+	results, _ := simulateAllContext(context.Background(), sims, 0, nil)
+	return results
+}
+
+// simulateAllContext is like simulateAll, but stops early with the error of
+// ctx once it is done, and calls progress, if not nil, with the progress of
+// all sims together at most once per interval.
+func simulateAllContext(ctx context.Context, sims []*Simulation, interval time.Duration, progress func(Progress)) ([]SimulationResult, error) {
+	if progress != nil {
+		total := int64(0)
+		for _, s := range sims {
+			total += int64(s.endTime - s.startTime)
+		}
+		p := newProgressTracker(total, interval, progress)
+		for _, s := range sims {
+			s.progress = p
+		}
+	}
+
+	results := make([]SimulationResult, len(sims))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.GOMAXPROCS(0); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// a cancelled run returns early and is dropped with the
+				// rest
+				results[i], _ = sims[i].SimulateContext(ctx)
+			}
+		}()
+	}
+feed:
+	for i := range sims {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
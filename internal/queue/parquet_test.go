@@ -0,0 +1,187 @@
+package queue
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// traceRow is a row of a ParquetTrace as a reference reader sees it.
+type traceRow struct {
+	Customer      int64    `parquet:"customer"`
+	Class         int32    `parquet:"class"`
+	Outcome       string   `parquet:"outcome"`
+	Arrival       float64  `parquet:"arrival"`
+	Start         *float64 `parquet:"start,optional"`
+	Left          float64  `parquet:"left"`
+	Wait          float64  `parquet:"wait"`
+	Service       *float64 `parquet:"service,optional"`
+	Server        *int32   `parquet:"server,optional"`
+	Interruptions int32    `parquet:"interruptions"`
+}
+
+// readTrace reads a Parquet file with parquet-go.
+func readTrace(t *testing.T, b []byte) []traceRow {
+	t.Helper()
+	f, err := parquet.OpenFile(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := parquet.NewGenericReader[traceRow](f)
+	defer r.Close()
+	rows := make([]traceRow, f.NumRows())
+	if n, err := r.Read(rows); n != len(rows) {
+		t.Fatalf("read %d of %d rows: %v", n, len(rows), err)
+	}
+	return rows
+}
+
+func ptr[T any](v T) *T { return &v }
+
+// goldenTrace writes a few customers on a clock of 10 ticks a minute.
+func goldenTrace() ([]byte, []traceRow) {
+	var b bytes.Buffer
+	tr := NewParquetTrace(&b, 10)
+	tr.groupSize = 2
+	tr.Add(CustomerEvent{Kind: CustomerServed, Time: 5000, Customer: Customer{Index: 1, ArrivalTime: 4800, ServedTime: 4825, FinishTime: 5000, Server: 0}})
+	tr.Add(CustomerEvent{Kind: CustomerArrived, Time: 4900, Customer: Customer{Index: 2, ArrivalTime: 4900}})
+	tr.Add(CustomerEvent{Kind: CustomerAbandoned, Time: 5123, Customer: Customer{Index: 3, ArrivalTime: 4950, Class: 2}})
+	tr.Add(CustomerEvent{Kind: CustomerServed, Time: 5400, Customer: Customer{Index: 2, ArrivalTime: 4900, ServedTime: 5000, FinishTime: 5400, Server: 1, Class: 1, Interruptions: 2}})
+	tr.Close()
+	left := 512.3 // as a float64, not an exact constant
+	return b.Bytes(), []traceRow{
+		{Customer: 1, Outcome: "served", Arrival: 480, Start: ptr(482.5), Left: 500, Wait: 2.5, Service: ptr(17.5), Server: ptr[int32](0)},
+		{Customer: 3, Class: 2, Outcome: "abandoned", Arrival: 495, Left: left, Wait: left - 495},
+		{Customer: 2, Class: 1, Outcome: "served", Arrival: 490, Start: ptr(500.0), Left: 540, Wait: 10, Service: ptr(40.0), Server: ptr[int32](1), Interruptions: 2},
+	}
+}
+
+func TestParquetGolden(t *testing.T) {
+	b, want := goldenTrace()
+	golden := filepath.Join("testdata", "trace.parquet")
+	if *update {
+		if err := os.WriteFile(golden, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, g) {
+		t.Errorf("the trace differs from %s, go test -run Golden -update rewrites it", golden)
+	}
+	got := readTrace(t, g)
+	if len(got) != len(want) {
+		t.Fatalf("%d rows, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if g, w := describeRow(got[i]), describeRow(want[i]); g != w {
+			t.Errorf("row %d is\n%s\nwant\n%s", i, g, w)
+		}
+	}
+}
+
+// describeRow returns the columns of r as text, with null for the nulls.
+func describeRow(r traceRow) string {
+	null := func(p any) any {
+		switch p := p.(type) {
+		case *float64:
+			if p != nil {
+				return *p
+			}
+		case *int32:
+			if p != nil {
+				return *p
+			}
+		}
+		return "null"
+	}
+	return fmt.Sprintf("%d %d %s %g %v %g %g %v %v %d", r.Customer, r.Class, r.Outcome, r.Arrival, null(r.Start), r.Left, r.Wait, null(r.Service), null(r.Server), r.Interruptions)
+}
+
+func TestParquetSchema(t *testing.T) {
+	b, _ := goldenTrace()
+	f, err := parquet.OpenFile(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(f.RowGroups()); n != 2 {
+		t.Errorf("%d row groups, want 2", n)
+	}
+	want := map[string]string{
+		"customer": "INT64", "class": "INT32", "outcome": "BYTE_ARRAY", "arrival": "DOUBLE", "start": "DOUBLE",
+		"left": "DOUBLE", "wait": "DOUBLE", "service": "DOUBLE", "server": "INT32", "interruptions": "INT32",
+	}
+	optional := map[string]bool{"start": true, "service": true, "server": true}
+	for _, field := range f.Schema().Fields() {
+		if got := field.Type().Kind().String(); got != want[field.Name()] {
+			t.Errorf("%s is %s, want %s", field.Name(), got, want[field.Name()])
+		}
+		if field.Optional() != optional[field.Name()] {
+			t.Errorf("%s optional %v", field.Name(), field.Optional())
+		}
+		delete(want, field.Name())
+	}
+	if len(want) > 0 {
+		t.Errorf("missing columns %v", want)
+	}
+	if lt := f.Schema().Fields()[2].Type().LogicalType(); lt == nil || lt.UTF8 == nil {
+		t.Errorf("outcome has logical type %v, want a string", lt)
+	}
+}
+
+func TestParquetRun(t *testing.T) {
+	var b bytes.Buffer
+	tr := NewParquetTrace(&b, 1)
+	tr.groupSize = 100
+	patience, err := parseDistributionFlag("exp,20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []traceRow
+	h := tr.Hooks()
+	record := func(e CustomerEvent) {
+		c := e.Customer
+		row := traceRow{Customer: int64(c.Index), Class: int32(c.Class), Arrival: float64(c.ArrivalTime), Left: float64(e.Time), Interruptions: int32(c.Interruptions)}
+		if e.Kind == CustomerServed {
+			row.Outcome, row.Start, row.Wait = "served", ptr(float64(c.ServedTime)), float64(c.WaitTime())
+			row.Service, row.Server = ptr(float64(c.ServiceTime())), ptr(int32(c.Server))
+		} else {
+			row.Outcome, row.Wait = "abandoned", float64(e.Time-c.ArrivalTime)
+		}
+		want = append(want, row)
+	}
+	hooks := Hooks{
+		OnDeparture: func(e CustomerEvent) { h.OnDeparture(e); record(e) },
+		OnRenege:    func(e CustomerEvent) { h.OnRenege(e); record(e) },
+	}
+	NewSimulation(480, 480+60*24, 2, 14, 6, 3, WithPatience(patience), WithHooks(hooks)).Simulate(false)
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := readTrace(t, b.Bytes())
+	if len(got) != len(want) || len(want) < 250 {
+		t.Fatalf("%d rows, want %d", len(got), len(want))
+	}
+	abandoned := 0
+	for i := range want {
+		if g, w := describeRow(got[i]), describeRow(want[i]); g != w {
+			t.Fatalf("row %d is\n%s\nwant\n%s", i, g, w)
+		}
+		if want[i].Outcome == "abandoned" {
+			abandoned++
+		}
+	}
+	if abandoned == 0 {
+		t.Error("no customer gave up, so no nulls were checked")
+	}
+}
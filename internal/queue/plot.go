@@ -0,0 +1,81 @@
+package queue
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// writeGridPlot writes a gnuplot script, with the data inline, that plots
+// the average wait against the simulated hours of a grid, a line per number
+// of servers next to the stationary M/M/c wait they tend to, and with
+// intervals the 95% confidence intervals as error bars. The script renders
+// to a PNG named png.
+func writeGridPlot(w io.Writer, results []SimulationResult, estimates []waitEstimate, intervals bool, customerRate, serverRate float64, png string) error {
+	var servers []int
+	for _, r := range results {
+		if !slices.Contains(servers, r.TotalServers) {
+			servers = append(servers, r.TotalServers)
+		}
+	}
+	slices.Sort(servers)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# average wait time by simulated hours, at %.2f customers/hour and %.2f per server\n", customerRate, serverRate)
+	for _, c := range servers {
+		fmt.Fprintf(bw, "$servers%d << EOD\n", c)
+		for i, r := range results {
+			if r.TotalServers != c {
+				continue
+			}
+			fmt.Fprintf(bw, "%d %.4f", r.TotalTime/60, r.AverageWaitTime)
+			if intervals {
+				// a cell without an interval gets an empty error bar
+				half := estimates[i].Half
+				if math.IsNaN(half) {
+					half = 0
+				}
+				fmt.Fprintf(bw, " %.4f %.4f", r.AverageWaitTime-half, r.AverageWaitTime+half)
+			}
+			fmt.Fprintln(bw)
+		}
+		fmt.Fprintln(bw, "EOD")
+	}
+	fmt.Fprintln(bw)
+	fmt.Fprintln(bw, "set terminal pngcairo size 900,600")
+	fmt.Fprintf(bw, "set output %q\n", png)
+	fmt.Fprintln(bw, `set title "Average wait time by simulation length"`)
+	fmt.Fprintln(bw, `set xlabel "simulated hours"`)
+	fmt.Fprintln(bw, `set ylabel "average wait time (minutes)"`)
+	fmt.Fprintln(bw, "set logscale xy")
+	fmt.Fprintln(bw, "set key top left")
+	fmt.Fprintln(bw, "set grid")
+
+	var plots []string
+	for k, c := range servers {
+		style := "linespoints"
+		if intervals {
+			style = "yerrorlines"
+		}
+		title := fmt.Sprintf("%d servers", c)
+		if c == 1 {
+			title = "1 server"
+		}
+		plots = append(plots, fmt.Sprintf(`$servers%d with %s lt %d title %q`, c, style, k+1, title))
+		if wait := 60 * MMcWait(c, customerRate, serverRate); !math.IsInf(wait, 1) {
+			plots = append(plots, fmt.Sprintf(`%.4f with lines lt %d dt 2 title "M/M/%d stationary wait"`, wait, k+1, c))
+		}
+	}
+	fmt.Fprintf(bw, "plot %s\n", strings.Join(plots, ", \\\n     "))
+	return bw.Flush()
+}
+
+// plotImage returns the name of the image a plot script renders to: the
+// script's with a .png extension.
+func plotImage(script string) string {
+	return strings.TrimSuffix(script, filepath.Ext(script)) + ".png"
+}
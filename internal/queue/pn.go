@@ -0,0 +1,102 @@
+package queue
+
+import (
+	"fmt"
+	"io"
+)
+
+// MMcPn returns the stationary probabilities P0 to Pn of there being 0 to n
+// customers in an M/M/c queue with c servers, arrival rate lambda and
+// service rate mu per server, from the birth-death balance equations. It
+// returns nil if the queue is unstable.
+func MMcPn(c int, lambda, mu float64, n int) []float64 {
+	a := lambda / mu
+	rho := a / float64(c)
+	if rho >= 1 {
+		return nil
+	}
+	q := birthDeath(c, a, max(n, c))
+	// beyond c every state is rho times the one before
+	total := q[c] / (1 - rho)
+	for _, qk := range q[:c] {
+		total += qk
+	}
+	pn := make([]float64, n+1)
+	for k := range pn {
+		pn[k] = q[k] / total
+	}
+	return pn
+}
+
+// MMcKPn returns the stationary probabilities P0 to Pk of an M/M/c/K queue,
+// with room for k customers in the system, as with the admission policy
+// MaxInSystem{k}. It is stable for any rates.
+func MMcKPn(c, k int, lambda, mu float64) []float64 {
+	q := birthDeath(c, lambda/mu, k)
+	total := float64(0)
+	for _, qk := range q {
+		total += qk
+	}
+	for i := range q {
+		q[i] /= total
+	}
+	return q
+}
+
+// birthDeath returns the unnormalized stationary probabilities of 0 to n
+// customers with c servers and an offered load of a Erlangs, relative to
+// that of none.
+func birthDeath(c int, a float64, n int) []float64 {
+	q := make([]float64, n+1)
+	q[0] = 1
+	for k := 1; k <= n; k++ {
+		q[k] = q[k-1] * a / float64(min(k, c))
+	}
+	return q
+}
+
+// pn returns the fraction of the run, from the start until the last change
+// of the number in the system, spent with each number.
+func (r *run) pn() []float64 {
+	span := r.lastChange - r.s.startTime
+	if span <= 0 {
+		return nil
+	}
+	pn := make([]float64, len(r.timeAt))
+	for n, d := range r.timeAt {
+		pn[n] = float64(d) / float64(span)
+	}
+	return pn
+}
+
+// writePnTable writes the distribution of the number in the system as CSV,
+// a row for every n up to upTo and one for more, next to the probabilities
+// in theory if there are any.
+func writePnTable(w io.Writer, pn, theory []float64, upTo int) {
+	at := func(p []float64, n int) float64 {
+		if n < len(p) {
+			return p[n]
+		}
+		return 0
+	}
+	more := func(p []float64) float64 {
+		rest := float64(1)
+		for n := 0; n <= upTo; n++ {
+			rest -= at(p, n)
+		}
+		return max(rest, 0)
+	}
+	if theory == nil {
+		fmt.Fprintln(w, "n,simulated")
+		for n := 0; n <= upTo; n++ {
+			fmt.Fprintf(w, "%d,%.6f\n", n, at(pn, n))
+		}
+		fmt.Fprintf(w, ">%d,%.6f\n", upTo, more(pn))
+		return
+	}
+	fmt.Fprintln(w, "n,simulated,theory,difference")
+	for n := 0; n <= upTo; n++ {
+		fmt.Fprintf(w, "%d,%.6f,%.6f,%+.6f\n", n, at(pn, n), at(theory, n), at(pn, n)-at(theory, n))
+	}
+	fmt.Fprintf(w, ">%d,%.6f,%.6f,%+.6f\n", upTo, more(pn), more(theory), more(pn)-more(theory))
+}
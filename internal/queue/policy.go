@@ -0,0 +1,87 @@
+package queue
+
+import "fmt"
+
+// ServerSelectionPolicy decides which server takes a customer when several
+// servers are equally early to become available, e.g. when a customer walks
+// in and more than one server is idle. A customer that finds every server busy
+// still goes to whichever server frees up first.
+type ServerSelectionPolicy int
+
+const (
+	// EarliestAvailable picks the lowest-numbered server.
+	EarliestAvailable ServerSelectionPolicy = iota
+	// LeastBusy picks the server with the least accumulated service time.
+	LeastBusy
+	// RandomServer picks uniformly at random.
+	RandomServer
+	// RoundRobin picks the next server after the one chosen last.
+	RoundRobin
+	// FastestServer picks the server with the highest service rate.
+	FastestServer
+	// ServerAffinity picks a specific server, see WithServerAffinity.
+	ServerAffinity
+)
+
+var serverSelectionPolicyNames = []string{
+	EarliestAvailable: "earliest",
+	LeastBusy:         "least-busy",
+	RandomServer:      "random",
+	RoundRobin:        "round-robin",
+	FastestServer:     "fastest",
+	ServerAffinity:    "affinity",
+}
+
+func (p ServerSelectionPolicy) String() string {
+	if p < 0 || int(p) >= len(serverSelectionPolicyNames) {
+		return fmt.Sprintf("ServerSelectionPolicy(%d)", int(p))
+	}
+	return serverSelectionPolicyNames[p]
+}
+
+// ParseServerSelectionPolicy returns the policy with the given name.
+func ParseServerSelectionPolicy(name string) (ServerSelectionPolicy, error) {
+	for i, n := range serverSelectionPolicyNames {
+		if n == name {
+			return ServerSelectionPolicy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown server selection policy %q", name)
+}
+
+// selectServer picks one of candidates, which are server indices in
+// increasing order. busyTime holds the accumulated service time per server.
+func (s *Simulation) selectServer(candidates []int, busyTime []int) int {
+	chosen := candidates[0]
+	switch s.policy {
+	case LeastBusy:
+		for _, j := range candidates {
+			if busyTime[j] < busyTime[chosen] {
+				chosen = j
+			}
+		}
+	case RandomServer:
+		chosen = candidates[s.rng.Intn(len(candidates))]
+	case RoundRobin:
+		for _, j := range candidates {
+			if j >= s.nextServer {
+				chosen = j
+				break
+			}
+		}
+		s.nextServer = chosen + 1
+	case FastestServer:
+		for _, j := range candidates {
+			if s.serverRates[j] > s.serverRates[chosen] {
+				chosen = j
+			}
+		}
+	case ServerAffinity:
+		for _, j := range candidates {
+			if j == s.affinity {
+				chosen = j
+			}
+		}
+	}
+	return chosen
+}
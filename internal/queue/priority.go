@@ -0,0 +1,111 @@
+package queue
+
+import (
+	"log/slog"
+	"slices"
+)
+
+// WithPreemption lets an arriving customer who finds every server busy take
+// the server of a customer of lower priority, as in emergency-room triage.
+// Priorities come from the classes of the catalog. The preempted customer
+// goes back to the line, ahead of the others of the same priority, and later
+// resumes the service that was left. Among the customers of the lowest
+// priority in service, the one with the most service left is preempted.
+// Only the shared line preempts, and only servers serving one customer at
+// a time.
+func WithPreemption() Option {
+	return func(s *Simulation) {
+		s.preemptive = true
+	}
+}
+
+// priority returns the priority of customer c, 0 without a catalog.
+func (s *Simulation) priority(c *Customer) int {
+	if len(s.classes) == 0 {
+		return 0
+	}
+	return s.classes[c.Class].Priority
+}
+
+// enqueue puts customers at the back of line q, behind the others of the
+// same or a higher priority.
+func (s *Simulation) enqueue(q []*Customer, cs ...*Customer) []*Customer {
+	if !s.prioritized {
+		return append(q, cs...)
+	}
+	for _, c := range cs {
+		p := s.priority(c)
+		i := len(q)
+		for i > 0 && s.priority(q[i-1]) < p {
+			i--
+		}
+		q = slices.Insert(q, i, c)
+	}
+	return q
+}
+
+// requeue puts customer c back in line q, ahead of the others of the same
+// priority.
+func (s *Simulation) requeue(q []*Customer, c *Customer) []*Customer {
+	p := s.priority(c)
+	i := 0
+	for i < len(q) && s.priority(q[i]) > p {
+		i++
+	}
+	return slices.Insert(q, i, c)
+}
+
+// preempt lets the customers at the front of the shared line take the
+// servers of customers of a lower priority at time t.
+func (r *run) preempt(t int) {
+	for len(r.queue) > 0 && r.nIdle() == 0 {
+		p := r.s.priority(r.queue[0])
+		victim, lowest := -1, p
+		for j, sv := range r.servers {
+			if !r.available(j) || len(sv.batch) != 1 || !r.serves(j, r.queue[0]) {
+				continue
+			}
+			c := sv.batch[0]
+			if q := r.s.priority(c); q < lowest || (q == lowest && victim != -1 && c.FinishTime > r.servers[victim].batch[0].FinishTime) {
+				victim, lowest = j, q
+			}
+		}
+		if victim == -1 {
+			return
+		}
+
+		sv := &r.servers[victim]
+		c := sv.batch[0]
+		left := c.FinishTime - t
+		r.busyTime[victim] -= left
+		if sv.setupEnd > t {
+			sv.setupTime -= sv.setupEnd - t
+			left -= sv.setupEnd - t
+		}
+		sv.version++
+		sv.batch = sv.batch[:0]
+		sv.freeAt = t
+		c.Interruptions++
+		c.Preemptions++
+		c.work = left + sv.rest
+		c.preempted, c.preemptedAt = true, t
+		r.preemptions++
+		if r.logs(LevelCustomer) {
+			r.logAttrs(LevelCustomer, "customer preempted", slog.Int("customer", c.Index), r.at(t), slog.Int("server", victim), slog.Int("by", r.queue[0].Index), r.durationAttr("left", left))
+		}
+		r.queue = r.s.requeue(r.queue, c)
+		r.event(CustomerInterrupted, t, c)
+		r.next(victim, t)
+	}
+}
+
+// nIdle returns the number of idle servers.
+func (r *run) nIdle() int {
+	n := 0
+	for j := range r.servers {
+		if r.idle(j) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,84 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Progress reports how far a simulation, or a batch of them, has come.
+type Progress struct {
+	// Done is the fraction of the simulated time done.
+	Done float64
+	// Customers counts the customers who arrived so far.
+	Customers int
+	Elapsed   time.Duration
+	// ETA estimates the wall clock time left from the pace so far.
+	ETA time.Duration
+}
+
+// WithProgress calls fn with the progress of the simulation at most once
+// per interval of wall clock time, and once more when it is done.
+// Simulations run together by simulateAllContext report their progress
+// together instead.
+func WithProgress(interval time.Duration, fn func(Progress)) Option {
+	return func(s *Simulation) {
+		s.progress = newProgressTracker(int64(s.endTime-s.startTime), interval, fn)
+	}
+}
+
+// progressTracker adds up the simulated minutes of one or more simulations
+// and calls fn with the progress, one call at a time.
+type progressTracker struct {
+	total    int64 // simulated minutes
+	interval time.Duration
+	fn       func(Progress)
+	start    time.Time
+
+	done, customers atomic.Int64
+	last            atomic.Int64 // time of the last report, in nanoseconds
+	mu              sync.Mutex
+}
+
+func newProgressTracker(total int64, interval time.Duration, fn func(Progress)) *progressTracker {
+	p := &progressTracker{total: total, interval: interval, fn: fn, start: time.Now()}
+	p.last.Store(p.start.UnixNano())
+	return p
+}
+
+// add records minutes more of simulated time, in which customers arrived,
+// and reports the progress if an interval has passed or all is done.
+func (p *progressTracker) add(minutes, customers int) {
+	done := p.done.Add(int64(minutes))
+	c := p.customers.Add(int64(customers))
+	now := time.Now()
+	last := p.last.Load()
+	if done < p.total && (now.UnixNano()-last < int64(p.interval) || !p.last.CompareAndSwap(last, now.UnixNano())) {
+		return
+	}
+
+	pr := Progress{Done: float64(done) / float64(p.total), Customers: int(c), Elapsed: now.Sub(p.start)}
+	if pr.Done > 0 {
+		pr.ETA = time.Duration(float64(pr.Elapsed) * (1 - pr.Done) / pr.Done)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fn(pr)
+}
+
+// checkpoint is called every simulated hour and at endTime. It reports the
+// progress up to time t, saves the state of the run when a Checkpoint is
+// due and stops the run if ctx is done.
+func (r *run) checkpoint(ctx context.Context, t int) error {
+	if p := r.s.progress; p != nil {
+		p.add((t-r.reportedTime)/r.s.tick, r.customers-r.reportedCustomers)
+		r.reportedTime, r.reportedCustomers = t, r.customers
+	}
+	if cp := r.s.checkpoints; cp != nil && cp.Every > 0 && t < r.s.endTime && (t-r.s.startTime)%(cp.Every*60*r.s.tick) == 0 {
+		if err := r.save(t); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
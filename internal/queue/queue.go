@@ -0,0 +1,1221 @@
+// Package queue is the simulator and its commands. It is internal: other
+// modules use it through the packages under pkg, whose API is stable, while
+// this one changes as the simulator does.
+package queue
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand"
+	"os"
+	"os/signal"
+	"time"
+)
+
+const epsilon = 1e-6
+
+type Poisson struct {
+	lambda float64
+	maxn   int
+	p      []float64
+	rng    *rand.Rand
+}
+
+func NewPoisson(lambda float64, maxn int, seed int64) *Poisson {
+	return newPoisson(lambda, maxn, rand.New(rand.NewSource(seed)))
+}
+
+// newPoisson is like NewPoisson but draws from an existing generator, so
+// that several rates can share one random stream.
+func newPoisson(lambda float64, maxn int, rng *rand.Rand) *Poisson {
+	p := make([]float64, maxn+1)
+	p[0] = math.Exp(-lambda)
+	for i := 1; i <= maxn; i++ {
+		p[i] = p[i-1] * lambda / float64(i)
+	}
+	return &Poisson{
+		lambda: lambda,
+		maxn:   maxn,
+		p:      p,
+		rng:    rng,
+	}
+}
+
+func (p *Poisson) Get() int {
+	x := p.rng.Float64()
+	cum := float64(0)
+	for i, pi := range p.p {
+		cum += pi
+		if x <= cum {
+			return i
+		}
+	}
+	return p.maxn
+}
+
+type Exponential struct {
+	lambda float64
+	rng    *rand.Rand
+}
+
+func NewExponential(lambda float64, seed int64) *Exponential {
+	return &Exponential{
+		lambda: lambda,
+		rng:    rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (e *Exponential) Get() float64 {
+	return e.Sample(e.rng)
+}
+
+type Customer struct {
+	Index                               int
+	ArrivalTime, ServedTime, FinishTime int
+	Server                              int
+
+	// Class is the index of the customer's class in the catalog.
+	Class int
+
+	// Interruptions counts how often a breakdown, a preemption or the end
+	// of a round-robin time slice cut the service short, and Preemptions
+	// how often a preemption did.
+	Interruptions int
+	Preemptions   int
+
+	booked      bool
+	appointment int // booked time, if booked
+
+	service int // service minutes needed
+	work    int // service minutes still to do
+
+	preempted   bool // waiting to resume after a preemption
+	preemptedAt int
+
+	left float64 // work left with processor sharing, in ticks
+}
+
+func (c *Customer) WaitTime() int {
+	return c.ServedTime - c.ArrivalTime
+}
+
+func (c *Customer) ServiceTime() int {
+	return c.FinishTime - c.ServedTime
+}
+
+func (c *Customer) SpentTime() int {
+	return c.FinishTime - c.ArrivalTime
+}
+
+type Simulation struct {
+	nServers                 int
+	startTime, endTime       int
+	customerRate, serverRate float64
+	serverRates              []float64
+
+	policy     ServerSelectionPolicy
+	affinity   int
+	nextServer int
+
+	separateQueues bool
+	jockeying      bool
+
+	profile     []RatePeriod
+	profileDist []*Poisson
+	covariates  []Covariate
+	speeds      []ServiceSpeed
+
+	shifts, breaks map[int][]Shift
+	redirect       bool
+
+	cutoff    int
+	hasCutoff bool
+	closing   ClosingPolicy
+
+	day        int     // from 0, the day the times are on
+	multiplier float64 // of the arrival rates
+
+	classes     []CustomerClass
+	prioritized bool // some classes have priorities
+	preemptive  bool
+	mixRng      *rand.Rand
+	service     ServiceDistribution
+
+	groupMean          float64
+	groupDist          *Poisson
+	minBatch, maxBatch int
+
+	breakdowns              *Breakdowns
+	failureDist, repairDist []*Exponential
+
+	patience    ServiceDistribution
+	patienceRng *rand.Rand
+
+	setup    *Setup
+	setupRng []*rand.Rand
+
+	stop        *Stop
+	sla         *SLA
+	checkpoints *Checkpoint
+	streaming   bool
+	stateTimes  []int // sorted, in minutes of the day until scaleTimes
+	hooks       *Hooks
+	admission   AdmissionPolicy
+	routing     RoutingPolicy
+	skills      [][]int  // classes by server, with WithSkills
+	skilled     [][]bool // whether a server serves a class, by trainSkills
+	scaling     *Autoscaling
+	pause       func(*run, []CustomerEvent) // of a Stepper
+
+	population int // of a closed system
+	think      ServiceDistribution
+	thinkRng   *rand.Rand
+
+	sharing    bool
+	roundRobin float64 // quantum, in minutes
+	quantum    int     // in ticks
+
+	sources       SourceFactory
+	streamSources map[string]rand.Source // by key, for checkpoints
+
+	appointments []Appointment
+	noShow       float64
+	lateness     ServiceDistribution
+
+	customerDist *Poisson
+	serverDist   []*Exponential
+	rng          *rand.Rand
+
+	antithetic bool
+	batchMeans int
+
+	tick     int // clock ticks per minute
+	seed     int64
+	logger   *slog.Logger
+	progress *progressTracker
+}
+
+// Option customizes a Simulation created by NewSimulation.
+type Option func(*Simulation)
+
+// WithServerSelection sets the policy used to pick among free servers.
+func WithServerSelection(policy ServerSelectionPolicy) Option {
+	return func(s *Simulation) {
+		s.policy = policy
+	}
+}
+
+// WithServerAffinity makes customers prefer the given server whenever it is
+// among the earliest available ones.
+func WithServerAffinity(server int) Option {
+	return func(s *Simulation) {
+		s.policy = ServerAffinity
+		s.affinity = server
+	}
+}
+
+// WithSeparateQueues gives every server its own line. Arriving customers join
+// the shortest line, counting the customer in service, and the selection
+// policy breaks ties. With jockeying, a server whose line empties takes the
+// last customer from the longest other line.
+func WithSeparateQueues(jockeying bool) Option {
+	return func(s *Simulation) {
+		s.separateQueues = true
+		s.jockeying = jockeying
+	}
+}
+
+// RatePeriod sets the arrival rate, in customers per hour, between Start
+// (inclusive) and End (exclusive), in minutes.
+type RatePeriod struct {
+	Start, End int
+	Rate       float64
+}
+
+// WithArrivalProfile varies the arrival rate over the day. Outside of the
+// given periods customers arrive at the common customerRate.
+func WithArrivalProfile(periods ...RatePeriod) Option {
+	return func(s *Simulation) {
+		s.profile = append(s.profile, periods...)
+	}
+}
+
+// WithServerRates overrides the service rate (customers per hour) of each
+// server in turn. Servers without an entry keep the common serverRate.
+func WithServerRates(rates ...float64) Option {
+	return func(s *Simulation) {
+		copy(s.serverRates, rates)
+	}
+}
+
+func NewSimulation(startTime, endTime, nServers int, customerRate, serverRate float64, seed int64, opts ...Option) *Simulation {
+	s := &Simulation{
+		nServers:     nServers,
+		startTime:    startTime,
+		endTime:      endTime,
+		customerRate: customerRate,
+		serverRate:   serverRate,
+		serverRates:  make([]float64, nServers),
+		minBatch:     1,
+		maxBatch:     1,
+		seed:         seed,
+		tick:         1,
+		multiplier:   1,
+	}
+	for i := range s.serverRates {
+		s.serverRates[i] = serverRate
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.tick > 1 || s.day > 0 {
+		s.scaleTimes()
+	}
+	if s.multiplier != 1 {
+		s.scaleRates()
+	}
+	s.modulateArrivals()
+	s.trainSkills()
+	for _, c := range s.classes {
+		s.prioritized = s.prioritized || c.Priority != 0
+	}
+	if s.roundRobin > 0 {
+		s.quantum = max(1, s.ticks(s.roundRobin))
+	}
+
+	poisson := newPoisson(s.customerRate/60/float64(s.tick), 100, s.stream(arrivalStream))
+	exp := make([]*Exponential, nServers)
+	for i := range exp {
+		exp[i] = &Exponential{lambda: float64(1) / (float64(60) / s.serverRates[i]), rng: s.stream(serviceStream, i)}
+	}
+
+	s.customerDist = poisson
+	for _, p := range s.profile {
+		s.profileDist = append(s.profileDist, newPoisson(p.Rate/60/float64(s.tick), 100, poisson.rng))
+	}
+	s.serverDist = exp
+	s.rng = s.stream(selectionStream)
+	s.mixRng = s.stream(mixStream)
+	if s.groupMean > 1 {
+		s.groupDist = newPoisson(s.groupMean-1, 100, s.stream(groupStream))
+	}
+	if b := s.breakdowns; b != nil {
+		for j := range nServers {
+			s.failureDist = append(s.failureDist, &Exponential{lambda: 1 / b.TimeToFailure, rng: s.stream(failureStream, j)})
+			s.repairDist = append(s.repairDist, &Exponential{lambda: 1 / b.RepairTime, rng: s.stream(repairStream, j)})
+		}
+	}
+	if s.patience != nil {
+		s.patienceRng = s.stream(patienceStream)
+	}
+	if s.population > 0 {
+		s.thinkRng = s.stream(thinkStream)
+	}
+	if s.setup != nil {
+		for j := range nServers {
+			s.setupRng = append(s.setupRng, s.stream(setupStream, j))
+		}
+	}
+	return s
+}
+
+type SimulationResult struct {
+	TotalTime          int
+	TotalCustomers     int
+	TotalServers       int
+	AverageWaitTime    float64
+	AverageServiceTime float64
+	Jockeys            int
+	Servers            []ServerStats
+	Interruptions      int
+
+	// WaitStdDev is the standard deviation of the waits of the customers
+	// served, in minutes.
+	WaitStdDev float64
+
+	// Preemptions counts the services cut short by a customer of higher
+	// priority, with WithPreemption. The preempted customers waited
+	// AveragePreemptionDelay minutes on average before resuming.
+	Preemptions            int
+	AveragePreemptionDelay float64
+
+	// Denied counts customers turned away after the cutoff, by the
+	// admission policy or by the OnArrival hook, and SentAway those sent home from the line at
+	// closing time with SendAwayAtClose. LastFinishTime is when the last
+	// customer left and Overtime how long that was after endTime; every
+	// server has its own overtime too.
+	Denied         int
+	SentAway       int
+	LastFinishTime int
+	Overtime       int
+
+	// AverageGroupSize is the number of customers per arrival and
+	// AverageBatchSize the number served at once.
+	AverageGroupSize float64
+	AverageBatchSize float64
+
+	// Abandoned counts customers who ran out of patience before being
+	// served, after AverageAbandonWait minutes on average. Wait and service
+	// averages only count the customers served.
+	Abandoned          int
+	AverageAbandonWait float64
+
+	// NoShows counts booked customers who did not come. Booked customers
+	// were served AverageAppointmentDelay minutes after their booked time on
+	// average, counting those served early as on time.
+	NoShows                 int
+	AverageAppointmentDelay float64
+
+	// Overload is set when the arrival rate exceeds the total service
+	// capacity for part of the run.
+	Overload *OverloadStats
+
+	// Little checks Little's law over the whole run, which it must satisfy
+	// exactly, and LittleOpen over the opening hours only, where the
+	// customers left at endTime make it drift.
+	Little, LittleOpen LittlesLaw
+
+	// Pn is the distribution of the number of customers in the system:
+	// Pn[n] is the fraction of the run, from startTime until the last
+	// customer left, with n of them there. Its mean is Little.L. See
+	// MMcPn for that of an M/M/c queue in the long run.
+	Pn []float64
+
+	// BatchMeans are the mean waits of equal batches of the customers
+	// served, with WithBatchMeans.
+	BatchMeans []float64
+
+	// Stopped names the criterion of WithStop that ended the run before
+	// endTime, one of StoppedServed, StoppedHalfWidth and StoppedWallClock,
+	// and is empty if the run went on to endTime.
+	Stopped string
+
+	// Classes breaks the customers down by the class of the catalog, with
+	// WithCatalog.
+	Classes []ClassStats
+
+	// SLA holds the service-level metrics, with WithSLA.
+	SLA *SLAStats
+
+	// States are the states of the system at the times of WithStates.
+	States []State
+	// Scaling reports the servers called in and sent away, with
+	// WithAutoscaling.
+	Scaling *ScalingStats
+
+	waits     histogram       // of the customers served, in ticks
+	streaming *streamingWaits // instead, with streaming statistics
+	tick      int             // per minute
+}
+
+// WaitQuantile returns the smallest wait, in minutes, that at least a
+// fraction q of the customers served did not exceed. With streaming
+// statistics it is an estimate.
+func (r SimulationResult) WaitQuantile(q float64) int {
+	k := max(r.tick, 1)
+	if r.streaming != nil {
+		return int(math.Round(r.streaming.quantile(q) / float64(k)))
+	}
+	return (r.waits.quantile(q) + k - 1) / k
+}
+
+// ServedWithin returns the fraction of the customers served who waited at
+// most the given minutes. With streaming statistics it is an estimate.
+func (r SimulationResult) ServedWithin(minutes int) float64 {
+	if r.streaming != nil {
+		return r.streaming.within(float64(minutes * max(r.tick, 1)))
+	}
+	return r.waits.within(minutes * max(r.tick, 1))
+}
+
+// Simulate runs the simulation. verbose is kept for compatibility: it logs
+// every customer to standard output unless WithLogger set a logger.
+func (s *Simulation) Simulate(verbose bool) SimulationResult {
+	log := s.logger
+	if log == nil && verbose {
+		log = slog.New(newTextHandler(os.Stdout, LevelCustomer))
+	}
+	result, _ := s.simulate(context.Background(), log, nil)
+	return result
+}
+
+// SimulateContext runs the simulation until it is done or ctx is, checking
+// every simulated hour and every few thousand events, and then returns the
+// error of ctx.
+func (s *Simulation) SimulateContext(ctx context.Context) (SimulationResult, error) {
+	return s.simulate(ctx, s.logger, nil)
+}
+
+// simulate runs the simulation, logging to log and passing every customer
+// who leaves to emit, if not nil.
+func (s *Simulation) simulate(ctx context.Context, log *slog.Logger, emit func(CustomerEvent)) (SimulationResult, error) {
+	r := s.newRun(log)
+	r.emit, r.ctx = emit, ctx
+	first := s.startTime
+	if cp := s.checkpoints; cp != nil {
+		r.options = s.fingerprint()
+	}
+	if cp := s.checkpoints; cp != nil && cp.Resume {
+		var err error
+		if first, err = r.load(); err != nil {
+			return SimulationResult{}, err
+		}
+	}
+	if s.unstable() && r.logs(LevelQuiet) {
+		r.logAttrs(LevelQuiet, "unstable queue, the line grows for as long as customers arrive", r.at(first), slog.Float64("traffic_intensity", s.TrafficIntensity()))
+	}
+	for t := first; t < s.endTime; t++ {
+		if (t-s.startTime)%(60*s.tick) == 0 && t > s.startTime {
+			if err := r.checkpoint(ctx, t); err != nil {
+				return SimulationResult{}, err
+			}
+		}
+		if s.stop != nil {
+			r.advance(t)
+			if r.stopped(t) {
+				break
+			}
+		}
+		r.tick(t)
+		if s.stateTimes != nil {
+			r.recordStates(t)
+		}
+		if s.population > 0 {
+			// customers come back as events
+			r.advance(t)
+		} else {
+			r.arriveBooked(t)
+			r.pause()
+			k := s.arrivals(t)
+			for ik := 0; ik < k; ik++ {
+				r.advance(t)
+				r.arrive(t, s.groupSize())
+				r.pause()
+			}
+		}
+		if s.sla != nil {
+			r.measureQueue(t)
+		}
+		if r.err != nil {
+			return SimulationResult{}, r.err
+		}
+	}
+	// the end, unless a stopping criterion came first
+	end := r.s.endTime
+	if err := r.checkpoint(ctx, end); err != nil {
+		return SimulationResult{}, err
+	}
+	r.tick(end)
+	r.closeDoors(end)
+	r.pause()
+	r.recordLateStates(end)
+	// serve everyone still waiting at endTime
+	r.advance(math.MaxInt)
+	if r.err != nil {
+		return SimulationResult{}, r.err
+	}
+	result := r.result()
+	if r.logs(LevelSummary) {
+		r.logAttrs(LevelSummary, "run finished",
+			slog.Int64("seed", s.seed),
+			slog.Int("hours", result.TotalTime/60),
+			slog.Int("servers", result.TotalServers),
+			slog.Int("customers", result.TotalCustomers),
+			slog.Float64("average_wait", result.AverageWaitTime),
+			slog.String("last_finish", formatTime(result.LastFinishTime)))
+	}
+	return result, nil
+}
+
+// arrivals returns the number of customers arriving during tick t.
+func (s *Simulation) arrivals(t int) int {
+	for i, p := range s.profile {
+		if t >= p.Start && t < p.End {
+			return s.profileDist[i].Get()
+		}
+	}
+	return s.customerDist.Get()
+}
+
+func simulateOnce(seed int64, args []string) {
+	startTime := 8 * 60 // 08:00
+	endTime := 16 * 60  // 16:00
+	customerRate := 5.8 // 5.8 customers per hour
+	serverRate := 6.0   // 6 customers per hour, or 10 minutes per customer
+
+	fs := flag.NewFlagSet("once", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	nServers := fs.Int("servers", 2, "number of servers")
+	policyName := fs.String("policy", EarliestAvailable.String(), "server selection policy: earliest, least-busy, random, round-robin, fastest or affinity")
+	queues := fs.String("queues", "shared", "queue layout: shared, or separate to join the shortest line")
+	jockey := fs.Bool("jockey", false, "with separate queues, move a customer over whenever a line empties")
+	catalog := fs.String("catalog", "", "CSV `file` of transaction categories, see catalog.csv")
+	covariates := fs.String("covariates", "", "CSV `file` of arrival and service rate multipliers over the day, see covariates.csv")
+	normalize := fs.Bool("normalize", false, "with -covariates, divide the multipliers by their means, for raw counts such as foot traffic")
+	var speeds speedFlag
+	fs.Var(&speeds, "service-speed", "service rate multiplier by the state as a service starts: `line,PER_CUSTOMER,MOST` to speed up by the customers waiting or fatigue,PER_HOUR,LEAST to slow down over the shift; repeatable")
+	service := fs.String("service", "", "service time `distribution` as NAME,PARAMS..., e.g. lognormal,10,5 or empirical,service_times.csv,interpolate")
+	cutoff := fs.String("cutoff", "", "last ticket time as HH:MM, before the doors close at 16:00")
+	warmup := fs.String("warmup", "", "setup time `distribution` of a server starting after being idle, e.g. uniform,5,5")
+	changeover := fs.String("changeover", "", "setup time `distribution` of a server switching between classes of the catalog")
+	discipline := fs.String("discipline", "fcfs", "service discipline: fcfs, ps for processor sharing or rr for round robin")
+	quantum := fs.Float64("quantum", 1, "with -discipline rr, the time slice in minutes")
+	preempt := fs.Bool("preempt", false, "with a catalog with priorities, let arriving customers take the servers of those of a lower priority")
+	closing := fs.String("closing", "serve", "at closing time, serve everyone inside or send-away those still in line")
+	sla := fs.String("sla", "", "report the fraction of customers served within each of these comma-separated waits in minutes, e.g. 5,10,15")
+	queueLength := fs.Int("queue-length", 5, "with -sla, report the fraction of the day with more than this many customers in line")
+	redirect := fs.Bool("redirect", false, "with separate queues, send the line of a server going off duty to other lines")
+	admission := fs.String("admission", "", "admission `policy`: max-line,N, max-in-system,N or reserve,LINE,CLASS...")
+	scaleUp := fs.Int("scale-up", 0, "autoscaling: call in a standby server for every `N` customers waiting")
+	scaleAt := fs.String("scale-at", "", "scheduled scaling: comma-separated `HH:MM=SERVERS`, the least servers on duty from then on")
+	scaleMin := fs.Int("scale-min", 1, "with autoscaling, the servers on duty from the start, out of -servers")
+	scaleDelay := fs.Float64("scale-delay", 5, "with -scale-up, the minutes a server takes to come on duty after the call")
+	scaleIdle := fs.Float64("scale-idle", 10, "with autoscaling, the minutes a server stays idle before going back on standby")
+	routing := fs.String("routing", "", "routing `policy` instead of -policy: threshold,BASE,LINE, longest-idle or order,SERVER...")
+	var shifts, breaks shiftFlag
+	fs.Var(&shifts, "shift", "on-duty window of a server as `SERVER=HH:MM-HH:MM`, SERVER may be \"all\"; repeatable")
+	fs.Var(&breaks, "break", "break of a server as `SERVER=HH:MM-HH:MM`, SERVER may be \"all\"; repeatable")
+	logLevel := fs.String("log-level", "customer", "log level: quiet, summary, customer or debug")
+	logFile := fs.String("log-file", "", "write the log to `file` instead of standard output")
+	viz := fs.Bool("viz", false, "play the day on the terminal, logging only to -log-file")
+	speed := fs.Float64("speed", 30, "with -viz, simulated minutes per second, or 0 for as fast as possible")
+	gantt := fs.String("gantt", "", "write the busy segments of every server as CSV to `file`")
+	ganttSVG := fs.String("gantt-svg", "", "draw the busy segments of every server as an SVG Gantt chart in `file`")
+	resolution := fs.Duration("resolution", time.Minute, "length of a clock tick, down to 1s, to which service and other times are rounded")
+	store := fs.String("store", "", "add the run to the experiments in the SQLite `database`, see the results command")
+	parquet := fs.String("parquet", "", "write a record of every customer who left to `file` in Apache Parquet")
+	pn := fs.Int("pn", 0, "print the distribution of the number in the system over the day, P0 to P`N`")
+	fs.Parse(args)
+	checkServers("servers", *nServers)
+
+	if *viz && *logFile == "" {
+		*logLevel = "quiet"
+	}
+	logger, closeLog, err := newLogger(*logLevel, *logFile)
+	exitOnError(err)
+	defer closeLog()
+
+	policy, err := ParseServerSelectionPolicy(*policyName)
+	exitOnError(err)
+	opts := []Option{WithServerSelection(policy), WithLogger(logger)}
+	if *resolution != time.Minute {
+		opts = append(opts, WithResolution(*resolution))
+	}
+	switch *queues {
+	case "shared":
+	case "separate":
+		opts = append(opts, WithSeparateQueues(*jockey))
+	default:
+		exitOnError(fmt.Errorf("unknown queue layout %q", *queues))
+	}
+	if *redirect {
+		opts = append(opts, WithOffDutyRedirect())
+	}
+	if *catalog != "" {
+		classes, err := LoadCatalog(*catalog)
+		exitOnError(err)
+		opts = append(opts, WithCatalog(classes))
+	}
+	if *covariates != "" {
+		cs, err := LoadCovariates(*covariates)
+		exitOnError(err)
+		if *normalize {
+			cs = NormalizeCovariates(cs)
+		}
+		opts = append(opts, WithCovariates(cs...))
+	}
+	if len(speeds) > 0 {
+		opts = append(opts, WithServiceSpeed(speeds...))
+	}
+	switch *discipline {
+	case "fcfs":
+	case "ps":
+		opts = append(opts, WithProcessorSharing())
+	case "rr":
+		if *quantum <= 0 {
+			exitOnError(fmt.Errorf("quantum must be positive, got %g", *quantum))
+		}
+		opts = append(opts, WithRoundRobin(*quantum))
+	default:
+		exitOnError(fmt.Errorf("unknown service discipline %q", *discipline))
+	}
+	switch *closing {
+	case "serve":
+	case "send-away":
+		opts = append(opts, WithClosingPolicy(SendAwayAtClose))
+	default:
+		exitOnError(fmt.Errorf("unknown closing policy %q", *closing))
+	}
+	if *preempt {
+		opts = append(opts, WithPreemption())
+	}
+	if *admission != "" {
+		p, err := ParseAdmissionPolicy(*admission)
+		exitOnError(err)
+		opts = append(opts, WithAdmission(p))
+	}
+	if *routing != "" {
+		p, err := ParseRoutingPolicy(*routing)
+		exitOnError(err)
+		opts = append(opts, WithRouting(p))
+	}
+	if *scaleUp > 0 || *scaleAt != "" {
+		a := Autoscaling{Min: *scaleMin, ScaleUp: *scaleUp, Delay: *scaleDelay, Idle: *scaleIdle}
+		if *scaleAt != "" {
+			a.Schedule, err = parseScaleSteps(*scaleAt)
+			exitOnError(err)
+		}
+		opts = append(opts, WithAutoscaling(a))
+	}
+	if *sla != "" {
+		thresholds, err := parseThresholds(*sla)
+		exitOnError(err)
+		opts = append(opts, WithSLA(SLA{Thresholds: thresholds, QueueLength: *queueLength}))
+	}
+	if *warmup != "" || *changeover != "" {
+		var setup Setup
+		if *warmup != "" {
+			setup.Warmup, err = parseDistributionFlag(*warmup)
+			exitOnError(err)
+		}
+		if *changeover != "" {
+			setup.Changeover, err = parseDistributionFlag(*changeover)
+			exitOnError(err)
+		}
+		opts = append(opts, WithSetup(setup))
+	}
+	if *service != "" {
+		dist, err := parseDistributionFlag(*service)
+		exitOnError(err)
+		opts = append(opts, WithServiceDistribution(dist))
+	}
+	if *cutoff != "" {
+		t, err := parseTime(*cutoff)
+		exitOnError(err)
+		opts = append(opts, WithCutoff(t))
+	}
+	shiftOpts, err := shifts.options(*nServers, WithShifts)
+	exitOnError(err)
+	breakOpts, err := breaks.options(*nServers, WithBreaks)
+	exitOnError(err)
+	opts = append(append(opts, shiftOpts...), breakOpts...)
+	var trace *ParquetTrace
+	closeTrace := func() error { return nil }
+	if *parquet != "" {
+		trace, closeTrace, err = createParquetTrace(*parquet, ticksPerMinute(*resolution))
+		exitOnError(err)
+		opts = append(opts, WithHooks(trace.Hooks()))
+	}
+
+	s := NewSimulation(startTime, endTime, *nServers, customerRate, serverRate, seed, opts...)
+	var result SimulationResult
+	if *viz || *gantt != "" || *ganttSVG != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		var view *terminalView
+		var p *pacer
+		if *viz {
+			view, p = newTerminalView(os.Stdout, startTime, endTime, *nServers, s.TicksPerMinute()), newPacer(*speed, startTime)
+			view.draw()
+		}
+		tl := newTimeline()
+		events, results := s.Stream(ctx)
+		for e := range events {
+			if view != nil {
+				view.show(ctx, e, p)
+			}
+			tl.add(e)
+		}
+		if view != nil {
+			view.draw()
+		}
+		r, ok := <-results
+		if !ok {
+			fmt.Fprintln(os.Stderr, "once:", ctx.Err())
+			os.Exit(1)
+		}
+		result = r
+		if *gantt != "" {
+			exitOnError(writeFile(*gantt, func(w io.Writer) error { return writeGanttCSV(w, tl.segments, s.TicksPerMinute()) }))
+		}
+		if *ganttSVG != "" {
+			exitOnError(writeFile(*ganttSVG, func(w io.Writer) error {
+				return writeGanttSVG(w, tl.segments, *nServers, startTime, endTime, s.TicksPerMinute())
+			}))
+		}
+	} else {
+		result = s.Simulate(false)
+	}
+	exitOnError(closeTrace())
+
+	fmt.Println()
+	fmt.Printf("Simulation Time    : %d hours\n", result.TotalTime/60)
+	fmt.Printf("Total Customers    : %d (%.6f customers/hour)\n", result.TotalCustomers, float64(result.TotalCustomers)/(float64(result.TotalTime)/float64(60)))
+	fmt.Printf("Total Servers      : %d\n", result.TotalServers)
+	fmt.Printf("Average WaitTime   : %.6f minutes\n", result.AverageWaitTime)
+	fmt.Printf("Average ServiceTime: %.6f minutes\n", result.AverageServiceTime)
+	for _, l := range []struct {
+		name string
+		law  LittlesLaw
+	}{{"Little's Law", result.Little}, {"  Opening Hours", result.LittleOpen}} {
+		fmt.Printf("%-19s: L = %.6f, λW = %.6f × %.6f = %.6f (%+.2f%%)\n", l.name, l.law.L, l.law.Lambda, l.law.W, l.law.Lambda*l.law.W, l.law.Discrepancy()*100)
+	}
+	if *jockey {
+		fmt.Printf("Jockeys            : %d\n", result.Jockeys)
+	}
+	if *cutoff != "" {
+		fmt.Printf("Denied Customers   : %d (last ticket at %s)\n", result.Denied, *cutoff)
+	} else if *admission != "" {
+		fmt.Printf("Denied Customers   : %d (admission %s)\n", result.Denied, *admission)
+	}
+	if *closing == "send-away" {
+		fmt.Printf("Sent Away          : %d customers in line at %s\n", result.SentAway, formatTime(endTime))
+	}
+	fmt.Printf("Last Customer Left : %s (%d minutes overtime)\n", formatTime(result.LastFinishTime), result.Overtime)
+	for j, st := range result.Servers {
+		fmt.Printf("Server %-12d: %d customers, busy %.2f of %.2f scheduled hours (%.1f%%), %d minutes overtime", j, st.Customers, float64(st.BusyTime)/60, float64(st.ScheduledTime)/60, st.Utilization*100, st.Overtime)
+		if *warmup != "" || *changeover != "" {
+			fmt.Printf(", %d setups taking %d minutes", st.Setups, st.SetupTime)
+		}
+		fmt.Println()
+	}
+	if st := result.Scaling; st != nil {
+		fmt.Printf("Server Hours       : %.2f, at most %d servers on duty\n", st.ServerHours, st.PeakServers)
+		for _, e := range st.Events {
+			fmt.Printf("%-19s: server %d %s (%s)\n", "  Scaled "+formatTime(e.Time), e.Server, e.Action, e.Reason)
+		}
+	}
+	if *preempt {
+		fmt.Printf("Preemptions        : %d, resumed after %.2f minutes on average\n", result.Preemptions, result.AveragePreemptionDelay)
+	}
+	for _, c := range result.Classes {
+		fmt.Printf("%-19s: %d customers, %.2f minutes wait (p90 %d), %.2f in service, %.2f in the system\n",
+			"Class "+c.Name, c.Customers, c.AverageWaitTime, c.P90WaitTime, c.AverageServiceTime, c.AverageSojournTime)
+	}
+	if st := result.SLA; st != nil {
+		for i, x := range st.Thresholds {
+			fmt.Printf("%-19s: %.2f%% of customers served\n", fmt.Sprintf("Within %g Minutes", x), st.ServedWithin[i]*100)
+		}
+		fmt.Printf("Longest Wait       : %g minutes\n", st.LongestWait)
+		fmt.Printf("Queue Over %-8d: %.2f%% of the time\n", st.QueueLength, st.QueueOver*100)
+	}
+	if *store != "" {
+		sc := Scenario{Start: formatTime(startTime), End: formatTime(endTime), Servers: *nServers, CustomerRate: customerRate, ServerRate: serverRate,
+			Seed: seed, Policy: *policyName, Queues: *queues, Cutoff: *cutoff, Service: *service}
+		if *queues == "separate" && *jockey {
+			sc.Queues = "jockey"
+		}
+		st, err := openStore(*store)
+		exitOnError(err)
+		e, err := st.Add(newExperiment("once", args, sc, result))
+		st.Close()
+		exitOnError(err)
+		fmt.Printf("Stored Experiment  : %d in %s\n", e.ID, *store)
+	}
+	if trace != nil {
+		fmt.Printf("Parquet Trace      : %d customers in %s\n", trace.Len(), *parquet)
+	}
+	if *pn > 0 {
+		fmt.Println()
+		writePnTable(os.Stdout, result.Pn, nil, *pn)
+	}
+}
+
+func simulatePolicies(seed int64) {
+	startTime := 0
+	endTime := 1000 * 60 // long enough for the policies to separate
+	customerRate := 5.8  // 5.8 customers per hour
+	serverRate := 6.0    // 6 customers per hour on average
+	serverRates := []float64{8.0, 4.0}
+	nServers := len(serverRates)
+
+	policies := []ServerSelectionPolicy{EarliestAvailable, LeastBusy, RandomServer, RoundRobin, FastestServer, ServerAffinity}
+
+	fmt.Println("policy,total_customers,average_wait_time,average_service_time")
+	for _, p := range policies {
+		// The same seed gives every policy the same arrival stream
+		opts := []Option{WithServerSelection(p), WithServerRates(serverRates...)}
+		if p == ServerAffinity {
+			opts = append(opts, WithServerAffinity(nServers-1))
+		}
+		s := NewSimulation(startTime, endTime, nServers, customerRate, serverRate, seed, opts...)
+		result := s.Simulate(false)
+		fmt.Printf("%s,%d,%.4f,%.4f\n", p, result.TotalCustomers, result.AverageWaitTime, result.AverageServiceTime)
+	}
+}
+
+var gridTimes = []int{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000, 20000, 50000, 100000, 200000, 500000, 1000000}
+
+// runGrid simulates every combination of times (in hours) and nServers and
+// returns one averaged result per combination, in row-major order, with the
+// precision of its average wait time. Every combination simulates about
+// hours hours in total, split into replications. opts apply to every
+// simulation. It stops early once ctx is done and reports the progress of
+// the whole grid to progress, if not nil, every interval.
+func runGrid(ctx context.Context, seed int64, times, nServers []int, hours int, customerRate, serverRate float64, vr VarianceReduction, interval time.Duration, progress func(Progress), opts ...Option) ([]SimulationResult, []waitEstimate, error) {
+	rng := rand.New(rand.NewSource(seed))
+
+	// Seeds are drawn up front in a fixed order so that running the
+	// replications in parallel does not change the results.
+	var sims []*Simulation
+	var reps []int
+	for _, t := range times {
+		for _, ns := range nServers {
+			// We run the simulation several times for better convergence
+			n := hours / t
+			if vr.Antithetic {
+				n /= 2
+			}
+			if n == 0 {
+				n = 1
+			}
+			opts := opts
+			if n == 1 && vr.Batches > 0 {
+				opts = append(opts[:len(opts):len(opts)], WithBatchMeans(vr.Batches))
+			}
+			for i := 0; i < n; i++ {
+				seed := rng.Int63()
+				sims = append(sims, NewSimulation(0, t*60, ns, customerRate, serverRate, seed, opts...))
+				if vr.Antithetic {
+					sims = append(sims, NewSimulation(0, t*60, ns, customerRate, serverRate, seed, append(opts[:len(opts):len(opts)], WithAntithetic())...))
+				}
+			}
+			reps = append(reps, n)
+		}
+	}
+	runs, err := simulateAllContext(ctx, sims, interval, progress)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	perRep := 1
+	if vr.Antithetic {
+		perRep = 2
+	}
+	results := make([]SimulationResult, 0, len(reps))
+	estimates := make([]waitEstimate, 0, len(reps))
+	for _, t := range times {
+		for _, ns := range nServers {
+			n := reps[len(results)] * perRep
+			result := SimulationResult{}
+			for _, r := range runs[:n] {
+				if r.TotalCustomers > 0 {
+					result.TotalCustomers += r.TotalCustomers
+					result.AverageWaitTime += r.AverageWaitTime
+					result.AverageServiceTime += r.AverageServiceTime
+				}
+			}
+
+			// A replication is a run, or the average of an antithetic
+			// pair, with the number of customers and the average service
+			// time as controls.
+			meanService := roundedExponentialMean(serverRate / 60)
+			var waits []float64
+			controls := make([][]float64, 2)
+			for i := 0; i < n; i += perRep {
+				var wait, customers, service float64
+				for _, r := range runs[i : i+perRep] {
+					customers += float64(r.TotalCustomers) / float64(perRep)
+					if r.TotalCustomers > 0 {
+						wait += r.AverageWaitTime / float64(perRep)
+						service += r.AverageServiceTime / float64(perRep)
+					} else {
+						service += meanService / float64(perRep)
+					}
+				}
+				waits = append(waits, wait)
+				controls[0] = append(controls[0], customers)
+				controls[1] = append(controls[1], service)
+			}
+			_, variance := meanVariance(waits)
+			stdErr := math.Sqrt(variance / float64(len(waits)))
+			if len(waits) < 2 {
+				stdErr = math.NaN()
+			}
+			df := len(waits) - 1
+
+			// A single run, or antithetic pair, is split into batches
+			// instead, whose means are nearly independent if the batches
+			// are long enough.
+			lag1 := math.NaN()
+			if n == perRep {
+				if means := pairedBatchMeans(runs[:n]); len(means) > 1 {
+					_, variance := meanVariance(means)
+					stdErr, df = math.Sqrt(variance/float64(len(means))), len(means)-1
+					lag1 = autocorrelation(means, 1)
+				}
+			}
+
+			runs = runs[n:]
+			result.TotalTime = t * 60
+			result.TotalServers = ns
+			result.TotalCustomers /= n
+			result.AverageWaitTime /= float64(n)
+			result.AverageServiceTime /= float64(n)
+			if vr.Control && len(waits) > len(controls)+1 {
+				arrivals := sims[0].customerDist.Mean() * float64(t*60)
+				result.AverageWaitTime, stdErr = controlVariates(waits, controls, []float64{arrivals, meanService})
+				df -= len(controls)
+			}
+			half := math.NaN()
+			if df > 0 {
+				half = tQuantile(0.975, df) * stdErr
+			}
+			results = append(results, result)
+			estimates = append(estimates, waitEstimate{StdErr: stdErr, Half: half, Lag1: lag1})
+		}
+	}
+	return results, estimates, nil
+}
+
+// pairedBatchMeans returns the batch means of a run, or of an antithetic
+// pair of runs the means of its batches in pairs. Should the pair have
+// served too different numbers of customers to be batched alike, the batch
+// means of both runs are pooled, which ignores their negative correlation
+// and so errs on the wide side.
+func pairedBatchMeans(runs []SimulationResult) []float64 {
+	if len(runs) != 2 {
+		return runs[0].BatchMeans
+	}
+	a, b := runs[0].BatchMeans, runs[1].BatchMeans
+	if len(a) != len(b) {
+		return append(a[:len(a):len(a)], b...)
+	}
+	means := make([]float64, len(a))
+	for i := range a {
+		means[i] = (a[i] + b[i]) / 2
+	}
+	return means
+}
+
+func simulateGrid(seed int64, args []string) {
+	customerRate := 5.8 // 5.8 customers per hour
+	serverRate := 6.0   // 6 customers per hour, or 10 minutes per customer
+
+	fs := flag.NewFlagSet("grid", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	hours := fs.Int("hours", 1000, "hours to simulate per grid cell, split into replications; longer cells are a single run")
+	maxHours := fs.Int("max-hours", gridTimes[len(gridTimes)-1], "leave out the cells longer than this many hours")
+	var vr VarianceReduction
+	fs.BoolVar(&vr.Antithetic, "antithetic", false, "run replications in antithetic pairs")
+	fs.BoolVar(&vr.Control, "control", false, "correct with the number of customers and service time as control variates")
+	fs.IntVar(&vr.Batches, "batches", 20, "batches for the confidence interval of cells simulated in a single run")
+	logLevel := fs.String("log-level", "quiet", "log level: quiet, summary for a line per run, customer or debug")
+	logFile := fs.String("log-file", "", "write the log to `file` instead of standard output")
+	interval := fs.Duration("progress", 5*time.Second, "report progress to standard error this often, 0 for never")
+	stdErr := fs.Bool("stderr", false, "add the standard error and 95% confidence interval of the average wait time and the M/M/c wait time; implied by -antithetic and -control")
+	plot := fs.String("plot", "", "also write a gnuplot script to `file` that plots the wait against the hours, next to the M/M/c wait")
+	fs.Parse(args)
+
+	if *hours < 1 || *maxHours < 1 {
+		exitOnError(fmt.Errorf("need -hours and -max-hours >= 1"))
+	}
+	logger, closeLog, err := newLogger(*logLevel, *logFile)
+	exitOnError(err)
+	defer closeLog()
+	extra := *stdErr || vr.Antithetic || vr.Control
+
+	header := "total_time,total_servers,total_customers,customer_rate,server_rate,actual_customer_rate,actual_server_rate,average_wait_time"
+	if extra {
+		header += ",std_error,ci_low,ci_high,lag1_autocorrelation,mmc_wait_time"
+	}
+	fmt.Println(header)
+
+	// stop cleanly on ^C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	var progress func(Progress)
+	if *interval > 0 {
+		progress = func(p Progress) {
+			fmt.Fprintf(os.Stderr, "%5.1f%% simulated, %d customers, %s elapsed, %s to go\n", p.Done*100, p.Customers, p.Elapsed.Round(time.Second), p.ETA.Round(time.Second))
+		}
+	}
+	var times []int
+	for _, t := range gridTimes {
+		if t <= *maxHours {
+			times = append(times, t)
+		}
+	}
+	results, estimates, err := runGrid(ctx, seed, times, []int{1, 2}, *hours, customerRate, serverRate, vr, *interval, progress, WithLogger(logger))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "grid:", err)
+		os.Exit(1)
+	}
+	for i, result := range results {
+		fmt.Printf("%d,%d,%d,%.4f,%.4f,%.4f,%.4f,%.4f", result.TotalTime/60, result.TotalServers, result.TotalCustomers, customerRate, serverRate, float64(result.TotalCustomers)/(float64(result.TotalTime)/60), float64(60)/result.AverageServiceTime, result.AverageWaitTime)
+		if extra {
+			e := estimates[i]
+			lag1 := ""
+			if !math.IsNaN(e.Lag1) {
+				lag1 = fmt.Sprintf("%.4f", e.Lag1)
+			}
+			fmt.Printf(",%.4f,%.4f,%.4f,%s,%.4f", e.StdErr, result.AverageWaitTime-e.Half, result.AverageWaitTime+e.Half, lag1, 60*MMcWait(result.TotalServers, customerRate, serverRate))
+		}
+		fmt.Println()
+	}
+	// Correlated batch means make the interval too narrow.
+	for i, e := range estimates {
+		if extra && e.Lag1 > 2/math.Sqrt(float64(vr.Batches)) {
+			fmt.Fprintf(os.Stderr, "warning: the batch means of %d hours with %d servers are autocorrelated (lag 1: %.2f), try fewer -batches\n", results[i].TotalTime/60, results[i].TotalServers, e.Lag1)
+		}
+	}
+	if *plot != "" {
+		exitOnError(writeFile(*plot, func(w io.Writer) error {
+			return writeGridPlot(w, results, estimates, extra, customerRate, serverRate, plotImage(*plot))
+		}))
+	}
+}
+
+const usage = `usage: queue [command]
+
+commands:
+  grid        average wait time over a grid of simulation lengths (default)
+  once        a single business day with per-customer output
+  step        a day event by event, to inspect and change as it runs
+  lobby       the line and the servers at given times, over replications
+  policies    compare server selection policies on the same arrivals
+  cutoff      customers denied and overtime for several last ticket times
+  batch       customers arriving in groups and served in batches
+  breakdowns  wait times with and without random server failures
+  days        several days with a daily arrival profile and busier weekdays
+  steady      one long run until the mean wait is known precisely enough
+  closed      throughput and response time of a closed system by population
+  overload    backlog growth and recovery when arrivals outpace the servers
+  rho         long-run wait as the traffic intensity approaches 1
+  network     customers flowing through a network of stations with routing
+  mix         staffing and wait impact of a shift in the transaction mix
+  facility    dedicated and cross-trained servers for several service types
+  booked      a clinic's booking calendar against the number of doctors
+  compare     paired differences between scenarios on common random numbers
+  sweep       replications of every combination of scenario parameters
+  staff       fewest servers that meet a service level target
+  cost        server and waiting costs over the number of servers
+  serve       HTTP API: POST a scenario as JSON to /simulate for the result
+  results     list and show the experiments stored by once -store and serve -store
+  replay      run again the command or scenario of a manifest and compare the results
+  fit         estimate arrival and service rates from a log and simulate them
+  example     worked studies: bank, clinic, callcenter and web
+  audit       check that results do not depend on GOMAXPROCS
+  validate    statistical tests of the samplers and of M/M/c queues
+  bench       customers simulated per second and allocations per customer
+`
+
+// exitOnError reports a bad command line and exits.
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
+
+// checkServers exits on a command line that asks for fewer than one
+// server in the flag of the given name.
+func checkServers(name string, n int) {
+	if n < 1 {
+		exitOnError(fmt.Errorf("need -%s >= 1, got %d", name, n))
+	}
+}
+
+// Main runs the command named by the first argument, grid by default, as
+// the queue_simulation program.
+func Main() {
+	seed := int64(2021)
+
+	cmd := "grid"
+	if len(os.Args) > 1 {
+		cmd = os.Args[1]
+	}
+	runCommand(cmd, seed, os.Args[min(2, len(os.Args)):])
+}
+
+// runCommand runs command cmd with the default seed and arguments and then,
+// if its output is a result, writes its manifest to standard error.
+func runCommand(cmd string, seed int64, args []string) {
+	switch cmd {
+	case "serve", "results", "replay", "step":
+	default:
+		if isCommand(cmd) {
+			m := newManifest(cmd, args, commandSeed(args, seed))
+			defer func() {
+				m.Inputs = readInputs()
+				printManifest(os.Stderr, m)
+			}()
+		}
+	}
+	switch cmd {
+	case "grid":
+		simulateGrid(seed, args)
+	case "once":
+		simulateOnce(seed, args)
+	case "lobby":
+		simulateStates(seed, args)
+	case "policies":
+		simulatePolicies(seed)
+	case "cutoff":
+		simulateCutoffs(seed, args)
+	case "batch":
+		simulateBatches(seed, args)
+	case "breakdowns":
+		simulateBreakdowns(seed, args)
+	case "days":
+		simulateDays(seed, args)
+	case "steady":
+		simulateSteady(seed, args)
+	case "closed":
+		simulateClosed(seed, args)
+	case "overload":
+		simulateOverload(seed, args)
+	case "rho":
+		simulateIntensities(seed, args)
+	case "mix":
+		simulateMix(seed, args)
+	case "facility":
+		simulateFacility(seed, args)
+	case "booked":
+		simulateAppointments(seed, args)
+	case "compare":
+		compareScenarios(seed, args)
+	case "sweep":
+		simulateSweep(seed, args)
+	case "staff":
+		simulateStaffing(seed, args)
+	case "cost":
+		simulateCosts(seed, args)
+	case "serve":
+		serve(seed, args)
+	case "fit":
+		fitLog(seed, args)
+	case "results":
+		showResults(args)
+	case "replay":
+		replay(args)
+	case "network":
+		simulateNetwork(seed, args)
+	case "step":
+		simulateSteps(seed, args)
+	case "example":
+		if err := runExamples(seed, args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "audit":
+		if err := auditDeterminism(seed, args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "validate":
+		if err := validate(seed, args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "bench":
+		runBenchmarks(seed, args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
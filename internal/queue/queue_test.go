@@ -0,0 +1,49 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestSimulateContextCancelsOvertime(t *testing.T) {
+	// an hour of arrivals takes thousands of hours to serve after closing
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	departures := 0
+	service, err := parseDistributionFlag("const,30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSimulation(480, 540, 1, 6000, 2, 1, WithServiceDistribution(service), WithHooks(Hooks{
+		OnDeparture: func(CustomerEvent) {
+			if departures++; departures == 3 {
+				cancel()
+			}
+		},
+	}))
+	if _, err := s.SimulateContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+	if departures > 3+cancelCheck {
+		t.Errorf("%d departures after cancelling at the 3rd", departures)
+	}
+}
+
+func TestRunGridIntervals(t *testing.T) {
+	// with -hours 100, the cells of 20 hours have several replications,
+	// of 50 hours one antithetic pair and of 200 hours a single run
+	for _, vr := range []VarianceReduction{{Batches: 20}, {Antithetic: true, Batches: 20}, {Antithetic: true, Control: true, Batches: 20}} {
+		results, estimates, err := runGrid(context.Background(), 1, []int{20, 50, 200}, []int{1, 2}, 100, 5.8, 6, vr, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, e := range estimates {
+			r := results[i]
+			if math.IsNaN(e.StdErr) || math.IsNaN(e.Half) || !(e.Half > 0) {
+				t.Errorf("%+v: %d hours with %d servers: standard error %g, half width %g", vr, r.TotalTime/60, r.TotalServers, e.StdErr, e.Half)
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package queue
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TrafficIntensity returns ρ = λ/(cμ), the rate at which customers arrive
+// over the rate at which the servers together can serve them, at the
+// common customerRate with every server on duty and, with batch service,
+// every batch full. A queue settles down to a steady state only if ρ is
+// below 1: at 1 or more the line grows without bound the longer it runs,
+// unless customers give up. Near 1 the wait grows as 1/(1-ρ). It is 0 for
+// a closed system, whose population bounds the line.
+func (s *Simulation) TrafficIntensity() float64 {
+	if s.population > 0 {
+		return 0
+	}
+	rate := s.customerRate
+	if s.groupMean > 0 {
+		rate *= s.groupMean
+	}
+	return rate / (s.capacity() * float64(s.maxBatch))
+}
+
+// unstable reports whether the line of s grows for as long as customers
+// arrive.
+func (s *Simulation) unstable() bool {
+	return s.TrafficIntensity() >= 1 && s.patience == nil
+}
+
+// warnUnstable warns on standard error, after name, if the line of s grows
+// for as long as customers arrive.
+func warnUnstable(name string, s *Simulation) {
+	if s.unstable() {
+		fmt.Fprintf(os.Stderr, "warning: %s: traffic intensity %.2f >= 1, the servers cannot keep up and the line grows for as long as customers arrive\n", name, s.TrafficIntensity())
+	}
+}
+
+// parseIntensities parses a comma-separated list of traffic intensities,
+// each a number or a range FROM:TO:STEP.
+func parseIntensities(list string) ([]float64, error) {
+	var rhos []float64
+	for _, v := range strings.Split(list, ",") {
+		vs := []string{v}
+		if strings.Contains(v, ":") {
+			var err error
+			if vs, err = expandRange(v); err != nil {
+				return nil, err
+			}
+		}
+		for _, v := range vs {
+			rho, err := strconv.ParseFloat(v, 64)
+			if err != nil || rho <= 0 {
+				return nil, fmt.Errorf("invalid traffic intensity %q", v)
+			}
+			rhos = append(rhos, rho)
+		}
+	}
+	return rhos, nil
+}
+
+func simulateIntensities(seed int64, args []string) {
+	serverRate := 6.0 // 6 customers per hour, or 10 minutes per customer
+
+	fs := flag.NewFlagSet("rho", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	nServers := fs.Int("servers", 2, "number of servers")
+	list := fs.String("rho", "0.1:0.9:0.1,0.95,0.99", "traffic intensities, comma-separated numbers or ranges FROM:TO:STEP")
+	hours := fs.Int("hours", 20000, "simulated hours of every run")
+	batches := fs.Int("batches", 20, "least number of batch means for the confidence interval")
+	service := fs.String("service", "", "service time `distribution` as NAME,PARAMS..., e.g. const,10, instead of exponential at 6 customers/hour")
+	fs.Parse(args)
+	checkServers("servers", *nServers)
+
+	rhos, err := parseIntensities(*list)
+	exitOnError(err)
+	var opts []Option
+	var dist ServiceDistribution
+	mean := 60 / serverRate
+	if *service != "" {
+		dist, err = parseDistributionFlag(*service)
+		exitOnError(err)
+		opts = append(opts, WithServiceDistribution(dist))
+		mean = dist.Mean()
+	}
+	opts = append(opts, WithBatchMeans(*batches))
+
+	// The arrival rate that makes the traffic intensity rho, on the same
+	// seed for every rho.
+	var sims []*Simulation
+	for _, rho := range rhos {
+		rate := rho * float64(*nServers) * 60 / mean
+		s := NewSimulation(0, *hours*60, *nServers, rate, serverRate, seed, opts...)
+		warnUnstable(fmt.Sprintf("rho %g", rho), s)
+		sims = append(sims, s)
+	}
+	results := simulateAll(sims)
+
+	formula := "mmc_wait_time"
+	if dist != nil {
+		formula = "mgc_wait_time"
+	}
+	fmt.Printf("Total Servers      : %d\n", *nServers)
+	fmt.Printf("Service Time       : %.2f minutes on average\n", mean)
+	fmt.Printf("Simulation Time    : %d hours per traffic intensity\n", *hours)
+	fmt.Println()
+	fmt.Println("rho,arrival_rate,customers,average_wait_time,ci_low,ci_high,lag1_autocorrelation," + formula + ",growth,wait_times_1_minus_rho")
+	var previous float64
+	for i, r := range results {
+		rho := rhos[i]
+		w, half, lag1 := BatchMeansInterval(r.BatchMeans, 0.95)
+		expected := ""
+		if dist == nil {
+			expected = fmt.Sprintf("%.4f", 60*MMcWait(*nServers, sims[i].customerRate, serverRate))
+		} else if d, ok := dist.(interface{ SCV() float64 }); ok {
+			mgc, _ := MGcWait(*nServers, sims[i].customerRate/60, mean, d.SCV())
+			expected = fmt.Sprintf("%.4f", mgc)
+		}
+		growth := ""
+		if previous > 0 {
+			growth = fmt.Sprintf("%.4f", w/previous)
+		}
+		previous = w
+		// bounded as rho approaches 1 if the wait grows as 1/(1-rho)
+		scaled := ""
+		if rho < 1 {
+			scaled = fmt.Sprintf("%.4f", w*(1-rho))
+		}
+		fmt.Printf("%.4f,%.4f,%d,%.4f,%.4f,%.4f,%.4f,%s,%s,%s\n", rho, sims[i].customerRate, r.TotalCustomers, w, w-half, w+half, lag1, expected, growth, scaled)
+	}
+	// Near rho = 1 the wait takes long to settle and the batch means are
+	// correlated, making the interval too narrow.
+	for i, r := range results {
+		if _, _, lag1 := BatchMeansInterval(r.BatchMeans, 0.95); lag1 > 2/math.Sqrt(float64(len(r.BatchMeans))) {
+			fmt.Fprintf(os.Stderr, "warning: the batch means at rho %g are autocorrelated (lag 1: %.2f), try more -hours or fewer -batches\n", rhos[i], lag1)
+		}
+	}
+}
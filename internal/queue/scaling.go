@@ -0,0 +1,265 @@
+package queue
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Autoscaling adds servers during the run as the line grows and sends them
+// away again once they are idle, as a cloud service scales out or a manager
+// calls in extra staff. Of the servers of the simulation, the first Min are
+// on duty from the start and the others on standby.
+type Autoscaling struct {
+	Min int
+	// ScaleUp calls in a standby server for every ScaleUp customers
+	// waiting, counting the servers on their way, which come on duty Delay
+	// minutes after the call. With processor sharing, where nobody
+	// waits, the customers beyond one per server on duty count as waiting.
+	// Without ScaleUp only the Schedule scales.
+	ScaleUp int
+	Delay   float64
+	// Idle is how long, in minutes, a server stays idle before it goes
+	// back on standby, as long as Min, or the servers of the Schedule,
+	// stay on duty.
+	Idle float64
+	// Schedule raises or lowers the least number of servers on duty at
+	// given times, as scheduled scaling. Servers come on duty at once.
+	Schedule []ScaleStep
+}
+
+// ScaleStep keeps at least Servers on duty from time At, in minutes since
+// midnight, until the next step.
+type ScaleStep struct {
+	At, Servers int
+}
+
+// WithAutoscaling scales the servers on duty by the rules of a. Shifts and
+// breaks still take servers off duty, on standby or not.
+func WithAutoscaling(a Autoscaling) Option {
+	return func(s *Simulation) {
+		// every simulation gets its own schedule, in ticks once scaled
+		a := a
+		a.Schedule = slices.Clone(a.Schedule)
+		slices.SortStableFunc(a.Schedule, func(x, y ScaleStep) int { return x.At - y.At })
+		s.scaling = &a
+	}
+}
+
+// ScalingStats reports what Autoscaling did during a run.
+type ScalingStats struct {
+	Events []ScalingEvent
+	// ServerHours is the time servers were on duty, or on their way after
+	// being called in, until the last customer left, as a cloud provider
+	// bills them.
+	ServerHours float64
+	// PeakServers is the most servers on duty, or on their way, at once.
+	PeakServers int
+}
+
+// ScalingEvent is a server called in, coming on duty or going back on
+// standby. Action is "call", "start" or "stop", and Reason "line",
+// "schedule" or "idle".
+type ScalingEvent struct {
+	// Time is in minutes since midnight.
+	Time   int
+	Server int
+	Action string
+	Reason string
+}
+
+// floor returns the least number of servers to keep on duty at time t.
+func (a *Autoscaling) floor(t int) int {
+	n := a.Min
+	for _, step := range a.Schedule {
+		if step.At <= t {
+			n = step.Servers
+		}
+	}
+	return n
+}
+
+// scheduleScaling puts the servers beyond the first floor on standby and
+// queues the steps of the schedule.
+func (r *run) scheduleScaling() {
+	a := r.s.scaling
+	if a == nil {
+		return
+	}
+	r.scaling = &ScalingStats{}
+	n := a.floor(r.s.startTime)
+	for j := range r.servers {
+		sv := &r.servers[j]
+		sv.standby = j >= n
+		sv.dutySince = r.s.startTime
+	}
+	r.scaling.PeakServers = r.onDuty(true)
+	for _, step := range a.Schedule {
+		if step.At > r.s.startTime && step.At < r.s.endTime {
+			r.events.push(event{time: step.At, kind: scaleStepEvent})
+		}
+	}
+}
+
+// onDuty returns the number of servers not on standby, and with calling
+// those called in too.
+func (r *run) onDuty(calling bool) int {
+	n := 0
+	for _, sv := range r.servers {
+		if !sv.standby || calling && sv.calling {
+			n++
+		}
+	}
+	return n
+}
+
+// scaleUp calls in standby servers for the line at time t.
+func (r *run) scaleUp(t int) {
+	a := r.s.scaling
+	if a == nil || a.ScaleUp <= 0 {
+		return
+	}
+	for {
+		waiting := PolicyView{r, t}.Waiting()
+		if r.s.sharing {
+			waiting = r.inSystem - r.onDuty(false)
+		}
+		calling, j := 0, -1
+		for k, sv := range r.servers {
+			switch {
+			case sv.calling:
+				calling++
+			case sv.standby && j == -1:
+				j = k
+			}
+		}
+		if j == -1 || waiting < a.ScaleUp*(calling+1) {
+			return
+		}
+		sv := &r.servers[j]
+		sv.calling, sv.dutySince = true, t
+		r.scaled(t, j, "call", "line")
+		if delay := r.s.ticks(a.Delay); delay > 0 {
+			r.events.push(event{time: t + delay, kind: scaleUpEvent, server: j})
+		} else {
+			r.comeOnDuty(j, t, "line")
+		}
+	}
+}
+
+// comeOnDuty brings standby server j on duty at time t.
+func (r *run) comeOnDuty(j int, t int, reason string) {
+	sv := &r.servers[j]
+	if !sv.standby {
+		return
+	}
+	if !sv.calling {
+		sv.dutySince = t
+	}
+	sv.standby, sv.calling = false, false
+	r.scaled(t, j, "start", reason)
+	if r.idle(j) {
+		r.next(j, t)
+	}
+	r.scheduleIdle(j, t)
+}
+
+// scheduleIdle starts the idle time of server j at time t, if it is idle,
+// after which it may go back on standby.
+func (r *run) scheduleIdle(j int, t int) {
+	sv := &r.servers[j]
+	if r.s.scaling == nil || !r.idle(j) || len(sv.queue) > 0 {
+		return
+	}
+	sv.idleSince = t
+	r.events.push(event{time: t + r.s.ticks(r.s.scaling.Idle), kind: scaleDownEvent, server: j, version: t})
+}
+
+// standBy sends server j back on standby at time t if it is still idle
+// since idleSince and the floor allows.
+func (r *run) standBy(j int, t int, idleSince int, reason string) {
+	sv := &r.servers[j]
+	if sv.standby || !r.idle(j) || len(sv.queue) > 0 || sv.idleSince != idleSince || r.onDuty(false) <= r.s.scaling.floor(t) {
+		return
+	}
+	sv.standby = true
+	sv.dutyTime += t - sv.dutySince
+	r.scaled(t, j, "stop", reason)
+}
+
+// scaleStep applies the step of the schedule at time t: servers come on
+// duty up to the new floor, or those idle long enough go on standby.
+func (r *run) scaleStep(t int) {
+	a := r.s.scaling
+	n := a.floor(t)
+	for j := range r.servers {
+		if r.onDuty(false) >= n {
+			break
+		}
+		r.comeOnDuty(j, t, "schedule")
+	}
+	idle := r.s.ticks(a.Idle)
+	for j := range r.servers {
+		if sv := &r.servers[j]; r.idle(j) && t-sv.idleSince >= idle {
+			r.standBy(j, t, sv.idleSince, "schedule")
+		}
+	}
+}
+
+// scaled records a scaling event at time t.
+func (r *run) scaled(t int, j int, action, reason string) {
+	st := r.scaling
+	st.Events = append(st.Events, ScalingEvent{Time: t/r.s.tick - r.s.day*24*60, Server: j, Action: action, Reason: reason})
+	st.PeakServers = max(st.PeakServers, r.onDuty(true))
+	if r.logs(LevelDebug) {
+		r.logAttrs(LevelDebug, "server scaled", slog.Int("server", j), r.at(t), slog.String("action", action), slog.String("reason", reason))
+	}
+}
+
+// scalingStats returns the scaling statistics, with the servers on duty
+// billed up to end.
+func (r *run) scalingStats(end int) *ScalingStats {
+	if r.scaling == nil {
+		return nil
+	}
+	st := *r.scaling
+	total := 0
+	for j := range r.servers {
+		total += r.dutyTime(j, end)
+	}
+	st.ServerHours = float64(total) / float64(r.s.tick) / 60
+	return &st
+}
+
+// dutyTime returns the ticks server j was on duty, or on its way, up to
+// end.
+func (r *run) dutyTime(j int, end int) int {
+	sv := &r.servers[j]
+	if !sv.standby || sv.calling {
+		return sv.dutyTime + max(end-sv.dutySince, 0)
+	}
+	return sv.dutyTime
+}
+
+// parseScaleSteps parses comma-separated steps HH:MM=SERVERS.
+func parseScaleSteps(list string) ([]ScaleStep, error) {
+	var steps []ScaleStep
+	for _, v := range strings.Split(list, ",") {
+		at, n, ok := strings.Cut(v, "=")
+		if !ok {
+			return nil, fmt.Errorf("want HH:MM=SERVERS, got %q", v)
+		}
+		t, err := parseTime(at)
+		if err != nil {
+			return nil, err
+		}
+		servers, err := strconv.Atoi(n)
+		if err != nil || servers < 0 {
+			return nil, fmt.Errorf("invalid number of servers %q", n)
+		}
+		steps = append(steps, ScaleStep{At: t, Servers: servers})
+	}
+	return steps, nil
+}
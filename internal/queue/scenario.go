@@ -0,0 +1,266 @@
+package queue
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Scenario describes a simulation in plain values, as posted to the serve
+// command in JSON. Times are HH:MM, rates are per hour, and distributions
+// are NAME,PARAMS... as for the -service flag of once.
+type Scenario struct {
+	Start        string    `json:"start"`
+	End          string    `json:"end"`
+	Servers      int       `json:"servers"`
+	CustomerRate float64   `json:"customer_rate"`
+	ServerRate   float64   `json:"server_rate"`
+	ServerRates  []float64 `json:"server_rates,omitempty"`
+	Seed         int64     `json:"seed"`
+
+	// Policy is a server selection policy, see ParseServerSelectionPolicy.
+	Policy string `json:"policy,omitempty"`
+	// Queues is shared, separate, or jockey for separate queues with
+	// jockeying.
+	Queues string `json:"queues,omitempty"`
+	// Cutoff is the last ticket time.
+	Cutoff   string `json:"cutoff,omitempty"`
+	Service  string `json:"service,omitempty"`
+	Patience string `json:"patience,omitempty"`
+	// Discipline is fcfs, ps for processor sharing or rr for round robin
+	// with time slices of Quantum minutes.
+	Discipline string  `json:"discipline,omitempty"`
+	Quantum    float64 `json:"quantum,omitempty"`
+	// Admission and Routing are built-in policies, see
+	// ParseAdmissionPolicy and ParseRoutingPolicy.
+	Admission string `json:"admission,omitempty"`
+	Routing   string `json:"routing,omitempty"`
+	// Catalog is a catalog file, and Covariates a file of covariates, see
+	// ReadCovariates, which only the command line may give.
+	Catalog    string `json:"-"`
+	Covariates string `json:"-"`
+}
+
+// DefaultScenario returns the business day of the once command.
+func DefaultScenario() Scenario {
+	return Scenario{
+		Start:        "08:00",
+		End:          "16:00",
+		Servers:      2,
+		CustomerRate: 5.8,
+		ServerRate:   6.0,
+		Seed:         2021,
+	}
+}
+
+// parseDistributionFlag parses a distribution as NAME,PARAMS..., e.g.
+// lognormal,10,5.
+func parseDistributionFlag(s string) (ServiceDistribution, error) {
+	name, params, _ := strings.Cut(s, ",")
+	var ps []string
+	if params != "" {
+		ps = strings.Split(params, ",")
+	}
+	return ParseDistribution(name, ps)
+}
+
+// readsFile reports whether the distribution NAME,PARAMS... is read from a
+// file, as empirical and phase are.
+func readsFile(spec string) bool {
+	name, _, _ := strings.Cut(spec, ",")
+	name = strings.TrimSpace(name)
+	return name == "empirical" || name == "phase"
+}
+
+// Simulation returns the simulation the scenario describes, with the
+// options extra on top, such as policies of one's own to compare on the
+// same scenario.
+func (sc Scenario) Simulation(extra ...Option) (*Simulation, error) {
+	start, err := parseTime(sc.Start)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseTime(sc.End)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case end <= start:
+		return nil, fmt.Errorf("end %s is not after start %s", sc.End, sc.Start)
+	case sc.Servers < 1:
+		return nil, fmt.Errorf("need at least one server")
+	case !(sc.CustomerRate >= 0) || !(sc.ServerRate > 0) || math.IsInf(sc.CustomerRate, 0) || math.IsInf(sc.ServerRate, 0):
+		return nil, fmt.Errorf("need a finite customer rate >= 0 and server rate > 0")
+	case len(sc.ServerRates) > sc.Servers:
+		return nil, fmt.Errorf("%d server rates for %d servers", len(sc.ServerRates), sc.Servers)
+	}
+
+	var opts []Option
+	if sc.Policy != "" {
+		p, err := ParseServerSelectionPolicy(sc.Policy)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithServerSelection(p))
+	}
+	switch sc.Queues {
+	case "", "shared":
+	case "separate", "jockey":
+		opts = append(opts, WithSeparateQueues(sc.Queues == "jockey"))
+	default:
+		return nil, fmt.Errorf("unknown queue layout %q", sc.Queues)
+	}
+	for _, r := range sc.ServerRates {
+		if !(r > 0) || math.IsInf(r, 0) {
+			return nil, fmt.Errorf("need finite server rates > 0")
+		}
+	}
+	if len(sc.ServerRates) > 0 {
+		opts = append(opts, WithServerRates(sc.ServerRates...))
+	}
+	if sc.Cutoff != "" {
+		t, err := parseTime(sc.Cutoff)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithCutoff(t))
+	}
+	if sc.Catalog != "" {
+		classes, err := LoadCatalog(sc.Catalog)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithCatalog(classes))
+	}
+	if sc.Covariates != "" {
+		covariates, err := LoadCovariates(sc.Covariates)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithCovariates(covariates...))
+	}
+	if sc.Service != "" {
+		dist, err := parseDistributionFlag(sc.Service)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithServiceDistribution(dist))
+	}
+	if sc.Patience != "" {
+		dist, err := parseDistributionFlag(sc.Patience)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithPatience(dist))
+	}
+	switch sc.Discipline {
+	case "", "fcfs":
+	case "ps":
+		opts = append(opts, WithProcessorSharing())
+	case "rr":
+		quantum := sc.Quantum
+		if quantum == 0 {
+			quantum = 1
+		}
+		if !(quantum > 0) || quantum > maxMinutes {
+			return nil, fmt.Errorf("need a quantum > 0 of at most %g minutes", maxMinutes)
+		}
+		opts = append(opts, WithRoundRobin(quantum))
+	default:
+		return nil, fmt.Errorf("unknown service discipline %q", sc.Discipline)
+	}
+	if sc.Admission != "" {
+		p, err := ParseAdmissionPolicy(sc.Admission)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithAdmission(p))
+	}
+	if sc.Routing != "" {
+		p, err := ParseRoutingPolicy(sc.Routing)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithRouting(p))
+	}
+	opts = append(opts, extra...)
+	return NewSimulation(start, end, sc.Servers, sc.CustomerRate, sc.ServerRate, sc.Seed, opts...), nil
+}
+
+// scenarioKeys are the keys of Scenario.set.
+const scenarioKeys = "start, end, servers, rate, service-rate, policy, queues (shared, separate or jockey), cutoff, catalog, covariates, service, patience, discipline (fcfs, ps or rr), quantum, admission and routing"
+
+// set sets the field of the scenario named by key, one of scenarioKeys, to
+// value as given on the command line.
+func (sc *Scenario) set(key, value string) error {
+	var err error
+	switch key {
+	case "start":
+		sc.Start = value
+	case "end":
+		sc.End = value
+	case "servers":
+		sc.Servers, err = strconv.Atoi(value)
+	case "rate":
+		sc.CustomerRate, err = strconv.ParseFloat(value, 64)
+	case "service-rate":
+		sc.ServerRate, err = strconv.ParseFloat(value, 64)
+	case "policy":
+		sc.Policy = value
+	case "queues":
+		sc.Queues = value
+	case "cutoff":
+		sc.Cutoff = value
+	case "catalog":
+		sc.Catalog = value
+	case "covariates":
+		sc.Covariates = value
+	case "service":
+		sc.Service = value
+	case "patience":
+		sc.Patience = value
+	case "discipline":
+		sc.Discipline = value
+	case "quantum":
+		sc.Quantum, err = strconv.ParseFloat(value, 64)
+	case "admission":
+		sc.Admission = value
+	case "routing":
+		sc.Routing = value
+	default:
+		err = fmt.Errorf("unknown key %q", key)
+	}
+	return err
+}
+
+// parseScenario parses a scenario given on the command line as
+// comma-separated key=value pairs, e.g. "servers=3,policy=fastest", on top
+// of the default scenario. See scenarioKeys for the keys. A part without
+// "=" continues the value before it, so that distributions can be given
+// as in "service=lognormal,10,5,servers=3".
+func parseScenario(spec string) (Scenario, error) {
+	sc := DefaultScenario()
+	var pairs [][2]string
+	for _, kv := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(kv, "=")
+		switch {
+		case ok:
+			pairs = append(pairs, [2]string{key, value})
+		case len(pairs) > 0:
+			pairs[len(pairs)-1][1] += "," + kv
+		default:
+			return sc, fmt.Errorf("%q: want key=value, got %q", spec, kv)
+		}
+	}
+	for _, kv := range pairs {
+		if err := sc.set(kv[0], kv[1]); err != nil {
+			return sc, fmt.Errorf("%q: %v", spec, err)
+		}
+	}
+	// catch bad values now rather than in the middle of the replications
+	if _, err := sc.Simulation(); err != nil {
+		return sc, fmt.Errorf("%q: %v", spec, err)
+	}
+	return sc, nil
+}
@@ -0,0 +1,347 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CustomerEventKind is written in JSON as served or abandoned.
+func (k CustomerEventKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// simulateRequest is the body of POST /simulate: a scenario, and whether
+// to return every customer too.
+type simulateRequest struct {
+	Scenario
+	Trace bool `json:"trace"`
+}
+
+// simulateResponse is the answer to POST /simulate. A trace longer than
+// the server allows is cut short, with TraceTruncated set.
+type simulateResponse struct {
+	Manifest       Manifest         `json:"manifest"`
+	Result         SimulationResult `json:"result"`
+	Trace          []CustomerEvent  `json:"trace,omitempty"`
+	TraceTruncated bool             `json:"trace_truncated,omitempty"`
+}
+
+// simulationServer answers simulation requests over HTTP.
+type simulationServer struct {
+	seed         int64 // of scenarios without one
+	maxHours     int
+	maxServers   int
+	maxCustomers int // expected in a scenario
+	maxTrace     int // customer events in a response
+	timeout      time.Duration
+	store        *resultStore // of every simulation, if set
+	metrics      *serverMetrics
+	origins      []string // of pages allowed on /stream besides those of the server
+}
+
+func (srv *simulationServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	// method patterns need Go 1.22 semantics, which a build without a
+	// go.mod does not get, so methods are checked by hand
+	mux.HandleFunc("/", allow(http.MethodGet, srv.dashboard))
+	mux.HandleFunc("/simulate", allow(http.MethodPost, srv.simulate))
+	mux.HandleFunc("/stream", allow(http.MethodGet, srv.stream))
+	mux.Handle("/metrics", allow(http.MethodGet, srv.metrics.ServeHTTP))
+	mux.HandleFunc("/scenario", allow(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, srv.defaults())
+	}))
+	return mux
+}
+
+func (srv *simulationServer) defaults() Scenario {
+	sc := DefaultScenario()
+	sc.Seed = srv.seed
+	return sc
+}
+
+// simulation returns the simulation of a scenario from a client, within
+// the limits of the server. Clients may not have the server read files, so
+// neither the path nor the contents of one ends up in an error. Nor may
+// they ask for more customers than the server takes, or for services
+// longer on average than the whole run, whose overtime would go on for
+// ages.
+func (srv *simulationServer) simulation(sc Scenario) (*Simulation, error) {
+	if sc.Servers > srv.maxServers {
+		return nil, fmt.Errorf("%d servers are more than the limit of %d", sc.Servers, srv.maxServers)
+	}
+	for _, d := range []struct{ name, spec string }{{"service", sc.Service}, {"patience", sc.Patience}} {
+		if readsFile(d.spec) {
+			return nil, fmt.Errorf("%s: distributions read from files are only accepted on the command line", d.name)
+		}
+	}
+	sim, err := sc.Simulation()
+	if err != nil {
+		return nil, err
+	}
+	if hours := (sim.endTime - sim.startTime) / 60; hours > srv.maxHours {
+		return nil, fmt.Errorf("%d hours is longer than the limit of %d", hours, srv.maxHours)
+	}
+	minutes := float64(sim.endTime - sim.startTime)
+	if customers := sc.CustomerRate * minutes / 60; customers > float64(srv.maxCustomers) {
+		return nil, fmt.Errorf("%.0f customers expected, more than the limit of %d", customers, srv.maxCustomers)
+	}
+	means := []float64{60 / sc.ServerRate}
+	for _, r := range sc.ServerRates {
+		means = append(means, 60/r)
+	}
+	if sim.service != nil {
+		means = []float64{sim.service.Mean()}
+	}
+	for _, m := range means {
+		if m > minutes {
+			return nil, fmt.Errorf("service: a mean of %g minutes is longer than the %g minutes simulated", m, minutes)
+		}
+	}
+	return sim, nil
+}
+
+// simulate runs the scenario in the body, starting from the default
+// scenario for the fields left out.
+func (srv *simulationServer) simulate(w http.ResponseWriter, r *http.Request) {
+	req := simulateRequest{Scenario: srv.defaults()}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid scenario: %v", err))
+		return
+	}
+	sim, err := srv.simulation(req.Scenario)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), srv.timeout)
+	defer cancel()
+	var resp simulateResponse
+	run := srv.metrics.begin(sim.startTime, sim.nServers)
+	events, results := sim.Stream(ctx)
+	for e := range events {
+		srv.metrics.observe(run, e)
+		switch {
+		case !req.Trace:
+		case len(resp.Trace) < srv.maxTrace:
+			resp.Trace = append(resp.Trace, e)
+		default:
+			resp.TraceTruncated = true
+		}
+	}
+	srv.metrics.end(run)
+	result, ok := <-results
+	if !ok {
+		err = ctx.Err()
+	}
+	resp.Manifest, resp.Result = scenarioManifest(req.Scenario), result
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("the simulation took longer than %s", srv.timeout))
+	case err != nil:
+		// the client went away
+		return
+	default:
+		if srv.store != nil {
+			if _, err := srv.store.Add(newExperiment("serve", nil, req.Scenario, resp.Result)); err != nil {
+				log.Printf("storing the experiment: %v", err)
+			}
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// streamRequest is the first message on /stream: a scenario and the
+// playback speed, in simulated minutes per second, where 0 plays as fast as
+// the client reads. Later messages of just {"speed": ...} change the speed.
+type streamRequest struct {
+	Scenario
+	Speed float64 `json:"speed"`
+}
+
+// streamMessage is a message sent on /stream: an event, the result at the
+// end, or an error.
+type streamMessage struct {
+	Type     string            `json:"type"`
+	Event    *CustomerEvent    `json:"event,omitempty"`
+	Manifest *Manifest         `json:"manifest,omitempty"`
+	Result   *SimulationResult `json:"result,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// stream plays a simulation over a WebSocket, event by event, at the
+// requested speed.
+func (srv *simulationServer) stream(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgradeWebSocket(w, r, srv.origins)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+	send := func(m streamMessage) error {
+		b, _ := json.Marshal(m)
+		return ws.WriteText(b)
+	}
+
+	msg, err := ws.ReadMessage()
+	if err != nil {
+		return
+	}
+	req := streamRequest{Scenario: srv.defaults(), Speed: 60}
+	dec := json.NewDecoder(bytes.NewReader(msg))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		send(streamMessage{Type: "error", Error: fmt.Sprintf("invalid scenario: %v", err)})
+		return
+	}
+	sim, err := srv.simulation(req.Scenario)
+	if err != nil {
+		send(streamMessage{Type: "error", Error: err.Error()})
+		return
+	}
+
+	// The hijacked connection outlives the request context, so the run
+	// stops when the client closes the connection or stops reading.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := newPacer(req.Speed, sim.startTime)
+	go func() {
+		defer cancel()
+		for {
+			msg, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var change struct {
+				Speed float64 `json:"speed"`
+			}
+			if json.Unmarshal(msg, &change) == nil {
+				p.setSpeed(change.Speed)
+			}
+		}
+	}()
+
+	run := srv.metrics.begin(sim.startTime, sim.nServers)
+	defer srv.metrics.end(run)
+	events, results := sim.Stream(ctx)
+	for e := range events {
+		p.wait(ctx, e.Time)
+		srv.metrics.observe(run, e)
+		if send(streamMessage{Type: "event", Event: &e}) != nil {
+			cancel()
+		}
+	}
+	if result, ok := <-results; ok {
+		m := scenarioManifest(req.Scenario)
+		send(streamMessage{Type: "result", Manifest: &m, Result: &result})
+	}
+}
+
+// pacer holds a stream back to a speed in simulated minutes per second of
+// wall clock time.
+type pacer struct {
+	mu    sync.Mutex
+	speed float64
+	// the wall clock time at which the simulated time sim was due
+	wall time.Time
+	sim  int
+	last int // the latest simulated time played
+}
+
+func newPacer(speed float64, start int) *pacer {
+	return &pacer{speed: speed, wall: time.Now(), sim: start, last: start}
+}
+
+func (p *pacer) setSpeed(speed float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.speed, p.wall, p.sim = speed, time.Now(), p.last
+}
+
+// wait returns when simulated time t is due, or ctx is done.
+func (p *pacer) wait(ctx context.Context, t int) {
+	defer func() {
+		p.mu.Lock()
+		p.last = max(p.last, t)
+		p.mu.Unlock()
+	}()
+	for {
+		p.mu.Lock()
+		if p.speed <= 0 {
+			p.wall, p.sim = time.Now(), t
+			p.mu.Unlock()
+			return
+		}
+		due := p.wall.Add(time.Duration(float64(t-p.sim) / p.speed * float64(time.Second)))
+		p.mu.Unlock()
+		left := time.Until(due)
+		if left <= 0 {
+			return
+		}
+		// wake up now and then to follow changes of speed
+		select {
+		case <-time.After(min(left, 100*time.Millisecond)):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// allow restricts h to requests with the given method.
+func allow(method string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("use %s", method))
+			return
+		}
+		h(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func serve(seed int64, args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed of scenarios without one")
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	maxHours := fs.Int("max-hours", 10000, "longest simulation to accept, in hours")
+	maxServers := fs.Int("max-servers", 1000, "most servers to accept in a scenario")
+	maxCustomers := fs.Int("max-customers", 1000000, "most customers to accept in a scenario, by its arrival rate")
+	maxTrace := fs.Int("max-trace", 100000, "most customers to return in a trace, which is cut short beyond")
+	timeout := fs.Duration("timeout", time.Minute, "longest time to spend on a request")
+	store := fs.String("store", "", "add every simulation to the experiments in the SQLite `database`, see the results command")
+	origins := fs.String("allow-origin", "", "comma-separated `origins`, such as https://example.com, whose pages may use /stream besides the server's own")
+	fs.Parse(args)
+
+	srv := &simulationServer{seed: seed, maxHours: *maxHours, maxServers: *maxServers, maxCustomers: *maxCustomers, maxTrace: *maxTrace, timeout: *timeout, metrics: newServerMetrics()}
+	if *origins != "" {
+		srv.origins = strings.Split(*origins, ",")
+	}
+	if *store != "" {
+		st, err := openStore(*store)
+		exitOnError(err)
+		defer st.Close()
+		srv.store = st
+	}
+	log.Printf("serving simulations on http://%s/", *addr)
+	log.Fatal(http.ListenAndServe(*addr, srv.handler()))
+}
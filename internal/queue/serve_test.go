@@ -0,0 +1,101 @@
+package queue
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testServer() *simulationServer {
+	return &simulationServer{seed: 1, maxHours: 10000, maxServers: 1000, maxCustomers: 1000000, maxTrace: 100000, timeout: time.Minute, metrics: newServerMetrics()}
+}
+
+// response is a simulateResponse as decoded by a client, with the events of
+// the trace left as they are.
+type response struct {
+	simulateResponse
+	Trace []json.RawMessage `json:"trace"`
+	Error string            `json:"error"`
+}
+
+// post sends body to POST /simulate and decodes the response.
+func post(t *testing.T, srv *simulationServer, body string) (int, response) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	srv.handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/simulate", strings.NewReader(body)))
+	var resp response
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s: %v", body, err)
+	}
+	return w.Code, resp
+}
+
+func TestServeSimulate(t *testing.T) {
+	code, resp := post(t, testServer(), `{"servers": 3, "customer_rate": 12, "service": "lognormal,10,5"}`)
+	if code != http.StatusOK {
+		t.Fatalf("status %d: %s", code, resp.Error)
+	}
+	if resp.Result.TotalCustomers == 0 || resp.Manifest.Scenario == nil || resp.Manifest.Scenario.Servers != 3 {
+		t.Errorf("got %+v", resp)
+	}
+}
+
+func TestServeRejects(t *testing.T) {
+	for _, body := range []string{
+		`{"service": "const,1e11"}`,
+		`{"service": "exp,Inf"}`,
+		`{"service": "exp,NaN"}`,
+		`{"patience": "lognormal,NaN,1"}`,
+		`{"service": "uniform,0,1e300"}`,
+		`{"service": "empirical,/etc/passwd"}`,
+		`{"patience": "phase,/etc/passwd"}`,
+		`{"servers": 1001}`,
+		`{"servers": 0}`,
+		`{"end": "day 500 16:00"}`,
+		`{"customer_rate": 1e300}`,
+		`{"customer_rate": 1e400}`,
+		`{"server_rate": 1e-300}`,
+		`{"end": "09:00", "service": "const,100"}`,
+		`{"end": "09:00", "server_rate": 0.5}`,
+		`{"end": "09:00", "server_rates": [6, 0.5]}`,
+		`{"discipline": "rr", "quantum": 1e300}`,
+		`{"unknown": 1}`,
+	} {
+		code, resp := post(t, testServer(), body)
+		if code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want %d", body, code, http.StatusBadRequest)
+		}
+		if strings.Contains(resp.Error, "passwd") || strings.Contains(resp.Error, "root:") {
+			t.Errorf("%s: the error %q gives the file away", body, resp.Error)
+		}
+	}
+}
+
+func TestServeTraceCapped(t *testing.T) {
+	srv := testServer()
+	code, resp := post(t, srv, `{"trace": true}`)
+	if code != http.StatusOK || resp.TraceTruncated || len(resp.Trace) == 0 {
+		t.Fatalf("status %d, %d events, truncated %v: %s", code, len(resp.Trace), resp.TraceTruncated, resp.Error)
+	}
+	srv.maxTrace = 10
+	code, resp = post(t, srv, `{"trace": true}`)
+	if code != http.StatusOK || !resp.TraceTruncated || len(resp.Trace) != 10 {
+		t.Errorf("status %d, %d events, truncated %v: %s", code, len(resp.Trace), resp.TraceTruncated, resp.Error)
+	}
+}
+
+func TestServeTimeout(t *testing.T) {
+	srv := testServer()
+	srv.timeout = 20 * time.Millisecond
+	began := time.Now()
+	code, resp := post(t, srv, `{"end": "day 400 16:00", "customer_rate": 100, "servers": 20}`)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("status %d, want %d: %s", code, http.StatusServiceUnavailable, resp.Error)
+	}
+	if d := time.Since(began); d > 2*time.Second {
+		t.Errorf("took %s after a timeout of %s", d, srv.timeout)
+	}
+}
@@ -0,0 +1,49 @@
+package queue
+
+import "log/slog"
+
+// Setup describes the time a server needs before it can serve, in minutes:
+// Warmup when it starts after being idle, such as an oven heating up at
+// every start, and Changeover when it switches to a customer of another
+// class of the catalog, such as retooling or a context switch. A server
+// that was idle and switches class needs both. Either may be nil; use
+// Uniform{5, 5} for a fixed 5 minutes.
+//
+// Setup time counts as busy time, so it takes from the servers' capacity,
+// but not as service time. Customers wait in line until the setup is over.
+type Setup struct {
+	Warmup, Changeover ServiceDistribution
+}
+
+// WithSetup makes servers take setup time before serving.
+func WithSetup(setup Setup) Option {
+	return func(s *Simulation) {
+		s.setup = &setup
+	}
+}
+
+// setupTime draws the setup server j needs before it starts serving
+// customers of the given class at time t, in ticks.
+func (r *run) setupTime(j int, t int, class int) int {
+	if r.s.setup == nil {
+		return 0
+	}
+	sv := &r.servers[j]
+	rng := r.s.setupRng[j]
+	warmup, changeover := 0, 0
+	if w := r.s.setup.Warmup; w != nil && sv.freeAt < t {
+		warmup = r.s.ticks(w.Sample(rng))
+	}
+	if c := r.s.setup.Changeover; c != nil && sv.lastClass >= 0 && class != sv.lastClass {
+		changeover = r.s.ticks(c.Sample(rng))
+	}
+	sv.lastClass = class
+	if warmup+changeover > 0 {
+		sv.setups++
+		sv.setupTime += warmup + changeover
+		if r.logs(LevelDebug) {
+			r.logAttrs(LevelDebug, "server setup", slog.Int("server", j), r.at(t), r.durationAttr("warmup", warmup), r.durationAttr("changeover", changeover))
+		}
+	}
+	return warmup + changeover
+}
@@ -0,0 +1,167 @@
+package queue
+
+import (
+	"log/slog"
+	"math"
+)
+
+// WithProcessorSharing makes every server serve all its customers at once,
+// each at an equal share of its rate, like a CPU or a web server rather
+// than a teller: a customer who needs 10 minutes of service at a server
+// shared with another takes 20. No one waits in line while a server is
+// available; arrivals go to the server with the fewest customers. Batches,
+// separate queues, setup times, preemption and breakdowns do not apply.
+func WithProcessorSharing() Option {
+	return func(s *Simulation) {
+		s.sharing = true
+	}
+}
+
+// WithRoundRobin serves customers in time slices of the given quantum, in
+// minutes: a customer whose service is not done by the end of the slice
+// goes to the back of the line, with the work left, and the server takes
+// the next. As the quantum shrinks round robin approaches processor
+// sharing, and as it grows it turns into first come, first served.
+func WithRoundRobin(quantum float64) Option {
+	return func(s *Simulation) {
+		s.roundRobin = quantum
+	}
+}
+
+// sliceEnd ends the time slice of server j at time t, sending the customers
+// whose service is not done back to the line. It reports whether any went.
+func (r *run) sliceEnd(j int, t int) bool {
+	sv := &r.servers[j]
+	var done, again []*Customer
+	for _, c := range sv.batch {
+		if c.work -= sv.slice; c.work > 0 {
+			again = append(again, c)
+		} else {
+			done = append(done, c)
+		}
+	}
+	if len(again) == 0 {
+		return false
+	}
+	for _, c := range again {
+		c.Interruptions++
+		if r.logs(LevelDebug) {
+			r.logAttrs(LevelDebug, "time slice over", slog.Int("customer", c.Index), r.at(t), slog.Int("server", j), r.durationAttr("left", c.work))
+		}
+		if r.s.separateQueues {
+			sv.queue = r.s.enqueue(sv.queue, c)
+		} else {
+			r.queue = r.s.enqueue(r.queue, c)
+		}
+		r.event(CustomerInterrupted, t, c)
+	}
+	// the others leave as usual
+	sv.batch = append(sv.batch[:0], done...)
+	r.depart(j, t)
+	return true
+}
+
+// joinShared lets customer c in at time t at the available server with the
+// fewest customers, or in line if there is none.
+func (r *run) joinShared(t int, c *Customer) {
+	fewest := -1
+	r.candidates = r.candidates[:0]
+	for j := range r.servers {
+		if !r.available(j) {
+			continue
+		}
+		n := len(r.servers[j].batch)
+		if n < fewest || fewest == -1 {
+			fewest = n
+			r.candidates = r.candidates[:0]
+		}
+		if n == fewest {
+			r.candidates = append(r.candidates, j)
+		}
+	}
+	if len(r.candidates) == 0 {
+		r.queue = r.s.enqueue(r.queue, c)
+		return
+	}
+	r.share(r.route(t, c, r.candidates, false), t, c)
+}
+
+// share starts the service of customer c at server j at time t, alongside
+// the customers already there.
+func (r *run) share(j int, t int, c *Customer) {
+	sv := &r.servers[j]
+	r.updateShares(j, t)
+	if len(sv.batch) == 0 {
+		sv.batches++
+	}
+	c.service = r.serviceTime(j, c, t)
+	c.left = float64(c.service)
+	c.ServedTime = t
+	c.Server = j
+	r.served(j, c, t)
+	sv.batch = append(sv.batch, c)
+	r.event(CustomerStarted, t, c)
+	r.scheduleShares(j, t)
+}
+
+// updateShares takes the work done at server j since it was last brought up
+// to date off its customers' work left.
+func (r *run) updateShares(j int, t int) {
+	sv := &r.servers[j]
+	if n := len(sv.batch); n > 0 {
+		done := float64(t-sv.sharedAt) / float64(n)
+		for _, c := range sv.batch {
+			c.left -= done
+		}
+		r.busyTime[j] += t - sv.sharedAt
+	}
+	sv.sharedAt = t
+}
+
+// scheduleShares schedules the next departure from server j, whose
+// customers are up to date at time t, replacing the one scheduled before.
+// Departures fall on the first tick by which the work is done.
+func (r *run) scheduleShares(j int, t int) {
+	sv := &r.servers[j]
+	sv.version++
+	if len(sv.batch) == 0 {
+		return
+	}
+	least := math.Inf(1)
+	for _, c := range sv.batch {
+		least = min(least, c.left)
+	}
+	at := t + max(0, int(math.Ceil(least*float64(len(sv.batch))-1e-9)))
+	r.events.push(event{time: at, kind: departureEvent, server: j, version: sv.version})
+}
+
+// shareDepart lets the customers of server j whose work is done leave at
+// time t.
+func (r *run) shareDepart(j int, t int) {
+	sv := &r.servers[j]
+	r.updateShares(j, t)
+	staying := sv.batch[:0]
+	for _, c := range sv.batch {
+		if c.left > 1e-9 {
+			staying = append(staying, c)
+			continue
+		}
+		c.FinishTime = t
+		r.timeInSystem += c.SpentTime()
+		if r.classes != nil {
+			r.classes[c.Class].sojourn += c.SpentTime()
+		}
+		r.completed++
+		r.leave(t)
+		r.event(CustomerServed, t, c)
+		if r.logs(LevelCustomer) {
+			r.logServed(c, c.service)
+		}
+	}
+	clear(sv.batch[len(staying):])
+	sv.batch = staying
+	sv.freeAt = t
+	r.lastFinish = max(r.lastFinish, t)
+	r.scheduleShares(j, t)
+	r.scheduleIdle(j, t)
+}
@@ -0,0 +1,235 @@
+package queue
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Shift is a window of time, in minutes, from Start (inclusive) to End
+// (exclusive). It is used both for the hours a server works and for its
+// breaks.
+type Shift struct {
+	Start, End int
+}
+
+func (w Shift) String() string {
+	return formatTime(w.Start) + "-" + formatTime(w.End)
+}
+
+// WithShifts sets the windows in which server j is on duty. Servers without
+// shifts work from startTime to endTime. A server on duty at endTime stays
+// until everyone has been served.
+func WithShifts(j int, shifts ...Shift) Option {
+	return func(s *Simulation) {
+		if s.shifts == nil {
+			s.shifts = make(map[int][]Shift)
+		}
+		s.shifts[j] = append(s.shifts[j], shifts...)
+	}
+}
+
+// WithBreaks takes server j off duty during the given windows.
+func WithBreaks(j int, breaks ...Shift) Option {
+	return func(s *Simulation) {
+		if s.breaks == nil {
+			s.breaks = make(map[int][]Shift)
+		}
+		s.breaks[j] = append(s.breaks[j], breaks...)
+	}
+}
+
+// WithOffDutyRedirect makes customers in the line of a server that goes off
+// duty or breaks down move to the shortest line of an available server
+// instead of waiting for it to come back. It only matters with separate
+// queues.
+func WithOffDutyRedirect() Option {
+	return func(s *Simulation) {
+		s.redirect = true
+	}
+}
+
+// dutyWindows returns the sorted windows in which server j is on duty, or
+// false if it works the whole run.
+func (s *Simulation) dutyWindows(j int) ([]Shift, bool) {
+	shifts, hasShifts := s.shifts[j]
+	breaks, hasBreaks := s.breaks[j]
+	if !hasShifts && !hasBreaks {
+		return nil, false
+	}
+	if !hasShifts {
+		shifts = []Shift{{s.startTime, s.endTime}}
+	}
+	windows := append([]Shift(nil), shifts...)
+	for _, b := range breaks {
+		var cut []Shift
+		for _, w := range windows {
+			if b.End <= w.Start || b.Start >= w.End {
+				cut = append(cut, w)
+				continue
+			}
+			if w.Start < b.Start {
+				cut = append(cut, Shift{w.Start, b.Start})
+			}
+			if b.End < w.End {
+				cut = append(cut, Shift{b.End, w.End})
+			}
+		}
+		windows = cut
+	}
+	sort.Slice(windows, func(a, b int) bool { return windows[a].Start < windows[b].Start })
+	return windows, true
+}
+
+// scheduledTime returns the minutes server j is on duty between startTime
+// and endTime.
+func (s *Simulation) scheduledTime(j int) int {
+	windows, ok := s.dutyWindows(j)
+	if !ok {
+		return s.endTime - s.startTime
+	}
+	total := 0
+	for _, w := range windows {
+		total += max(0, min(w.End, s.endTime)-max(w.Start, s.startTime))
+	}
+	return total
+}
+
+// scheduleShifts puts every server with a schedule off duty and queues the
+// events that bring it on and off duty.
+func (r *run) scheduleShifts() {
+	for j := range r.servers {
+		windows, ok := r.s.dutyWindows(j)
+		if !ok {
+			continue
+		}
+		r.servers[j].offDuty = true
+		for _, w := range windows {
+			r.events.push(event{time: max(w.Start, r.s.startTime), kind: shiftStartEvent, server: j})
+			if w.End < r.s.endTime {
+				r.events.push(event{time: w.End, kind: shiftEndEvent, server: j})
+			}
+		}
+	}
+}
+
+// shiftStart brings server j on duty at time t.
+func (r *run) shiftStart(j int, t int) {
+	r.servers[j].offDuty = false
+	if r.logs(LevelDebug) {
+		r.logAttrs(LevelDebug, "server on duty", slog.Int("server", j), r.at(t))
+	}
+	if r.idle(j) {
+		r.next(j, t)
+	}
+}
+
+// shiftEnd takes server j off duty at time t. A customer in service is
+// served to the end.
+func (r *run) shiftEnd(j int, t int) {
+	r.servers[j].offDuty = true
+	if r.logs(LevelDebug) {
+		r.logAttrs(LevelDebug, "server off duty", slog.Int("server", j), r.at(t))
+	}
+	r.redirectLine(j, t)
+}
+
+// redirectLine sends the line of server j to other lines, if customers are
+// to be redirected when a server becomes unavailable.
+func (r *run) redirectLine(j int, t int) {
+	if !r.s.separateQueues || !r.s.redirect {
+		return
+	}
+	q := r.servers[j].queue
+	r.servers[j].queue = nil
+	for _, c := range q {
+		r.join(t, c)
+	}
+}
+
+// ServerStats summarizes the work of one server. Utilization is measured
+// against the scheduled hours, so it can exceed 1 when a server stays past
+// the end of its shift to finish a customer. With autoscaling the
+// scheduled hours are those the server was on duty.
+type ServerStats struct {
+	Customers     int
+	Batches       int
+	BusyTime      int
+	ScheduledTime int
+	Utilization   float64
+
+	// Failures and Downtime count breakdowns and the minutes spent
+	// under repair.
+	Failures int
+	Downtime int
+
+	// Overtime is how long after endTime the server finished its last
+	// customer, in minutes.
+	Overtime int
+
+	// Setups counts the times the server needed a setup, with WithSetup,
+	// and SetupTime the minutes spent on them, part of BusyTime.
+	Setups    int
+	SetupTime int
+}
+
+// shiftFlag parses repeated "j=HH:MM-HH:MM" command line values, where j is
+// a server index or "all".
+type shiftFlag struct {
+	windows map[int][]Shift
+	all     []Shift
+}
+
+func (f *shiftFlag) String() string { return "" }
+
+func (f *shiftFlag) Set(v string) error {
+	server, window, ok := strings.Cut(v, "=")
+	from, to, ok2 := strings.Cut(window, "-")
+	if !ok || !ok2 {
+		return fmt.Errorf("want SERVER=HH:MM-HH:MM, got %q", v)
+	}
+	start, err := parseTime(from)
+	if err != nil {
+		return err
+	}
+	end, err := parseTime(to)
+	if err != nil {
+		return err
+	}
+	if end <= start {
+		return fmt.Errorf("window %s ends before it starts", window)
+	}
+	w := Shift{start, end}
+	if server == "all" {
+		f.all = append(f.all, w)
+		return nil
+	}
+	j, err := strconv.Atoi(server)
+	if err != nil {
+		return fmt.Errorf("invalid server %q", server)
+	}
+	if f.windows == nil {
+		f.windows = make(map[int][]Shift)
+	}
+	f.windows[j] = append(f.windows[j], w)
+	return nil
+}
+
+// options turns the parsed windows into options for nServers servers. It
+// returns an error for windows of servers that do not exist.
+func (f *shiftFlag) options(nServers int, option func(int, ...Shift) Option) ([]Option, error) {
+	for j := range f.windows {
+		if j < 0 || j >= nServers {
+			return nil, fmt.Errorf("no server %d, the servers are 0 to %d", j, nServers-1)
+		}
+	}
+	var opts []Option
+	for j := 0; j < nServers; j++ {
+		if windows := append(append([]Shift(nil), f.windows[j]...), f.all...); len(windows) > 0 {
+			opts = append(opts, option(j, windows...))
+		}
+	}
+	return opts, nil
+}
@@ -0,0 +1,368 @@
+package queue
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// WithSkills restricts which classes of the catalog each server handles, as
+// at a bank where tellers take deposits and only loan officers take loan
+// applications: server j serves the classes listed in skills[j], by index,
+// and a server with no list, or past the end of skills, is cross-trained
+// and serves every class. A server free to take someone from the shared
+// line takes the first customer it can serve, and an arriving customer only
+// goes to the servers, or with separate queues the lines, that can serve
+// it. Customers of a class no server has the skill for may go to any
+// server. Skills have no effect with processor sharing.
+func WithSkills(skills ...[]int) Option {
+	return func(s *Simulation) {
+		s.skills = skills
+	}
+}
+
+// trainSkills sets up which server serves which class from the skills.
+func (s *Simulation) trainSkills() {
+	if s.skills == nil || s.sharing || len(s.classes) == 0 {
+		return
+	}
+	trained := make([]bool, len(s.classes))
+	s.skilled = make([][]bool, s.nServers)
+	for j := range s.skilled {
+		s.skilled[j] = make([]bool, len(s.classes))
+		all := j >= len(s.skills) || len(s.skills[j]) == 0
+		for i := range s.skilled[j] {
+			s.skilled[j][i] = all || slices.Contains(s.skills[j], i)
+			trained[i] = trained[i] || s.skilled[j][i]
+		}
+	}
+	for j := range s.skilled {
+		for i, ok := range trained {
+			s.skilled[j][i] = s.skilled[j][i] || !ok
+		}
+	}
+}
+
+// serves reports whether server j has the skill to serve customer c.
+func (r *run) serves(j int, c *Customer) bool {
+	return r.s.skilled == nil || r.s.skilled[j][c.Class]
+}
+
+// nAvailableFor returns the number of available servers that can serve
+// customer c.
+func (r *run) nAvailableFor(c *Customer) int {
+	n := 0
+	for j := range r.servers {
+		if r.available(j) && r.serves(j, c) {
+			n++
+		}
+	}
+	return n
+}
+
+// firstServed returns the index in the shared line of the first customer
+// server j can serve, or -1 if there is none.
+func (r *run) firstServed(j int) int {
+	for i, c := range r.queue {
+		if r.serves(j, c) {
+			return i
+		}
+	}
+	return -1
+}
+
+// takeSkilled lets server j take the first customers from the shared line
+// it can serve, up to a batch, at time t.
+func (r *run) takeSkilled(j int, t int) {
+	var batch []*Customer
+	rest := r.queue[:0]
+	for _, c := range r.queue {
+		if len(batch) < r.s.maxBatch && r.serves(j, c) {
+			batch = append(batch, c)
+		} else {
+			rest = append(rest, c)
+		}
+	}
+	r.queue = rest
+	r.start(j, t, batch)
+}
+
+// Skills returns the indices of the classes server j can serve, or nil if
+// it serves every class.
+func (v PolicyView) Skills(j int) []int {
+	if v.r.s.skilled == nil {
+		return nil
+	}
+	var skills []int
+	for i, ok := range v.r.s.skilled[j] {
+		if ok {
+			skills = append(skills, i)
+		}
+	}
+	if len(skills) == len(v.r.s.classes) {
+		return nil
+	}
+	return skills
+}
+
+// Specialists picks the candidate with the fewest skills, keeping the
+// cross-trained servers free for the customers only they can serve.
+type Specialists struct{}
+
+func (Specialists) Route(v PolicyView, c Customer, candidates []int) int {
+	chosen, fewest := candidates[0], -1
+	for _, j := range candidates {
+		n := len(v.Skills(j))
+		if n == 0 {
+			n = len(v.r.s.classes)
+		}
+		if fewest == -1 || n < fewest {
+			chosen, fewest = j, n
+		}
+	}
+	return chosen
+}
+
+// StaffGroup is a number of servers with the same skills, the names of the
+// classes of the catalog they serve, or none for every class.
+type StaffGroup struct {
+	Skills  []string
+	Servers int
+}
+
+// ParseStaffing parses a staffing plan given as SKILLS:N,..., where SKILLS
+// are names of classes joined with "+", or "*" for every class, e.g.
+// "deposit+withdrawal:2,loan application:1,*:1" for two tellers, a loan
+// officer and a cross-trained server.
+func ParseStaffing(spec string) ([]StaffGroup, error) {
+	var plan []StaffGroup
+	for _, part := range strings.Split(spec, ",") {
+		skills, count, ok := strings.Cut(part, ":")
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if !ok || err != nil || n < 1 {
+			return nil, fmt.Errorf("want SKILLS:N, got %q", part)
+		}
+		g := StaffGroup{Servers: n}
+		if skills = strings.TrimSpace(skills); skills != "*" {
+			for _, name := range strings.Split(skills, "+") {
+				g.Skills = append(g.Skills, strings.TrimSpace(name))
+			}
+		}
+		plan = append(plan, g)
+	}
+	return plan, nil
+}
+
+// staffSkills returns the skills of every server of the plan, by index in
+// classes, for WithSkills. Every class must have a server.
+func staffSkills(classes []CustomerClass, plan []StaffGroup) ([][]int, error) {
+	var skills [][]int
+	trained := make([]bool, len(classes))
+	for _, g := range plan {
+		var skill []int
+		for _, name := range g.Skills {
+			i := slices.IndexFunc(classes, func(c CustomerClass) bool { return c.Name == name })
+			if i < 0 {
+				return nil, fmt.Errorf("unknown category %q", name)
+			}
+			skill = append(skill, i)
+		}
+		for i := range trained {
+			trained[i] = trained[i] || skill == nil || slices.Contains(skill, i)
+		}
+		for range g.Servers {
+			skills = append(skills, skill)
+		}
+	}
+	for i, ok := range trained {
+		if !ok {
+			return nil, fmt.Errorf("no server serves %s", classes[i].Name)
+		}
+	}
+	return skills, nil
+}
+
+func (g StaffGroup) String() string {
+	if g.Skills == nil {
+		return fmt.Sprintf("%d × all", g.Servers)
+	}
+	return fmt.Sprintf("%d × %s", g.Servers, strings.Join(g.Skills, "+"))
+}
+
+// staffFlag parses repeated staffing plans.
+type staffFlag [][]StaffGroup
+
+func (f *staffFlag) String() string { return "" }
+
+func (f *staffFlag) Set(v string) error {
+	plan, err := ParseStaffing(v)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, plan)
+	return nil
+}
+
+// typeRates parses per-category arrival rates given as CATEGORY=N,....
+func typeRates(spec string) (map[string]float64, error) {
+	rates := map[string]float64{}
+	if spec == "" {
+		return rates, nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		name, rate, ok := strings.Cut(part, "=")
+		r, err := strconv.ParseFloat(strings.TrimSpace(rate), 64)
+		if !ok || err != nil || r < 0 {
+			return nil, fmt.Errorf("want CATEGORY=N, got %q", part)
+		}
+		rates[strings.TrimSpace(name)] = r
+	}
+	return rates, nil
+}
+
+func simulateFacility(seed int64, args []string) {
+	startTime := 8 * 60 // 08:00
+	endTime := 16 * 60  // 16:00
+	serverRate := 6.0   // only seeds the servers, service times come from the catalog
+
+	fs := flag.NewFlagSet("facility", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	catalog := fs.String("catalog", "catalog.csv", "CSV `file` of service types")
+	customerRate := fs.Float64("rate", 20.0, "arrival rate, in customers per hour, split between the types by their frequencies")
+	arrivals := fs.String("arrivals", "", "arrival rates of single types as `CATEGORY=N,...`, in customers per hour, in place of their share of -rate")
+	routing := fs.String("routing", "specialists", "which idle server an arriving customer goes to: specialists, those with the fewest skills, or first")
+	reps := fs.Int("reps", 200, "number of replications to average over")
+	var plans staffFlag
+	fs.Var(&plans, "staff", "staffing plan as `SKILLS:N,...`, with SKILLS the categories joined by + or * for all, e.g. \"deposit+withdrawal:2,*:1\"; repeatable")
+	fs.Parse(args)
+
+	classes, err := LoadCatalog(*catalog)
+	exitOnError(err)
+	if len(plans) == 0 {
+		// tellers and loan officers, with one or all of them cross-trained
+		tellers := "deposit+withdrawal+inquiry"
+		officers := "account opening+loan application"
+		for _, spec := range []string{tellers + ":2," + officers + ":2", tellers + ":2," + officers + ":1,*:1", "*:4"} {
+			exitOnError(plans.Set(spec))
+		}
+	}
+	if *routing != "specialists" && *routing != "first" {
+		exitOnError(fmt.Errorf("unknown routing %q, want specialists or first", *routing))
+	}
+
+	// Splitting Poisson arrivals by the frequencies gives every type its own
+	// Poisson stream, so per-type rates are frequencies of their total.
+	rates, err := typeRates(*arrivals)
+	exitOnError(err)
+	total := float64(0)
+	for _, c := range classes {
+		total += c.Frequency
+	}
+	rate := float64(0)
+	for i, c := range classes {
+		r, ok := rates[c.Name]
+		if !ok {
+			r = *customerRate * c.Frequency / total
+		}
+		delete(rates, c.Name)
+		classes[i].Frequency = r
+		rate += r
+	}
+	for name := range rates {
+		exitOnError(fmt.Errorf("unknown category %q", name))
+	}
+
+	var skills [][][]int
+	for _, plan := range plans {
+		sk, err := staffSkills(classes, plan)
+		exitOnError(err)
+		skills = append(skills, sk)
+	}
+
+	// Every plan sees the same arrival and service streams.
+	rng := rand.New(rand.NewSource(seed))
+	var sims []*Simulation
+	for range *reps {
+		seed := rng.Int63()
+		for _, sk := range skills {
+			opts := []Option{WithCatalog(classes), WithSkills(sk...)}
+			if *routing == "specialists" {
+				opts = append(opts, WithRouting(Specialists{}))
+			}
+			sims = append(sims, NewSimulation(startTime, endTime, len(sk), rate, serverRate, seed, opts...))
+		}
+	}
+	results := simulateAll(sims)
+
+	var types []string
+	for _, c := range classes {
+		types = append(types, fmt.Sprintf("%s %.2f", c.Name, c.Frequency))
+	}
+	fmt.Printf("Arrival Rates      : %s customers/hour, %d replications\n", strings.Join(types, ", "), *reps)
+	fmt.Printf("Routing            : %s\n", *routing)
+	for p, plan := range plans {
+		var groups []string
+		for _, g := range plan {
+			groups = append(groups, g.String())
+		}
+		fmt.Printf("Plan %-14d: %s\n", p+1, strings.Join(groups, ", "))
+	}
+	fmt.Println()
+
+	n := float64(*reps)
+	fmt.Println("plan,type,customers,average_wait,p90_wait")
+	waits := make([]float64, len(plans))
+	for p := range plans {
+		stats := make([]ClassStats, len(classes))
+		var all ClassStats
+		var p90 float64
+		for k := p; k < len(results); k += len(plans) {
+			r := results[k]
+			for i, c := range r.Classes {
+				stats[i].Customers += c.Customers
+				stats[i].AverageWaitTime += c.AverageWaitTime / n
+				stats[i].P90WaitTime += c.P90WaitTime
+			}
+			all.Customers += r.TotalCustomers
+			all.AverageWaitTime += r.AverageWaitTime / n
+			p90 += float64(r.WaitQuantile(0.9)) / n
+		}
+		for i, c := range stats {
+			fmt.Printf("%d,%s,%.2f,%.4f,%.2f\n", p+1, classes[i].Name, float64(c.Customers)/n, c.AverageWaitTime, float64(c.P90WaitTime)/n)
+		}
+		fmt.Printf("%d,all,%.2f,%.4f,%.2f\n", p+1, float64(all.Customers)/n, all.AverageWaitTime, p90)
+		waits[p] = all.AverageWaitTime
+	}
+	fmt.Println()
+
+	fmt.Println("plan,servers,skills,utilization")
+	for p, plan := range plans {
+		first := 0
+		for _, g := range plan {
+			utilization := float64(0)
+			for k := p; k < len(results); k += len(plans) {
+				for _, sv := range results[k].Servers[first : first+g.Servers] {
+					utilization += sv.Utilization / n / float64(g.Servers)
+				}
+			}
+			skills := "all"
+			if g.Skills != nil {
+				skills = strings.Join(g.Skills, "+")
+			}
+			fmt.Printf("%d,%d,%s,%.4f\n", p+1, g.Servers, skills, utilization)
+			first += g.Servers
+		}
+	}
+	fmt.Println()
+
+	best := 0
+	for p, w := range waits {
+		if w < waits[best] {
+			best = p
+		}
+	}
+	fmt.Printf("Best Plan          : %d (average wait %.2f minutes)\n", best+1, waits[best])
+}
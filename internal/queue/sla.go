@@ -0,0 +1,231 @@
+package queue
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Target is a service level: with a Fraction, that fraction of the
+// customers served waits at most Wait minutes, and without one, the average
+// wait is at most Wait minutes.
+type Target struct {
+	Fraction float64
+	Wait     float64
+}
+
+// ParseTarget parses a target such as "90%<=5", for 90% of customers
+// waiting at most 5 minutes, or "avg<=2", for an average wait of at most 2
+// minutes.
+func ParseTarget(s string) (Target, error) {
+	lhs, rhs, ok := strings.Cut(strings.ReplaceAll(s, " ", ""), "<=")
+	wait, err := strconv.ParseFloat(rhs, 64)
+	if !ok || err != nil || wait < 0 {
+		return Target{}, fmt.Errorf("invalid target %q, want e.g. 90%%<=5 or avg<=2", s)
+	}
+	if lhs == "avg" {
+		return Target{Wait: wait}, nil
+	}
+	pct, ok := strings.CutSuffix(lhs, "%")
+	p, err := strconv.ParseFloat(pct, 64)
+	if !ok || err != nil || p <= 0 || p > 100 {
+		return Target{}, fmt.Errorf("invalid target %q, want e.g. 90%%<=5 or avg<=2", s)
+	}
+	return Target{Fraction: p / 100, Wait: wait}, nil
+}
+
+// SLA asks for the service-level metrics of SLAStats: the fraction of the
+// customers served who waited at most each of Thresholds, in minutes, and
+// the fraction of the opening hours with more than QueueLength customers
+// waiting in line.
+type SLA struct {
+	Thresholds  []float64
+	QueueLength int
+}
+
+// SLAStats holds the service-level metrics asked for with WithSLA.
+type SLAStats struct {
+	// ServedWithin has the fraction of the customers served who waited at
+	// most each of the thresholds, in order.
+	Thresholds   []float64
+	ServedWithin []float64
+
+	// LongestWait is the longest wait of a customer served, in minutes.
+	LongestWait float64
+
+	// QueueOver is the fraction of the opening hours during which more
+	// than QueueLength customers waited in line, not counting those in
+	// service.
+	QueueLength int
+	QueueOver   float64
+}
+
+// WithSLA reports the service-level metrics of sla in SimulationResult.SLA.
+func WithSLA(sla SLA) Option {
+	return func(s *Simulation) {
+		s.sla = &sla
+	}
+}
+
+// measureQueue counts whether the line was longer than the SLA allows
+// during tick t, once everything at t has happened.
+func (r *run) measureQueue(t int) {
+	r.advance(t)
+	waiting := r.inSystem
+	for _, sv := range r.servers {
+		waiting -= len(sv.batch)
+	}
+	r.queueTicks++
+	if waiting > r.s.sla.QueueLength {
+		r.queueOverTicks++
+	}
+}
+
+func (r *run) slaStats() *SLAStats {
+	sla := r.s.sla
+	if sla == nil {
+		return nil
+	}
+	k := float64(r.s.tick)
+	st := &SLAStats{
+		Thresholds:   sla.Thresholds,
+		ServedWithin: make([]float64, len(sla.Thresholds)),
+		LongestWait:  r.longestWait() / k,
+		QueueLength:  sla.QueueLength,
+		QueueOver:    ratio(r.queueOverTicks, r.queueTicks),
+	}
+	for i, x := range sla.Thresholds {
+		st.ServedWithin[i] = r.waitsWithin(x * k)
+	}
+	return st
+}
+
+// parseThresholds parses a comma-separated list of waits in minutes.
+func parseThresholds(s string) ([]float64, error) {
+	var xs []float64
+	for _, v := range strings.Split(s, ",") {
+		x, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || x < 0 {
+			return nil, fmt.Errorf("invalid wait threshold %q", v)
+		}
+		xs = append(xs, x)
+	}
+	return xs, nil
+}
+
+func (t Target) String() string {
+	if t.Fraction == 0 {
+		return fmt.Sprintf("average wait <= %g minutes", t.Wait)
+	}
+	return fmt.Sprintf("%g%% of customers wait <= %g minutes", t.Fraction*100, t.Wait)
+}
+
+// measure returns the measure of the target over the customers of all
+// results, the fraction served in time or the average wait, and whether
+// the target is met.
+func (t Target) measure(results []SimulationResult) (float64, bool) {
+	var waits histogram
+	k := 1
+	for _, r := range results {
+		waits.merge(r.waits)
+		k = max(r.tick, 1)
+	}
+	if t.Fraction == 0 {
+		avg := waits.mean() / float64(k)
+		return avg, avg <= t.Wait
+	}
+	within := waits.within(int(t.Wait * float64(k)))
+	return within, within >= t.Fraction
+}
+
+// StaffingTrial is one number of servers tried by Staff.
+type StaffingTrial struct {
+	Servers int
+	Measure float64
+	Met     bool
+}
+
+// Staff returns the smallest number of servers, up to maxServers, that
+// meets the target, where run returns the replications of a simulation
+// with the given number of servers. It doubles the number of servers until
+// the target is met and then bisects, which assumes that more servers never
+// do worse; giving every run the same seeds makes that hold much better.
+// It also returns the numbers tried, in order.
+func Staff(target Target, maxServers int, run func(nServers int) []SimulationResult) (int, []StaffingTrial, error) {
+	var trials []StaffingTrial
+	try := func(n int) bool {
+		m, ok := target.measure(run(n))
+		trials = append(trials, StaffingTrial{Servers: n, Measure: m, Met: ok})
+		return ok
+	}
+
+	lo, hi := 0, 1 // lo fails, hi is to be tried
+	for !try(hi) {
+		if hi == maxServers {
+			return 0, trials, fmt.Errorf("%d servers do not meet the target", maxServers)
+		}
+		lo, hi = hi, min(2*hi, maxServers)
+	}
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if try(mid) {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return hi, trials, nil
+}
+
+func simulateStaffing(seed int64, args []string) {
+	startTime := 8 * 60 // 08:00
+	endTime := 16 * 60  // 16:00
+
+	fs := flag.NewFlagSet("staff", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	targetFlag := fs.String("target", "90%<=5", "service level to meet, e.g. 90%<=5 or avg<=2")
+	customerRate := fs.Float64("rate", 30.0, "arrival rate, in customers per hour")
+	serverRate := fs.Float64("service-rate", 6.0, "service rate of a server, in customers per hour")
+	maxServers := fs.Int("max-servers", 100, "largest number of servers to consider")
+	reps := fs.Int("reps", 200, "number of replications per number of servers")
+	fs.Parse(args)
+	checkServers("max-servers", *maxServers)
+
+	target, err := ParseTarget(*targetFlag)
+	exitOnError(err)
+
+	rng := rand.New(rand.NewSource(seed))
+	seeds := make([]int64, *reps)
+	for i := range seeds {
+		seeds[i] = rng.Int63()
+	}
+	n, trials, err := Staff(target, *maxServers, func(nServers int) []SimulationResult {
+		sims := make([]*Simulation, len(seeds))
+		for i, seed := range seeds {
+			sims[i] = NewSimulation(startTime, endTime, nServers, *customerRate, *serverRate, seed)
+		}
+		return simulateAll(sims)
+	})
+
+	fmt.Printf("Target             : %s\n", target)
+	fmt.Printf("Arrival Rate       : %.2f customers/hour\n", *customerRate)
+	fmt.Printf("Service Rate       : %.2f customers/hour per server\n", *serverRate)
+	fmt.Printf("Replications       : %d per trial\n", *reps)
+	fmt.Println()
+	measure := "served_within_target"
+	if target.Fraction == 0 {
+		measure = "average_wait_time"
+	}
+	fmt.Printf("servers,%s,met\n", measure)
+	for _, t := range trials {
+		fmt.Printf("%d,%.4f,%t\n", t.Servers, t.Measure, t.Met)
+	}
+	fmt.Println()
+	if err != nil {
+		fmt.Printf("Minimum Servers    : none (%v)\n", err)
+		return
+	}
+	fmt.Printf("Minimum Servers    : %d\n", n)
+}
@@ -0,0 +1,134 @@
+package queue
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// SourceFactory makes the source of a random stream of a run with the
+// given seed. The streams are arrivals, service (index: the server),
+// selection, groups, mix, failures and repairs (index: the server), and
+// patience; a factory may ignore the names or the seed.
+type SourceFactory func(seed int64, stream string, index ...int) rand.Source
+
+// WithSource draws every random number of the simulation from the sources
+// of f instead of the default PCG generators, to substitute e.g.
+// CryptoSource, a low-discrepancy sequence through FloatSource, or Replay
+// of a Recording.
+func WithSource(f SourceFactory) Option {
+	return func(s *Simulation) {
+		s.sources = f
+	}
+}
+
+// PCGSource is the default factory: a PCG generator per stream, seeded
+// with the seed and the name of the stream.
+func PCGSource(seed int64, stream string, index ...int) rand.Source {
+	return newStream(seed, stream, index...)
+}
+
+// CryptoSource draws from the operating system's cryptographic generator.
+// Runs with it cannot be repeated.
+func CryptoSource(seed int64, stream string, index ...int) rand.Source {
+	return cryptoSource{}
+}
+
+type cryptoSource struct{}
+
+func (cryptoSource) Int63() int64 {
+	var b [8]byte
+	crand.Read(b[:])
+	return int64(binary.LittleEndian.Uint64(b[:]) >> 1)
+}
+
+func (cryptoSource) Seed(int64) {}
+
+// FloatSource turns a generator of numbers in [0, 1) into a source, such
+// that rand.Rand.Float64 returns the numbers of next as they are.
+func FloatSource(next func() float64) rand.Source {
+	return floatSource(next)
+}
+
+type floatSource func() float64
+
+func (f floatSource) Int63() int64 {
+	return int64(math.Ldexp(f(), 63))
+}
+
+func (floatSource) Seed(int64) {}
+
+// Recording holds the numbers drawn from every stream of a run, to replay
+// them exactly.
+type Recording struct {
+	mu      sync.Mutex
+	streams map[string]*[]int64
+}
+
+func streamKey(stream string, index []int) string {
+	for _, i := range index {
+		stream += fmt.Sprintf("/%d", i)
+	}
+	return stream
+}
+
+// Record returns a factory that draws from the sources of f and records
+// every number drawn in rec. A recording holds a single run.
+func (rec *Recording) Record(f SourceFactory) SourceFactory {
+	return func(seed int64, stream string, index ...int) rand.Source {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		if rec.streams == nil {
+			rec.streams = map[string]*[]int64{}
+		}
+		draws := new([]int64)
+		rec.streams[streamKey(stream, index)] = draws
+		return &recordingSource{Source: f(seed, stream, index...), draws: draws}
+	}
+}
+
+// Replay returns a factory that draws the numbers of rec again, stream by
+// stream, whatever the seed. Drawing past the end of a recorded stream
+// panics, as the run replayed is not the one recorded.
+func (rec *Recording) Replay() SourceFactory {
+	return func(seed int64, stream string, index ...int) rand.Source {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		key := streamKey(stream, index)
+		var draws []int64
+		if p := rec.streams[key]; p != nil {
+			draws = *p
+		}
+		return &replaySource{key: key, draws: draws}
+	}
+}
+
+type recordingSource struct {
+	rand.Source
+	draws *[]int64
+}
+
+func (r *recordingSource) Int63() int64 {
+	x := r.Source.Int63()
+	*r.draws = append(*r.draws, x)
+	return x
+}
+
+type replaySource struct {
+	key   string
+	draws []int64
+}
+
+func (r *replaySource) Int63() int64 {
+	if len(r.draws) == 0 {
+		panic(fmt.Sprintf("replay of stream %s ran past the recording", r.key))
+	}
+	x := r.draws[0]
+	r.draws = r.draws[1:]
+	return x
+}
+
+func (*replaySource) Seed(int64) {}
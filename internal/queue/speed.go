@@ -0,0 +1,112 @@
+package queue
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ServiceSpeed returns the multiplier of a server's service rate for a
+// service that starts with waiting customers still in line for the server,
+// in the shared line or with separate queues its own, after onDuty minutes
+// since its shift began, or since the start. A multiplier of 1.25 serves 25%
+// faster and one of 0.8 takes 25% longer; it must be positive.
+type ServiceSpeed func(waiting int, onDuty float64) float64
+
+// WithServiceSpeed makes the service rates depend on the state of the
+// system as services start, with the product of the speeds, as servers
+// hurry when the line is long or tire over the shift. Services under way
+// keep their length.
+func WithServiceSpeed(speeds ...ServiceSpeed) Option {
+	return func(s *Simulation) {
+		s.speeds = append(s.speeds, speeds...)
+	}
+}
+
+// LineSpeedUp serves faster by perCustomer for every customer waiting, up
+// to a multiplier of most: LineSpeedUp(0.05, 1.5) serves 10% faster with 2
+// waiting and at most 50% faster.
+func LineSpeedUp(perCustomer, most float64) ServiceSpeed {
+	return func(waiting int, onDuty float64) float64 {
+		return min(1+perCustomer*float64(waiting), most)
+	}
+}
+
+// Fatigue serves slower by perHour for every hour on duty, down to a
+// multiplier of least: Fatigue(0.03, 0.8) serves 12% slower after 4 hours
+// and at most 20% slower.
+func Fatigue(perHour, least float64) ServiceSpeed {
+	return func(waiting int, onDuty float64) float64 {
+		return max(1-perHour*onDuty/60, least)
+	}
+}
+
+// ParseServiceSpeed parses a service speed given as NAME,PARAMS...:
+// line,PER_CUSTOMER,MOST for LineSpeedUp or fatigue,PER_HOUR,LEAST for
+// Fatigue.
+func ParseServiceSpeed(spec string) (ServiceSpeed, error) {
+	parts := strings.Split(spec, ",")
+	var params []float64
+	for _, p := range parts[1:] {
+		x, err := strconv.ParseFloat(p, 64)
+		if err != nil || x < 0 {
+			return nil, fmt.Errorf("invalid service speed %q, want NAME,X...", spec)
+		}
+		params = append(params, x)
+	}
+	switch {
+	case parts[0] == "line" && len(params) == 2 && params[1] >= 1:
+		return LineSpeedUp(params[0], params[1]), nil
+	case parts[0] == "fatigue" && len(params) == 2 && params[1] > 0 && params[1] <= 1:
+		return Fatigue(params[0], params[1]), nil
+	}
+	return nil, fmt.Errorf("unknown service speed %q, want line,PER_CUSTOMER,MOST with MOST at least 1 or fatigue,PER_HOUR,LEAST with LEAST in (0, 1]", spec)
+}
+
+// speedFlag parses repeated service speeds.
+type speedFlag []ServiceSpeed
+
+func (f *speedFlag) String() string { return "" }
+
+func (f *speedFlag) Set(v string) error {
+	speed, err := ParseServiceSpeed(v)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, speed)
+	return nil
+}
+
+// speed returns the multiplier of the service rate of server j for a
+// service starting at time t.
+func (r *run) speed(j int, t int) float64 {
+	waiting := len(r.queue)
+	if r.s.separateQueues {
+		waiting = len(r.servers[j].queue)
+	}
+	onDuty := r.s.minutes(t - r.shiftBegan(j, t))
+	m := float64(1)
+	for _, f := range r.s.speeds {
+		m *= f(waiting, onDuty)
+	}
+	if m <= 0 {
+		return 1
+	}
+	return m
+}
+
+// shiftBegan returns when the shift of server j under way at time t began:
+// the latest start of its shifts by then, or with autoscaling when it came
+// on duty, and otherwise startTime. Breaks do not end a shift.
+func (r *run) shiftBegan(j int, t int) int {
+	if r.scaling != nil {
+		return r.servers[j].dutySince
+	}
+	start, found := r.s.startTime, false
+	for _, w := range r.s.shifts[j] {
+		if w.Start <= t && (!found || w.Start > start) {
+			start, found = w.Start, true
+		}
+	}
+	return min(start, t)
+}
@@ -0,0 +1,243 @@
+package queue
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"strings"
+)
+
+// State is what the system looks like at a moment of a run: who is in line
+// and who is in service at every server.
+type State struct {
+	// Time is the moment, in minutes since midnight. The state is that
+	// after the departures at that minute and before its arrivals.
+	Time int
+	// Waiting is the shared line, the first to be served first.
+	Waiting []CustomerState
+	Servers []ServerState
+}
+
+// ServerState is a server in a State.
+type ServerState struct {
+	InService []CustomerState
+	// Waiting is the server's own line, with separate queues.
+	Waiting []CustomerState
+	// RemainingWork is the time, in minutes, until the server is done
+	// with the customers in service if nothing interrupts it, including a
+	// setup under way and, with round robin, the work left after the time
+	// slice.
+	RemainingWork float64
+	// OffDuty includes a server on standby, see WithAutoscaling.
+	OffDuty, Broken bool
+}
+
+// CustomerState is a customer in a State.
+type CustomerState struct {
+	Index int
+	// Class is the index of the customer's class in the catalog.
+	Class int
+	// InSystem is how long the customer has been in the system, in
+	// minutes.
+	InSystem float64
+}
+
+// InLine returns the number of customers waiting, in the shared line and
+// those of the servers.
+func (st State) InLine() int {
+	n := len(st.Waiting)
+	for _, sv := range st.Servers {
+		n += len(sv.Waiting)
+	}
+	return n
+}
+
+// InService returns the number of customers in service.
+func (st State) InService() int {
+	n := 0
+	for _, sv := range st.Servers {
+		n += len(sv.InService)
+	}
+	return n
+}
+
+// WithStates records the state of the system at the given times, in
+// minutes since midnight, in the result's States. Times after the doors
+// close show the customers still being served; times before the start are
+// left out.
+func WithStates(times ...int) Option {
+	return func(s *Simulation) {
+		s.stateTimes = append(s.stateTimes, times...)
+		slices.Sort(s.stateTimes)
+		s.stateTimes = slices.Compact(s.stateTimes)
+	}
+}
+
+// StateAt returns the state recorded at time t, in minutes since midnight,
+// with WithStates, and whether there is one.
+func (r SimulationResult) StateAt(t int) (State, bool) {
+	for _, st := range r.States {
+		if st.Time == t {
+			return st, true
+		}
+	}
+	return State{}, false
+}
+
+// recordStates records the states due at time t, skipping those before it,
+// which are before the start.
+func (r *run) recordStates(t int) {
+	times := r.s.stateTimes
+	for ; r.nextState < len(times) && times[r.nextState] <= t; r.nextState++ {
+		if times[r.nextState] == t {
+			r.advance(t)
+			r.states = append(r.states, r.state(t))
+		}
+	}
+}
+
+// recordLateStates records the states due after the doors close at time
+// end, before the customers still inside have left.
+func (r *run) recordLateStates(end int) {
+	for _, t := range r.s.stateTimes[r.nextState:] {
+		if t >= end {
+			r.advance(t)
+			r.states = append(r.states, r.state(t))
+		}
+	}
+	r.nextState = len(r.s.stateTimes)
+}
+
+// state returns the state at time t.
+func (r *run) state(t int) State {
+	st := State{Time: t/r.s.tick - r.s.day*24*60, Waiting: r.customerStates(r.queue, t)}
+	for j := range r.servers {
+		sv := &r.servers[j]
+		st.Servers = append(st.Servers, ServerState{
+			InService:     r.customerStates(sv.batch, t),
+			Waiting:       r.customerStates(sv.queue, t),
+			RemainingWork: r.remainingWork(j, t) / float64(r.s.tick),
+			OffDuty:       sv.offDuty || sv.standby,
+			Broken:        sv.broken,
+		})
+	}
+	return st
+}
+
+func (r *run) customerStates(cs []*Customer, t int) []CustomerState {
+	var states []CustomerState
+	for _, c := range cs {
+		states = append(states, CustomerState{Index: c.Index, Class: c.Class, InSystem: r.s.minutes(t - c.ArrivalTime)})
+	}
+	return states
+}
+
+// remainingWork returns the ticks until server j is done with the
+// customers in service at time t.
+func (r *run) remainingWork(j int, t int) float64 {
+	sv := &r.servers[j]
+	if len(sv.batch) == 0 {
+		return 0
+	}
+	if r.s.sharing {
+		// served together at the full rate of the server
+		done := float64(t-sv.sharedAt) / float64(len(sv.batch))
+		work := float64(0)
+		for _, c := range sv.batch {
+			work += max(c.left-done, 0)
+		}
+		return work
+	}
+	return float64(max(sv.batch[0].FinishTime-t, 0) + sv.rest)
+}
+
+func simulateStates(seed int64, args []string) {
+	startTime := 8 * 60 // 08:00
+	endTime := 16 * 60  // 16:00
+	customerRate := 5.8 // 5.8 customers per hour
+	serverRate := 6.0   // 6 customers per hour, or 10 minutes per customer
+
+	fs := flag.NewFlagSet("lobby", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	nServers := fs.Int("servers", 2, "number of servers")
+	reps := fs.Int("reps", 200, "number of replications to average over")
+	at := fs.String("at", "", "comma-separated times HH:MM to look at, instead of every -every minutes")
+	every := fs.Int("every", 60, "minutes between the times to look at, from opening to an hour after closing")
+	fs.Parse(args)
+	checkServers("servers", *nServers)
+
+	var times []int
+	if *at != "" {
+		for _, v := range strings.Split(*at, ",") {
+			t, err := parseTime(v)
+			exitOnError(err)
+			times = append(times, t)
+		}
+	} else {
+		if *every <= 0 {
+			exitOnError(fmt.Errorf("-every must be positive, got %d", *every))
+		}
+		for t := startTime; t <= endTime+60; t += *every {
+			times = append(times, t)
+		}
+	}
+	slices.Sort(times)
+	times = slices.Compact(times)
+
+	rng := rand.New(rand.NewSource(seed))
+	sims := make([]*Simulation, *reps)
+	for i := range sims {
+		sims[i] = NewSimulation(startTime, endTime, *nServers, customerRate, serverRate, rng.Int63(), WithStates(times...))
+	}
+	results := simulateAll(sims)
+
+	fmt.Printf("Replications       : %d\n", *reps)
+	fmt.Printf("Total Servers      : %d\n", *nServers)
+	fmt.Printf("Opening Hours      : %s-%s\n", formatTime(startTime), formatTime(endTime))
+	fmt.Println()
+	fmt.Println("time,in_line,p_no_line,p90_in_line,in_service,busy_servers,remaining_work,waited_so_far")
+	n := float64(*reps)
+	for _, t := range times {
+		var lines []int
+		var inService, busy, work, waited float64
+		waiting := 0
+		for _, r := range results {
+			st, ok := r.StateAt(t)
+			if !ok {
+				continue
+			}
+			lines = append(lines, st.InLine())
+			inService += float64(st.InService()) / n
+			for _, sv := range st.Servers {
+				if len(sv.InService) > 0 {
+					busy += 1 / n
+				}
+				work += sv.RemainingWork / n / float64(len(st.Servers))
+				for _, c := range sv.Waiting {
+					waited += c.InSystem
+				}
+			}
+			for _, c := range st.Waiting {
+				waited += c.InSystem
+			}
+			waiting += st.InLine()
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		slices.Sort(lines)
+		empty := 0
+		for _, l := range lines {
+			if l == 0 {
+				empty++
+			}
+		}
+		if waiting > 0 {
+			waited /= float64(waiting)
+		}
+		p90 := lines[int(math.Ceil(0.9*float64(len(lines))))-1]
+		fmt.Printf("%s,%.4f,%.4f,%d,%.4f,%.4f,%.4f,%.4f\n", formatTime(t), float64(waiting)/n, float64(empty)/n, p90, inService, busy, work, waited)
+	}
+}
@@ -0,0 +1,252 @@
+package queue
+
+import (
+	"math"
+	"sort"
+)
+
+// ksStatistic returns the Kolmogorov-Smirnov distance between the empirical
+// distribution of sample and the distribution with the given CDF.
+func ksStatistic(sample []float64, cdf func(float64) float64) float64 {
+	xs := append([]float64(nil), sample...)
+	sort.Float64s(xs)
+	n := float64(len(xs))
+	d := float64(0)
+	for i, x := range xs {
+		f := cdf(x)
+		d = max(d, f-float64(i)/n, float64(i+1)/n-f)
+	}
+	return d
+}
+
+// ksPValue returns the asymptotic p-value of a Kolmogorov-Smirnov distance
+// d between n observations and a fully specified distribution. With
+// parameters estimated from the same observations it is conservative.
+func ksPValue(d float64, n int) float64 {
+	sn := math.Sqrt(float64(n))
+	lambda := (sn + 0.12 + 0.11/sn) * d
+	if lambda < 0.2 {
+		return 1
+	}
+	p := float64(0)
+	for k := 1; k <= 100; k++ {
+		term := 2 * math.Exp(-2*float64(k*k)*lambda*lambda)
+		if k%2 == 0 {
+			term = -term
+		}
+		p += term
+		if math.Abs(term) < 1e-12 {
+			break
+		}
+	}
+	return min(max(p, 0), 1)
+}
+
+// meanVariance returns the mean and the unbiased sample variance of xs.
+func meanVariance(xs []float64) (mean, variance float64) {
+	for _, x := range xs {
+		mean += x / float64(len(xs))
+	}
+	for _, x := range xs {
+		variance += (x - mean) * (x - mean)
+	}
+	if len(xs) > 1 {
+		variance /= float64(len(xs) - 1)
+	}
+	return mean, variance
+}
+
+// tQuantile returns the p-quantile of Student's t distribution with df
+// degrees of freedom.
+func tQuantile(p float64, df int) float64 {
+	if p < 0.5 {
+		return -tQuantile(1-p, df)
+	}
+	// bisect on the CDF, which for t >= 0 is 1 - I_x(df/2, 1/2)/2 with
+	// x = df/(df+t^2)
+	v := float64(df)
+	cdf := func(t float64) float64 { return 1 - betaInc(v/2, 0.5, v/(v+t*t))/2 }
+	lo, hi := float64(0), float64(1)
+	for cdf(hi) < p {
+		hi *= 2
+	}
+	for hi-lo > 1e-10 {
+		mid := (lo + hi) / 2
+		if cdf(mid) < p {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// gammaQ returns the regularized upper incomplete gamma function Q(a, x),
+// of which the chi-square distribution with k degrees of freedom has the
+// tail Q(k/2, x/2).
+func gammaQ(a, x float64) float64 {
+	if x <= 0 {
+		return 1
+	}
+	lg, _ := math.Lgamma(a)
+	front := math.Exp(-x + a*math.Log(x) - lg)
+	if x < a+1 {
+		// the series of P(a, x) converges fast below the mean
+		sum, term := 1/a, 1/a
+		for n := 1; n <= 1000 && term > sum*1e-15; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+		}
+		return max(1-front*sum, 0)
+	}
+	// the continued fraction of Q(a, x), by the modified Lentz method
+	const tiny = 1e-300
+	b := x + 1 - a
+	c, d := 1/tiny, 1/b
+	f := d
+	for n := 1; n <= 1000; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		f *= c * d
+		if math.Abs(c*d-1) < 1e-15 {
+			break
+		}
+	}
+	return front * f
+}
+
+// betaInc returns the regularized incomplete beta function I_x(a, b).
+func betaInc(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	// the continued fraction converges fast below the mean
+	if x > (a+1)/(a+b+2) {
+		return 1 - front*betaFraction(b, a, 1-x)/b
+	}
+	return front * betaFraction(a, b, x) / a
+}
+
+// betaFraction evaluates the continued fraction of the incomplete beta
+// function by the modified Lentz method.
+func betaFraction(a, b, x float64) float64 {
+	const tiny = 1e-300
+	c, d := float64(1), 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	f := d
+	for m := 1; m <= 300; m++ {
+		fm := float64(m)
+		for _, num := range []float64{
+			fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm)),
+			-(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1)),
+		} {
+			d = 1 + num*d
+			if math.Abs(d) < tiny {
+				d = tiny
+			}
+			c = 1 + num/c
+			if math.Abs(c) < tiny {
+				c = tiny
+			}
+			d = 1 / d
+			f *= c * d
+		}
+		if math.Abs(c*d-1) < 1e-12 {
+			break
+		}
+	}
+	return f
+}
+
+// controlVariates returns the control variate estimate of the mean of ys
+// and its standard error, where controls[k][i] is control k of observation i
+// and means[k] its known expectation. The coefficients are fitted by least
+// squares on the same observations.
+func controlVariates(ys []float64, controls [][]float64, means []float64) (estimate, stdErr float64) {
+	n := len(ys)
+	my, _ := meanVariance(ys)
+	// drop controls that do not vary, which carry no information
+	var cs [][]float64
+	var mc, mu []float64
+	for k, c := range controls {
+		if m, v := meanVariance(c); v > 0 {
+			cs = append(cs, c)
+			mc = append(mc, m)
+			mu = append(mu, means[k])
+		}
+	}
+	if n <= len(cs)+1 {
+		return my, math.NaN()
+	}
+
+	// solve the normal equations S beta = r by Gaussian elimination
+	k := len(cs)
+	S := make([][]float64, k)
+	for a := range S {
+		S[a] = make([]float64, k+1)
+		for b := range k {
+			for i := range n {
+				S[a][b] += (cs[a][i] - mc[a]) * (cs[b][i] - mc[b])
+			}
+		}
+		for i := range n {
+			S[a][k] += (cs[a][i] - mc[a]) * (ys[i] - my)
+		}
+	}
+	for a := range k {
+		p := a
+		for b := a + 1; b < k; b++ {
+			if math.Abs(S[b][a]) > math.Abs(S[p][a]) {
+				p = b
+			}
+		}
+		S[a], S[p] = S[p], S[a]
+		for b := a + 1; b < k; b++ {
+			f := S[b][a] / S[a][a]
+			for j := a; j <= k; j++ {
+				S[b][j] -= f * S[a][j]
+			}
+		}
+	}
+	beta := make([]float64, k)
+	for a := k - 1; a >= 0; a-- {
+		beta[a] = S[a][k]
+		for b := a + 1; b < k; b++ {
+			beta[a] -= S[a][b] * beta[b]
+		}
+		beta[a] /= S[a][a]
+	}
+
+	estimate = my
+	for a := range k {
+		estimate -= beta[a] * (mc[a] - mu[a])
+	}
+	sq := float64(0)
+	for i := range n {
+		e := ys[i] - my
+		for a := range k {
+			e -= beta[a] * (cs[a][i] - mc[a])
+		}
+		sq += e * e
+	}
+	return estimate, math.Sqrt(sq / float64(n-1-k) / float64(n))
+}
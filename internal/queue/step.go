@@ -0,0 +1,404 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Stepper runs a simulation a step at a time, for watching the dynamics of
+// a queue unfold in class: an arrival, a departure or another event of the
+// run with the customer events it sets off at once, such as the next
+// customer in line starting service. Between steps the run is paused, its
+// state can be inspected and its parameters changed before it goes on.
+type Stepper struct {
+	s       *Simulation
+	ctx     context.Context
+	cancel  context.CancelFunc
+	events  chan []CustomerEvent
+	ctrl    chan func(*run) // run while paused, nil to go on
+	results chan SimulationResult
+
+	started, done bool
+	last          CustomerEvent
+	pending       []func(*run)
+	result        SimulationResult
+}
+
+// Stepper starts s paused before its first step; Next runs it a step at a
+// time. s must not be run otherwise. Close, or running to the end,
+// releases the run.
+func (s *Simulation) Stepper(ctx context.Context) *Stepper {
+	ctx, cancel := context.WithCancel(ctx)
+	st := &Stepper{s: s, ctx: ctx, cancel: cancel, events: make(chan []CustomerEvent), ctrl: make(chan func(*run)), results: make(chan SimulationResult, 1)}
+	s.pause = st.pause
+	go func() {
+		defer close(st.results)
+		result, err := s.simulate(ctx, s.logger, nil)
+		close(st.events)
+		if err == nil {
+			st.results <- result
+		}
+	}()
+	return st
+}
+
+// pause hands the events of a step to Next and runs the changes asked for
+// until Next is called again.
+func (st *Stepper) pause(r *run, events []CustomerEvent) {
+	select {
+	case st.events <- events:
+	case <-st.ctx.Done():
+		return
+	}
+	for {
+		select {
+		case f := <-st.ctrl:
+			if f == nil {
+				return
+			}
+			f(r)
+		case <-st.ctx.Done():
+			return
+		}
+	}
+}
+
+// pause ends a step of the run, pausing it for a Stepper if anything
+// happened to customers.
+func (r *run) pause() {
+	if r.s.pause != nil && len(r.stepped) > 0 {
+		events := r.stepped
+		r.stepped = nil
+		r.s.pause(r, events)
+	}
+}
+
+// Next runs the simulation to the end of its next step and returns the
+// customer events of the step, in order, or false once the run is over,
+// when Result has the outcome.
+func (st *Stepper) Next() ([]CustomerEvent, bool) {
+	if st.done {
+		return nil, false
+	}
+	if st.started {
+		select {
+		case st.ctrl <- nil:
+		case <-st.ctx.Done():
+		}
+	}
+	events, ok := <-st.events
+	if !ok {
+		st.done = true
+		st.result = <-st.results
+		st.cancel()
+		return nil, false
+	}
+	st.started, st.last = true, events[len(events)-1]
+	for _, f := range st.pending {
+		st.do(f)
+	}
+	st.pending = nil
+	return events, true
+}
+
+// do runs f on the paused run and waits for it, or before the first event
+// step has it wait for that.
+func (st *Stepper) do(f func(*run)) {
+	switch {
+	case st.done:
+	case !st.started:
+		st.pending = append(st.pending, f)
+	default:
+		done := make(chan struct{})
+		select {
+		case st.ctrl <- func(r *run) { f(r); close(done) }:
+			<-done
+		case <-st.ctx.Done():
+		}
+	}
+}
+
+// Event returns the last customer event of the last step.
+func (st *Stepper) Event() CustomerEvent {
+	return st.last
+}
+
+// State returns the state of the system at the end of the last step, with
+// Time in minutes since midnight. Before the first step and after the
+// last it is empty.
+func (st *Stepper) State() State {
+	var state State
+	if st.started && !st.done {
+		st.do(func(r *run) { state = r.state(st.last.Time) })
+	}
+	return state
+}
+
+// SetServers keeps n servers on duty from time at, in minutes since
+// midnight, or from the last step if that is later. More come on duty at
+// once; of those beyond n the idle ones go on standby first, and the
+// others after serving their customers to the end, as at the end of a
+// shift. The servers there may be are those of the simulation, which needs
+// WithAutoscaling for the ones not on duty at the start; without ScaleUp,
+// Min then sets how many are. Changes made before the first step take
+// effect after it.
+func (st *Stepper) SetServers(n int, at int) error {
+	switch {
+	case st.done:
+		return errors.New("the run is over")
+	case st.s.scaling == nil:
+		return errors.New("no servers on standby, see WithAutoscaling")
+	case n < 1 || n > st.s.nServers:
+		return fmt.Errorf("want 1 to %d servers, got %d", st.s.nServers, n)
+	}
+	st.do(func(r *run) {
+		t := (at + r.s.day*24*60) * r.s.tick
+		if t <= st.last.Time {
+			r.setServers(n, st.last.Time)
+			return
+		}
+		r.events.push(event{time: t, kind: serversEvent, server: n})
+	})
+	return nil
+}
+
+// setServers keeps n servers on duty from time t, also as the least number
+// for autoscaling.
+func (r *run) setServers(n int, t int) {
+	a := r.s.scaling
+	a.Schedule = append(a.Schedule, ScaleStep{At: t, Servers: n})
+	slices.SortStableFunc(a.Schedule, func(x, y ScaleStep) int { return x.At - y.At })
+	for j := range r.servers {
+		if r.onDuty(false) >= n {
+			break
+		}
+		r.comeOnDuty(j, t, "schedule")
+	}
+	for _, busy := range []bool{false, true} {
+		for j := len(r.servers) - 1; j >= 0 && r.onDuty(false) > n; j-- {
+			sv := &r.servers[j]
+			if sv.standby || (len(sv.batch) > 0) != busy {
+				continue
+			}
+			sv.standby = true
+			sv.dutyTime += t - sv.dutySince
+			r.scaled(t, j, "stop", "schedule")
+			r.redirectLine(j, t)
+		}
+	}
+}
+
+// SetArrivalRate changes the arrival rate to rate customers per hour from
+// the next tick of the clock, outside the periods of an arrival profile.
+func (st *Stepper) SetArrivalRate(rate float64) error {
+	if st.done {
+		return errors.New("the run is over")
+	}
+	st.do(func(r *run) {
+		s := r.s
+		s.customerRate = rate
+		s.customerDist = newPoisson(rate/60/float64(s.tick), 100, s.customerDist.rng)
+	})
+	return nil
+}
+
+// Result returns the result of the run, and whether it ran to the end.
+func (st *Stepper) Result() (SimulationResult, bool) {
+	return st.result, st.done
+}
+
+// Close stops the run if it is not over.
+func (st *Stepper) Close() {
+	st.cancel()
+}
+
+// stepHelp lists the commands of the step command.
+const stepHelp = `commands:
+  step [N]               go on N steps, 1 by default (also: s, or an empty line)
+  until HH:MM            go on to the first step at or after HH:MM
+  run                    go on to the end
+  state                  the line and every server
+  servers N [at HH:MM]   keep N servers on duty, now or from HH:MM
+  rate X                 X customers per hour from now on
+  help                   this list
+  quit                   leave
+`
+
+func simulateSteps(seed int64, args []string) {
+	fs := flag.NewFlagSet("step", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	nServers := fs.Int("servers", 2, "servers on duty at the start")
+	maxServers := fs.Int("max-servers", 0, "servers there may be, with those beyond -servers on standby (default -servers + 2)")
+	customerRate := fs.Float64("rate", 5.8, "arrival rate, in customers per hour")
+	serverRate := fs.Float64("service-rate", 6.0, "service rate of a server, in customers per hour")
+	start := fs.String("start", "08:00", "opening time as HH:MM")
+	end := fs.String("end", "16:00", "closing time as HH:MM")
+	fs.Parse(args)
+
+	startTime, err := parseTime(*start)
+	exitOnError(err)
+	endTime, err := parseTime(*end)
+	exitOnError(err)
+	if *maxServers == 0 {
+		*maxServers = *nServers + 2
+	}
+	if *nServers < 1 || *maxServers < *nServers {
+		exitOnError(fmt.Errorf("want 1 <= -servers <= -max-servers, got %d and %d", *nServers, *maxServers))
+	}
+	// servers idle beyond the number on duty go on standby at once
+	s := NewSimulation(startTime, endTime, *maxServers, *customerRate, *serverRate, seed, WithAutoscaling(Autoscaling{Min: *nServers}))
+	st := s.Stepper(context.Background())
+	defer st.Close()
+
+	fmt.Printf("%d of %d servers on duty from %s to %s, %g customers per hour, %g served per hour per server; \"help\" for the commands\n",
+		*nServers, *maxServers, *start, *end, *customerRate, *serverRate)
+	in := bufio.NewScanner(os.Stdin)
+	for {
+		prompt := *start
+		if e := st.Event(); e.Time > 0 {
+			prompt = s.clock(e.Time)
+		}
+		fmt.Printf("%s> ", prompt)
+		if !in.Scan() {
+			fmt.Println()
+			return
+		}
+		if err := stepCommand(s, st, strings.Fields(in.Text())); err != nil {
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			fmt.Println(err)
+		}
+		if _, over := st.Result(); over {
+			printStepResult(st)
+			return
+		}
+	}
+}
+
+// stepCommand runs a command of the step command on st.
+func stepCommand(s *Simulation, st *Stepper, f []string) error {
+	cmd := "step"
+	if len(f) > 0 {
+		cmd = f[0]
+	}
+	next := func(more func(CustomerEvent) bool) {
+		for {
+			events, ok := st.Next()
+			if !ok {
+				return
+			}
+			for _, e := range events {
+				printStepEvent(s, e)
+			}
+			if !more(events[0]) {
+				return
+			}
+		}
+	}
+	switch {
+	case (cmd == "step" || cmd == "s") && len(f) <= 2:
+		n := 1
+		if len(f) == 2 {
+			var err error
+			if n, err = strconv.Atoi(f[1]); err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps %q", f[1])
+			}
+		}
+		next(func(CustomerEvent) bool { n--; return n > 0 })
+	case cmd == "until" && len(f) == 2:
+		t, err := parseTime(f[1])
+		if err != nil {
+			return err
+		}
+		next(func(e CustomerEvent) bool { return e.Time < t*s.tick })
+	case cmd == "run" && len(f) == 1:
+		next(func(CustomerEvent) bool { return true })
+	case cmd == "state" && len(f) == 1:
+		printStepState(st.State())
+	case cmd == "servers" && (len(f) == 2 || len(f) == 4 && f[2] == "at"):
+		n, err := strconv.Atoi(f[1])
+		if err != nil {
+			return fmt.Errorf("invalid number of servers %q", f[1])
+		}
+		at := 0
+		if len(f) == 4 {
+			if at, err = parseTime(f[3]); err != nil {
+				return err
+			}
+		}
+		return st.SetServers(n, at)
+	case cmd == "rate" && len(f) == 2:
+		rate, err := strconv.ParseFloat(f[1], 64)
+		if err != nil || rate < 0 {
+			return fmt.Errorf("invalid arrival rate %q", f[1])
+		}
+		return st.SetArrivalRate(rate)
+	case cmd == "help":
+		fmt.Print(stepHelp)
+	case cmd == "quit" || cmd == "q":
+		return io.EOF
+	default:
+		return fmt.Errorf("unknown command %q, see help", strings.Join(f, " "))
+	}
+	return nil
+}
+
+func printStepEvent(s *Simulation, e CustomerEvent) {
+	c := e.Customer
+	where := ""
+	switch e.Kind {
+	case CustomerStarted, CustomerServed, CustomerInterrupted:
+		where = fmt.Sprintf(" at server %d", c.Server)
+	}
+	fmt.Printf("%s  customer %d %s%s, %d waiting, %d in the system\n", s.clock(e.Time), c.Index, e.Kind, where, e.Waiting, e.InSystem)
+}
+
+func printStepState(st State) {
+	ids := func(cs []CustomerState) string {
+		var b strings.Builder
+		for i, c := range cs {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "%d (%.0f min)", c.Index, c.InSystem)
+		}
+		return b.String()
+	}
+	if len(st.Servers) == 0 {
+		fmt.Println("no state before the first step")
+		return
+	}
+	fmt.Printf("Line               : %d waiting %s\n", len(st.Waiting), ids(st.Waiting))
+	for j, sv := range st.Servers {
+		status := "idle"
+		switch {
+		case sv.Broken:
+			status = "broken"
+		case len(sv.InService) > 0:
+			status = fmt.Sprintf("serving %s, %.0f minutes of work left", ids(sv.InService), sv.RemainingWork)
+		case sv.OffDuty:
+			status = "off duty"
+		}
+		fmt.Printf("%-19s: %s\n", fmt.Sprintf("Server %d", j), status)
+	}
+}
+
+func printStepResult(st *Stepper) {
+	r, _ := st.Result()
+	fmt.Println()
+	fmt.Printf("Total Customers    : %d\n", r.TotalCustomers)
+	fmt.Printf("Average WaitTime   : %.6f minutes\n", r.AverageWaitTime)
+	fmt.Printf("Last Customer Left : %s (%d minutes overtime)\n", formatTime(r.LastFinishTime), r.Overtime)
+	if sc := r.Scaling; sc != nil {
+		fmt.Printf("Server Hours       : %.2f, at most %d servers on duty\n", sc.ServerHours, sc.PeakServers)
+	}
+}
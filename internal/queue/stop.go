@@ -0,0 +1,177 @@
+package queue
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// Stop ends a run before endTime, at the first minute at which any of the
+// criteria set is met. The doors then close as they do at endTime: no one
+// else comes in, and the customers in line or in service are served to the
+// end, so that the result covers every customer who arrived, with the
+// result's TotalTime up to the stop.
+type Stop struct {
+	// Served stops once this many customers have been served.
+	Served int
+	// HalfWidth stops once the 95% confidence interval of the mean wait,
+	// from batch means, is at most this many minutes on either side.
+	// It is checked every simulated hour, once there are as many batches
+	// as WithBatchMeans asks for, 20 unless set.
+	HalfWidth float64
+	// WallClock stops once the run has taken this long, checked every
+	// simulated hour. The result then depends on the speed of the machine.
+	WallClock time.Duration
+}
+
+// WithStop lets the run end early according to stop.
+func WithStop(stop Stop) Option {
+	return func(s *Simulation) {
+		s.stop = &stop
+		if stop.HalfWidth > 0 && s.batchMeans == 0 {
+			s.batchMeans = 20
+		}
+	}
+}
+
+// The criteria that stopped a run, as SimulationResult.Stopped has them.
+const (
+	StoppedServed    = "served"
+	StoppedHalfWidth = "half-width"
+	StoppedWallClock = "wall-clock"
+)
+
+// stopped reports whether the run should stop at time t, and if so ends
+// it there: the rest of the run sees t as endTime.
+func (r *run) stopped(t int) bool {
+	st := r.s.stop
+	hourly := (t-r.s.startTime)%(60*r.s.tick) == 0 && t > r.s.startTime
+	switch {
+	case st.Served > 0 && r.completed >= st.Served:
+		r.stoppedBy = StoppedServed
+	case st.HalfWidth > 0 && hourly && r.narrow(st.HalfWidth):
+		r.stoppedBy = StoppedHalfWidth
+	case st.WallClock > 0 && hourly && time.Since(r.began) >= st.WallClock:
+		r.stoppedBy = StoppedWallClock
+	default:
+		return false
+	}
+	s := *r.s
+	s.endTime = t
+	r.s = &s
+	return true
+}
+
+// narrow reports whether the confidence interval of the mean wait is at
+// most half minutes on either side.
+func (r *run) narrow(half float64) bool {
+	means := r.batchMeans.means()
+	if len(means) < r.s.batchMeans {
+		return false
+	}
+	_, h, _ := BatchMeansInterval(means, 0.95)
+	return h <= half
+}
+
+func simulateSteady(seed int64, args []string) {
+	customerRate := 5.8 // 5.8 customers per hour
+	serverRate := 6.0   // 6 customers per hour, or 10 minutes per customer
+
+	fs := flag.NewFlagSet("steady", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	nServers := fs.Int("servers", 2, "number of servers")
+	maxHours := fs.Int("max-hours", 1000000, "simulated hours at most")
+	served := fs.Int("served", 0, "stop once this many customers have been served")
+	halfWidth := fs.Float64("half-width", 0.1, "stop once the 95% confidence interval of the mean wait is at most this many minutes on either side")
+	wallClock := fs.Duration("wall-clock", 0, "stop once the run has taken this long")
+	batches := fs.Int("batches", 20, "least number of batch means for the confidence interval")
+	service := fs.String("service", "", "service time `distribution` as NAME,PARAMS..., e.g. const,10 for an M/D/c queue")
+	checkpoint := fs.String("checkpoint", "", "save the state of the run to `file` every -every simulated hours")
+	every := fs.Int("every", 10000, "with -checkpoint, simulated hours between saves")
+	resume := fs.Bool("resume", false, "with -checkpoint, go on from the state saved in the file, if any")
+	streaming := fs.Bool("streaming", false, "keep the statistics of the waits in constant memory, estimating the percentiles")
+	pn := fs.Int("pn", 0, "print the distribution of the number in the system, P0 to P`N`, against M/M/c with exponential service")
+	parquet := fs.String("parquet", "", "write a record of every customer who left to `file` in Apache Parquet, a row group at a time")
+	fs.Parse(args)
+	checkServers("servers", *nServers)
+
+	stop := Stop{Served: *served, HalfWidth: *halfWidth, WallClock: *wallClock}
+	opts := []Option{WithBatchMeans(*batches), WithStop(stop)}
+	var dist ServiceDistribution
+	if *service != "" {
+		var err error
+		dist, err = parseDistributionFlag(*service)
+		exitOnError(err)
+		opts = append(opts, WithServiceDistribution(dist))
+	}
+	if *streaming {
+		opts = append(opts, WithStreamingStatistics())
+	}
+	if *checkpoint != "" {
+		opts = append(opts, WithCheckpoint(Checkpoint{Path: *checkpoint, Every: *every, Resume: *resume}))
+	}
+	var trace *ParquetTrace
+	var closeTrace func() error
+	if *parquet != "" {
+		var err error
+		trace, closeTrace, err = createParquetTrace(*parquet, 1)
+		exitOnError(err)
+		opts = append(opts, WithHooks(trace.Hooks()))
+	}
+	s := NewSimulation(0, *maxHours*60, *nServers, customerRate, serverRate, seed, opts...)
+	warnUnstable("steady", s)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	r, err := s.SimulateContext(ctx)
+	if trace != nil {
+		// what was recorded before an interruption is still worth reading
+		exitOnError(closeTrace())
+	}
+	if err != nil && ctx.Err() != nil && *checkpoint != "" {
+		fmt.Fprintf(os.Stderr, "steady: %v, run again with -resume to go on from %s\n", err, *checkpoint)
+		os.Exit(1)
+	}
+	exitOnError(err)
+
+	reason := map[string]string{
+		"":               fmt.Sprintf("after %d hours, the most allowed", *maxHours),
+		StoppedServed:    fmt.Sprintf("after %d customers served", *served),
+		StoppedHalfWidth: fmt.Sprintf("once the half width reached %g minutes", *halfWidth),
+		StoppedWallClock: fmt.Sprintf("after %s of real time", *wallClock),
+	}[r.Stopped]
+	mean, half, lag1 := BatchMeansInterval(r.BatchMeans, 0.95)
+	fmt.Printf("Stopped            : %s\n", reason)
+	fmt.Printf("Simulation Time    : %d hours\n", r.TotalTime/60)
+	fmt.Printf("Total Customers    : %d, all served to the end\n", r.TotalCustomers)
+	fmt.Printf("Average WaitTime   : %.6f minutes (standard deviation %.6f)\n", r.AverageWaitTime, r.WaitStdDev)
+	fmt.Printf("Wait Percentiles   : p50 %d, p90 %d, p95 %d, p99 %d minutes\n", r.WaitQuantile(0.5), r.WaitQuantile(0.9), r.WaitQuantile(0.95), r.WaitQuantile(0.99))
+	fmt.Printf("Batch Means        : %.6f ± %.6f minutes (%d batches, lag 1 autocorrelation %.2f)\n", mean, half, len(r.BatchMeans), lag1)
+	if trace != nil {
+		fmt.Printf("Parquet Trace      : %d customers in %s\n", trace.Len(), *parquet)
+	}
+	if *pn > 0 {
+		defer func() {
+			var theory []float64
+			if dist == nil {
+				theory = MMcPn(*nServers, customerRate, serverRate, *pn)
+			}
+			fmt.Println()
+			writePnTable(os.Stdout, r.Pn, theory, *pn)
+		}()
+	}
+	if dist == nil {
+		fmt.Printf("M/M/c WaitTime     : %.6f minutes in the long run\n", 60*MMcWait(*nServers, customerRate, serverRate))
+		return
+	}
+	if d, ok := dist.(interface{ SCV() float64 }); ok {
+		w, exact := MGcWait(*nServers, customerRate/60, dist.Mean(), d.SCV())
+		how := "Pollaczek-Khinchine"
+		if !exact {
+			how = "Allen-Cunneen approximation"
+		}
+		fmt.Printf("M/G/c WaitTime     : %.6f minutes in the long run (%s)\n", w, how)
+	}
+}
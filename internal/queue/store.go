@@ -0,0 +1,333 @@
+package queue
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Experiment is a stored run: the command that ran it, its scenario and
+// the command line arguments left out of the scenario, the engine version
+// and commit, as in a Manifest, and the result.
+type Experiment struct {
+	ID      int       `json:"id"`
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	Args    []string  `json:"args,omitempty"`
+	Version string    `json:"version,omitempty"`
+	Commit  string    `json:"commit,omitempty"`
+
+	Scenario Scenario         `json:"scenario"`
+	Result   SimulationResult `json:"result"`
+	// WaitPercentiles holds the 50th, 90th, 95th and 99th percentile
+	// waits, which the result alone does not carry.
+	WaitPercentiles map[string]int `json:"wait_percentiles"`
+}
+
+func newExperiment(command string, args []string, sc Scenario, result SimulationResult) Experiment {
+	e := Experiment{Command: command, Args: args, Version: Version, Commit: buildCommit(), Scenario: sc, Result: result, WaitPercentiles: map[string]int{}}
+	for _, p := range []int{50, 90, 95, 99} {
+		e.WaitPercentiles[fmt.Sprintf("p%d", p)] = result.WaitQuantile(float64(p) / 100)
+	}
+	return e
+}
+
+// experimentsSchema creates the table of a store of experiments, a row per
+// experiment with its arguments, scenario and result as JSON and their
+// main figures in columns of their own.
+const experimentsSchema = `CREATE TABLE IF NOT EXISTS experiments (
+	id INTEGER PRIMARY KEY,
+	time TEXT,
+	command TEXT,
+	args TEXT,
+	version TEXT,
+	build_commit TEXT,
+	seed INTEGER,
+	servers INTEGER,
+	customer_rate REAL,
+	server_rate REAL,
+	total_customers INTEGER,
+	average_wait_time REAL,
+	p50_wait_time INTEGER,
+	p90_wait_time INTEGER,
+	p95_wait_time INTEGER,
+	p99_wait_time INTEGER,
+	scenario TEXT,
+	result TEXT
+)`
+
+// experimentsColumns are the columns of experimentsSchema, in order.
+var experimentsColumns = []string{
+	"id", "time", "command", "args", "version", "build_commit", "seed", "servers", "customer_rate", "server_rate",
+	"total_customers", "average_wait_time", "p50_wait_time", "p90_wait_time", "p95_wait_time", "p99_wait_time", "scenario", "result",
+}
+
+// sqliteHeader starts every SQLite database file.
+const sqliteHeader = "SQLite format 3\x00"
+
+// storeBusyTimeout is how long a write waits for another process, or
+// connection, holding the lock of the database to let go of it.
+const storeBusyTimeout = 10 * time.Second
+
+// resultStore keeps experiments in a SQLite database, in the table
+// experiments, which the sqlite3 shell or any SQLite library can query as
+// well as the results command. Other tables and indexes in the database
+// are left alone, and SQLite's own locking makes adding safe from several
+// goroutines and processes at once.
+type resultStore struct {
+	path string
+	db   *sql.DB
+}
+
+// openStore opens the store of experiments at path, creating it if need
+// be. It refuses a database whose table experiments is not one of ours.
+func openStore(path string) (*resultStore, error) {
+	st, err := openDatabase(path)
+	if err != nil {
+		return nil, err
+	}
+	ours, err := st.hasExperiments()
+	if err == nil && !ours {
+		_, err = st.db.Exec(experimentsSchema)
+	}
+	if err != nil {
+		st.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return st, nil
+}
+
+// readStore returns the experiments stored at path, none if there is no
+// store there yet, without changing the file.
+func readStore(path string) ([]Experiment, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+	st, err := openDatabase(path)
+	if err != nil {
+		return nil, err
+	}
+	defer st.Close()
+	if ours, err := st.hasExperiments(); !ours || err != nil {
+		if err != nil {
+			err = fmt.Errorf("%s: %v", path, err)
+		}
+		return nil, err
+	}
+	return st.All()
+}
+
+// openDatabase opens the SQLite database at path, which calls wait up to
+// storeBusyTimeout to lock.
+func openDatabase(path string) (*resultStore, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(%d)", strings.NewReplacer("?", "%3f", "#", "%23", "%", "%25").Replace(path), storeBusyTimeout.Milliseconds())
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &resultStore{path: path, db: db}, nil
+}
+
+// hasExperiments reports whether the database has a table experiments,
+// and fails if it has one that is not a table of experiments.
+func (st *resultStore) hasExperiments() (bool, error) {
+	rows, err := st.db.Query("SELECT name FROM pragma_table_info('experiments') ORDER BY cid")
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		columns = append(columns, name)
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	if columns != nil && !slices.Equal(columns, experimentsColumns) {
+		return false, fmt.Errorf("the table experiments has columns %s, not those of a store of experiments", strings.Join(columns, ", "))
+	}
+	return columns != nil, nil
+}
+
+func (st *resultStore) Close() error {
+	return st.db.Close()
+}
+
+// Add numbers the experiment, stamps it with the time and stores it.
+func (st *resultStore) Add(e Experiment) (Experiment, error) {
+	e.ID = 0
+	e.Time = time.Now().UTC().Truncate(time.Second)
+	values, err := e.values()
+	if err != nil {
+		return e, err
+	}
+	res, err := st.db.Exec("INSERT INTO experiments VALUES (?"+strings.Repeat(", ?", len(values)-1)+")", values...)
+	if err != nil {
+		return e, fmt.Errorf("%s: %v", st.path, err)
+	}
+	id, err := res.LastInsertId()
+	e.ID = int(id)
+	return e, err
+}
+
+// All returns the stored experiments in the order they were added.
+func (st *resultStore) All() ([]Experiment, error) {
+	rows, err := st.db.Query("SELECT " + strings.Join(experimentsColumns, ", ") + " FROM experiments ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", st.path, err)
+	}
+	defer rows.Close()
+	var all []Experiment
+	for rows.Next() {
+		v := make([]any, len(experimentsColumns))
+		p := make([]any, len(v))
+		for i := range v {
+			p[i] = &v[i]
+		}
+		if err := rows.Scan(p...); err != nil {
+			return nil, fmt.Errorf("%s: %v", st.path, err)
+		}
+		e, err := experimentOf(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: experiment %v: %v", st.path, v[0], err)
+		}
+		all = append(all, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", st.path, err)
+	}
+	return all, nil
+}
+
+// values returns the values of the columns of the experiment in the table
+// of experiments, with a NULL id for SQLite to number it.
+func (e Experiment) values() ([]any, error) {
+	var args any
+	if e.Args != nil {
+		b, err := json.Marshal(e.Args)
+		if err != nil {
+			return nil, err
+		}
+		args = string(b)
+	}
+	scenario, err := json.Marshal(e.Scenario)
+	if err != nil {
+		return nil, err
+	}
+	result, err := json.Marshal(e.Result)
+	if err != nil {
+		return nil, err
+	}
+	var id any
+	if e.ID > 0 {
+		id = int64(e.ID)
+	}
+	sc, r, p := e.Scenario, e.Result, e.WaitPercentiles
+	return []any{
+		id, e.Time.Format(time.RFC3339), e.Command, args, nullable(e.Version), nullable(e.Commit),
+		sc.Seed, int64(sc.Servers), sc.CustomerRate, sc.ServerRate, int64(r.TotalCustomers), r.AverageWaitTime,
+		int64(p["p50"]), int64(p["p90"]), int64(p["p95"]), int64(p["p99"]), string(scenario), string(result),
+	}, nil
+}
+
+// experimentOf returns the experiment of the values of a row of the table
+// of experiments.
+func experimentOf(v []any) (Experiment, error) {
+	id, _ := v[0].(int64)
+	e := Experiment{ID: int(id), Command: columnText(v[2]), Version: columnText(v[4]), Commit: columnText(v[5]), WaitPercentiles: map[string]int{}}
+	var err error
+	if e.Time, err = time.Parse(time.RFC3339, columnText(v[1])); err != nil {
+		return e, err
+	}
+	if args := columnText(v[3]); args != "" {
+		if err := json.Unmarshal([]byte(args), &e.Args); err != nil {
+			return e, fmt.Errorf("args: %v", err)
+		}
+	}
+	if err := json.Unmarshal([]byte(columnText(v[16])), &e.Scenario); err != nil {
+		return e, fmt.Errorf("scenario: %v", err)
+	}
+	if err := json.Unmarshal([]byte(columnText(v[17])), &e.Result); err != nil {
+		return e, fmt.Errorf("result: %v", err)
+	}
+	for i, p := range []int{50, 90, 95, 99} {
+		w, ok := v[12+i].(int64)
+		if !ok {
+			return e, fmt.Errorf("p%d_wait_time is not an integer", p)
+		}
+		e.WaitPercentiles[fmt.Sprintf("p%d", p)] = int(w)
+	}
+	return e, nil
+}
+
+// nullable returns s, or nil for NULL if it is empty.
+func nullable(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// columnText returns a value of a column as text, empty for NULL.
+func columnText(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return ""
+}
+
+func showResults(args []string) {
+	if len(args) == 0 || (args[0] != "list" && args[0] != "show") {
+		exitOnError(fmt.Errorf("usage: queue results list|show [flags]"))
+	}
+	fs := flag.NewFlagSet("results "+args[0], flag.ExitOnError)
+	path := fs.String("store", "experiments.db", "SQLite `database` of stored experiments")
+	command := fs.String("command", "", "with list, only the experiments of this command")
+	fs.Parse(args[1:])
+
+	all, err := readStore(*path)
+	exitOnError(err)
+
+	if args[0] == "show" {
+		id, err := strconv.Atoi(fs.Arg(0))
+		if fs.NArg() != 1 || err != nil {
+			exitOnError(fmt.Errorf("usage: queue results show [flags] ID"))
+		}
+		for _, e := range all {
+			if e.ID == id {
+				b, _ := json.MarshalIndent(e, "", "  ")
+				fmt.Println(string(b))
+				return
+			}
+		}
+		exitOnError(fmt.Errorf("no experiment %d in %s", id, *path))
+	}
+
+	fmt.Println("id,time,command,seed,servers,customer_rate,server_rate,total_customers,average_wait_time,p90_wait_time,utilization")
+	for _, e := range all {
+		if *command != "" && e.Command != *command {
+			continue
+		}
+		sc, r := e.Scenario, e.Result
+		util := float64(0)
+		if len(r.Servers) > 0 {
+			util = meanUtilization(r)
+		}
+		fmt.Printf("%d,%s,%s,%d,%d,%.4f,%.4f,%d,%.4f,%d,%.4f\n", e.ID, e.Time.Format(time.RFC3339), e.Command, sc.Seed, sc.Servers, sc.CustomerRate, sc.ServerRate, r.TotalCustomers, r.AverageWaitTime, e.WaitPercentiles["p90"], util)
+	}
+}
@@ -0,0 +1,158 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func testExperiment(servers int) Experiment {
+	sim := NewSimulation(480, 960, servers, 20, 6, 7)
+	sc := Scenario{Start: "08:00", End: "16:00", Servers: servers, CustomerRate: 20, ServerRate: 6, Seed: 7}
+	return newExperiment("once", []string{"-servers", fmt.Sprint(servers)}, sc, sim.Simulate(false))
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "experiments.db")
+	if all, err := readStore(path); err != nil || all != nil {
+		t.Fatalf("a store not there yet has %v, %v", all, err)
+	}
+	st, err := openStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	var want []Experiment
+	for servers := 1; servers <= 3; servers++ {
+		e, err := st.Add(testExperiment(servers))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.ID != servers {
+			t.Errorf("experiment %d numbered %d", servers, e.ID)
+		}
+		want = append(want, e)
+	}
+	got, err := readStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// as JSON, leaving out what the result keeps for itself
+	g, _ := json.Marshal(got)
+	w, _ := json.Marshal(want)
+	if string(g) != string(w) {
+		t.Errorf("read back\n%s\nwant\n%s", g, w)
+	}
+}
+
+func TestStoreConcurrent(t *testing.T) {
+	// stores opened apart share nothing but the file, as processes do
+	path := filepath.Join(t.TempDir(), "experiments.db")
+	e := testExperiment(2)
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			st, err := openStore(path)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer st.Close()
+			for range 10 {
+				if _, err := st.Add(e); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	all, err := readStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range all {
+		if e.ID != i+1 {
+			t.Fatalf("experiment %d numbered %d", i+1, e.ID)
+		}
+	}
+	if len(all) != 40 {
+		t.Errorf("%d experiments, want 40", len(all))
+	}
+}
+
+// sqlite3 runs the sqlite3 shell on the database at path, skipping the test
+// without one.
+func sqlite3(t *testing.T, path, sql string) string {
+	t.Helper()
+	bin, err := exec.LookPath("sqlite3")
+	if err != nil {
+		t.Skip("no sqlite3 shell")
+	}
+	out, err := exec.Command(bin, path, sql).CombinedOutput()
+	if err != nil {
+		t.Fatalf("sqlite3 %q: %v: %s", sql, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestStoreSQLite3(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "experiments.db")
+	sqlite3(t, path, "CREATE TABLE notes (text TEXT); INSERT INTO notes VALUES ('kept')")
+	st, err := openStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := st.Add(testExperiment(2))
+	st.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := fmt.Sprintf("ok\n1|once|2|%d|%.6f|%d", e.Result.TotalCustomers, e.Result.AverageWaitTime, e.WaitPercentiles["p90"])
+	got := sqlite3(t, path, "PRAGMA integrity_check; SELECT id, command, servers, total_customers, printf('%.6f', average_wait_time), p90_wait_time FROM experiments")
+	if got != want {
+		t.Errorf("sqlite3 reads\n%s\nwant\n%s", got, want)
+	}
+	if got := sqlite3(t, path, "SELECT json_extract(scenario, '$.servers'), json_extract(args, '$[1]') FROM experiments"); got != "2|2" {
+		t.Errorf("sqlite3 reads the JSON as %q", got)
+	}
+
+	// a row added by sqlite3 and an index of its own
+	sqlite3(t, path, "CREATE INDEX by_seed ON experiments (seed); INSERT INTO experiments SELECT NULL, time, command, args, version, build_commit, seed, 5, customer_rate, server_rate, total_customers, average_wait_time, p50_wait_time, p90_wait_time, p95_wait_time, p99_wait_time, scenario, result FROM experiments")
+	st, err = openStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, err = st.Add(testExperiment(3)); err != nil || e.ID != 3 {
+		t.Errorf("the next experiment is %d, %v, want 3", e.ID, err)
+	}
+	st.Close()
+	all, err := readStore(path)
+	if err != nil || len(all) != 3 || all[1].Result.TotalServers != 2 {
+		t.Fatalf("got %d experiments, %v", len(all), err)
+	}
+	if got := sqlite3(t, path, "SELECT text FROM notes; SELECT name FROM sqlite_master WHERE type = 'index'"); got != "kept\nby_seed" {
+		t.Errorf("the other table and index read %q", got)
+	}
+}
+
+func TestStoreRefusesOtherSchemas(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "other.db")
+	sqlite3(t, path, "CREATE TABLE experiments (name TEXT, outcome TEXT); INSERT INTO experiments VALUES ('a', 'b')")
+	if st, err := openStore(path); err == nil {
+		st.Close()
+		t.Fatal("opened a table experiments of another schema")
+	}
+	if _, err := readStore(path); err == nil {
+		t.Error("read a table experiments of another schema")
+	}
+	if got := sqlite3(t, path, "SELECT * FROM experiments"); got != "a|b" {
+		t.Errorf("the table now reads %q", got)
+	}
+}
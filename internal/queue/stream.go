@@ -0,0 +1,103 @@
+package queue
+
+import "context"
+
+// CustomerEventKind tells what happened to a customer.
+type CustomerEventKind int
+
+const (
+	// CustomerServed is a customer leaving after service.
+	CustomerServed CustomerEventKind = iota
+	// CustomerAbandoned is a customer leaving the line without service.
+	CustomerAbandoned
+	// CustomerArrived is a customer coming in, before joining a line.
+	CustomerArrived
+	// CustomerStarted is a server starting, or resuming, the service of a
+	// customer.
+	CustomerStarted
+	// CustomerInterrupted is a breakdown, a preemption or the end of a
+	// time slice cutting the service of a customer short, putting the
+	// customer back in line.
+	CustomerInterrupted
+	// CustomerSentAway is a customer still in line at closing time sent
+	// away without service, see SendAwayAtClose.
+	CustomerSentAway
+)
+
+func (k CustomerEventKind) String() string {
+	switch k {
+	case CustomerAbandoned:
+		return "abandoned"
+	case CustomerArrived:
+		return "arrived"
+	case CustomerStarted:
+		return "started"
+	case CustomerInterrupted:
+		return "interrupted"
+	case CustomerSentAway:
+		return "sent-away"
+	}
+	return "served"
+}
+
+// CustomerEvent is something happening to a customer at Time. InSystem and
+// Waiting count the customers in the system and in line right after it.
+type CustomerEvent struct {
+	Kind     CustomerEventKind
+	Time     int
+	Customer Customer
+	InSystem int
+	Waiting  int
+}
+
+// event passes what happened to c at time t to emit and the hooks, if set.
+func (r *run) event(kind CustomerEventKind, t int, c *Customer) {
+	if r.emit == nil && r.s.hooks == nil && r.s.pause == nil {
+		return
+	}
+	e := r.customerEvent(kind, t, c)
+	if r.emit != nil {
+		r.emit(e)
+	}
+	if r.s.hooks != nil {
+		r.s.hooks.call(e)
+	}
+	if r.s.pause != nil {
+		r.stepped = append(r.stepped, e)
+	}
+}
+
+func (r *run) customerEvent(kind CustomerEventKind, t int, c *Customer) CustomerEvent {
+	waiting := len(r.queue)
+	for _, sv := range r.servers {
+		waiting += len(sv.queue)
+	}
+	return CustomerEvent{Kind: kind, Time: t, Customer: *c, InSystem: r.inSystem, Waiting: waiting}
+}
+
+// Stream runs the simulation in a goroutine and sends every customer event
+// on the first channel as it happens, in order of time. When the run is
+// done it closes the first channel and sends the result on the second,
+// which it then closes too. If ctx is done first, both close without a result.
+//
+// The run waits for every event to be received, so the caller must keep
+// reading the events, or cancel ctx, for the result to arrive.
+func (s *Simulation) Stream(ctx context.Context) (<-chan CustomerEvent, <-chan SimulationResult) {
+	events := make(chan CustomerEvent)
+	results := make(chan SimulationResult, 1)
+	go func() {
+		defer close(results)
+		emit := func(e CustomerEvent) {
+			select {
+			case events <- e:
+			case <-ctx.Done():
+			}
+		}
+		result, err := s.simulate(ctx, s.logger, emit)
+		close(events)
+		if err == nil {
+			results <- result
+		}
+	}()
+	return events, results
+}
@@ -0,0 +1,212 @@
+package queue
+
+import (
+	"math"
+	"slices"
+)
+
+// WithStreamingStatistics keeps the statistics of the waits in memory that
+// does not grow with the run: the mean and variance by Welford's method and
+// the 50th, 90th, 95th and 99th percentiles, and the 90th of every class,
+// by the P² algorithm, rather than a histogram of every wait, which takes
+// up to about 900 KB for every class. The percentiles are then estimates,
+// rounded to the minute, and other quantiles and ServedWithin are
+// interpolated between them. P² works best when the order of the
+// observations does not matter, but the waits of a queue come in long
+// stretches of short and of long ones, so the high percentiles of a busy
+// queue can be off by a fifth or more: prefer the histogram. Results kept
+// this way cannot be pooled with those of other runs.
+func WithStreamingStatistics() Option {
+	return func(s *Simulation) {
+		s.streaming = true
+	}
+}
+
+// streamingQuantiles are the quantiles of the waits kept with streaming
+// statistics.
+var streamingQuantiles = []float64{0.5, 0.9, 0.95, 0.99}
+
+// welford keeps the count, mean, sum of squared deviations and largest of
+// a stream of observations, updated one at a time with no loss of
+// precision from subtracting large sums.
+type welford struct {
+	n        int
+	mean, m2 float64
+	max      float64
+}
+
+func (w *welford) add(x float64) {
+	w.n++
+	d := x - w.mean
+	w.mean += d / float64(w.n)
+	w.m2 += d * (x - w.mean)
+	if w.n == 1 || x > w.max {
+		w.max = x
+	}
+}
+
+// variance returns the sample variance, 0 with fewer than two observations.
+func (w *welford) variance() float64 {
+	if w.n < 2 {
+		return 0
+	}
+	return w.m2 / float64(w.n-1)
+}
+
+// p2Quantile estimates the p-quantile of a stream of observations with the
+// P² algorithm of Jain and Chlamtac, keeping five markers: the smallest and
+// largest observations, the estimate and two on either side of it, whose
+// heights are adjusted by piecewise-parabolic interpolation as the
+// observations come.
+type p2Quantile struct {
+	p       float64
+	n       int        // observations
+	heights [5]float64 // of the markers
+	pos     [5]float64 // actual positions of the markers, from 1
+	desired [5]float64 // desired positions
+	inc     [5]float64 // of the desired positions per observation
+}
+
+func newP2Quantile(p float64) *p2Quantile {
+	return &p2Quantile{
+		p:       p,
+		pos:     [5]float64{1, 2, 3, 4, 5},
+		desired: [5]float64{1, 1 + 2*p, 1 + 4*p, 3 + 2*p, 5},
+		inc:     [5]float64{0, p / 2, p, (1 + p) / 2, 1},
+	}
+}
+
+func (q *p2Quantile) add(x float64) {
+	if q.n < 5 {
+		q.heights[q.n] = x
+		q.n++
+		if q.n == 5 {
+			slices.Sort(q.heights[:])
+		}
+		return
+	}
+	q.n++
+
+	// the cell the observation falls in, stretching the extremes
+	h := &q.heights
+	k := 0
+	switch {
+	case x < h[0]:
+		h[0] = x
+	case x >= h[4]:
+		h[4] = x
+		k = 3
+	default:
+		for k < 3 && x >= h[k+1] {
+			k++
+		}
+	}
+	for i := k + 1; i < 5; i++ {
+		q.pos[i]++
+	}
+	for i := range q.desired {
+		q.desired[i] += q.inc[i]
+	}
+
+	// move the middle markers that are off their desired positions
+	for i := 1; i <= 3; i++ {
+		d := q.desired[i] - q.pos[i]
+		if (d >= 1 && q.pos[i+1]-q.pos[i] > 1) || (d <= -1 && q.pos[i-1]-q.pos[i] < -1) {
+			s := math.Copysign(1, d)
+			y := q.parabolic(i, s)
+			if y <= h[i-1] || y >= h[i+1] {
+				j := i + int(s)
+				y = h[i] + s*(h[j]-h[i])/(q.pos[j]-q.pos[i])
+			}
+			h[i] = y
+			q.pos[i] += s
+		}
+	}
+}
+
+// parabolic returns the height of marker i moved by s, 1 or -1, on the
+// parabola through it and its neighbours.
+func (q *p2Quantile) parabolic(i int, s float64) float64 {
+	h, n := &q.heights, &q.pos
+	return h[i] + s/(n[i+1]-n[i-1])*((n[i]-n[i-1]+s)*(h[i+1]-h[i])/(n[i+1]-n[i])+(n[i+1]-n[i]-s)*(h[i]-h[i-1])/(n[i]-n[i-1]))
+}
+
+// value returns the estimate, exact with fewer than five observations.
+func (q *p2Quantile) value() float64 {
+	if q.n >= 5 {
+		return q.heights[2]
+	}
+	if q.n == 0 {
+		return 0
+	}
+	first := slices.Clone(q.heights[:q.n])
+	slices.Sort(first)
+	return first[int(math.Ceil(q.p*float64(q.n)))-1]
+}
+
+// streamingWaits keeps the statistics of the waits with streaming
+// statistics, in ticks.
+type streamingWaits struct {
+	welford
+	quantiles []*p2Quantile // at streamingQuantiles
+}
+
+func newStreamingWaits() *streamingWaits {
+	w := &streamingWaits{}
+	for _, p := range streamingQuantiles {
+		w.quantiles = append(w.quantiles, newP2Quantile(p))
+	}
+	return w
+}
+
+func (w *streamingWaits) add(v int) {
+	w.welford.add(float64(v))
+	for _, q := range w.quantiles {
+		q.add(float64(v))
+	}
+}
+
+// points returns the estimated quantile function as points (wait, fraction)
+// from no one to everyone, made non-decreasing.
+func (w *streamingWaits) points() (waits, fractions []float64) {
+	waits, fractions = []float64{0}, []float64{0}
+	for i, q := range w.quantiles {
+		waits = append(waits, min(max(q.value(), waits[len(waits)-1]), w.max))
+		fractions = append(fractions, streamingQuantiles[i])
+	}
+	return append(waits, w.max), append(fractions, 1)
+}
+
+// quantile returns the estimated p-quantile, interpolated between the
+// quantiles kept.
+func (w *streamingWaits) quantile(p float64) float64 {
+	if w.n == 0 {
+		return 0
+	}
+	waits, fractions := w.points()
+	for i := 1; i < len(waits); i++ {
+		if p <= fractions[i] {
+			return waits[i-1] + (waits[i]-waits[i-1])*(p-fractions[i-1])/(fractions[i]-fractions[i-1])
+		}
+	}
+	return w.max
+}
+
+// within returns the estimated fraction of the waits that are at most v,
+// interpolated between the quantiles kept.
+func (w *streamingWaits) within(v float64) float64 {
+	if w.n == 0 {
+		return 0
+	}
+	waits, fractions := w.points()
+	f := float64(0)
+	for i := 1; i < len(waits); i++ {
+		switch {
+		case v >= waits[i]:
+			f = fractions[i]
+		case v > waits[i-1]:
+			return fractions[i-1] + (fractions[i]-fractions[i-1])*(v-waits[i-1])/(waits[i]-waits[i-1])
+		}
+	}
+	return f
+}
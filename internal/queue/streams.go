@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand"
+	randv2 "math/rand/v2"
+)
+
+// Every random stream of a run has a name, and an index for the streams
+// that come one per server, and draws from a PCG generator of its own
+// seeded with the run's seed and the name. The streams are thus
+// independent of each other and of how many there are: adding a server
+// changes neither the arrivals, nor the service times of the other servers,
+// nor the patience of the customers.
+const (
+	arrivalStream   = "arrivals"
+	serviceStream   = "service" // per server
+	selectionStream = "selection"
+	groupStream     = "groups"
+	mixStream       = "mix"
+	failureStream   = "failures" // per server
+	repairStream    = "repairs"  // per server
+	patienceStream  = "patience"
+	routingStream   = "routing"
+	setupStream     = "setup" // per server
+	thinkStream     = "think"
+)
+
+// pcgSource is a PCG generator as a math/rand source.
+type pcgSource struct {
+	*randv2.PCG
+}
+
+func (p pcgSource) Int63() int64 {
+	return int64(p.Uint64() >> 1)
+}
+
+func (p pcgSource) Seed(seed int64) {
+	p.PCG.Seed(uint64(seed), 0)
+}
+
+// newStream returns the source of the named stream of a run with the given
+// seed.
+func newStream(seed int64, name string, index ...int) rand.Source {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	for _, i := range index {
+		binary.Write(h, binary.LittleEndian, int64(i))
+	}
+	id := h.Sum64()
+	return pcgSource{randv2.NewPCG(splitMix64(uint64(seed)^id), id)}
+}
+
+// splitMix64 scrambles x, so that close seeds start far apart.
+func splitMix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// stream returns the named random stream of the simulation.
+func (s *Simulation) stream(name string, index ...int) *rand.Rand {
+	sources := s.sources
+	if sources == nil {
+		sources = PCGSource
+	}
+	src := sources(s.seed, name, index...)
+	if s.antithetic {
+		src = antitheticSource{src}
+	}
+	if s.streamSources == nil {
+		s.streamSources = map[string]rand.Source{}
+	}
+	s.streamSources[streamKey(name, index)] = src
+	return rand.New(src)
+}
@@ -0,0 +1,224 @@
+package queue
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// sweepAxis is a scenario key and the values a sweep gives it.
+type sweepAxis struct {
+	key    string
+	values []string
+}
+
+// parseSweepAxis parses an axis given as KEY=VALUE,VALUE..., where a
+// numeric value may be a range FROM:TO:STEP, and the values of service and
+// patience are distributions, a new one starting at every name, as in
+// service=exp,10,lognormal,10,5.
+func parseSweepAxis(arg string) (sweepAxis, error) {
+	key, list, ok := strings.Cut(strings.TrimSpace(arg), "=")
+	if !ok || list == "" {
+		return sweepAxis{}, fmt.Errorf("%q: want KEY=VALUE,VALUE...", arg)
+	}
+	axis := sweepAxis{key: key}
+	for _, v := range strings.Split(list, ",") {
+		switch _, err := strconv.ParseFloat(v, 64); {
+		case key == "service" || key == "patience":
+			if err == nil && len(axis.values) > 0 {
+				axis.values[len(axis.values)-1] += "," + v
+			} else {
+				axis.values = append(axis.values, v)
+			}
+		case strings.Contains(v, ":"):
+			vs, err := expandRange(v)
+			if err != nil {
+				return sweepAxis{}, fmt.Errorf("%q: %v", arg, err)
+			}
+			axis.values = append(axis.values, vs...)
+		default:
+			axis.values = append(axis.values, v)
+		}
+	}
+	return axis, nil
+}
+
+// expandRange expands FROM:TO:STEP into the numbers from FROM up to TO in
+// steps of STEP.
+func expandRange(r string) ([]string, error) {
+	parts := strings.Split(r, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid range %q, want FROM:TO:STEP", r)
+	}
+	var p [3]float64
+	for i, s := range parts {
+		var err error
+		if p[i], err = strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("invalid range %q, want FROM:TO:STEP", r)
+		}
+	}
+	from, to, step := p[0], p[1], p[2]
+	if step <= 0 || to < from {
+		return nil, fmt.Errorf("invalid range %q, want FROM <= TO and STEP > 0", r)
+	}
+	var values []string
+	for i := range int(math.Floor((to-from)/step+epsilon)) + 1 {
+		x := math.Round((from+float64(i)*step)*1e9) / 1e9
+		values = append(values, strconv.FormatFloat(x, 'g', -1, 64))
+	}
+	return values, nil
+}
+
+// readSweepConfig reads the axes of a sweep from a file, one KEY=VALUE,...
+// per line. Blank lines and lines starting with # are skipped.
+func readSweepConfig(path string) ([]string, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var axes []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			axes = append(axes, line)
+		}
+	}
+	return axes, sc.Err()
+}
+
+// sweepScenarios returns the scenarios of every combination of the values
+// of the axes, on top of the default scenario, the last axis varying
+// fastest, with the values of each.
+func sweepScenarios(axes []sweepAxis) ([]Scenario, [][]string, error) {
+	var scenarios []Scenario
+	var combos [][]string
+	at := make([]int, len(axes))
+	for {
+		sc := DefaultScenario()
+		combo := make([]string, len(axes))
+		for i, a := range axes {
+			combo[i] = a.values[at[i]]
+			if err := sc.set(a.key, combo[i]); err != nil {
+				return nil, nil, fmt.Errorf("%s=%s: %v", a.key, combo[i], err)
+			}
+		}
+		// catch bad values now rather than in the middle of the replications
+		if _, err := sc.Simulation(); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", strings.Join(combo, ","), err)
+		}
+		scenarios, combos = append(scenarios, sc), append(combos, combo)
+
+		i := len(axes) - 1
+		for ; i >= 0; i-- {
+			if at[i]++; at[i] < len(axes[i].values) {
+				break
+			}
+			at[i] = 0
+		}
+		if i < 0 {
+			return scenarios, combos, nil
+		}
+	}
+}
+
+func simulateSweep(seed int64, args []string) {
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	reps := fs.Int("reps", 100, "number of replications of every combination")
+	level := fs.Float64("level", 0.95, "confidence level of the intervals")
+	config := fs.String("config", "", "read the axes from `file`, one KEY=VALUE,... per line, before those given as arguments")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: queue sweep [flags] KEY=VALUE,VALUE... ...\n\n"+
+			"Simulates every combination of the values of the keys on top of the business\n"+
+			"day of once, with keys "+scenarioKeys+".\n"+
+			"Numbers may be given as ranges FROM:TO:STEP, e.g. rate=4:8:1.\n\nflags:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	specs := fs.Args()
+	if *config != "" {
+		lines, err := readSweepConfig(*config)
+		exitOnError(err)
+		specs = append(lines, specs...)
+	}
+	if len(specs) == 0 {
+		specs = []string{"rate=4:10:2", "servers=1,2,3"}
+	}
+	if *reps < 2 || *level <= 0 || *level >= 1 {
+		fs.Usage()
+		exitOnError(fmt.Errorf("need -reps >= 2 and 0 < -level < 1"))
+	}
+	var axes []sweepAxis
+	for _, spec := range specs {
+		a, err := parseSweepAxis(spec)
+		exitOnError(err)
+		axes = append(axes, a)
+	}
+	scenarios, combos, err := sweepScenarios(axes)
+	exitOnError(err)
+
+	// Common random numbers: replication k of every combination uses the
+	// same seed.
+	rng := rand.New(rand.NewSource(seed))
+	seeds := make([]int64, *reps)
+	for i := range seeds {
+		seeds[i] = rng.Int63()
+	}
+	var sims []*Simulation
+	for i, sc := range scenarios {
+		for _, seed := range seeds {
+			sc.Seed = seed
+			sim, _ := sc.Simulation() // checked by sweepScenarios
+			sims = append(sims, sim)
+		}
+		var name []string
+		for j, a := range axes {
+			name = append(name, a.key+"="+combos[i][j])
+		}
+		warnUnstable(strings.Join(name, " "), sims[len(sims)-1])
+	}
+	results := simulateAll(sims)
+
+	fmt.Printf("Combinations       : %d\n", len(scenarios))
+	fmt.Printf("Replications       : %d per combination, common random numbers\n", *reps)
+	fmt.Printf("Confidence Level   : %.0f%%\n", *level*100)
+	fmt.Println()
+	var header []string
+	for _, a := range axes {
+		header = append(header, strings.ReplaceAll(a.key, "-", "_"))
+	}
+	fmt.Println(strings.Join(header, ",") + ",customers,average_wait_time,std_error,ci_low,ci_high,p90_wait_time,utilization,abandoned,overtime_minutes")
+	t := tQuantile(1-(1-*level)/2, *reps-1)
+	for i, combo := range combos {
+		rs := results[i**reps : (i+1)**reps]
+		var waits histogram
+		var wait []float64
+		var customers, util, abandoned, overtime float64
+		k := 1
+		n := float64(*reps)
+		for _, r := range rs {
+			waits.merge(r.waits)
+			k = max(r.tick, 1)
+			wait = append(wait, r.AverageWaitTime)
+			customers += float64(r.TotalCustomers) / n
+			util += meanUtilization(r) / n
+			abandoned += float64(r.Abandoned) / n
+			overtime += float64(r.Overtime) / n
+		}
+		m, v := meanVariance(wait)
+		se := math.Sqrt(v / n)
+		p90 := (waits.quantile(0.9) + k - 1) / k
+		for j, value := range combo {
+			if strings.Contains(value, ",") {
+				combo[j] = strconv.Quote(value)
+			}
+		}
+		fmt.Printf("%s,%.2f,%.4f,%.4f,%.4f,%.4f,%d,%.4f,%.2f,%.2f\n", strings.Join(combo, ","), customers, m, se, m-t*se, m+t*se, p90, util, abandoned, overtime)
+	}
+}
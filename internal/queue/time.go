@@ -0,0 +1,166 @@
+package queue
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Times of day count minutes since midnight of the first day. From the
+// second day on they are written with the day, as in "day 2 08:00".
+
+// formatTime formats t, in minutes, as HH:MM.
+func formatTime(t int) string {
+	day, m := t/(24*60), t%(24*60)
+	hhmm := fmt.Sprintf("%02d:%02d", m/60, m%60)
+	if day > 0 {
+		return fmt.Sprintf("day %d %s", day+1, hhmm)
+	}
+	return hhmm
+}
+
+// formatClock formats t, in minutes, as HH:MM:SS, rounded to the second.
+func formatClock(t float64) string {
+	s := int(math.Round(t * 60))
+	day, s := s/(24*3600), s%(24*3600)
+	hhmmss := fmt.Sprintf("%02d:%02d:%02d", s/3600, s/60%60, s%60)
+	if day > 0 {
+		return fmt.Sprintf("day %d %s", day+1, hhmmss)
+	}
+	return hhmmss
+}
+
+// parseClock parses a time of day as HH:MM or HH:MM:SS, optionally after
+// "day N", into minutes.
+func parseClock(s string) (float64, error) {
+	invalid := fmt.Errorf("invalid time %q, want HH:MM or HH:MM:SS", s)
+	day := 0
+	clock := strings.TrimSpace(s)
+	if rest, ok := strings.CutPrefix(clock, "day "); ok {
+		d, hhmm, _ := strings.Cut(strings.TrimSpace(rest), " ")
+		n, err := strconv.Atoi(d)
+		if err != nil || n < 1 {
+			return 0, invalid
+		}
+		day, clock = n-1, hhmm
+	}
+	parts := strings.Split(clock, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, invalid
+	}
+	var hms [3]int
+	for i, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil || v < 0 || i > 0 && v >= 60 {
+			return 0, invalid
+		}
+		hms[i] = v
+	}
+	return float64(day*24*60+hms[0]*60+hms[1]) + float64(hms[2])/60, nil
+}
+
+// parseTime parses a time of day as HH:MM, optionally after "day N", into
+// minutes.
+func parseTime(s string) (int, error) {
+	t, err := parseClock(s)
+	if err != nil || t != math.Trunc(t) {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", s)
+	}
+	return int(t), nil
+}
+
+// WithResolution runs the clock in ticks of d instead of whole minutes, so
+// that service times, patience, failures, repairs and lateness are rounded
+// to the tick rather than to the minute. A minute holds a whole number of
+// ticks, from 1 to 60, so d is rounded up to the next such length. Times
+// given in minutes, such as shifts, stay whole minutes.
+//
+// Customer times and the times of CustomerEvents count ticks, of which
+// there are TicksPerMinute in a minute. The SimulationResult is in minutes
+// whatever the resolution, with times of day and durations in whole
+// minutes rounded down, and averages, utilizations and Little's law
+// exact.
+func WithResolution(d time.Duration) Option {
+	return func(s *Simulation) {
+		s.tick = ticksPerMinute(d)
+	}
+}
+
+// ticksPerMinute returns the ticks in a minute with ticks of length d, as
+// WithResolution sets them.
+func ticksPerMinute(d time.Duration) int {
+	return min(max(int(time.Minute/max(d, 1)), 1), 60)
+}
+
+// TicksPerMinute returns the number of clock ticks in a minute, 1 unless
+// set by WithResolution.
+func (s *Simulation) TicksPerMinute() int {
+	return s.tick
+}
+
+// ticks converts a duration drawn in minutes to whole ticks.
+func (s *Simulation) ticks(minutes float64) int {
+	return int(math.Round(minutes * float64(s.tick)))
+}
+
+// scaleTimes moves the times of the simulation, given in minutes of the
+// day, to the day set by WithDay and converts them to ticks.
+func (s *Simulation) scaleTimes() {
+	k, offset := s.tick, s.day*24*60
+	at := func(t int) int { return (t + offset) * k }
+	s.startTime = at(s.startTime)
+	s.endTime = at(s.endTime)
+	s.cutoff = at(s.cutoff)
+	profile := make([]RatePeriod, len(s.profile))
+	for i, p := range s.profile {
+		profile[i] = RatePeriod{Start: at(p.Start), End: at(p.End), Rate: p.Rate}
+	}
+	s.profile = profile
+	covariates := make([]Covariate, len(s.covariates))
+	for i, c := range s.covariates {
+		covariates[i] = Covariate{Start: at(c.Start), End: at(c.End), Arrival: c.Arrival, Service: c.Service}
+	}
+	s.covariates = covariates
+	scale := func(windows map[int][]Shift) map[int][]Shift {
+		if windows == nil {
+			return nil
+		}
+		scaled := make(map[int][]Shift, len(windows))
+		for j, ws := range windows {
+			for _, w := range ws {
+				scaled[j] = append(scaled[j], Shift{at(w.Start), at(w.End)})
+			}
+		}
+		return scaled
+	}
+	s.shifts, s.breaks = scale(s.shifts), scale(s.breaks)
+	appointments := make([]Appointment, len(s.appointments))
+	for i, a := range s.appointments {
+		appointments[i] = Appointment{Time: at(a.Time), Category: a.Category}
+	}
+	s.appointments = appointments
+	for i, t := range s.stateTimes {
+		s.stateTimes[i] = at(t)
+	}
+	if s.scaling != nil {
+		for i, step := range s.scaling.Schedule {
+			s.scaling.Schedule[i].At = at(step.At)
+		}
+	}
+}
+
+// clock formats t, in ticks, as HH:MM, or as HH:MM:SS when a minute holds
+// several ticks.
+func (s *Simulation) clock(t int) string {
+	if s.tick == 1 {
+		return formatTime(t)
+	}
+	return formatClock(float64(t) / float64(s.tick))
+}
+
+// minutes converts t, in ticks, to minutes.
+func (s *Simulation) minutes(t int) float64 {
+	return float64(t) / float64(s.tick)
+}
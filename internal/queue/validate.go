@@ -0,0 +1,244 @@
+package queue
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Validation is the outcome of a statistical test of the simulator: of a
+// sampler against its distribution, or of a simulated queue against its
+// closed form.
+type Validation struct {
+	Test string
+	// Statistic is that of the test, chi-square, Kolmogorov-Smirnov or t,
+	// and PValue the chance of one at least as extreme if the sampler or
+	// the simulator is right.
+	Statistic, PValue float64
+	// Expected and Observed are the means, in theory and as measured.
+	Expected, Observed float64
+}
+
+// Pass reports whether the test passes at significance level alpha.
+func (v Validation) Pass(alpha float64) bool {
+	return v.PValue >= alpha
+}
+
+// ChiSquareTest returns Pearson's chi-square statistic of the observed
+// counts against the expected ones, its degrees of freedom and its p-value.
+// Neighbouring bins are merged until every one expects at least 5.
+func ChiSquareTest(observed []int, expected []float64) (stat float64, df int, p float64) {
+	var obs, exp []float64
+	o, e := float64(0), float64(0)
+	for i := range observed {
+		o, e = o+float64(observed[i]), e+expected[i]
+		if e >= 5 {
+			obs, exp = append(obs, o), append(exp, e)
+			o, e = 0, 0
+		}
+	}
+	if len(exp) > 0 {
+		// the tail left over joins the last bin
+		obs[len(obs)-1] += o
+		exp[len(exp)-1] += e
+	}
+	for i := range obs {
+		stat += (obs[i] - exp[i]) * (obs[i] - exp[i]) / exp[i]
+	}
+	df = len(obs) - 1
+	if df < 1 {
+		return stat, df, math.NaN()
+	}
+	return stat, df, gammaQ(float64(df)/2, stat/2)
+}
+
+// ValidatePoisson draws n numbers from the Poisson sampler with mean
+// lambda, capped at maxn as the simulator uses it, and tests them against
+// the Poisson distribution by chi-square.
+func ValidatePoisson(lambda float64, maxn, n int, seed int64) Validation {
+	p := NewPoisson(lambda, maxn, seed)
+	counts := make([]int, maxn+1)
+	sum := 0
+	for range n {
+		k := p.Get()
+		counts[k]++
+		sum += k
+	}
+	// the last bin holds the whole tail
+	expected := make([]float64, maxn+1)
+	rest := float64(n)
+	for k := 0; k < maxn; k++ {
+		expected[k] = float64(n) * poissonPMF(lambda, k)
+		rest -= expected[k]
+	}
+	expected[maxn] = max(rest, 0)
+	stat, _, pv := ChiSquareTest(counts, expected)
+	return Validation{
+		Test:      fmt.Sprintf("poisson %.4g chi-square", lambda),
+		Statistic: stat, PValue: pv,
+		Expected: lambda, Observed: float64(sum) / float64(n),
+	}
+}
+
+// ValidateExponential draws n numbers from the exponential sampler with
+// rate lambda and tests them against the exponential distribution by
+// Kolmogorov-Smirnov.
+func ValidateExponential(lambda float64, n int, seed int64) Validation {
+	e := NewExponential(lambda, seed)
+	xs := make([]float64, n)
+	sum := float64(0)
+	for i := range xs {
+		xs[i] = e.Get()
+		sum += xs[i]
+	}
+	d := ksStatistic(xs, e.CDF)
+	return Validation{
+		Test:      fmt.Sprintf("exponential %.4g ks", lambda),
+		Statistic: d, PValue: ksPValue(d, n),
+		Expected: 1 / lambda, Observed: sum / float64(n),
+	}
+}
+
+// ValidateMMc simulates an M/M/c queue with c servers and arrival and
+// service rates lambda and mu per hour for the given hours, with the clock
+// in seconds so that service times are all but unrounded, and tests its
+// mean wait, by a t test on 20 to 39 batch means, against MMcWait.
+func ValidateMMc(c int, lambda, mu float64, hours int, seed int64) Validation {
+	s := NewSimulation(0, hours*60, c, lambda, mu, seed, WithResolution(time.Second), WithBatchMeans(20))
+	v := validateWait(s, 60*MMcWait(c, lambda, mu))
+	v.Test = fmt.Sprintf("m/m/%d rho %.2f t", c, lambda/(float64(c)*mu))
+	return v
+}
+
+// ValidateRoundedMM1 simulates an M/M/1 queue as ValidateMMc does, but with
+// the clock in whole minutes, and tests its mean wait against the
+// Pollaczek-Khinchine formula for the service times as rounded, see
+// ServiceRounding. It checks the error bound of the rounding.
+func ValidateRoundedMM1(lambda, mu float64, hours int, seed int64) Validation {
+	s := NewSimulation(0, hours*60, 1, lambda, mu, seed, WithBatchMeans(20))
+	mean, scv := ServiceRounding(mu/60, 1)
+	want, _ := MGcWait(1, lambda/60, mean, scv)
+	v := validateWait(s, want)
+	v.Test = fmt.Sprintf("m/m/1 rho %.2f rounded t", lambda/mu)
+	return v
+}
+
+// validateWait runs s and tests its mean wait, from batch means, against
+// want, in minutes.
+func validateWait(s *Simulation, want float64) Validation {
+	r := s.Simulate(false)
+	w, half, _ := BatchMeansInterval(r.BatchMeans, 0.95)
+	df := float64(len(r.BatchMeans) - 1)
+	t := (w - want) / (half / tQuantile(0.975, len(r.BatchMeans)-1))
+	return Validation{Statistic: t, PValue: betaInc(df/2, 0.5, df/(df+t*t)), Expected: want, Observed: w}
+}
+
+func poissonPMF(lambda float64, k int) float64 {
+	lg, _ := math.Lgamma(float64(k + 1))
+	return math.Exp(-lambda + float64(k)*math.Log(lambda) - lg)
+}
+
+// PoissonTruncation returns how far the Poisson sampler with mean lambda,
+// capped at maxn, is from the Poisson distribution: a bound on the chance of
+// more than maxn, which it draws as maxn; the part of its table lost to
+// rounding, also drawn as maxn; and the error of its mean.
+func PoissonTruncation(lambda float64, maxn int) (tail, shortfall, meanError float64) {
+	// beyond maxn the probabilities fall at least geometrically, by
+	// lambda/(maxn+1) from one to the next
+	tail = 1
+	if q := lambda / float64(maxn+1); q < 1 {
+		tail = poissonPMF(lambda, maxn) * q / (1 - q)
+	}
+	p := newPoisson(lambda, maxn, nil)
+	cum := float64(0)
+	for _, pi := range p.p {
+		cum += pi
+	}
+	return tail, max(1-cum, 0), p.Mean() - lambda
+}
+
+// ServiceRounding returns the mean, in minutes, and the squared
+// coefficient of variation of an exponential service time with rate mu per
+// minute once rounded to ticks of 1/tick minute, as the simulator serves
+// it. Unrounded the mean is 1/mu and the coefficient 1.
+func ServiceRounding(mu float64, tick int) (mean, scv float64) {
+	m := mu / float64(tick) // per tick
+	// P(k ticks) = exp(-m(k-1/2)) - exp(-m(k+1/2)) for k >= 1
+	var m1, m2 float64
+	for k := 1; ; k++ {
+		pk := math.Exp(-m*(float64(k)-0.5)) * -math.Expm1(-m)
+		m1 += float64(k) * pk
+		m2 += float64(k*k) * pk
+		if float64(k*k)*pk < m2*1e-16 {
+			break
+		}
+	}
+	mean = m1 / float64(tick)
+	return mean, (m2 - m1*m1) / (m1 * m1)
+}
+
+func validate(seed int64, args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.Int64Var(&seed, "seed", seed, "random seed")
+	samples := fs.Int("samples", 100000, "numbers drawn from every sampler")
+	hours := fs.Int("hours", 20000, "simulated hours of every queue")
+	alpha := fs.Float64("alpha", 0.01, "significance level of every test")
+	rate := fs.Float64("rate", 5.8, "customers per hour for the error bounds")
+	serviceRate := fs.Float64("service-rate", 6.0, "customers per hour per server for the error bounds")
+	fs.Parse(args)
+
+	const maxn = 100 // as the simulator draws arrivals
+	tests := []func(seed int64) Validation{
+		func(seed int64) Validation { return ValidatePoisson(*rate/60, maxn, *samples, seed) },
+		func(seed int64) Validation { return ValidatePoisson(4, maxn, *samples, seed) },
+		func(seed int64) Validation { return ValidateExponential(*serviceRate/60, *samples, seed) },
+		func(seed int64) Validation { return ValidateMMc(1, 3, 6, *hours, seed) },
+		func(seed int64) Validation { return ValidateMMc(1, 4.8, 6, *hours, seed) },
+		func(seed int64) Validation { return ValidateMMc(2, 9.6, 6, *hours, seed) },
+		func(seed int64) Validation { return ValidateMMc(5, 27, 6, *hours, seed) },
+		func(seed int64) Validation { return ValidateRoundedMM1(4.8, 6, *hours, seed) },
+	}
+
+	fmt.Printf("Significance       : %g\n", *alpha)
+	fmt.Printf("Samples            : %d per sampler\n", *samples)
+	fmt.Printf("Simulation Time    : %d hours per queue\n", *hours)
+	fmt.Println()
+	fmt.Println("test,statistic,p_value,expected,observed,result")
+	failed := 0
+	rng := rand.New(rand.NewSource(seed))
+	for _, test := range tests {
+		v := test(rng.Int63())
+		result := "PASS"
+		if !v.Pass(*alpha) {
+			result = "FAIL"
+			failed++
+		}
+		fmt.Printf("%s,%.4f,%.4f,%.4f,%.4f,%s\n", v.Test, v.Statistic, v.PValue, v.Expected, v.Observed, result)
+	}
+
+	// Errors too small for tests of any reasonable size to see.
+	mu := *serviceRate / 60
+	tail, shortfall, meanError := PoissonTruncation(*rate/60, maxn)
+	mean, scv := ServiceRounding(mu, 1)
+	fmt.Println()
+	fmt.Printf("Poisson Tail       : P(more than %d arrivals in a minute) < %.3g, drawn as %d\n", maxn, tail, maxn)
+	fmt.Printf("Poisson Table      : %.3g of the probability lost to rounding, drawn as %d arrivals\n", shortfall, maxn)
+	fmt.Printf("Poisson Mean       : off by %.3g arrivals per minute\n", meanError)
+	fmt.Printf("Exponential Draws  : within %g minutes, by bisection\n", epsilon)
+	fmt.Printf("Service Rounding   : %.4f minutes on average for %.4f (%+.3f%%), SCV %.4f for 1\n", mean, 1/mu, 100*(mean*mu-1), scv)
+	lambda := *rate / 60
+	var errs [2]float64
+	for i, c := range []int{1, 2} {
+		rounded, _ := MGcWait(c, lambda, mean, scv)
+		errs[i] = 100 * (rounded/MMcWait(c, lambda, mu) - 1)
+	}
+	fmt.Printf("Wait Error         : %+.2f%% with 1 server (Pollaczek-Khinchine), %+.2f%% with 2 (Allen-Cunneen)\n", errs[0], errs[1])
+
+	if failed > 0 {
+		return fmt.Errorf("validate: %d of %d tests failed at significance %g", failed, len(tests), *alpha)
+	}
+	fmt.Printf("PASS: %d tests\n", len(tests))
+	return nil
+}
@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"math"
+	"testing"
+)
+
+func TestValidateSamplers(t *testing.T) {
+	for _, v := range []Validation{
+		ValidatePoisson(5.8/60, 100, 100000, 1),
+		ValidatePoisson(4, 100, 100000, 2),
+		ValidatePoisson(30, 100, 100000, 3),
+		ValidateExponential(6.0/60, 100000, 4),
+		ValidateExponential(3, 100000, 5),
+	} {
+		if !v.Pass(0.001) {
+			t.Errorf("%s: statistic %g, p-value %g, mean %g, want %g", v.Test, v.Statistic, v.PValue, v.Observed, v.Expected)
+		}
+	}
+}
+
+func TestValidateQueues(t *testing.T) {
+	for _, v := range []Validation{
+		ValidateMMc(1, 4.8, 6, 10000, 1),
+		ValidateMMc(3, 15, 6, 10000, 2),
+		ValidateRoundedMM1(4.8, 6, 10000, 3),
+	} {
+		if !v.Pass(0.001) {
+			t.Errorf("%s: statistic %g, p-value %g, wait %g, want %g", v.Test, v.Statistic, v.PValue, v.Observed, v.Expected)
+		}
+	}
+}
+
+func TestChiSquareTestRejects(t *testing.T) {
+	// the counts of a fair die against those of a loaded one
+	observed := []int{1000, 1000, 1000, 1000, 1000, 1000}
+	if _, df, p := ChiSquareTest(observed, []float64{1000, 1000, 1000, 1000, 1000, 1000}); p < 0.99 || df != 5 {
+		t.Errorf("p-value %g with %d degrees of freedom for a perfect fit", p, df)
+	}
+	if _, _, p := ChiSquareTest(observed, []float64{800, 1000, 1000, 1000, 1000, 1200}); p > 1e-6 {
+		t.Errorf("p-value %g for a loaded die", p)
+	}
+	// a Poisson sampler 2% off in its mean fails
+	p := NewPoisson(4*1.02, 100, 2)
+	counts := make([]int, 101)
+	for range 100000 {
+		counts[p.Get()]++
+	}
+	expected := make([]float64, 101)
+	for k := range expected {
+		expected[k] = 100000 * poissonPMF(4, k)
+	}
+	if _, _, p := ChiSquareTest(counts, expected); p >= 0.001 {
+		t.Errorf("p-value %g for a sampler 2%% off", p)
+	}
+}
+
+func TestErlangC(t *testing.T) {
+	for _, tc := range []struct {
+		c    int
+		a    float64
+		want float64
+	}{
+		{1, 0.8, 0.8},
+		{2, 1, 1.0 / 3},
+		{3, 2, 4.0 / 9},
+		{2, 2, 1},
+	} {
+		if got := ErlangC(tc.c, tc.a); math.Abs(got-tc.want) > 1e-12 {
+			t.Errorf("ErlangC(%d, %g) = %g, want %g", tc.c, tc.a, got, tc.want)
+		}
+	}
+	// M/M/1 waits rho/(mu-lambda)
+	if got, want := MMcWait(1, 4.8, 6), 0.8/1.2; math.Abs(got-want) > 1e-12 {
+		t.Errorf("MMcWait(1, 4.8, 6) = %g, want %g", got, want)
+	}
+	if got, want := MMcWait(2, 6, 6), (1.0/3)/6; math.Abs(got-want) > 1e-12 {
+		t.Errorf("MMcWait(2, 6, 6) = %g, want %g", got, want)
+	}
+}
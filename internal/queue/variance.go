@@ -0,0 +1,111 @@
+package queue
+
+import (
+	"math"
+	"math/rand"
+)
+
+// antitheticSource turns every number u of its source into 1-u, in the
+// sense that rand.Rand.Float64 returns 1-u where it would return u. Drawn
+// by inversion, a long service time becomes a short one and a busy minute a
+// quiet one.
+type antitheticSource struct {
+	rand.Source
+}
+
+func (a antitheticSource) Int63() int64 {
+	return math.MaxInt64 - a.Source.Int63()
+}
+
+// WithAntithetic runs the simulation on the antithetic random numbers of its
+// seed. The average of a run and its antithetic run, with the same seed,
+// varies less than that of two independent runs whenever the result is
+// monotone in the random numbers, as the wait time is.
+func WithAntithetic() Option {
+	return func(s *Simulation) {
+		s.antithetic = true
+	}
+}
+
+// VarianceReduction selects the techniques runGrid uses to estimate the
+// average wait time with fewer replications.
+type VarianceReduction struct {
+	// Antithetic runs the replications in pairs, the second of each pair on
+	// the antithetic random numbers of the first.
+	Antithetic bool
+	// Control corrects the average wait time by its regression on the number
+	// of customers and the average service time, whose expectations are
+	// known exactly.
+	Control bool
+	// Batches, if positive, estimates the precision of a cell that is a
+	// single run from that many batch means instead.
+	Batches int
+}
+
+// waitEstimate is the precision of an average wait time: its standard error
+// and the half width of its 95% confidence interval. Lag1 is the lag-1
+// autocorrelation of the batch means when the precision comes from batch
+// means, and NaN otherwise.
+type waitEstimate struct {
+	StdErr, Half float64
+	Lag1         float64
+}
+
+// ErlangC returns the probability that a customer has to wait in a
+// stationary M/M/c queue with c servers and an offered load of a Erlangs.
+func ErlangC(c int, a float64) float64 {
+	if a >= float64(c) {
+		return 1
+	}
+	// Erlang B by its recurrence, which does not overflow
+	b := float64(1)
+	for k := 1; k <= c; k++ {
+		b = a * b / (float64(k) + a*b)
+	}
+	return b / (1 - a/float64(c)*(1-b))
+}
+
+// MMcWait returns the average wait of a stationary M/M/c queue with c
+// servers, arrival rate lambda and service rate mu per server, in the unit
+// of time of the rates. It is infinite if the queue is unstable.
+func MMcWait(c int, lambda, mu float64) float64 {
+	if lambda >= float64(c)*mu {
+		return math.Inf(1)
+	}
+	return ErlangC(c, lambda/mu) / (float64(c)*mu - lambda)
+}
+
+// MGcWait returns the average wait of a stationary M/G/c queue with c
+// servers, arrival rate lambda and service times of the given mean and
+// squared coefficient of variation, in the unit of time of the mean. With
+// one server it is exact, the Pollaczek-Khinchine formula, which gives the
+// M/D/1 wait with scv 0; with more it is the Allen-Cunneen approximation,
+// the M/M/c wait scaled by (1+scv)/2, and reports false.
+func MGcWait(c int, lambda, mean, scv float64) (float64, bool) {
+	if c == 1 {
+		rho := lambda * mean
+		if rho >= 1 {
+			return math.Inf(1), true
+		}
+		return lambda * mean * mean * (1 + scv) / (2 * (1 - rho)), true
+	}
+	return MMcWait(c, lambda, 1/mean) * (1 + scv) / 2, false
+}
+
+// Mean returns the mean of the numbers drawn by Get, which caps them at
+// maxn.
+func (p *Poisson) Mean() float64 {
+	mean, cum := float64(0), float64(0)
+	for i, pi := range p.p {
+		mean += float64(i) * pi
+		cum += pi
+	}
+	return mean + float64(p.maxn)*max(1-cum, 0)
+}
+
+// roundedExponentialMean returns the mean of an exponential service time
+// with rate mu per minute rounded to whole minutes, as served.
+func roundedExponentialMean(mu float64) float64 {
+	// P(round(X) >= k) = exp(-mu(k-1/2)) summed over k >= 1
+	return math.Exp(mu/2) / math.Expm1(mu)
+}
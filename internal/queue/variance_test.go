@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestAntitheticSource(t *testing.T) {
+	u := rand.New(rand.NewSource(7))
+	v := rand.New(antitheticSource{rand.NewSource(7)})
+	e := &Exponential{lambda: 0.1}
+	for range 1000 {
+		if a, b := u.Float64(), v.Float64(); math.Abs(a+b-1) > 1e-15 {
+			t.Fatalf("%g and its antithetic %g", a, b)
+		}
+		// the exponential draws by inversion, so its draws are
+		// F^-1(u) and F^-1(1-u), to the precision of the bisection
+		if a, b := e.Sample(u), e.Sample(v); math.Abs(e.CDF(a)+e.CDF(b)-1) > epsilon {
+			t.Fatalf("%g and its antithetic %g", a, b)
+		}
+	}
+}
+
+// correlation returns the sample correlation of xs and ys.
+func correlation(xs, ys []float64) float64 {
+	mx, vx := meanVariance(xs)
+	my, vy := meanVariance(ys)
+	cov := 0.0
+	for i := range xs {
+		cov += (xs[i] - mx) * (ys[i] - my)
+	}
+	return cov / float64(len(xs)-1) / math.Sqrt(vx*vy)
+}
+
+func TestAntitheticRuns(t *testing.T) {
+	// the service times of a run and its antithetic run go opposite ways;
+	// the arrivals, one Poisson draw a minute, barely do
+	var plain, anti []float64
+	for seed := range int64(30) {
+		plain = append(plain, NewSimulation(480, 960, 2, 10, 6, seed).Simulate(false).AverageServiceTime)
+		anti = append(anti, NewSimulation(480, 960, 2, 10, 6, seed, WithAntithetic()).Simulate(false).AverageServiceTime)
+	}
+	if rho := correlation(plain, anti); rho > -0.3 {
+		t.Errorf("the service times of a run and its antithetic run have correlation %g, want clearly negative", rho)
+	}
+}
+
+func TestControlVariates(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	n := 50
+	ys, c1, c2, flat := make([]float64, n), make([]float64, n), make([]float64, n), make([]float64, n)
+	for i := range ys {
+		c1[i], c2[i], flat[i] = 5+rng.NormFloat64(), 1+rng.ExpFloat64(), 3
+		ys[i] = 3 + 2*(c1[i]-5) - (c2[i] - 2)
+	}
+	// ys is linear in the controls, so the estimate is exact; the control
+	// that does not vary is left out
+	est, se := controlVariates(ys, [][]float64{c1, flat, c2}, []float64{5, 3, 2})
+	if math.Abs(est-3) > 1e-9 || se > 1e-9 {
+		t.Errorf("estimate %g with standard error %g, want 3 exactly", est, se)
+	}
+
+	// with noise, the standard error is that of the residuals, far below
+	// that of the mean
+	for i := range ys {
+		ys[i] += 0.1 * rng.NormFloat64()
+	}
+	est, se = controlVariates(ys, [][]float64{c1, c2}, []float64{5, 2})
+	_, v := meanVariance(ys)
+	if math.Abs(est-3) > 4*se || se > math.Sqrt(v/float64(n))/5 {
+		t.Errorf("estimate %g with standard error %g, the mean has %g", est, se, math.Sqrt(v/float64(n)))
+	}
+
+	if _, se := controlVariates(ys[:3], [][]float64{c1[:3], c2[:3]}, []float64{5, 2}); !math.IsNaN(se) {
+		t.Errorf("standard error %g from 3 observations and 2 controls", se)
+	}
+}
@@ -0,0 +1,147 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// terminalView draws a run on a terminal as it plays: the clock, a bar per
+// server, the line, and averages over the last hour.
+type terminalView struct {
+	w          io.Writer
+	tick       int // per minute
+	start, end int // in ticks, as is the clock
+	clock      int
+
+	busy     []int // customers in service per server
+	inSystem int
+	waiting  int
+
+	arrived, served, abandoned int
+
+	// the last hour, a minute per slot, indexed by time modulo 60
+	minutes [60]viewMinute
+}
+
+// viewMinute is what happened in a minute, and the state at its end.
+type viewMinute struct {
+	arrivals, started, waited int
+	waiting                   int
+	busy                      []bool
+}
+
+// newTerminalView returns a view of a run from start to end, in minutes,
+// with the given clock ticks per minute.
+func newTerminalView(w io.Writer, start, end, nServers, tick int) *terminalView {
+	v := &terminalView{w: w, tick: tick, start: start * tick, end: end * tick, clock: start * tick, busy: make([]int, nServers)}
+	for i := range v.minutes {
+		v.minutes[i].busy = make([]bool, nServers)
+	}
+	return v
+}
+
+// show plays the clock up to event e as due by p, a frame per simulated
+// minute, and records e. It returns early if ctx is done.
+func (v *terminalView) show(ctx context.Context, e CustomerEvent, p *pacer) {
+	for v.clock+v.tick <= e.Time && ctx.Err() == nil {
+		v.nextMinute()
+		p.wait(ctx, v.clock/v.tick)
+		v.draw()
+	}
+	v.record(e)
+}
+
+func (v *terminalView) record(e CustomerEvent) {
+	m := &v.minutes[v.clock/v.tick%60]
+	c := e.Customer
+	switch e.Kind {
+	case CustomerArrived:
+		v.arrived++
+		m.arrivals++
+	case CustomerStarted:
+		v.busy[c.Server]++
+		if c.Interruptions == 0 {
+			m.started++
+			m.waited += c.WaitTime()
+		}
+	case CustomerInterrupted:
+		v.busy[c.Server]--
+	case CustomerServed:
+		v.busy[c.Server]--
+		v.served++
+	case CustomerAbandoned:
+		v.abandoned++
+	}
+	v.inSystem, v.waiting = e.InSystem, e.Waiting
+}
+
+// nextMinute closes the current minute and moves the clock to the next.
+func (v *terminalView) nextMinute() {
+	m := &v.minutes[v.clock/v.tick%60]
+	m.waiting = v.waiting
+	for j, n := range v.busy {
+		m.busy[j] = n > 0
+	}
+	v.clock += v.tick
+	next := &v.minutes[v.clock/v.tick%60]
+	busy := next.busy
+	clear(busy)
+	*next = viewMinute{busy: busy}
+}
+
+func (v *terminalView) draw() {
+	var b strings.Builder
+	// move home and clear the screen
+	b.WriteString("\x1b[H\x1b[2J")
+	state := fmt.Sprintf("open %s-%s", formatTime(v.start/v.tick), formatTime(v.end/v.tick))
+	if v.clock >= v.end {
+		state = "closed, serving those inside"
+	}
+	fmt.Fprintf(&b, "Clock              : %s (%s)\n", formatTime(v.clock/v.tick), state)
+
+	// the completed minutes of the last hour
+	now := v.clock / v.tick
+	n := min(60, now-v.start/v.tick)
+	var arrivals, started, waited, waiting int
+	busy := make([]int, len(v.busy))
+	for t := now - n; t < now; t++ {
+		m := v.minutes[t%60]
+		arrivals += m.arrivals
+		started += m.started
+		waited += m.waited
+		waiting += m.waiting
+		for j, ok := range m.busy {
+			if ok {
+				busy[j]++
+			}
+		}
+	}
+
+	const width = 20
+	for j, k := range v.busy {
+		state := "idle"
+		if k > 0 {
+			state = "busy"
+		}
+		u := ratio(busy[j], n)
+		bar := int(u*width + 0.5)
+		fmt.Fprintf(&b, "Server %-12d: %s [%s%s] %3.0f%% busy in the last hour\n", j, state, strings.Repeat("#", bar), strings.Repeat(" ", width-bar), u*100)
+	}
+	line := fmt.Sprint(v.waiting)
+	if v.waiting > 0 {
+		line += " " + strings.Repeat("o", min(v.waiting, 60))
+	}
+	if v.waiting > 60 {
+		line += "..."
+	}
+	fmt.Fprintf(&b, "Line               : %s\n", line)
+	fmt.Fprintf(&b, "In System          : %d\n", v.inSystem)
+	fmt.Fprintf(&b, "Customers          : %d arrived, %d served, %d abandoned\n", v.arrived, v.served, v.abandoned)
+	if n > 0 {
+		fmt.Fprintf(&b, "Last Hour          : %.1f arrivals/hour, %.2f minutes average wait, %.2f average line\n",
+			float64(arrivals)*60/float64(n), ratio(waited, started)/float64(v.tick), ratio(waiting, n))
+	}
+	io.WriteString(v.w, b.String())
+}
@@ -0,0 +1,223 @@
+package queue
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// A minimal server side of the WebSocket protocol (RFC 6455), enough to
+// exchange text messages with a browser without a dependency.
+
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+// wsMaxMessage is the most bytes a message may hold, over all its
+// fragments.
+const wsMaxMessage = 1 << 20
+
+// close codes
+const (
+	wsProtocolError = 1002
+	wsTooBig        = 1009
+)
+
+// wsConn is a WebSocket connection. Writes may come from several
+// goroutines; reads from one at a time.
+type wsConn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+	mu   sync.Mutex // guards writes
+}
+
+// upgradeWebSocket answers the opening handshake of r and takes over its
+// connection. A browser's handshake must come from a page of the same host
+// or of one of origins, such as "https://example.com", so that other sites
+// cannot use the server through their visitors.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, origins []string) (*wsConn, error) {
+	if origin := r.Header.Get("Origin"); origin != "" && !allowedOrigin(origin, r.Host, origins) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return nil, fmt.Errorf("origin %q not allowed", origin)
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "expected a WebSocket handshake", http.StatusBadRequest)
+		return nil, errors.New("not a WebSocket handshake")
+	}
+	if v := r.Header.Get("Sec-WebSocket-Version"); v != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("unsupported WebSocket version %q", v)
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "cannot upgrade the connection", http.StatusInternalServerError)
+		return nil, errors.New("connection cannot be hijacked")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(sum[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, rw: rw}, nil
+}
+
+// allowedOrigin reports whether a page from origin may open a WebSocket to
+// host.
+func allowedOrigin(origin, host string, origins []string) bool {
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, host) {
+		return true
+	}
+	for _, o := range origins {
+		if strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeFrame writes one unfragmented, unmasked frame, as servers do.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xffff:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	c.rw.Write(header)
+	c.rw.Write(payload)
+	return c.rw.Flush()
+}
+
+// WriteText sends a text message.
+func (c *wsConn) WriteText(msg []byte) error {
+	return c.writeFrame(wsText, msg)
+}
+
+// ReadMessage returns the next text or binary message, answering pings on
+// the way. It returns io.EOF once the client closes the connection. Frames
+// that break the protocol, such as unmasked ones, and messages longer than
+// wsMaxMessage close the connection with an error.
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	var msg []byte
+	fragmented := false
+	for {
+		var head [2]byte
+		if _, err := io.ReadFull(c.rw, head[:]); err != nil {
+			return nil, err
+		}
+		fin, opcode := head[0]&0x80 != 0, head[0]&0x0f
+		masked, n := head[1]&0x80 != 0, uint64(head[1]&0x7f)
+		switch n {
+		case 126:
+			var b [2]byte
+			if _, err := io.ReadFull(c.rw, b[:]); err != nil {
+				return nil, err
+			}
+			n = uint64(binary.BigEndian.Uint16(b[:]))
+		case 127:
+			var b [8]byte
+			if _, err := io.ReadFull(c.rw, b[:]); err != nil {
+				return nil, err
+			}
+			n = binary.BigEndian.Uint64(b[:])
+		}
+		control := opcode&0x8 != 0
+		switch {
+		case opcode > wsBinary && opcode < wsClose || opcode > wsPong:
+			return nil, c.fail(wsProtocolError, fmt.Sprintf("unknown opcode %#x", opcode))
+		case head[0]&0x70 != 0:
+			return nil, c.fail(wsProtocolError, "reserved bits set")
+		case !masked:
+			return nil, c.fail(wsProtocolError, "unmasked frame from the client")
+		case control && (!fin || n > 125):
+			return nil, c.fail(wsProtocolError, "fragmented or long control frame")
+		case !control && (opcode == wsContinuation) != fragmented:
+			return nil, c.fail(wsProtocolError, "fragments out of order")
+		case !control && n > wsMaxMessage-uint64(len(msg)):
+			return nil, c.fail(wsTooBig, "message too large")
+		}
+		var mask [4]byte
+		if _, err := io.ReadFull(c.rw, mask[:]); err != nil {
+			return nil, err
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(c.rw, payload); err != nil {
+			return nil, err
+		}
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+
+		switch opcode {
+		case wsClose:
+			c.writeFrame(wsClose, payload[:min(len(payload), 2)])
+			return nil, io.EOF
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		}
+		msg = append(msg, payload...)
+		if fin {
+			return msg, nil
+		}
+		fragmented = true
+	}
+}
+
+// fail closes the connection with the close code and returns the reason
+// as an error.
+func (c *wsConn) fail(code uint16, reason string) error {
+	c.writeFrame(wsClose, binary.BigEndian.AppendUint16(nil, code))
+	c.conn.Close()
+	return errors.New("WebSocket: " + reason)
+}
+
+// Close sends a normal close frame and closes the connection.
+func (c *wsConn) Close() error {
+	c.writeFrame(wsClose, []byte{0x03, 0xe8}) // 1000, normal closure
+	return c.conn.Close()
+}
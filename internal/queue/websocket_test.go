@@ -0,0 +1,249 @@
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echoServer serves WebSockets that send back every message.
+func echoServer(t *testing.T, origins ...string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgradeWebSocket(w, r, origins)
+		if err != nil {
+			return
+		}
+		defer ws.conn.Close()
+		for {
+			msg, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			ws.WriteText(msg)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// dial opens a WebSocket to srv from a page of origin, if not empty, and
+// returns the status of the handshake.
+func dial(t *testing.T, srv *httptest.Server, origin string) (net.Conn, *bufio.Reader, int) {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	req := "GET / HTTP/1.1\r\nHost: " + srv.Listener.Addr().String() + "\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n"
+	if origin != "" {
+		req += "Origin: " + origin + "\r\n"
+	}
+	if _, err := io.WriteString(conn, req+"\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode == http.StatusSwitchingProtocols && resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Sec-WebSocket-Accept %q", resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+	return conn, r, resp.StatusCode
+}
+
+// frame returns a frame as a client sends it, masked unless mask is nil.
+func frame(fin bool, opcode byte, payload []byte, mask []byte) []byte {
+	b := []byte{opcode}
+	if fin {
+		b[0] |= 0x80
+	}
+	maskBit := byte(0)
+	if mask != nil {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		b = append(b, maskBit|byte(n))
+	case n <= 0xffff:
+		b = binary.BigEndian.AppendUint16(append(b, maskBit|126), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint64(append(b, maskBit|127), uint64(n))
+	}
+	b = append(b, mask...)
+	for i, c := range payload {
+		if mask != nil {
+			c ^= mask[i%4]
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+var testMask = []byte{0x37, 0xfa, 0x21, 0x3d}
+
+// readFrame reads a frame of the server, which must be whole and unmasked.
+func readFrame(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		t.Fatalf("reading a frame: %v", err)
+	}
+	if head[0]&0x80 == 0 || head[1]&0x80 != 0 {
+		t.Fatalf("frame %08b %08b is fragmented or masked", head[0], head[1])
+	}
+	n := int(head[1] & 0x7f)
+	switch n {
+	case 126:
+		var b [2]byte
+		io.ReadFull(r, b[:])
+		n = int(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		io.ReadFull(r, b[:])
+		n = int(binary.BigEndian.Uint64(b[:]))
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatalf("reading a frame: %v", err)
+	}
+	return head[0] & 0x0f, payload
+}
+
+// wantClose reads a close frame with the given code.
+func wantClose(t *testing.T, r *bufio.Reader, code uint16) {
+	t.Helper()
+	opcode, payload := readFrame(t, r)
+	if opcode != wsClose || len(payload) < 2 || binary.BigEndian.Uint16(payload) != code {
+		t.Errorf("got opcode %#x with %v, want a close with code %d", opcode, payload, code)
+	}
+}
+
+func TestWebSocketMasking(t *testing.T) {
+	conn, r, status := dial(t, echoServer(t), "")
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("status %d", status)
+	}
+	for _, msg := range []string{"hello", "", strings.Repeat("long ", 100), strings.Repeat("longer ", 10000)} {
+		conn.Write(frame(true, wsText, []byte(msg), testMask))
+		if opcode, payload := readFrame(t, r); opcode != wsText || string(payload) != msg {
+			t.Errorf("sent %d bytes, got opcode %#x with %d bytes", len(msg), opcode, len(payload))
+		}
+	}
+	// servers close the connection on a frame the client did not mask
+	conn.Write(frame(true, wsText, []byte("hello"), nil))
+	wantClose(t, r, wsProtocolError)
+}
+
+func TestWebSocketFragments(t *testing.T) {
+	conn, r, _ := dial(t, echoServer(t), "")
+	conn.Write(frame(false, wsText, []byte("hel"), testMask))
+	conn.Write(frame(true, wsPing, []byte("in between"), testMask))
+	conn.Write(frame(false, wsContinuation, []byte("lo, "), testMask))
+	conn.Write(frame(true, wsContinuation, []byte("world"), testMask))
+	if opcode, payload := readFrame(t, r); opcode != wsPong || string(payload) != "in between" {
+		t.Errorf("got opcode %#x with %q, want the pong", opcode, payload)
+	}
+	if opcode, payload := readFrame(t, r); opcode != wsText || string(payload) != "hello, world" {
+		t.Errorf("got opcode %#x with %q, want the message", opcode, payload)
+	}
+
+	// a continuation with nothing to continue
+	conn.Write(frame(true, wsContinuation, []byte("lo"), testMask))
+	wantClose(t, r, wsProtocolError)
+
+	// a new message in the middle of one
+	conn, r, _ = dial(t, echoServer(t), "")
+	conn.Write(frame(false, wsText, []byte("hel"), testMask))
+	conn.Write(frame(true, wsText, []byte("lo"), testMask))
+	wantClose(t, r, wsProtocolError)
+}
+
+func TestWebSocketControlFrames(t *testing.T) {
+	srv := echoServer(t)
+	conn, r, _ := dial(t, srv, "")
+	conn.Write(frame(true, wsPing, []byte("are you there"), testMask))
+	if opcode, payload := readFrame(t, r); opcode != wsPong || string(payload) != "are you there" {
+		t.Errorf("got opcode %#x with %q, want the pong", opcode, payload)
+	}
+	// unsolicited pongs are ignored
+	conn.Write(frame(true, wsPong, nil, testMask))
+	conn.Write(frame(true, wsClose, []byte{0x03, 0xe8}, testMask))
+	wantClose(t, r, 1000)
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Errorf("after the close got %v, want EOF", err)
+	}
+
+	for name, f := range map[string][]byte{
+		"fragmented ping": frame(false, wsPing, []byte("a"), testMask),
+		"long ping":       frame(true, wsPing, bytes.Repeat([]byte("a"), 126), testMask),
+		"unknown opcode":  frame(true, 0x3, []byte("a"), testMask),
+		"reserved bit":    append([]byte{0x80 | 0x40 | wsText}, frame(true, wsText, []byte("a"), testMask)[1:]...),
+	} {
+		conn, r, _ := dial(t, srv, "")
+		conn.Write(f)
+		t.Run(name, func(t *testing.T) { wantClose(t, r, wsProtocolError) })
+	}
+}
+
+func TestWebSocketMessageCap(t *testing.T) {
+	srv := echoServer(t)
+	for name, frames := range map[string][][]byte{
+		"one frame": {frame(true, wsText, make([]byte, wsMaxMessage+1), testMask)},
+		"fragments": {
+			frame(false, wsText, make([]byte, wsMaxMessage/2), testMask),
+			frame(false, wsContinuation, make([]byte, wsMaxMessage/2), testMask),
+			frame(true, wsContinuation, []byte("a"), testMask),
+		},
+		"announced": {frame(true, wsText, nil, testMask)[:1], {0x80 | 127, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+	} {
+		conn, r, _ := dial(t, srv, "")
+		go func() {
+			for _, f := range frames {
+				if _, err := conn.Write(f); err != nil {
+					return
+				}
+			}
+		}()
+		t.Run(name, func(t *testing.T) { wantClose(t, r, wsTooBig) })
+	}
+	// exactly the cap is fine
+	conn, r, _ := dial(t, srv, "")
+	go conn.Write(frame(true, wsText, make([]byte, wsMaxMessage), testMask))
+	if _, payload := readFrame(t, r); len(payload) != wsMaxMessage {
+		t.Errorf("echoed %d bytes, want %d", len(payload), wsMaxMessage)
+	}
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	srv := echoServer(t, "https://example.com")
+	host := srv.Listener.Addr().String()
+	for _, tc := range []struct {
+		origin string
+		status int
+	}{
+		{"", http.StatusSwitchingProtocols},
+		{"http://" + host, http.StatusSwitchingProtocols},
+		{"https://example.com", http.StatusSwitchingProtocols},
+		{"https://evil.example", http.StatusForbidden},
+		{"http://" + host + ".evil.example", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+	} {
+		if _, _, status := dial(t, srv, tc.origin); status != tc.status {
+			t.Errorf("origin %q: status %d, want %d", tc.origin, status, tc.status)
+		}
+	}
+	if _, _, status := dial(t, echoServer(t), "https://example.com"); status != http.StatusForbidden {
+		t.Errorf("status %d without allowed origins", status)
+	}
+}
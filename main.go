@@ -0,0 +1,9 @@
+// Command queue_simulation simulates queues with several servers; see the
+// README for its commands.
+package main
+
+import "github.com/azaky/queue_simulation/internal/queue"
+
+func main() {
+	queue.Main()
+}
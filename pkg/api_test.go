@@ -0,0 +1,241 @@
+// Package pkg checks the v1 API of the packages under it against
+// api/v1.txt.
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite api/v1.txt with the API as it is")
+
+const module = "github.com/azaky/queue_simulation"
+
+// apiPackages are the packages of the v1 API.
+var apiPackages = []string{"dist", "policy", "sim"}
+
+// exportData returns the files of export data of the API packages and
+// their dependencies by import path, as the go command builds them.
+func exportData(t *testing.T) map[string]string {
+	t.Helper()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command to build the export data")
+	}
+	out, err := exec.Command("go", "list", "-export", "-deps", "-f", "{{.ImportPath}} {{.Export}}", "./...").Output()
+	if err != nil {
+		t.Fatalf("go list: %v", err)
+	}
+	files := map[string]string{}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		if path, file, ok := strings.Cut(sc.Text(), " "); ok && file != "" {
+			files[path] = file
+		}
+	}
+	return files
+}
+
+// api writes the declarations of the API packages a line each, as Go's own
+// api/go1.txt does, naming the types of internal packages by their aliases.
+type api struct {
+	names   map[*types.TypeName]string // public names of internal types
+	unnamed map[string]bool            // internal types the API has no name for
+}
+
+func (a *api) typeString(t types.Type) string {
+	switch t := types.Unalias(t).(type) {
+	case *types.Named:
+		if name, ok := a.names[t.Obj()]; ok {
+			return name
+		}
+		if t.Obj().Pkg() == nil {
+			return t.Obj().Name()
+		}
+		if strings.Contains(t.Obj().Pkg().Path(), "/internal/") {
+			a.unnamed[t.Obj().Pkg().Path()+"."+t.Obj().Name()] = true
+		}
+		return t.Obj().Pkg().Name() + "." + t.Obj().Name()
+	case *types.Basic:
+		return t.Name()
+	case *types.Pointer:
+		return "*" + a.typeString(t.Elem())
+	case *types.Slice:
+		return "[]" + a.typeString(t.Elem())
+	case *types.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), a.typeString(t.Elem()))
+	case *types.Map:
+		return "map[" + a.typeString(t.Key()) + "]" + a.typeString(t.Elem())
+	case *types.Chan:
+		prefix := map[types.ChanDir]string{types.SendRecv: "chan ", types.SendOnly: "chan<- ", types.RecvOnly: "<-chan "}[t.Dir()]
+		return prefix + a.typeString(t.Elem())
+	case *types.Signature:
+		return "func" + a.signature(t)
+	case *types.Struct:
+		var fields []string
+		for i := range t.NumFields() {
+			fields = append(fields, t.Field(i).Name()+" "+a.typeString(t.Field(i).Type()))
+		}
+		return "struct{" + strings.Join(fields, "; ") + "}"
+	case *types.Interface:
+		var methods []string
+		for i := range t.NumMethods() {
+			methods = append(methods, t.Method(i).Name()+a.signature(t.Method(i).Type().(*types.Signature)))
+		}
+		return "interface{" + strings.Join(methods, "; ") + "}"
+	}
+	return t.String()
+}
+
+func (a *api) signature(sig *types.Signature) string {
+	var params, results []string
+	for i := range sig.Params().Len() {
+		p := a.typeString(sig.Params().At(i).Type())
+		if sig.Variadic() && i == sig.Params().Len()-1 {
+			p = "..." + strings.TrimPrefix(p, "[]")
+		}
+		params = append(params, p)
+	}
+	for i := range sig.Results().Len() {
+		results = append(results, a.typeString(sig.Results().At(i).Type()))
+	}
+	s := "(" + strings.Join(params, ", ") + ")"
+	switch len(results) {
+	case 0:
+	case 1:
+		s += " " + results[0]
+	default:
+		s += " (" + strings.Join(results, ", ") + ")"
+	}
+	return s
+}
+
+// lines returns the declarations of pkg.
+func (a *api) lines(pkg *types.Package) []string {
+	var lines []string
+	add := func(format string, args ...any) {
+		lines = append(lines, "pkg "+pkg.Name()+", "+fmt.Sprintf(format, args...))
+	}
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
+			continue
+		}
+		switch obj := obj.(type) {
+		case *types.Const:
+			add("const %s %s = %s", name, a.typeString(obj.Type()), obj.Val().ExactString())
+		case *types.Var:
+			add("var %s %s", name, a.typeString(obj.Type()))
+		case *types.Func:
+			add("func %s%s", name, a.signature(obj.Type().(*types.Signature)))
+		case *types.TypeName:
+			t := types.Unalias(obj.Type())
+			switch u := t.Underlying().(type) {
+			case *types.Struct:
+				add("type %s struct", name)
+				for i := range u.NumFields() {
+					if f := u.Field(i); f.Exported() {
+						if f.Embedded() {
+							add("type %s struct, embedded %s", name, a.typeString(f.Type()))
+						} else {
+							add("type %s struct, %s %s", name, f.Name(), a.typeString(f.Type()))
+						}
+					}
+				}
+			case *types.Interface:
+				add("type %s interface", name)
+				for i := range u.NumMethods() {
+					if m := u.Method(i); m.Exported() {
+						add("type %s interface, %s%s", name, m.Name(), a.signature(m.Type().(*types.Signature)))
+					}
+				}
+				continue
+			default:
+				add("type %s %s", name, a.typeString(u))
+			}
+			values := types.NewMethodSet(t)
+			pointers := types.NewMethodSet(types.NewPointer(t))
+			for i := range pointers.Len() {
+				m := pointers.At(i).Obj()
+				if !m.Exported() {
+					continue
+				}
+				recv := "*" + name
+				if values.Lookup(m.Pkg(), m.Name()) != nil {
+					recv = name
+				}
+				add("method (%s) %s%s", recv, m.Name(), a.signature(m.Type().(*types.Signature)))
+			}
+		}
+	}
+	return lines
+}
+
+func TestAPI(t *testing.T) {
+	files := exportData(t)
+	imp := importer.ForCompiler(token.NewFileSet(), "gc", func(path string) (io.ReadCloser, error) {
+		file, ok := files[path]
+		if !ok {
+			return nil, fmt.Errorf("no export data for %s", path)
+		}
+		return os.Open(file)
+	})
+	a := &api{names: map[*types.TypeName]string{}, unnamed: map[string]bool{}}
+	var pkgs []*types.Package
+	for _, name := range apiPackages {
+		pkg, err := imp.Import(module + "/pkg/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkgs = append(pkgs, pkg)
+		for _, n := range pkg.Scope().Names() {
+			if obj, ok := pkg.Scope().Lookup(n).(*types.TypeName); ok && obj.Exported() {
+				if named, ok := types.Unalias(obj.Type()).(*types.Named); ok {
+					a.names[named.Obj()] = pkg.Name() + "." + n
+				}
+			}
+		}
+	}
+	var got []string
+	for _, pkg := range pkgs {
+		got = append(got, a.lines(pkg)...)
+	}
+	slices.Sort(got)
+	for name := range a.unnamed {
+		t.Errorf("the API reaches %s, which none of its packages names", name)
+	}
+
+	golden := filepath.Join("..", "api", "v1.txt")
+	if *update {
+		if err := os.WriteFile(golden, []byte(strings.Join(got, "\n")+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	for _, line := range want {
+		if !slices.Contains(got, line) {
+			t.Errorf("removed or changed, which v1 does not allow: %s", line)
+		}
+	}
+	for _, line := range got {
+		if !slices.Contains(want, line) {
+			t.Errorf("not in %s, go test ./pkg -update adds it: %s", golden, line)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Package dist holds the distributions of service, patience and think
+// times, in minutes, for the options of package sim.
+//
+// It is part of the v1 API of the simulator: within major version 1 its
+// names, signatures, fields and methods stay as they are, and only new ones
+// are added. See package sim.
+package dist
+
+import (
+	"io"
+
+	"github.com/azaky/queue_simulation/internal/queue"
+)
+
+// ServiceDistribution is a distribution of times, in minutes, that draws
+// from a random stream owned by the caller, so that every server keeps its
+// own stream whatever is being served.
+type ServiceDistribution = queue.ServiceDistribution
+
+// Exponential is the exponential distribution, drawn by inversion.
+type Exponential = queue.Exponential
+
+// NewExponential returns the exponential distribution of rate lambda per
+// minute, whose Get draws from a stream of its own with the given seed.
+func NewExponential(lambda float64, seed int64) *Exponential {
+	return queue.NewExponential(lambda, seed)
+}
+
+// Deterministic is a constant time Value, give or take uniform noise of up
+// to Noise either way.
+type Deterministic = queue.Deterministic
+
+// Uniform is the continuous uniform distribution on [Min, Max].
+type Uniform = queue.Uniform
+
+// LogNormal is the log-normal distribution with a given mean and standard
+// deviation.
+type LogNormal = queue.LogNormal
+
+// NewLogNormal returns the log-normal distribution with the given mean and
+// standard deviation.
+func NewLogNormal(mean, sd float64) *LogNormal {
+	return queue.NewLogNormal(mean, sd)
+}
+
+// Empirical is the distribution of observed values, resampled or, with
+// interpolation, drawn from the piecewise linear quantile function through
+// them.
+type Empirical = queue.Empirical
+
+// NewEmpirical returns the distribution of the observed values.
+func NewEmpirical(values []float64, interpolate bool) (*Empirical, error) {
+	return queue.NewEmpirical(values, interpolate)
+}
+
+// ReadEmpirical reads observations, one per line, taking the first column
+// of CSV lines and skipping lines that are not a number.
+func ReadEmpirical(r io.Reader, interpolate bool) (*Empirical, error) {
+	return queue.ReadEmpirical(r, interpolate)
+}
+
+// LoadEmpirical reads observations from a file, see ReadEmpirical.
+func LoadEmpirical(path string, interpolate bool) (*Empirical, error) {
+	return queue.LoadEmpirical(path, interpolate)
+}
+
+// Hyperexponential is a mixture of exponential distributions: with
+// probability Probs[i] a time is drawn from the exponential distribution of
+// mean Means[i].
+type Hyperexponential = queue.Hyperexponential
+
+// NewHyperexponential returns the mixture of exponentials of the given
+// means with the given branch probabilities, which must add up to 1.
+func NewHyperexponential(probs, means []float64) (*Hyperexponential, error) {
+	return queue.NewHyperexponential(probs, means)
+}
+
+// PhaseType is the distribution of the time through a network of
+// exponential phases.
+type PhaseType = queue.PhaseType
+
+// NewPhaseType checks the phases, every one of which must eventually lead
+// out, and returns their distribution: a time starts in phase i with
+// probability initial[i], spends a time of mean means[i] there, then moves
+// to phase j with probability next[i][j] or is done.
+func NewPhaseType(initial, means []float64, next [][]float64) (*PhaseType, error) {
+	return queue.NewPhaseType(initial, means, next)
+}
+
+// ReadPhaseType reads the phases of a phase-type distribution from CSV, a
+// line per phase with its initial probability, mean in minutes, and the
+// probabilities of moving on to each phase. Lines that do not start with a
+// number, like a header, are skipped.
+func ReadPhaseType(r io.Reader) (*PhaseType, error) {
+	return queue.ReadPhaseType(r)
+}
+
+// LoadPhaseType reads the phases of a phase-type distribution from a file,
+// see ReadPhaseType.
+func LoadPhaseType(path string) (*PhaseType, error) {
+	return queue.LoadPhaseType(path)
+}
+
+// ParseDistribution returns the distribution of the given name and
+// parameters, as the -service flag of the once command takes them: exp
+// with a mean, const with a value and optionally the noise, uniform with a
+// min and a max, lognormal with a mean and a standard deviation, hyperexp
+// with the probability and mean of every branch, phase with a file of
+// phases, or empirical with a file of observations and optionally
+// "interpolate". Times are in minutes.
+func ParseDistribution(name string, params []string) (ServiceDistribution, error) {
+	return queue.ParseDistribution(name, params)
+}
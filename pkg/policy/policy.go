@@ -0,0 +1,104 @@
+// Package policy holds the policies of a simulation: who comes in, which
+// server takes whom, what happens at closing time and to a service cut
+// short. The options of package sim put them in place.
+//
+// It is part of the v1 API of the simulator: within major version 1 its
+// names, signatures, fields and methods stay as they are, and only new ones
+// are added. See package sim.
+package policy
+
+import "github.com/azaky/queue_simulation/internal/queue"
+
+// PolicyView is what an AdmissionPolicy or a RoutingPolicy sees of the
+// system when it decides. It is only valid during the call.
+type PolicyView = queue.PolicyView
+
+// AdmissionPolicy decides whether an arriving customer may come in. It is
+// asked after the cutoff and before the OnArrival hook; a customer turned
+// away is counted in the result's Denied.
+type AdmissionPolicy = queue.AdmissionPolicy
+
+// RoutingPolicy decides which server takes a customer, in place of the
+// ServerSelectionPolicy; see sim.WithRouting.
+type RoutingPolicy = queue.RoutingPolicy
+
+// MaxLine turns customers away once N are waiting.
+type MaxLine = queue.MaxLine
+
+// MaxInSystem turns customers away once N are in the system, in line or in
+// service.
+type MaxInSystem = queue.MaxInSystem
+
+// Reservation turns customers of the given classes of the catalog away
+// once Line customers are waiting.
+type Reservation = queue.Reservation
+
+// ThresholdActivation keeps the servers numbered Base and up in reserve
+// until at least Line customers are waiting.
+type ThresholdActivation = queue.ThresholdActivation
+
+// LongestIdle picks the server that has been idle the longest.
+type LongestIdle = queue.LongestIdle
+
+// PreferenceOrder picks the first server of Order among the candidates.
+type PreferenceOrder = queue.PreferenceOrder
+
+// Specialists picks the candidate with the fewest skills, see
+// sim.WithSkills.
+type Specialists = queue.Specialists
+
+// ParseAdmissionPolicy parses an admission policy given as NAME,PARAMS...:
+// max-line,N, max-in-system,N or reserve,LINE,CLASS... with the indices of
+// the classes in the catalog.
+func ParseAdmissionPolicy(spec string) (AdmissionPolicy, error) {
+	return queue.ParseAdmissionPolicy(spec)
+}
+
+// ParseRoutingPolicy parses a routing policy given as NAME,PARAMS...:
+// threshold,BASE,LINE, longest-idle or order,SERVER....
+func ParseRoutingPolicy(spec string) (RoutingPolicy, error) {
+	return queue.ParseRoutingPolicy(spec)
+}
+
+// ServerSelectionPolicy decides which server takes a customer when several
+// are equally early to become available.
+type ServerSelectionPolicy = queue.ServerSelectionPolicy
+
+// The server selection policies.
+const (
+	EarliestAvailable = queue.EarliestAvailable
+	LeastBusy         = queue.LeastBusy
+	RandomServer      = queue.RandomServer
+	RoundRobin        = queue.RoundRobin
+	FastestServer     = queue.FastestServer
+	ServerAffinity    = queue.ServerAffinity
+)
+
+// ParseServerSelectionPolicy returns the server selection policy with the
+// given name: earliest, least-busy, random, round-robin, fastest or
+// affinity.
+func ParseServerSelectionPolicy(name string) (ServerSelectionPolicy, error) {
+	return queue.ParseServerSelectionPolicy(name)
+}
+
+// ClosingPolicy says what happens to the customers inside when the doors
+// close.
+type ClosingPolicy = queue.ClosingPolicy
+
+// The closing policies: ServeEveryone drains the line, SendAwayAtClose
+// sends those still in line home.
+const (
+	ServeEveryone   = queue.ServeEveryone
+	SendAwayAtClose = queue.SendAwayAtClose
+)
+
+// InterruptPolicy says what happens to a customer whose service a
+// breakdown cuts short.
+type InterruptPolicy = queue.InterruptPolicy
+
+// The interrupt policies: ResumeService continues with the work that was
+// left, RestartService does the whole service again.
+const (
+	ResumeService  = queue.ResumeService
+	RestartService = queue.RestartService
+)
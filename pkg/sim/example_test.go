@@ -0,0 +1,28 @@
+package sim_test
+
+import (
+	"fmt"
+
+	"github.com/azaky/queue_simulation/pkg/dist"
+	"github.com/azaky/queue_simulation/pkg/policy"
+	"github.com/azaky/queue_simulation/pkg/sim"
+)
+
+// A bank open from 8:00 to 16:00 with two tellers, where customers give up
+// after about 20 minutes in line and no one joins a line of 2.
+func Example() {
+	patience, err := dist.ParseDistribution("exp", []string{"20"})
+	if err != nil {
+		panic(err)
+	}
+	s := sim.NewSimulation(8*60, 16*60, 2, 11, 6, 1,
+		sim.WithPatience(patience),
+		sim.WithAdmission(policy.MaxLine{N: 2}),
+		sim.WithServerSelection(policy.LeastBusy))
+	r := s.Simulate(false)
+	fmt.Printf("%d customers, %d gave up, %d turned away\n", r.TotalCustomers, r.Abandoned, r.Denied)
+	fmt.Printf("%.2f minutes on average, %d at most for 90%%\n", r.AverageWaitTime, r.WaitQuantile(0.9))
+	// Output:
+	// 77 customers, 10 gave up, 4 turned away
+	// 1.90 minutes on average, 6 at most for 90%
+}
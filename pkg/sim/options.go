@@ -0,0 +1,272 @@
+package sim
+
+import (
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/azaky/queue_simulation/internal/queue"
+	"github.com/azaky/queue_simulation/pkg/dist"
+	"github.com/azaky/queue_simulation/pkg/policy"
+)
+
+// RatePeriod sets the arrival rate, in customers per hour, between Start
+// (inclusive) and End (exclusive), in minutes.
+type RatePeriod = queue.RatePeriod
+
+// WithArrivalProfile varies the arrival rate over the day. Outside of the
+// given periods customers arrive at the common customerRate.
+func WithArrivalProfile(periods ...RatePeriod) Option {
+	return queue.WithArrivalProfile(periods...)
+}
+
+// WithServerRates overrides the service rate, in customers per hour, of
+// each server in turn. Servers without an entry keep the common serverRate.
+func WithServerRates(rates ...float64) Option {
+	return queue.WithServerRates(rates...)
+}
+
+// WithServiceDistribution serves every customer with a service time drawn
+// from d instead of the servers' exponential service times. A catalog takes
+// precedence.
+func WithServiceDistribution(d dist.ServiceDistribution) Option {
+	return queue.WithServiceDistribution(d)
+}
+
+// CustomerClass is a kind of customer with its own service time
+// distribution, arriving with a relative Frequency and served ahead of the
+// classes of lower Priority.
+type CustomerClass = queue.CustomerClass
+
+// WithCatalog gives every arriving customer a class drawn according to the
+// class frequencies and serves it with the class's service distribution.
+func WithCatalog(classes []CustomerClass) Option {
+	return queue.WithCatalog(classes)
+}
+
+// ReadCatalog reads customer classes from CSV with a header line and the
+// columns category, frequency, optionally priority, distribution and the
+// distribution's parameters, see dist.ParseDistribution.
+func ReadCatalog(r io.Reader) ([]CustomerClass, error) {
+	return queue.ReadCatalog(r)
+}
+
+// LoadCatalog reads customer classes from a CSV file, see ReadCatalog.
+func LoadCatalog(path string) ([]CustomerClass, error) {
+	return queue.LoadCatalog(path)
+}
+
+// WithPatience makes customers give up and leave if they have not been
+// served within a patience time drawn from d, in minutes.
+func WithPatience(d dist.ServiceDistribution) Option {
+	return queue.WithPatience(d)
+}
+
+// WithPopulation makes the system closed: a population of n customers,
+// each thinking for a time drawn from think, in minutes, then arriving for
+// service and thinking again once served or out of patience.
+func WithPopulation(n int, think dist.ServiceDistribution) Option {
+	return queue.WithPopulation(n, think)
+}
+
+// WithGroupArrivals makes customers arrive in groups averaging meanSize
+// customers. The arrival rate then counts groups.
+func WithGroupArrivals(meanSize float64) Option {
+	return queue.WithGroupArrivals(meanSize)
+}
+
+// WithBatchService lets a server serve up to maxSize customers at once in a
+// single service time, waiting while idle until at least minSize are in
+// line, except after closing time.
+func WithBatchService(minSize, maxSize int) Option {
+	return queue.WithBatchService(minSize, maxSize)
+}
+
+// WithSeparateQueues gives every server its own line, which arriving
+// customers join by length. With jockeying, a server whose line empties
+// takes the last customer from the longest other line.
+func WithSeparateQueues(jockeying bool) Option {
+	return queue.WithSeparateQueues(jockeying)
+}
+
+// WithServerSelection sets the policy used to pick among free servers.
+func WithServerSelection(p policy.ServerSelectionPolicy) Option {
+	return queue.WithServerSelection(p)
+}
+
+// WithServerAffinity makes customers prefer the given server whenever it is
+// among the earliest available ones.
+func WithServerAffinity(server int) Option {
+	return queue.WithServerAffinity(server)
+}
+
+// WithAdmission lets the admission policy p decide who comes in.
+func WithAdmission(p policy.AdmissionPolicy) Option {
+	return queue.WithAdmission(p)
+}
+
+// WithRouting lets the routing policy p decide which server takes whom.
+func WithRouting(p policy.RoutingPolicy) Option {
+	return queue.WithRouting(p)
+}
+
+// WithSkills restricts the classes of the catalog server j serves to those
+// listed, by index, in skills[j]; a server without a list serves every
+// class.
+func WithSkills(skills ...[]int) Option {
+	return queue.WithSkills(skills...)
+}
+
+// WithPreemption lets an arriving customer who finds every server busy
+// take the server of a customer of lower priority, who goes back to the
+// line and later resumes.
+func WithPreemption() Option {
+	return queue.WithPreemption()
+}
+
+// WithProcessorSharing makes every server serve all its customers at once,
+// each at an equal share of its rate.
+func WithProcessorSharing() Option {
+	return queue.WithProcessorSharing()
+}
+
+// WithRoundRobin serves customers in time slices of the given quantum, in
+// minutes, sending those not done to the back of the line.
+func WithRoundRobin(quantum float64) Option {
+	return queue.WithRoundRobin(quantum)
+}
+
+// WithCutoff stops letting customers in at time t, in minutes, before the
+// doors close.
+func WithCutoff(t int) Option {
+	return queue.WithCutoff(t)
+}
+
+// WithClosingPolicy sets what happens at closing time, ServeEveryone
+// unless set.
+func WithClosingPolicy(p policy.ClosingPolicy) Option {
+	return queue.WithClosingPolicy(p)
+}
+
+// Breakdowns describes random server failures, with exponential times to
+// failure and repair of the given means, in minutes.
+type Breakdowns = queue.Breakdowns
+
+// WithBreakdowns makes every server fail from time to time, putting the
+// customer in service back at the front of the line.
+func WithBreakdowns(b Breakdowns) Option {
+	return queue.WithBreakdowns(b)
+}
+
+// Shift is a window of time, in minutes, from Start (inclusive) to End
+// (exclusive).
+type Shift = queue.Shift
+
+// WithShifts sets the windows in which server j is on duty. Servers without
+// shifts work from startTime to endTime.
+func WithShifts(j int, shifts ...Shift) Option {
+	return queue.WithShifts(j, shifts...)
+}
+
+// WithBreaks takes server j off duty during the given windows.
+func WithBreaks(j int, breaks ...Shift) Option {
+	return queue.WithBreaks(j, breaks...)
+}
+
+// WithOffDutyRedirect moves the customers in the line of a server that goes
+// off duty or breaks down to the shortest line of an available server.
+func WithOffDutyRedirect() Option {
+	return queue.WithOffDutyRedirect()
+}
+
+// Setup holds the distributions of the time, in minutes, a server takes to
+// warm up after being idle and to change over to a customer of another
+// class.
+type Setup = queue.Setup
+
+// WithSetup makes servers take setup time before serving.
+func WithSetup(setup Setup) Option {
+	return queue.WithSetup(setup)
+}
+
+// Autoscaling adds servers during the run as the line grows and sends them
+// away again once they are idle.
+type Autoscaling = queue.Autoscaling
+
+// ScaleStep keeps at least Servers on duty from time At, in minutes, until
+// the next step.
+type ScaleStep = queue.ScaleStep
+
+// WithAutoscaling scales the servers on duty by the rules of a.
+func WithAutoscaling(a Autoscaling) Option {
+	return queue.WithAutoscaling(a)
+}
+
+// WithHooks has the run call the hooks h.
+func WithHooks(h Hooks) Option {
+	return queue.WithHooks(h)
+}
+
+// WithLogger logs the simulation to l, at the levels LevelQuiet to
+// LevelDebug.
+func WithLogger(l *slog.Logger) Option {
+	return queue.WithLogger(l)
+}
+
+// Progress reports how far a simulation has come.
+type Progress = queue.Progress
+
+// WithProgress calls fn with the progress of the simulation at most once
+// per interval of wall clock time, and once more when it is done.
+func WithProgress(interval time.Duration, fn func(Progress)) Option {
+	return queue.WithProgress(interval, fn)
+}
+
+// WithResolution runs the clock in ticks of d instead of whole minutes, d
+// rounded up so that a minute holds from 1 to 60 of them. Customer times
+// and those of CustomerEvents then count ticks; the result stays in
+// minutes.
+func WithResolution(d time.Duration) Option {
+	return queue.WithResolution(d)
+}
+
+// Stop ends a run before endTime, at the first minute at which any of the
+// criteria set is met.
+type Stop = queue.Stop
+
+// WithStop lets the run end early according to stop.
+func WithStop(stop Stop) Option {
+	return queue.WithStop(stop)
+}
+
+// WithBatchMeans reports the mean waits of between k and 2k-1 batches of
+// the customers served in BatchMeans, see BatchMeansInterval.
+func WithBatchMeans(k int) Option {
+	return queue.WithBatchMeans(k)
+}
+
+// WithAntithetic runs the simulation on the antithetic random numbers of
+// its seed.
+func WithAntithetic() Option {
+	return queue.WithAntithetic()
+}
+
+// WithStreamingStatistics keeps the statistics of the waits in memory that
+// does not grow with the run, making quantiles estimates.
+func WithStreamingStatistics() Option {
+	return queue.WithStreamingStatistics()
+}
+
+// WithStates records the state of the system at the given times, in
+// minutes since midnight, in the result's States.
+func WithStates(times ...int) Option {
+	return queue.WithStates(times...)
+}
+
+// SLA asks for service-level metrics, returned as SLAStats.
+type SLA = queue.SLA
+
+// WithSLA reports the service-level metrics of sla in the result's SLA.
+func WithSLA(sla SLA) Option {
+	return queue.WithSLA(sla)
+}
@@ -0,0 +1,57 @@
+package sim
+
+import "github.com/azaky/queue_simulation/internal/queue"
+
+// SimulationResult is the outcome of a run, in minutes whatever the
+// resolution of the clock.
+type SimulationResult = queue.SimulationResult
+
+// ServerStats summarizes the work of one server.
+type ServerStats = queue.ServerStats
+
+// OverloadStats describes how the system copes with a period in which
+// customers arrive faster than the servers can serve them.
+type OverloadStats = queue.OverloadStats
+
+// LittlesLaw holds the three quantities of Little's law, L = λW, each
+// measured on its own.
+type LittlesLaw = queue.LittlesLaw
+
+// ClassStats describes the customers of one class of the catalog.
+type ClassStats = queue.ClassStats
+
+// SLAStats holds the service-level metrics asked for with WithSLA.
+type SLAStats = queue.SLAStats
+
+// State is what the system looks like at a moment of a run, recorded with
+// WithStates or seen by a Stepper.
+type State = queue.State
+
+// ServerState is a server in a State.
+type ServerState = queue.ServerState
+
+// CustomerState is a customer in a State.
+type CustomerState = queue.CustomerState
+
+// ScalingStats reports what Autoscaling did during a run.
+type ScalingStats = queue.ScalingStats
+
+// ScalingEvent is a server called in, coming on duty or going back on
+// standby.
+type ScalingEvent = queue.ScalingEvent
+
+// The criteria of Stop that ended a run, as SimulationResult.Stopped has
+// them.
+const (
+	StoppedServed    = queue.StoppedServed
+	StoppedHalfWidth = queue.StoppedHalfWidth
+	StoppedWallClock = queue.StoppedWallClock
+)
+
+// BatchMeansInterval returns the grand mean of batch means, such as those
+// of WithBatchMeans, the half width of its confidence interval at the given
+// level, and the lag-1 autocorrelation of the batch means, which should be
+// close to 0 for the interval to hold.
+func BatchMeansInterval(means []float64, level float64) (mean, half, lag1 float64) {
+	return queue.BatchMeansInterval(means, level)
+}
@@ -0,0 +1,76 @@
+// Package sim simulates queues with several servers: a business day, or any
+// stretch of time, of customers arriving, waiting in line and being served.
+//
+//	s := sim.NewSimulation(8*60, 16*60, 2, 10, 6, 1, sim.WithPatience(patience))
+//	r := s.Simulate(false)
+//	fmt.Println(r.AverageWaitTime, r.WaitQuantile(0.9))
+//
+// Together with packages dist, for the distributions of times, and policy,
+// for who comes in and which server takes whom, it is the v1 API of the
+// simulator. Within major version 1, the names these packages declare keep
+// their signatures, and their types keep their fields and methods; new
+// names, fields and methods may be added, so do not rely on struct types
+// being comparable or on positional composite literals. A run with the
+// same seed and options gives the same result within a minor version, but
+// a minor version may change the random numbers of a run, as a better
+// sampler does; results that must stay the same pin the version. Anything
+// under internal may change at any time. api/v1.txt lists the whole API,
+// and go test ./pkg fails on a change to it.
+package sim
+
+import (
+	"github.com/azaky/queue_simulation/internal/queue"
+)
+
+// Simulation is a simulation ready to run, with Simulate, SimulateContext,
+// Stream or Stepper.
+type Simulation = queue.Simulation
+
+// Option customizes a Simulation created by NewSimulation.
+type Option = queue.Option
+
+// NewSimulation returns a simulation of nServers servers from startTime to
+// endTime, in minutes since midnight, with customers arriving at
+// customerRate and every server serving serverRate customers an hour on
+// average, drawing its random numbers from streams derived from seed.
+func NewSimulation(startTime, endTime, nServers int, customerRate, serverRate float64, seed int64, opts ...Option) *Simulation {
+	return queue.NewSimulation(startTime, endTime, nServers, customerRate, serverRate, seed, opts...)
+}
+
+// Stepper runs a simulation an event at a time, see Simulation.Stepper.
+type Stepper = queue.Stepper
+
+// Customer is a customer of a run. Its times are in clock ticks, minutes
+// unless set by WithResolution.
+type Customer = queue.Customer
+
+// CustomerEvent is something happening to a customer at Time. InSystem and
+// Waiting count the customers in the system and in line right after it.
+type CustomerEvent = queue.CustomerEvent
+
+// CustomerEventKind tells what happened to a customer.
+type CustomerEventKind = queue.CustomerEventKind
+
+// The kinds of customer events.
+const (
+	CustomerServed      = queue.CustomerServed
+	CustomerAbandoned   = queue.CustomerAbandoned
+	CustomerArrived     = queue.CustomerArrived
+	CustomerStarted     = queue.CustomerStarted
+	CustomerInterrupted = queue.CustomerInterrupted
+	CustomerSentAway    = queue.CustomerSentAway
+)
+
+// Hooks are functions a run calls as things happen to customers. Any may be
+// nil. They are called on the goroutine of the run, in order of time.
+type Hooks = queue.Hooks
+
+// Log levels of a simulation for WithLogger, from the least to the most
+// output: Quiet only logs warnings, Summary a line per run, Customer every
+// customer and Debug every event.
+const (
+	LevelQuiet    = queue.LevelQuiet
+	LevelSummary  = queue.LevelSummary
+	LevelCustomer = queue.LevelCustomer
+	LevelDebug    = queue.LevelDebug
+)